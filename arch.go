@@ -0,0 +1,250 @@
+package rpm
+
+import "strings"
+
+// For the original tables, see:
+// https://github.com/rpm-software-management/rpm/blob/master/rpmrc.in
+
+// archNumbers maps each architecture to the number stored in the lead of
+// packages built for it. Related architectures share a number.
+var archNumbers = map[string]int{
+	"athlon": 1, "geode": 1, "pentium4": 1, "pentium3": 1, "i686": 1, "i586": 1,
+	"i486": 1, "i386": 1, "x86_64": 1, "amd64": 1, "ia32e": 1, "em64t": 1,
+	"alpha": 2, "alphaev5": 2, "alphaev56": 2, "alphapca56": 2, "alphaev6": 2,
+	"alphaev67": 2, "sparc64": 2, "sparc64v": 2,
+	"sparc": 3, "sparcv8": 3, "sparcv9": 3, "sparcv9v": 3,
+	"mips": 4, "mipsel": 4,
+	"ppc":    5,
+	"m68k":   6,
+	"sgi":    7,
+	"rs6000": 8,
+	"ia64":   9,
+	"mips64": 11, "mips64el": 11,
+	"armv3l": 12, "armv4b": 12, "armv4l": 12, "armv4tl": 12, "armv5tl": 12,
+	"armv5tel": 12, "armv5tejl": 12, "armv6l": 12, "armv6hl": 12, "armv7l": 12,
+	"armv7hl": 12, "armv7hnl": 12, "armv8l": 12, "armv8hl": 12, "armv8hnl": 12,
+	"armv8hcnl": 12,
+	"m68kmint":  13,
+	"s390":      14,
+	"s390x":     15,
+	"ppc64":     16, "ppc64le": 16, "ppc64p7": 16, "ppc64pseries": 16, "ppc64iseries": 16,
+	"sh": 17, "sh3": 17, "sh4": 17, "sh4a": 17,
+	"xtensa":  18,
+	"aarch64": 19,
+	"mipsr6":  20, "mipsr6el": 20,
+	"mips64r6": 21, "mips64r6el": 21,
+	"riscv64":     22,
+	"loongarch64": 23,
+	"noarch":      255,
+}
+
+// archNames maps each lead architecture number to the name of the primary
+// architecture of its family.
+var archNames = map[int]string{
+	1:   "i386",
+	2:   "alpha",
+	3:   "sparc",
+	4:   "mips",
+	5:   "ppc",
+	6:   "m68k",
+	7:   "sgi",
+	8:   "rs6000",
+	9:   "ia64",
+	11:  "mips64",
+	12:  "arm",
+	13:  "m68kmint",
+	14:  "s390",
+	15:  "s390x",
+	16:  "ppc64",
+	17:  "sh",
+	18:  "xtensa",
+	19:  "aarch64",
+	20:  "mipsr6",
+	21:  "mips64r6",
+	22:  "riscv64",
+	23:  "loongarch64",
+	255: "noarch",
+}
+
+// osNames maps each lead operating system number to its name.
+var osNames = map[int]string{
+	1:  "Linux",
+	2:  "Irix",
+	3:  "solaris",
+	4:  "SunOS",
+	5:  "AIX",
+	6:  "hpux10",
+	7:  "osf1",
+	8:  "FreeBSD",
+	9:  "SCO_SV",
+	10: "Irix64",
+	11: "NextStep",
+	12: "bsdi",
+	13: "machten",
+	14: "cygwin32",
+	16: "MP_RAS",
+	17: "FreeMiNT",
+	21: "darwin",
+}
+
+// archCompat lists the architectures whose packages may be installed directly
+// on each architecture, in order of preference. Compatibility is transitive.
+var archCompat = map[string][]string{
+	"i386":         {"noarch"},
+	"i486":         {"i386"},
+	"i586":         {"i486"},
+	"i686":         {"i586"},
+	"geode":        {"i686"},
+	"athlon":       {"i686"},
+	"pentium3":     {"i686"},
+	"pentium4":     {"pentium3"},
+	"x86_64":       {"amd64", "em64t", "athlon", "noarch"},
+	"amd64":        {"x86_64", "em64t", "athlon", "noarch"},
+	"ia32e":        {"x86_64", "em64t", "athlon", "noarch"},
+	"em64t":        {"x86_64", "amd64", "athlon", "noarch"},
+	"ia64":         {"noarch"},
+	"alpha":        {"noarch"},
+	"alphaev5":     {"alpha"},
+	"alphaev56":    {"alphaev5"},
+	"alphapca56":   {"alphaev56"},
+	"alphaev6":     {"alphapca56"},
+	"alphaev67":    {"alphaev6"},
+	"sparc":        {"noarch"},
+	"sparcv8":      {"sparc"},
+	"sparcv9":      {"sparcv8"},
+	"sparcv9v":     {"sparcv9"},
+	"sparc64":      {"sparcv9"},
+	"sparc64v":     {"sparc64"},
+	"mips":         {"noarch"},
+	"mipsel":       {"noarch"},
+	"mips64":       {"mips"},
+	"mips64el":     {"mipsel"},
+	"mipsr6":       {"noarch"},
+	"mipsr6el":     {"noarch"},
+	"mips64r6":     {"mipsr6"},
+	"mips64r6el":   {"mipsr6el"},
+	"ppc":          {"noarch"},
+	"ppc64":        {"ppc"},
+	"ppc64p7":      {"ppc64"},
+	"ppc64pseries": {"ppc64"},
+	"ppc64iseries": {"ppc64"},
+	"ppc64le":      {"noarch"},
+	"s390":         {"noarch"},
+	"s390x":        {"s390", "noarch"},
+	"armv3l":       {"noarch"},
+	"armv4b":       {"noarch"},
+	"armv4l":       {"armv3l"},
+	"armv4tl":      {"armv4l"},
+	"armv5tl":      {"armv4tl"},
+	"armv5tel":     {"armv5tl"},
+	"armv5tejl":    {"armv5tel"},
+	"armv6l":       {"armv5tejl"},
+	"armv7l":       {"armv6l"},
+	"armv8l":       {"armv7l"},
+	"armv6hl":      {"noarch"},
+	"armv7hl":      {"armv6hl"},
+	"armv7hnl":     {"armv7hl"},
+	"armv8hl":      {"armv7hl"},
+	"armv8hnl":     {"armv8hl", "armv7hnl"},
+	"armv8hcnl":    {"armv8hnl"},
+	"aarch64":      {"noarch"},
+	"riscv64":      {"noarch"},
+	"loongarch64":  {"noarch"},
+	"m68k":         {"noarch"},
+	"m68kmint":     {"noarch"},
+	"sh3":          {"noarch"},
+	"sh4":          {"noarch"},
+	"sh4a":         {"sh4"},
+	"xtensa":       {"noarch"},
+}
+
+// ArchitectureName returns the name of the architecture family identified by
+// the lead of the package, such as 'i386' for both i386 and x86_64 packages.
+// The lead does not distinguish between related architectures; use
+// Package.Architecture for the exact architecture of a package.
+//
+// An empty string is returned if the architecture number is unknown.
+func (c *Lead) ArchitectureName() string {
+	return archNames[c.Architecture]
+}
+
+// OperatingSystemName returns the name of the operating system identified by
+// the lead of the package, such as 'Linux'. An empty string is returned if the
+// operating system number is unknown.
+func (c *Lead) OperatingSystemName() string {
+	return osNames[c.OperatingSystem]
+}
+
+// ArchitectureNumber returns the number that identifies the given architecture
+// in the lead of a package, or zero if the architecture is unknown.
+func ArchitectureNumber(arch string) int {
+	return archNumbers[arch]
+}
+
+// OperatingSystemNumber returns the number that identifies the given operating
+// system in the lead of a package, or zero if the operating system is unknown.
+// Names are matched without regard to case.
+func OperatingSystemNumber(os string) int {
+	for n, name := range osNames {
+		if strings.EqualFold(name, os) {
+			return n
+		}
+	}
+	return 0
+}
+
+// CompatibleArchitectures returns the architectures whose packages may be
+// installed on a host of the given architecture, in rpm's order of
+// preference. The host architecture is always first. Unknown architectures
+// are compatible only with themselves and noarch.
+func CompatibleArchitectures(host string) []string {
+	a := []string{host}
+	seen := map[string]bool{host: true}
+	if _, ok := archCompat[host]; !ok && host != "noarch" {
+		return append(a, "noarch")
+	}
+	for i := 0; i < len(a); i++ {
+		for _, arch := range archCompat[a[i]] {
+			if !seen[arch] {
+				seen[arch] = true
+				a = append(a, arch)
+			}
+		}
+	}
+	return a
+}
+
+// IsCompatible returns true if a package built for arch may be installed on a
+// host of architecture host. For example, i686 and noarch packages may be
+// installed on x86_64 hosts.
+func IsCompatible(host, arch string) bool {
+	return ArchScore(host, arch) >= 0
+}
+
+// ArchScore ranks arch for installation on a host of architecture host. Lower
+// scores are preferred and zero indicates that arch is the host architecture.
+// If arch is not compatible with host, -1 is returned.
+func ArchScore(host, arch string) int {
+	for i, a := range CompatibleArchitectures(host) {
+		if a == arch {
+			return i
+		}
+	}
+	return -1
+}
+
+// BestArchitecture returns the architecture from arches that rpm would prefer
+// to install on a host of architecture host. For example, given x86_64 and
+// i686 builds of a multilib package, x86_64 is preferred on x86_64 hosts and
+// i686 on i686 hosts. An empty string is returned if none of the
+// architectures are compatible with host.
+func BestArchitecture(host string, arches []string) string {
+	best, bestScore := "", -1
+	for _, arch := range arches {
+		score := ArchScore(host, arch)
+		if score >= 0 && (bestScore < 0 || score < bestScore) {
+			best, bestScore = arch, score
+		}
+	}
+	return best
+}
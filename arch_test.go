@@ -0,0 +1,89 @@
+package rpm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompatibleArchitectures(t *testing.T) {
+	tests := []struct {
+		host   string
+		expect string
+	}{
+		{"x86_64", "x86_64 amd64 em64t athlon noarch i686 i586 i486 i386"},
+		{"i686", "i686 i586 i486 i386 noarch"},
+		{"ppc64le", "ppc64le noarch"},
+		{"s390x", "s390x s390 noarch"},
+		{"aarch64", "aarch64 noarch"},
+		{"riscv64", "riscv64 noarch"},
+		{"armv7hl", "armv7hl armv6hl noarch"},
+		{"noarch", "noarch"},
+		{"unknown", "unknown noarch"},
+	}
+	for _, test := range tests {
+		if s := strings.Join(CompatibleArchitectures(test.host), " "); s != test.expect {
+			t.Errorf("Expected %q for %s, got: %q", test.expect, test.host, s)
+		}
+	}
+}
+
+func TestIsCompatible(t *testing.T) {
+	tests := []struct {
+		host, arch string
+		expect     bool
+	}{
+		{"x86_64", "x86_64", true},
+		{"x86_64", "i686", true},
+		{"x86_64", "noarch", true},
+		{"x86_64", "aarch64", false},
+		{"i686", "x86_64", false},
+		{"ppc64le", "ppc64", false},
+		{"ppc64", "ppc", true},
+		{"s390x", "s390", true},
+		{"aarch64", "armv7hl", false},
+		{"noarch", "x86_64", false},
+	}
+	for _, test := range tests {
+		if ok := IsCompatible(test.host, test.arch); ok != test.expect {
+			t.Errorf("Expected %v for %s on %s, got: %v", test.expect, test.arch, test.host, ok)
+		}
+	}
+}
+
+func TestBestArchitecture(t *testing.T) {
+	tests := []struct {
+		host   string
+		arches []string
+		expect string
+	}{
+		{"x86_64", []string{"i686", "x86_64"}, "x86_64"},
+		{"i686", []string{"i686", "x86_64"}, "i686"},
+		{"x86_64", []string{"i386", "i686"}, "i686"},
+		{"x86_64", []string{"noarch", "i686"}, "noarch"},
+		{"aarch64", []string{"i686", "x86_64"}, ""},
+	}
+	for _, test := range tests {
+		if s := BestArchitecture(test.host, test.arches); s != test.expect {
+			t.Errorf("Expected %q for %v on %s, got: %q", test.expect, test.arches, test.host, s)
+		}
+	}
+}
+
+func TestLeadNames(t *testing.T) {
+	p, err := Open("./testdata/centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := p.Lead.ArchitectureName(); s != "i386" {
+		t.Errorf("Expected lead architecture i386, got: %s", s)
+	}
+	if s := p.Lead.OperatingSystemName(); s != "Linux" {
+		t.Errorf("Expected lead operating system Linux, got: %s", s)
+	}
+	if n := ArchitectureNumber(p.Architecture()); n != p.Lead.Architecture {
+		t.Errorf("Expected architecture number %d, got: %d", p.Lead.Architecture, n)
+	}
+	if n := OperatingSystemNumber(p.OperatingSystem()); n != p.Lead.OperatingSystem {
+		t.Errorf("Expected operating system number %d, got: %d", p.Lead.OperatingSystem, n)
+	}
+}
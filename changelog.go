@@ -0,0 +1,88 @@
+package rpm
+
+import (
+	"strings"
+	"time"
+)
+
+// A ChangelogEntry is an entry in the changelog of a package.
+type ChangelogEntry struct {
+	// Time is the date of the entry. Changelog dates have a resolution of one
+	// day.
+	Time time.Time
+
+	// Author is the name and email address of the author of the entry.
+	Author string
+
+	// EVR is the epoch, version and release of the package described by the
+	// entry, as written after the author's name. EVR is empty if the entry
+	// does not include a version.
+	EVR string
+
+	// Text is the content of the entry.
+	Text string
+}
+
+// Changelog returns the entries of the package changelog, most recent first.
+// Changelog returns nil if the changelog tags of the package header do not
+// have the same number of values. Use Validate to check for such packages.
+func (c *Package) Changelog() []ChangelogEntry {
+	entries, _ := c.changelog()
+	return entries
+}
+
+// changelog returns the entries of the package changelog or an error if the
+// changelog tags are inconsistent.
+func (c *Package) changelog() ([]ChangelogEntry, error) {
+	times := c.Header.GetTag(1080).Int64Slice()
+	names := c.Header.GetTag(1081).StringSlice()
+	texts := c.Header.GetTag(1082).StringSlice()
+	if len(times) != len(names) || len(texts) != len(names) {
+		return nil, errorf(
+			"changelog has %d times and %d texts for %d names",
+			len(times),
+			len(texts),
+			len(names),
+		)
+	}
+	a := make([]ChangelogEntry, len(names))
+	for i := range names {
+		a[i] = NewChangelogEntry(time.Unix(times[i], 0), names[i], texts[i])
+	}
+	return a, nil
+}
+
+// NewChangelogEntry returns a changelog entry with the given time, name line
+// and text. The name line is split into the author and EVR, as in
+// 'Jane Doe <jane@example.com> - 1:2.0-3'.
+func NewChangelogEntry(t time.Time, name, text string) ChangelogEntry {
+	author, evr := parseChangelogName(name)
+	return ChangelogEntry{
+		Time:   t,
+		Author: author,
+		EVR:    evr,
+		Text:   text,
+	}
+}
+
+// parseChangelogName splits the name line of a changelog entry, such as
+// 'Jane Doe <jane@example.com> - 1:2.0-3', into the author and the trailing
+// EVR.
+func parseChangelogName(s string) (author, evr string) {
+	s = strings.TrimSpace(s)
+	rest, offset := s, 0
+	if i := strings.LastIndexByte(s, '>'); i >= 0 {
+		rest, offset = s[i+1:], i+1
+	} else if i := strings.LastIndex(s, " - "); i >= 0 {
+		rest, offset = s[i:], i
+	} else {
+		return s, ""
+	}
+	evr = strings.TrimSpace(rest)
+	evr = strings.TrimSpace(strings.TrimPrefix(evr, "-"))
+	if strings.ContainsAny(evr, " \t") {
+		// not a version
+		return s, ""
+	}
+	return strings.TrimSpace(s[:offset]), evr
+}
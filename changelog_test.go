@@ -0,0 +1,46 @@
+package rpm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChangelog(t *testing.T) {
+	p := newTestPackage(map[int]interface{}{
+		1080: []int64{1609502400, 1577880000, 1546344000, 1514808000},
+		1081: []string{
+			"Jane Doe <jane@example.com> - 1:2.0-3",
+			"John Doe <john@example.com> 1.1-1",
+			"Build System <build@example.com>",
+			"jdoe - 1.0-1",
+		},
+		1082: []string{"- Update to 2.0", "- Fix build", "- Rebuilt", "- Initial package"},
+	})
+	expect := []ChangelogEntry{
+		{time.Unix(1609502400, 0), "Jane Doe <jane@example.com>", "1:2.0-3", "- Update to 2.0"},
+		{time.Unix(1577880000, 0), "John Doe <john@example.com>", "1.1-1", "- Fix build"},
+		{time.Unix(1546344000, 0), "Build System <build@example.com>", "", "- Rebuilt"},
+		{time.Unix(1514808000, 0), "jdoe", "1.0-1", "- Initial package"},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	entries := p.Changelog()
+	if len(entries) != len(expect) {
+		t.Fatalf("Expected %d changelog entries, got: %d", len(expect), len(entries))
+	}
+	for i, entry := range entries {
+		if entry != expect[i] {
+			t.Errorf("Expected changelog entry %+v, got: %+v", expect[i], entry)
+		}
+	}
+
+	// a missing text
+	p.Header.Tags[1082].Value = []string{"- Update to 2.0", "- Fix build", "- Rebuilt"}
+	if err := p.Validate(); err == nil {
+		t.Errorf("Expected error for inconsistent changelog")
+	}
+	if entries := p.Changelog(); entries != nil {
+		t.Errorf("Expected no changelog entries, got: %v", entries)
+	}
+}
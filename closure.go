@@ -0,0 +1,289 @@
+package rpm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ClosureOptions configures CheckClosure.
+type ClosureOptions struct {
+	// Arches lists the architectures of the target systems. The closure is
+	// checked separately for each architecture, using only the packages that
+	// are compatible with it. If Arches is empty, each architecture of the
+	// packages being checked is used.
+	Arches []string
+
+	// Lookaside lists packages that may satisfy requirements but are not
+	// checked themselves, such as the packages of a base repository.
+	Lookaside []*Package
+}
+
+// An UnresolvedDependency is a requirement of a package that is not satisfied
+// by any package in a set of packages.
+type UnresolvedDependency struct {
+	Package    *Package
+	Dependency Dependency
+
+	// Err is set instead of Dependency if the requirements of Package cannot
+	// be checked because its header is invalid, as reported by Validate.
+	Err error
+}
+
+// String returns a description of the unresolved dependency in the form
+// '[package] requires [dependency]', or '[package]: [error]' if the package
+// is invalid.
+func (c *UnresolvedDependency) String() string {
+	if c.Err != nil {
+		return fmt.Sprintf("%v: %v", c.Package, c.Err)
+	}
+	return fmt.Sprintf("%v requires %s", c.Package, c.requirement())
+}
+
+// requirement returns the formatted dependency, or an empty string if the
+// package is invalid.
+func (c *UnresolvedDependency) requirement() string {
+	if c.Dependency == nil {
+		return ""
+	}
+	return formatRequirement(c.Dependency)
+}
+
+// CheckClosure reports every requirement of the given packages which is not
+// satisfied by another package in the set, or by a package in
+// opts.Lookaside.
+//
+// Requirements are satisfied by the Provides of each package, the implicit
+// provide of each package's own name and version, and the files installed by
+// each package. Requirements on rpmlib() features are satisfied if the
+// feature is supported by modern versions of rpm. Rich dependencies are
+// satisfied if some combination of the available packages could satisfy them.
+//
+// Packages which are invalid, as reported by Validate, are not checked.
+// Instead, a single UnresolvedDependency with the validation error is
+// returned for each of them.
+//
+// The unresolved dependencies are returned in the order of the given
+// packages. An empty slice is returned if every requirement is satisfied.
+func CheckClosure(pkgs []*Package, opts *ClosureOptions) []*UnresolvedDependency {
+	if opts == nil {
+		opts = &ClosureOptions{}
+	}
+	arches := opts.Arches
+	if len(arches) == 0 {
+		arches = closureArches(pkgs)
+	}
+	type key struct {
+		pkg *Package
+		req string
+	}
+	found := make(map[key]*UnresolvedDependency)
+	invalid := make(map[*Package]bool)
+	for _, p := range pkgs {
+		if err := p.Validate(); err != nil {
+			found[key{p, ""}] = &UnresolvedDependency{Package: p, Err: err}
+			invalid[p] = true
+		}
+	}
+	for _, arch := range arches {
+		idx := newProvideIndex()
+		for _, p := range pkgs {
+			if archCompatible(arch, p.Architecture()) {
+				idx.add(p)
+			}
+		}
+		for _, p := range opts.Lookaside {
+			if archCompatible(arch, p.Architecture()) {
+				idx.add(p)
+			}
+		}
+		for _, p := range pkgs {
+			if invalid[p] || !archCompatible(arch, p.Architecture()) {
+				continue
+			}
+			for _, req := range p.Requires() {
+				if idx.resolvable(req) {
+					continue
+				}
+				k := key{p, formatRequirement(req)}
+				if _, ok := found[k]; !ok {
+					found[k] = &UnresolvedDependency{Package: p, Dependency: req}
+				}
+			}
+		}
+	}
+
+	// return results in the order of the given packages
+	order := make(map[*Package]int, len(pkgs))
+	for i, p := range pkgs {
+		if _, ok := order[p]; !ok {
+			order[p] = i
+		}
+	}
+	a := make([]*UnresolvedDependency, 0, len(found))
+	for _, u := range found {
+		a = append(a, u)
+	}
+	sort.Slice(a, func(i, j int) bool {
+		if a[i].Package != a[j].Package {
+			return order[a[i].Package] < order[a[j].Package]
+		}
+		return a[i].requirement() < a[j].requirement()
+	})
+	return a
+}
+
+// closureArches returns the distinct architectures of the given packages,
+// excluding noarch. If all packages are noarch, noarch is returned.
+func closureArches(pkgs []*Package) []string {
+	seen := make(map[string]bool)
+	a := make([]string, 0)
+	for _, p := range pkgs {
+		arch := p.Architecture()
+		if arch == "noarch" || seen[arch] {
+			continue
+		}
+		seen[arch] = true
+		a = append(a, arch)
+	}
+	if len(a) == 0 {
+		a = append(a, "noarch")
+	}
+	sort.Strings(a)
+	return a
+}
+
+// formatRequirement formats a dependency including its epoch and release.
+func formatRequirement(dep Dependency) string {
+	if IsRich(dep) {
+		return dep.Name()
+	}
+	return formatDependency(dep)
+}
+
+// provideIndex indexes the capabilities of a set of packages by name.
+type provideIndex struct {
+	provides map[string][]provideEntry
+}
+
+type provideEntry struct {
+	pkg *Package
+	dep Dependency
+}
+
+func newProvideIndex() *provideIndex {
+	return &provideIndex{provides: make(map[string][]provideEntry)}
+}
+
+// add indexes the provides, self-provide and files of p.
+func (c *provideIndex) add(p *Package) {
+	self := &dependency{
+		flags:   DepFlagEqual,
+		name:    p.Name(),
+		epoch:   p.Epoch(),
+		version: p.Version(),
+		release: p.Release(),
+	}
+	c.provides[self.name] = append(c.provides[self.name], provideEntry{p, self})
+	for _, dep := range p.Provides() {
+		c.provides[dep.Name()] = append(c.provides[dep.Name()], provideEntry{p, dep})
+	}
+	for _, fi := range p.Files() {
+		file := &dependency{name: fi.Name()}
+		c.provides[file.name] = append(c.provides[file.name], provideEntry{p, file})
+	}
+}
+
+// providers returns each package that satisfies the simple dependency dep.
+func (c *provideIndex) providers(dep Dependency) []*Package {
+	var a []*Package
+	for _, e := range c.provides[dep.Name()] {
+		if Satisfies(dep, e.dep) && (len(a) == 0 || a[len(a)-1] != e.pkg) {
+			a = append(a, e.pkg)
+		}
+	}
+	return a
+}
+
+// resolvable returns true if dep can be satisfied by the indexed packages.
+func (c *provideIndex) resolvable(dep Dependency) bool {
+	if !IsRich(dep) {
+		return c.resolvableSimple(dep)
+	}
+	rd, err := ParseRichDependency(dep.Name())
+	if err != nil {
+		return false
+	}
+	return c.resolvableRich(rd)
+}
+
+func (c *provideIndex) resolvableSimple(dep Dependency) bool {
+	if strings.HasPrefix(dep.Name(), "rpmlib(") {
+		return rpmlibSatisfies(dep)
+	}
+	return len(c.providers(dep)) > 0
+}
+
+// resolvableRich returns true if some combination of the indexed packages
+// could satisfy rd. Conditional operators are satisfied if the condition can
+// be avoided or if the required branch is resolvable.
+func (c *provideIndex) resolvableRich(rd *RichDependency) bool {
+	switch rd.Op {
+	case RichOpNone:
+		return c.resolvableSimple(rd.Dependency)
+	case RichOpAnd:
+		return c.resolvableRich(rd.Left) && c.resolvableRich(rd.Right)
+	case RichOpOr:
+		return c.resolvableRich(rd.Left) || c.resolvableRich(rd.Right)
+	case RichOpIf:
+		// A if B else C: B requires A, otherwise C is required
+		if rd.Else == nil || c.resolvableRich(rd.Else) {
+			return true
+		}
+		return c.resolvableRich(rd.Right) && c.resolvableRich(rd.Left)
+	case RichOpUnless:
+		// A unless B else C: B requires C, otherwise A is required
+		if c.resolvableRich(rd.Left) {
+			return true
+		}
+		return c.resolvableRich(rd.Right) && (rd.Else == nil || c.resolvableRich(rd.Else))
+	case RichOpWith, RichOpWithout:
+		dep := rd.Left
+		for dep.Op != RichOpNone {
+			dep = dep.Left
+		}
+		for _, p := range c.providers(dep.Dependency) {
+			if c.packageMatches(rd, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// packageMatches returns true if the single package p satisfies rd.
+func (c *provideIndex) packageMatches(rd *RichDependency, p *Package) bool {
+	switch rd.Op {
+	case RichOpNone:
+		for _, q := range c.providers(rd.Dependency) {
+			if q == p {
+				return true
+			}
+		}
+		return false
+	case RichOpAnd, RichOpWith:
+		return c.packageMatches(rd.Left, p) && c.packageMatches(rd.Right, p)
+	case RichOpOr:
+		return c.packageMatches(rd.Left, p) || c.packageMatches(rd.Right, p)
+	case RichOpWithout:
+		return c.packageMatches(rd.Left, p) && !c.packageMatches(rd.Right, p)
+	}
+	return c.packageMatches(rd.Left, p)
+}
+
+// archCompatible returns true if a package built for arch may be installed on
+// a host of architecture host. If every checked package is noarch, the host is
+// noarch and packages of any architecture may satisfy requirements.
+func archCompatible(host, arch string) bool {
+	return host == "noarch" || IsCompatible(host, arch)
+}
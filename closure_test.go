@@ -0,0 +1,92 @@
+package rpm
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCheckClosure(t *testing.T) {
+	epel := openPackage("./testdata/epel-release-7-5.noarch.rpm")
+	centos7 := openPackage("./testdata/centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm")
+	centos5 := openPackage("./testdata/centos-release-5-0.0.el5.centos.2.x86_64.rpm")
+	invalid := openPackage("./testdata/epel-release-7-5.noarch.rpm")
+	invalid.Header.Tags[1048] = &Tag{ID: 1048, Type: TagTypeInt32, Value: []int64{0}}
+	tests := []struct {
+		pkgs   []*Package
+		opts   *ClosureOptions
+		expect []string
+	}{
+		{
+			pkgs:   []*Package{epel},
+			expect: []string{"epel-release-7-5.noarch requires redhat-release >= 7"},
+		},
+		{
+			pkgs: []*Package{epel, centos7},
+		},
+		{
+			pkgs: []*Package{epel},
+			opts: &ClosureOptions{Lookaside: []*Package{centos7}},
+		},
+		{
+			// centos7 is incompatible with the target architecture
+			pkgs:   []*Package{epel},
+			opts:   &ClosureOptions{Arches: []string{"aarch64"}, Lookaside: []*Package{centos7}},
+			expect: []string{"epel-release-7-5.noarch requires redhat-release >= 7"},
+		},
+		{
+			pkgs: []*Package{centos5},
+			expect: []string{
+				"centos-release-5-0.0.el5.centos.2.x86_64 requires /bin/sh",
+				"centos-release-5-0.0.el5.centos.2.x86_64 requires centos-release-notes",
+			},
+		},
+		{
+			pkgs:   []*Package{invalid, centos7},
+			expect: []string{"epel-release-7-5.noarch: rpm: tag 1048 has 1 dependency flags for 6 names"},
+		},
+	}
+	for i, test := range tests {
+		unresolved := CheckClosure(test.pkgs, test.opts)
+		if len(unresolved) != len(test.expect) {
+			t.Errorf("Expected %d unresolved dependencies for test %d, got: %v", len(test.expect), i+1, unresolved)
+			continue
+		}
+		for j, u := range unresolved {
+			if s := u.String(); s != test.expect[j] {
+				t.Errorf("Expected %q for test %d, got: %q", test.expect[j], i+1, s)
+			}
+		}
+	}
+}
+
+func TestRPMLibSatisfies(t *testing.T) {
+	tests := []struct {
+		dep    Dependency
+		expect bool
+	}{
+		{&dependency{DepFlagLesserOrEqual | DepFlagRpmlib, "rpmlib(PayloadIsXz)", 0, "5.2", "1"}, true},
+		{&dependency{DepFlagLesserOrEqual | DepFlagRpmlib, "rpmlib(CompressedFileNames)", 0, "3.0.4", "1"}, true},
+		{&dependency{DepFlagGreaterOrEqual | DepFlagRpmlib, "rpmlib(CompressedFileNames)", 0, "9.0", ""}, false},
+		{&dependency{DepFlagAny, "rpmlib(Unknown)", 0, "", ""}, false},
+	}
+	for _, test := range tests {
+		if ok := rpmlibSatisfies(test.dep); ok != test.expect {
+			t.Errorf("Expected %v for %v, got: %v", test.expect, formatDependency(test.dep), ok)
+		}
+	}
+}
+
+// Reports the unresolved dependencies of a set of packages.
+func ExampleCheckClosure() {
+	pkgs := []*Package{
+		openPackage("./testdata/centos-release-5-0.0.el5.centos.2.x86_64.rpm"),
+		openPackage("./testdata/epel-release-7-5.noarch.rpm"),
+	}
+	for _, u := range CheckClosure(pkgs, nil) {
+		fmt.Println(u)
+	}
+
+	// Output:
+	// centos-release-5-0.0.el5.centos.2.x86_64 requires /bin/sh
+	// centos-release-5-0.0.el5.centos.2.x86_64 requires centos-release-notes
+}
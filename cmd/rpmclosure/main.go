@@ -0,0 +1,119 @@
+/*
+rpmclosure reports unresolved dependencies in a set of rpm packages, akin to
+dnf repoclosure.
+
+	usage: rpmclosure [-arch arch,...] [-lookaside path] [path ...]
+
+Each path may be an rpm package or a directory which is searched recursively
+for rpm packages. Packages found in lookaside paths may satisfy requirements
+but are not checked themselves.
+
+rpmclosure exits with status 1 if any requirement is unresolved or if the
+header of a package is invalid.
+
+Example:
+
+	$ rpmclosure centos-release-5-0.0.el5.centos.2.x86_64.rpm
+	package: centos-release-5-0.0.el5.centos.2.x86_64 from centos-release-5-0.0.el5.centos.2.x86_64.rpm
+	  unresolved deps:
+	    /bin/sh
+	    centos-release-notes
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+type stringList []string
+
+func (c *stringList) String() string { return strings.Join(*c, ",") }
+
+func (c *stringList) Set(s string) error {
+	*c = append(*c, strings.Split(s, ",")...)
+	return nil
+}
+
+func main() {
+	var arches, lookaside stringList
+	flag.Var(&arches, "arch", "check closure for the given architectures")
+	flag.Var(&lookaside, "lookaside", "path to packages that may satisfy dependencies")
+	flag.Usage = func() { usage(2) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		os.Exit(usage(1))
+	}
+
+	pkgs, paths, err := openPackages(flag.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	opts := &rpm.ClosureOptions{Arches: arches}
+	if opts.Lookaside, _, err = openPackages(lookaside); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	unresolved := rpm.CheckClosure(pkgs, opts)
+	var last *rpm.Package
+	for _, u := range unresolved {
+		if u.Err != nil {
+			fmt.Printf("package: %v from %v\n", u.Package, paths[u.Package])
+			fmt.Printf("  invalid header: %v\n", u.Err)
+			continue
+		}
+		if u.Package != last {
+			fmt.Printf("package: %v from %v\n", u.Package, paths[u.Package])
+			fmt.Printf("  unresolved deps:\n")
+			last = u.Package
+		}
+		fmt.Printf("    %v\n", u.Dependency)
+	}
+	if len(unresolved) > 0 {
+		os.Exit(1)
+	}
+}
+
+// openPackages reads the headers of each rpm package in the given files and
+// directories.
+func openPackages(names []string) ([]*rpm.Package, map[*rpm.Package]string, error) {
+	pkgs := make([]*rpm.Package, 0)
+	paths := make(map[*rpm.Package]string)
+	for _, name := range names {
+		err := filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || (path != name && !strings.HasSuffix(path, ".rpm")) {
+				return nil
+			}
+			p, err := rpm.Open(path)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", path, err)
+			}
+			pkgs = append(pkgs, p)
+			paths[p] = path
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return pkgs, paths, nil
+}
+
+func usage(exitCode int) int {
+	w := os.Stdout
+	if exitCode != 0 {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "usage: %v [-arch arch,...] [-lookaside path] [path ...]\n", os.Args[0])
+	return exitCode
+}
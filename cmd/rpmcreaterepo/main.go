@@ -0,0 +1,95 @@
+/*
+rpmcreaterepo generates yum and dnf repository metadata for a directory of rpm
+packages, akin to createrepo.
+
+	usage: rpmcreaterepo [-checksum type] [-compress type] [-baseurl url] [-changelog-limit n] [-update] [-updateinfo file] [-groups file] directory
+
+The metadata is written to the repodata subdirectory of the given directory.
+With -update, entries for packages whose size and modification time are
+unchanged are copied from the existing metadata. With -updateinfo, the
+advisories in the given updateinfo.xml file are included in the metadata, and
+with -groups, the package groups in the given comps.xml file.
+
+Example:
+
+	$ rpmcreaterepo -compress xz /srv/repo/el7/x86_64
+	Wrote /srv/repo/el7/x86_64/repodata (revision 1647302400)
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cavaliergopher/rpm/repo"
+)
+
+func main() {
+	opts := &repo.Options{}
+	flag.StringVar(&opts.ChecksumType, "checksum", repo.ChecksumSHA256, "checksum type: sha1, sha224, sha256, sha384 or sha512")
+	flag.StringVar(&opts.Compression, "compress", repo.CompressionGzip, "metadata compression: gz, xz or zst")
+	flag.StringVar(&opts.BaseURL, "baseurl", "", "base URL of package locations")
+	flag.IntVar(&opts.ChangelogLimit, "changelog-limit", 0, "maximum changelog entries per package")
+	flag.BoolVar(&opts.Update, "update", false, "reuse existing metadata for unchanged packages")
+	updateinfo := flag.String("updateinfo", "", "updateinfo.xml file of advisories to include")
+	groups := flag.String("groups", "", "comps.xml file of package groups to include")
+	flag.Usage = func() { usage(2) }
+	flag.Parse()
+	if flag.NArg() != 1 {
+		os.Exit(usage(1))
+	}
+
+	if *updateinfo != "" {
+		advisories, err := readUpdateinfo(*updateinfo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		opts.Advisories = advisories
+	}
+	if *groups != "" {
+		comps, err := readComps(*groups)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		opts.Comps = comps
+	}
+
+	dir := flag.Arg(0)
+	repomd, err := repo.Create(dir, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wrote %s (revision %s)\n", filepath.Join(dir, "repodata"), repomd.Revision)
+}
+
+func usage(exitCode int) int {
+	w := os.Stdout
+	if exitCode != 0 {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "usage: %v [-checksum type] [-compress type] [-baseurl url] [-changelog-limit n] [-update] [-updateinfo file] [-groups file] directory\n", os.Args[0])
+	return exitCode
+}
+
+func readUpdateinfo(name string) ([]*repo.Advisory, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return repo.ReadUpdateinfo(f)
+}
+
+func readComps(name string) (*repo.Comps, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return repo.ReadComps(f)
+}
@@ -0,0 +1,160 @@
+package rpm
+
+import "strings"
+
+// A Constraint is a set of version ranges, such as 'openssl >= 1.0, < 1:1.1.1k-5',
+// which a package version must satisfy.
+//
+// Constraint implements the Dependency interface. If the constraint has more
+// than one range, the Dependency methods describe only the first range; use
+// Ranges to inspect all of them.
+type Constraint struct {
+	name   string
+	ranges []*dependency
+}
+
+var _ Dependency = &Constraint{}
+
+// ParseConstraint parses a version constraint in the format of `rpm -qR`,
+// such as 'foo >= 1:2.0-3'.
+//
+// Multiple ranges may be combined with commas, as in 'foo >= 1.0, < 2.0'. A
+// version must satisfy every range to match the constraint. The package name
+// may be omitted, as in '>= 1.0, < 2.0', in which case the constraint matches
+// versions of any package.
+func ParseConstraint(s string) (*Constraint, error) {
+	c := &Constraint{}
+	for i, part := range strings.Split(s, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 1 || len(fields) == 3 {
+			if i > 0 && fields[0] != c.name {
+				return nil, errorf("unexpected package name %q in constraint: %q", fields[0], s)
+			}
+			c.name, fields = fields[0], fields[1:]
+			if strings.HasPrefix(c.name, "(") {
+				return nil, errorf("rich dependency is not a valid constraint: %q", s)
+			}
+			if parseDepFlags(c.name) != 0 {
+				return nil, errorf("expected version after %q in constraint: %q", c.name, s)
+			}
+		}
+		if len(fields) == 0 {
+			if len(strings.Split(s, ",")) > 1 {
+				return nil, errorf("missing version range in constraint: %q", s)
+			}
+			break
+		}
+		if len(fields) != 2 {
+			return nil, errorf("invalid constraint: %q", s)
+		}
+		flags := parseDepFlags(fields[0])
+		if flags == 0 {
+			return nil, errorf("invalid comparison operator %q in constraint: %q", fields[0], s)
+		}
+		dep := &dependency{flags: flags}
+		dep.epoch, dep.version, dep.release = parseVersion(fields[1])
+		if dep.version == "" {
+			return nil, errorf("invalid version %q in constraint: %q", fields[1], s)
+		}
+		c.ranges = append(c.ranges, dep)
+	}
+	if c.name == "" && len(c.ranges) == 0 {
+		return nil, errorf("empty constraint")
+	}
+	for _, dep := range c.ranges {
+		dep.name = c.name
+	}
+	return c, nil
+}
+
+// Ranges returns each version range of the constraint as a Dependency. Nil is
+// returned if the constraint matches any version.
+func (c *Constraint) Ranges() []Dependency {
+	if len(c.ranges) == 0 {
+		return nil
+	}
+	a := make([]Dependency, len(c.ranges))
+	for i, dep := range c.ranges {
+		a[i] = dep
+	}
+	return a
+}
+
+// Match returns true if v satisfies every range of the constraint, using the
+// same comparison rules as rpm. If v also has a Name method, such as a
+// Package or NEVRA, its name must match the name of the constraint, if any.
+func (c *Constraint) Match(v Version) bool {
+	if v == nil {
+		return false
+	}
+	if named, ok := v.(interface{ Name() string }); ok && c.name != "" && named.Name() != c.name {
+		return false
+	}
+	provide := &dependency{
+		flags:   DepFlagEqual,
+		name:    c.name,
+		epoch:   v.Epoch(),
+		version: v.Version(),
+		release: v.Release(),
+	}
+	for _, dep := range c.ranges {
+		if !Satisfies(dep, provide) {
+			return false
+		}
+	}
+	return true
+}
+
+// Name returns the package name of the constraint, which may be empty.
+func (c *Constraint) Name() string {
+	return c.name
+}
+
+// Flags returns the comparison flags of the first range of the constraint.
+func (c *Constraint) Flags() int {
+	if len(c.ranges) == 0 {
+		return DepFlagAny
+	}
+	return c.ranges[0].flags
+}
+
+// Epoch returns the epoch of the first range of the constraint.
+func (c *Constraint) Epoch() int {
+	if len(c.ranges) == 0 {
+		return 0
+	}
+	return c.ranges[0].epoch
+}
+
+// Version returns the version of the first range of the constraint.
+func (c *Constraint) Version() string {
+	if len(c.ranges) == 0 {
+		return ""
+	}
+	return c.ranges[0].version
+}
+
+// Release returns the release of the first range of the constraint.
+func (c *Constraint) Release() string {
+	if len(c.ranges) == 0 {
+		return ""
+	}
+	return c.ranges[0].release
+}
+
+// String returns the constraint in the format accepted by ParseConstraint,
+// including the epoch and release of each range.
+func (c *Constraint) String() string {
+	if len(c.ranges) == 0 {
+		return c.name
+	}
+	a := make([]string, len(c.ranges))
+	for i, dep := range c.ranges {
+		s := formatDependency(dep)
+		if i > 0 {
+			s = strings.TrimPrefix(s, c.name)
+		}
+		a[i] = strings.TrimSpace(s)
+	}
+	return strings.Join(a, ", ")
+}
@@ -0,0 +1,85 @@
+package rpm
+
+import "testing"
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect string
+	}{
+		{"foo", "foo"},
+		{"foo >= 1:2.0-3", "foo >= 1:2.0-3"},
+		{"  foo   =>  2.0 ", "foo >= 2.0"},
+		{"foo >= 1.0, < 2.0", "foo >= 1.0, < 2.0"},
+		{"foo >= 1.0, foo < 2.0", "foo >= 1.0, < 2.0"},
+		{">= 1.0, < 2.0", ">= 1.0, < 2.0"},
+		{"= 0:1.0", "= 1.0"},
+	}
+	for _, test := range tests {
+		c, err := ParseConstraint(test.in)
+		if err != nil {
+			t.Errorf("Error parsing %q: %v", test.in, err)
+			continue
+		}
+		if s := c.String(); s != test.expect {
+			t.Errorf("Expected %q for %q, got: %q", test.expect, test.in, s)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"foo >=",
+		"foo ~ 1.0",
+		"foo >= 1.0 bar",
+		"foo >= 1.0, bar < 2.0",
+		"foo >= 1.0,",
+		"(foo or bar)",
+		">=",
+	}
+	for _, s := range invalid {
+		if c, err := ParseConstraint(s); err == nil {
+			t.Errorf("Expected error parsing %q, got: %v", s, c)
+		}
+	}
+
+	c, err := ParseConstraint("foo >= 1:2.0-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Name() != "foo" || c.Flags() != DepFlagGreaterOrEqual || c.Epoch() != 1 ||
+		c.Version() != "2.0" || c.Release() != "3" {
+		t.Errorf("Unexpected dependency fields for %v", c)
+	}
+}
+
+func TestConstraintMatch(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    Version
+		expect     bool
+	}{
+		{"openssl < 1:1.1.1k-5", NewNEVRA("openssl", 1, "1.1.1k", "4.el8", "x86_64"), true},
+		{"openssl < 1:1.1.1k-5", NewNEVRA("openssl", 1, "1.1.1k", "5.el8", "x86_64"), false},
+		{"openssl < 1:1.1.1k-5", NewNEVRA("openssl", 0, "1.1.1z", "1", "x86_64"), true},
+		{"openssl < 1:1.1.1k-5", NewNEVRA("openssl-libs", 1, "1.1.1k", "4.el8", "x86_64"), false},
+		{"openssl", NewNEVRA("openssl", 3, "3.0", "1", "x86_64"), true},
+		{"foo >= 1.0, < 2.0", NewNEVRA("foo", 0, "1.0", "1", "noarch"), true},
+		{"foo >= 1.0, < 2.0", NewNEVRA("foo", 0, "1.9.9", "1", "noarch"), true},
+		{"foo >= 1.0, < 2.0", NewNEVRA("foo", 0, "2.0", "1", "noarch"), false},
+		{"foo >= 1.0, < 2.0", NewNEVRA("foo", 0, "0.9", "1", "noarch"), false},
+		{">= 1.0, < 2.0", NewNEVRA("bar", 0, "1.5", "1", "noarch"), true},
+		{"foo = 1.0", NewNEVRA("foo", 0, "1.0", "7", "noarch"), true},
+		{"foo = 1.0-1", NewNEVRA("foo", 0, "1.0", "7", "noarch"), false},
+		{"foo > 1.0^git1", NewNEVRA("foo", 0, "1.0.1", "1", "noarch"), true},
+	}
+	for _, test := range tests {
+		c, err := ParseConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("Error parsing %q: %v", test.constraint, err)
+			continue
+		}
+		if ok := c.Match(test.version); ok != test.expect {
+			t.Errorf("Expected %v for %q matching %v, got: %v", test.expect, test.constraint, test.version, ok)
+		}
+	}
+}
@@ -13,12 +13,22 @@ const (
 	DepFlagEqual          = (1 << 3)
 	DepFlagLesserOrEqual  = (DepFlagEqual | DepFlagLesser)
 	DepFlagGreaterOrEqual = (DepFlagEqual | DepFlagGreater)
+	DepFlagPostTrans      = (1 << 5)
 	DepFlagPrereq         = (1 << 6)
+	DepFlagPreTrans       = (1 << 7)
+	DepFlagInterp         = (1 << 8)
 	DepFlagScriptPre      = (1 << 9)
 	DepFlagScriptPost     = (1 << 10)
 	DepFlagScriptPreUn    = (1 << 11)
 	DepFlagScriptPostUn   = (1 << 12)
+	DepFlagScriptVerify   = (1 << 13)
+	DepFlagTriggerIn      = (1 << 16)
+	DepFlagTriggerUn      = (1 << 17)
+	DepFlagTriggerPostUn  = (1 << 18)
+	DepFlagMissingOk      = (1 << 19)
 	DepFlagRpmlib         = (1 << 24)
+	DepFlagTriggerPreIn   = (1 << 25)
+	DepFlagStrong         = (1 << 27)
 )
 
 // See: https://github.com/rpm-software-management/rpm/blob/master/lib/rpmds.h#L25
@@ -47,6 +57,18 @@ type dependency struct {
 
 var _ Dependency = &dependency{}
 
+// NewDependency returns a Dependency with the given flags, name and version
+// constraint.
+func NewDependency(flags int, name string, epoch int, version, release string) Dependency {
+	return &dependency{
+		flags:   flags,
+		name:    name,
+		epoch:   epoch,
+		version: version,
+		release: release,
+	}
+}
+
 // Flags determines the nature of the package relationship and the comparison
 // used for the given version constraint.
 func (c *dependency) Flags() int {
@@ -101,3 +123,62 @@ func (c *dependency) String() string {
 	}
 	return s
 }
+
+// depFlagSenseMask masks the comparison bits of a dependency's flags.
+const depFlagSenseMask = DepFlagLesser | DepFlagGreater | DepFlagEqual
+
+// Satisfies returns true if the version range described by provide overlaps
+// with the version range described by require. It implements the same range
+// overlap semantics as rpm when resolving dependencies.
+//
+// The names of both dependencies must match exactly. If either dependency has
+// no version or no comparison flags, it matches any version of the other. If
+// only one side specifies a release, the release is ignored when the versions
+// are otherwise equal and the side without a release compares for equality.
+func Satisfies(require, provide Dependency) bool {
+	// For the original C implementation, see:
+	// https://github.com/rpm-software-management/rpm/blob/master/rpmio/rpmver.c
+	if require == nil || provide == nil {
+		return false
+	}
+	if require.Name() != provide.Name() {
+		return false
+	}
+	rflags := require.Flags() & depFlagSenseMask
+	pflags := provide.Flags() & depFlagSenseMask
+	if rflags == 0 || pflags == 0 || require.Version() == "" || provide.Version() == "" {
+		return true
+	}
+
+	// compare epoch, version and release
+	sense := 0
+	if re, pe := require.Epoch(), provide.Epoch(); re > pe {
+		sense = 1
+	} else if re < pe {
+		sense = -1
+	}
+	if sense == 0 {
+		sense = CompareVersions(require.Version(), provide.Version())
+	}
+	if sense == 0 {
+		rrel, prel := require.Release(), provide.Release()
+		if rrel != "" && prel != "" {
+			sense = CompareVersions(rrel, prel)
+		} else if (rrel != "" && pflags&DepFlagEqual != 0) ||
+			(prel != "" && rflags&DepFlagEqual != 0) {
+			// the side without a release always matches if it includes equality
+			return true
+		}
+	}
+
+	// detect overlap of the two ranges
+	switch {
+	case sense < 0:
+		return rflags&DepFlagGreater != 0 || pflags&DepFlagLesser != 0
+	case sense > 0:
+		return rflags&DepFlagLesser != 0 || pflags&DepFlagGreater != 0
+	}
+	return (rflags&DepFlagEqual != 0 && pflags&DepFlagEqual != 0) ||
+		(rflags&DepFlagLesser != 0 && pflags&DepFlagLesser != 0) ||
+		(rflags&DepFlagGreater != 0 && pflags&DepFlagGreater != 0)
+}
@@ -35,3 +35,60 @@ func TestDependencyStrings(t *testing.T) {
 		}
 	}
 }
+
+func TestSatisfies(t *testing.T) {
+	dep := func(flags int, evr string) Dependency {
+		epoch, ver, rel := parseVersion(evr)
+		return &dependency{flags, "test", epoch, ver, rel}
+	}
+	tests := []struct {
+		require Dependency
+		provide Dependency
+		expect  bool
+	}{
+		{dep(DepFlagAny, ""), dep(DepFlagAny, ""), true},
+		{dep(DepFlagAny, ""), dep(DepFlagEqual, "1.0-1"), true},
+		{dep(DepFlagGreaterOrEqual, "1.0"), dep(DepFlagAny, ""), true},
+		{dep(DepFlagEqual, "1.0"), dep(DepFlagEqual, "1.0"), true},
+		{dep(DepFlagEqual, "1.0"), dep(DepFlagEqual, "1.1"), false},
+		{dep(DepFlagGreaterOrEqual, "1.0"), dep(DepFlagEqual, "1.1"), true},
+		{dep(DepFlagGreater, "1.0"), dep(DepFlagEqual, "1.0"), false},
+		{dep(DepFlagLesser, "1.0"), dep(DepFlagEqual, "0.9"), true},
+		{dep(DepFlagLesser, "1.0"), dep(DepFlagEqual, "1.0"), false},
+		{dep(DepFlagLesserOrEqual, "1.0"), dep(DepFlagEqual, "1.0"), true},
+		{dep(DepFlagLesser, "1.0"), dep(DepFlagLesser, "2.0"), true},
+		{dep(DepFlagGreater, "2.0"), dep(DepFlagLesser, "1.0"), false},
+		{dep(DepFlagGreater, "1.0"), dep(DepFlagLesser, "2.0"), true},
+
+		// epochs
+		{dep(DepFlagGreaterOrEqual, "1:1.0"), dep(DepFlagEqual, "2.0"), false},
+		{dep(DepFlagGreaterOrEqual, "1.0"), dep(DepFlagEqual, "1:0.5"), true},
+		{dep(DepFlagEqual, "1:1.0"), dep(DepFlagEqual, "1:1.0-1"), true},
+
+		// missing releases
+		{dep(DepFlagEqual, "1.0"), dep(DepFlagEqual, "1.0-1"), true},
+		{dep(DepFlagEqual, "1.0-1"), dep(DepFlagEqual, "1.0"), true},
+		{dep(DepFlagEqual, "1.0-1"), dep(DepFlagEqual, "1.0-2"), false},
+		{dep(DepFlagGreater, "1.0"), dep(DepFlagEqual, "1.0-1"), false},
+		{dep(DepFlagLesser, "1.0-2"), dep(DepFlagEqual, "1.0-1"), true},
+
+		// tildes
+		{dep(DepFlagGreaterOrEqual, "1.0"), dep(DepFlagEqual, "1.0~rc1"), false},
+		{dep(DepFlagGreaterOrEqual, "1.0~rc1"), dep(DepFlagEqual, "1.0"), true},
+	}
+	for i, test := range tests {
+		if ok := Satisfies(test.require, test.provide); ok != test.expect {
+			t.Errorf(
+				"Expected %v for test %d (%v satisfied by %v), got: %v",
+				test.expect,
+				i+1,
+				test.require,
+				test.provide,
+				ok,
+			)
+		}
+	}
+	if Satisfies(&dependency{name: "foo"}, &dependency{name: "bar"}) {
+		t.Errorf("Expected dependencies with different names not to match")
+	}
+}
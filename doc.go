@@ -88,27 +88,21 @@ function.
 Extracting files
 
 The payload of an rpm package is typically archived in cpio format and
-compressed with xz. To decompress and unarchive an rpm payload, the reader that
-read the rpm package headers will be positioned at the beginning of the payload
-and can be reused with the appropriate Go packages for the rpm payload format.
+compressed with xz. When Read returns, the reader that read the rpm package
+headers is positioned at the beginning of the payload. Use payload.NewReader
+from the payload subpackage with the same reader to iterate over the files in
+the payload and read their content. This package only reads headers and does
+not depend on any decompressors.
 
 You can check the archive format with Package.PayloadFormat and the compression
 algorithm with Package.PayloadCompression.
 
-For the cpio archive format, the following package is recommended:
-
-https://github.com/cavaliergopher/cpio
-
-For xz compression, the following package is recommended:
-
-https://github.com/ulikunitz/xz
-
-See README.md for a working example of extracting files from a cpio/xz rpm
-package using these packages.
+The spec file and sources of a source package may be read with
+payload.ReadSourcePackage.
 
 Example programs
 
-See cmd/rpmdump and cmd/rpminfo for example programs that emulate tools from the
-rpm ecosystem.
+See cmd/rpmclosure, cmd/rpmdump and cmd/rpminfo for example programs that emulate
+tools from the rpm ecosystem.
 */
 package rpm
@@ -0,0 +1,284 @@
+package drpm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/cavaliergopher/rpm/payload"
+)
+
+// ErrVerifyFailed indicates that a package reconstructed from a delta does not
+// match the checksums of the new package.
+var ErrVerifyFailed = errors.New("drpm: reconstructed package does not match the target checksums")
+
+// Apply reconstructs the new rpm package from the old rpm file read from old
+// and writes it to w.
+//
+// The content of the old package is checked against the sequence of the delta
+// and the file digests of the old package. The reconstructed package is
+// verified against the size and MD5 checksum of the new rpm file and the
+// digests in its signature header before it is written. If verification
+// fails, ErrVerifyFailed is returned and nothing is written to w.
+func (d *Delta) Apply(old io.Reader, w io.Writer) error {
+	br := bufio.NewReader(old)
+	var data []byte
+	if d.RPMOnly {
+		// the old data is the header and uncompressed payload of the old rpm
+		// file
+		buf, off, err := readHeaders(br)
+		if err != nil {
+			return err
+		}
+		pkg, err := rpm.Read(bytes.NewReader(buf))
+		if err != nil {
+			return err
+		}
+		if err := d.checkSource(pkg); err != nil {
+			return err
+		}
+		zr, err := payload.Decompress(br, pkg)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		var b bytes.Buffer
+		b.Write(buf[off:])
+		if _, err := io.Copy(&b, zr); err != nil {
+			return err
+		}
+		data = b.Bytes()
+	} else {
+		pkg, err := rpm.Read(br)
+		if err != nil {
+			return err
+		}
+		files, err := d.sequenceFiles(pkg)
+		if err != nil {
+			return err
+		}
+		if data, err = payloadData(br, pkg, files); err != nil {
+			return err
+		}
+	}
+	return d.apply(data, w)
+}
+
+// ApplyFiles reconstructs the new rpm package from the files of the old
+// package, which are installed in the given root directory, and writes it to
+// w. The headers of the old package are typically read from the rpm database.
+//
+// Deltas which are RPMOnly may not be applied to installed files. Otherwise,
+// ApplyFiles checks the installed files and verifies the reconstructed package
+// as Apply does.
+func (d *Delta) ApplyFiles(old *rpm.Package, root string, w io.Writer) error {
+	if d.RPMOnly {
+		return errorf("rpm-only delta cannot be applied to installed files")
+	}
+	files, err := d.sequenceFiles(old)
+	if err != nil {
+		return err
+	}
+	data, err := installedData(old, root, files)
+	if err != nil {
+		return err
+	}
+	return d.apply(data, w)
+}
+
+// sequenceFiles returns the files of the old package which make up the old
+// data of a standard delta, after checking that the old package matches the
+// sequence of the delta.
+func (d *Delta) sequenceFiles(old *rpm.Package) ([]*seqFile, error) {
+	if err := d.checkSource(old); err != nil {
+		return nil, err
+	}
+	return sequenceFiles(old, d.Sequence)
+}
+
+// checkSource returns an error if the old package is not the source of d.
+func (d *Delta) checkSource(old *rpm.Package) error {
+	if s := nevr(old); s != d.SourceNEVR {
+		return errorf("delta applies to %s, not %s", d.SourceNEVR, s)
+	}
+	return nil
+}
+
+// apply reconstructs the new package from the old data and writes it to w.
+func (d *Delta) apply(old []byte, w io.Writer) error {
+	if int64(len(old)) != d.outLen {
+		return errorf("old package content length does not match the delta")
+	}
+	c, err := newCompressor(d.TargetCompression, d.TargetCompressionLevel, d.compParams)
+	if err != nil {
+		return err
+	}
+	data, err := d.reconstruct(old)
+	if err != nil {
+		return err
+	}
+
+	// assemble the new package
+	header := d.header
+	if d.RPMOnly {
+		// the new data begins with the target header
+		if d.headerLen > len(data) {
+			return errorf("target header length is out of range: %d", d.headerLen)
+		}
+		header, data = data[:d.headerLen], data[d.headerLen:]
+	}
+	var buf bytes.Buffer
+	buf.Write(d.lead)
+	buf.Write(header)
+	if err := restorePayloadFormat(buf.Bytes()[len(d.lead):], d.payloadFormatOffset); err != nil {
+		return err
+	}
+	target := d.Target
+	if target == nil {
+		if target, err = d.readTarget(header); err != nil {
+			return err
+		}
+	}
+	zw, err := c.newWriter(&buf)
+	if err != nil {
+		return err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := d.verify(buf.Bytes(), target, len(header)); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// reconstruct returns the payload data of the new package, reconstructed from
+// the old data and the delta data.
+func (d *Delta) reconstruct(old []byte) ([]byte, error) {
+	if len(d.offadj) > 0 {
+		// written by makedeltarpm for large packages, which are not supported
+		return nil, errorf("offset adjustments are not supported")
+	}
+	var add []byte
+	if len(d.add) > 0 {
+		var err error
+		add, err = ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(d.add)))
+		if err != nil {
+			return nil, errorf("error reading add data: %v", err)
+		}
+	}
+
+	var target []byte
+	var off, pos int64
+	out, data, addPos := d.out, d.data, 0
+	for _, in := range d.in {
+		for i := uint32(0); i < in.copies; i++ {
+			if len(out) == 0 {
+				return nil, errorf("delta instructions are out of range")
+			}
+			off += out[0].adjust
+			end := off + int64(out[0].length)
+			if off < 0 || end > int64(len(old)) {
+				return nil, errorf("delta copy is out of range")
+			}
+			start := len(target)
+			target = append(target, old[off:end]...)
+			for j := start; j < len(target) && addPos < len(add); j++ {
+				target[j] += add[addPos]
+				addPos++
+			}
+			off, out = end, out[1:]
+		}
+		end := pos + int64(in.length)
+		if end > int64(len(data)) {
+			return nil, errorf("delta data is out of range")
+		}
+		target = append(target, data[pos:end]...)
+		pos = end
+	}
+	if len(out) > 0 || pos != int64(len(data)) {
+		return nil, errorf("delta instructions do not consume all delta data")
+	}
+	return target, nil
+}
+
+// verify checks the reconstructed rpm file b against the checksums of the new
+// package target, whose header has the given length.
+func (d *Delta) verify(b []byte, target *rpm.Package, headerLen int) error {
+	if d.TargetSize > 0 && int64(len(b)) != d.TargetSize {
+		return ErrVerifyFailed
+	}
+	if sum := md5.Sum(b); !bytes.Equal(sum[:], d.TargetMD5) {
+		return ErrVerifyFailed
+	}
+	sig := &target.Signature
+	signed := b[len(d.lead):]
+	header := signed[:headerLen]
+	payload := signed[headerLen:]
+	if size := sig.GetTag(270).Int64(); size > 0 && size != int64(len(signed)) { // RPMSIGTAG_LONGSIZE
+		return ErrVerifyFailed
+	}
+	if size := sig.GetTag(1000).Int64(); size > 0 && size != int64(len(signed)) { // RPMSIGTAG_SIZE
+		return ErrVerifyFailed
+	}
+	if expect := sig.GetTag(1004).Bytes(); expect != nil { // RPMSIGTAG_MD5
+		if sum := md5.Sum(signed); !bytes.Equal(sum[:], expect) {
+			return ErrVerifyFailed
+		}
+	}
+	if expect := sig.GetTag(269).String(); expect != "" { // RPMSIGTAG_SHA1
+		if sum := sha1.Sum(header); hex.EncodeToString(sum[:]) != expect {
+			return ErrVerifyFailed
+		}
+	}
+	if expect := sig.GetTag(273).String(); expect != "" { // RPMSIGTAG_SHA256
+		if sum := sha256.Sum256(header); hex.EncodeToString(sum[:]) != expect {
+			return ErrVerifyFailed
+		}
+	}
+	if expect := target.Header.GetTag(5092).String(); expect != "" { // RPMTAG_PAYLOADDIGEST
+		h, err := newDigest(target.Header.GetTag(5093).Int64()) // RPMTAG_PAYLOADDIGESTALGO
+		if err != nil {
+			return err
+		}
+		h.Write(payload)
+		if hex.EncodeToString(h.Sum(nil)) != expect {
+			return ErrVerifyFailed
+		}
+	}
+	return nil
+}
+
+// newDigest returns a new hash.Hash for the given OpenPGP hash algorithm, as
+// used by rpm for file and payload digests.
+func newDigest(algo int64) (hash.Hash, error) {
+	switch algo {
+	case 1:
+		return md5.New(), nil
+	case 2:
+		return sha1.New(), nil
+	case 0, 8:
+		return sha256.New(), nil
+	case 9:
+		return sha512.New384(), nil
+	case 10:
+		return sha512.New(), nil
+	case 11:
+		return sha256.New224(), nil
+	}
+	return nil, errorf("unsupported digest algorithm: %d", algo)
+}
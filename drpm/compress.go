@@ -0,0 +1,256 @@
+package drpm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/cavaliergopher/rpm/drpm/internal/liblzma"
+	"github.com/cavaliergopher/rpm/drpm/internal/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// compressions are the names of the compression types of the deltarpm
+// format, by their numeric code. The empty name is uncompressed. Code 4 is
+// not supported.
+var compressions = map[int]string{
+	0: "",
+	1: "gzip",
+	2: "bzip2",
+	3: "gzip-rsync",
+	5: "lzma",
+	6: "xz",
+	7: "zstd",
+}
+
+// compressionCode returns the numeric code of the given compression type.
+func compressionCode(compression string) (int, error) {
+	for code, s := range compressions {
+		if s == compression {
+			return code, nil
+		}
+	}
+	return 0, errorf("unsupported compression: %s", compression)
+}
+
+// newDecompressor detects the compression of the delta data in r and returns
+// a reader of the decompressed data and the name of the compression.
+func newDecompressor(r *bufio.Reader) (io.ReadCloser, string, error) {
+	magic, _ := r.Peek(6)
+	switch {
+	case bytes.HasPrefix(magic, []byte("DLT")):
+		return ioutil.NopCloser(r), "", nil
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(r)
+		return zr, "gzip", err
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return ioutil.NopCloser(bzip2.NewReader(r)), "bzip2", nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		zr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, "", err
+		}
+		return ioutil.NopCloser(zr), "xz", nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, "", err
+		}
+		return zr.IOReadCloser(), "zstd", nil
+	case bytes.HasPrefix(magic, []byte{0x5d, 0x00, 0x00}):
+		zr, err := lzma.NewReader(r)
+		if err != nil {
+			return nil, "", err
+		}
+		return ioutil.NopCloser(zr), "lzma", nil
+	}
+	return nil, "", errorf("unknown delta data compression")
+}
+
+// A compressor compresses data exactly as the compressor of rpm which wrote
+// a payload, so that the payload is reproduced byte for byte.
+//
+// The compression type and level are those of the target compression of a
+// delta. Where they do not suffice to reproduce a payload, the compressor
+// also has parameters, which are stored in the delta: the extra flags byte of
+// the gzip header, which zlib sets since version 1.2.4, and the options of
+// the xz encoder, where they differ from the preset of the level, as in the
+// payloads of packages compressed by early versions of xz.
+type compressor struct {
+	compression string
+	level       int
+	xfl         byte
+	xz          *liblzma.Options
+}
+
+// xzParamsSize is the size of the parameters of xz compressors.
+const xzParamsSize = 15
+
+// newCompressor returns the compressor of the given compression type, level
+// and parameters. A level of zero selects level 9 for gzip and level 2 for xz.
+// Only gzip, as written by zlib at levels 1 to 9 with or without the rsyncable
+// patch, and xz, as written by liblzma at levels 0 to 3, are supported, as
+// well as uncompressed data.
+func newCompressor(compression string, level int, params []byte) (*compressor, error) {
+	c := &compressor{compression: compression, level: level}
+	switch compression {
+	case "":
+		if len(params) > 0 {
+			return nil, errorf("invalid compression parameters")
+		}
+	case "gzip", "gzip-rsync":
+		if c.level == 0 {
+			c.level = 9
+		}
+		if c.level < 1 || c.level > 9 {
+			return nil, errorf("unsupported gzip compression level: %d", c.level)
+		}
+		switch len(params) {
+		case 0:
+		case 1:
+			c.xfl = params[0]
+		default:
+			return nil, errorf("invalid gzip compression parameters")
+		}
+	case "xz":
+		if c.level == 0 {
+			c.level = 2
+		}
+		switch len(params) {
+		case 0:
+			opts, err := liblzma.Preset(c.level, liblzma.CheckSHA256)
+			if err != nil {
+				return nil, errorf("unsupported xz compression level: %d", c.level)
+			}
+			c.xz = &opts
+		case xzParamsSize:
+			c.xz = &liblzma.Options{
+				Check:     params[0],
+				DictSize:  binary.BigEndian.Uint32(params[1:5]),
+				LC:        int(params[5]),
+				LP:        int(params[6]),
+				PB:        int(params[7]),
+				HashBytes: int(params[8]),
+				NiceLen:   int(binary.BigEndian.Uint16(params[9:11])),
+				Depth:     int(binary.BigEndian.Uint32(params[11:15])),
+			}
+		default:
+			return nil, errorf("invalid xz compression parameters")
+		}
+	default:
+		return nil, errorf("unsupported compression: %s", compression)
+	}
+	return c, nil
+}
+
+// params returns the parameters of c, which are empty if the compression
+// type and level suffice to reproduce its output.
+func (c *compressor) params() []byte {
+	switch c.compression {
+	case "gzip", "gzip-rsync":
+		if c.xfl != 0 {
+			return []byte{c.xfl}
+		}
+	case "xz":
+		if opts, err := liblzma.Preset(c.level, liblzma.CheckSHA256); err == nil && opts == *c.xz {
+			return nil
+		}
+		b := make([]byte, xzParamsSize)
+		b[0] = c.xz.Check
+		binary.BigEndian.PutUint32(b[1:5], c.xz.DictSize)
+		b[5], b[6], b[7] = byte(c.xz.LC), byte(c.xz.LP), byte(c.xz.PB)
+		b[8] = byte(c.xz.HashBytes)
+		binary.BigEndian.PutUint16(b[9:11], uint16(c.xz.NiceLen))
+		binary.BigEndian.PutUint32(b[11:15], uint32(c.xz.Depth))
+		return b
+	}
+	return nil
+}
+
+// newWriter returns a WriteCloser that compresses data written to it and
+// writes the compressed data to w. Closing it does not close w.
+func (c *compressor) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.compression {
+	case "":
+		return nopWriteCloser{w}, nil
+	case "gzip", "gzip-rsync":
+		return zlib.NewGzipWriter(w, c.level, c.compression == "gzip-rsync", c.xfl)
+	case "xz":
+		return liblzma.NewWriter(w, *c.xz)
+	}
+	return nil, errorf("unsupported compression: %s", c.compression)
+}
+
+// payloadCompressors returns the compressors which may have written a payload
+// with the given compression type and level, in order of likelihood.
+func payloadCompressors(compression string, level int) []*compressor {
+	var a []*compressor
+	add := func(compression string, level int, params []byte) {
+		if c, err := newCompressor(compression, level, params); err == nil {
+			a = append(a, c)
+		}
+	}
+	switch compression {
+	case "gzip":
+		// rpm used the gzio functions of zlib, which wrote no extra flags
+		// before version 1.2.4
+		xfl := []byte{0}
+		switch level {
+		case 0, 9:
+			xfl = append(xfl, 2)
+		case 1:
+			xfl = append(xfl, 4)
+		}
+		for _, name := range []string{"gzip", "gzip-rsync"} {
+			for _, x := range xfl {
+				add(name, level, []byte{x})
+			}
+		}
+	case "xz":
+		checks := []byte{liblzma.CheckSHA256, liblzma.CheckCRC64, liblzma.CheckCRC32, liblzma.CheckNone}
+		for _, check := range checks {
+			lvl := level
+			if lvl == 0 {
+				lvl = 2
+			}
+			if opts, err := liblzma.Preset(lvl, check); err == nil {
+				add("xz", level, xzParams(opts))
+			}
+		}
+		if level == 2 {
+			// the options of xz level 2 in the payloads of EL6 packages
+			for _, check := range checks {
+				add("xz", level, xzParams(liblzma.Options{
+					DictSize:  1 << 19,
+					LC:        3,
+					PB:        2,
+					HashBytes: 4,
+					NiceLen:   32,
+					Depth:     16,
+					Check:     check,
+				}))
+			}
+		}
+	case "":
+		add("", 0, nil)
+	}
+	return a
+}
+
+// xzParams returns the parameters of an xz compressor with the given options.
+func xzParams(opts liblzma.Options) []byte {
+	c := &compressor{compression: "xz", level: -1, xz: &opts}
+	return c.params()
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,625 @@
+// Package drpm reads, applies and creates delta rpm packages.
+//
+// A delta rpm contains the differences between two versions of a package.
+// Applying a delta to the old version of the package, either an rpm file or
+// the files of the package installed on a system, reconstructs the new version
+// of the package, which is verified against the checksums of the new package
+// before it is written.
+//
+// Delta files use the format of the deltarpm tools, versions 1 to 3, in both
+// standard and rpm-only variants. The old data of a standard delta is a
+// normalized cpio archive of the files of the old package, which is assembled
+// from the old rpm file or the installed files, and identified by the sequence
+// of the delta. The old data of an rpm-only delta is the header and the
+// uncompressed payload of the old rpm file.
+//
+// The reconstructed payload is compressed again with ports of the compressors
+// of zlib and liblzma, which produce the same output as the originals, so that
+// the new rpm file is reproduced byte for byte. Payloads compressed with gzip,
+// as written by zlib, and with xz at levels 0 to 3, as written by liblzma, are
+// supported.
+package drpm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// A Delta is a delta rpm package.
+type Delta struct {
+	// Version is the version of the delta format, from 1 to 3. RPM-only
+	// deltas are always version 3.
+	Version int
+
+	// RPMOnly indicates that the delta may only be applied to an rpm file of
+	// the old package, and not to its installed files.
+	RPMOnly bool
+
+	// SourceNEVR and TargetNEVR identify the old and new versions of the
+	// package in the form 'name-[epoch:]version-release'.
+	SourceNEVR string
+	TargetNEVR string
+
+	// Sequence identifies the files of the old package that the delta
+	// applies to. It is the MD5 checksum of the names, modes, sizes and
+	// digests of the files, followed by the compressed sequence of their
+	// indexes in the old header. The sequence of RPM-only deltas is only an
+	// MD5 checksum of the old package.
+	Sequence []byte
+
+	// TargetMD5 is the MD5 checksum of the new rpm file.
+	TargetMD5 []byte
+
+	// TargetSize is the size in bytes of the new rpm file. It is zero in
+	// version 1 deltas.
+	TargetSize int64
+
+	// TargetCompression is the compression of the new payload, which is
+	// applied to the reconstructed payload data, such as "gzip" or "xz". If
+	// empty, the payload is reconstructed as is.
+	TargetCompression string
+
+	// TargetCompressionLevel is the level of TargetCompression, or zero for
+	// the default level.
+	TargetCompressionLevel int
+
+	// Target contains the lead and headers of the new rpm package. It is nil
+	// for RPM-only deltas, whose target header is reconstructed from the old
+	// package.
+	Target *rpm.Package
+
+	// Compression is the compression of the delta data in the delta file,
+	// such as "gzip" or "xz". It is empty if the data is uncompressed.
+	Compression string
+
+	compParams          []byte
+	lead                []byte // target lead and signature
+	header              []byte // target header with payload format "drpm"
+	headerLen           int    // length of the target header
+	payloadFormatOffset int    // offset of the payload format in the header store
+	offadj              []uint32
+	in                  []inBlock
+	out                 []outBlock
+	outLen              int64
+	add                 []byte // bzip2 compressed
+	data                []byte
+}
+
+// An inBlock is an instruction to copy the given number of out blocks from
+// the old data, followed by length bytes of the delta data.
+type inBlock struct {
+	copies uint32
+	length uint32
+}
+
+// An outBlock is an instruction to move the offset in the old data by adjust
+// bytes and copy length bytes from the new offset.
+type outBlock struct {
+	adjust int64
+	length uint32
+}
+
+// leadMagic begins the lead of rpm and standard delta rpm files.
+var leadMagic = []byte{0xed, 0xab, 0xee, 0xdb}
+
+// Read reads a delta rpm package from r.
+func Read(r io.Reader) (*Delta, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, err
+	}
+	d := &Delta{}
+	switch {
+	case bytes.Equal(magic, []byte("drpm")):
+		d.RPMOnly = true
+		dec := &decoder{r: br}
+		if v := string(dec.read(8)); dec.err == nil && v != "drpmDLT3" {
+			return nil, errorf("unsupported rpm-only delta version: %q", v[4:])
+		}
+		d.TargetNEVR = dec.string()
+		d.add = dec.bytes()
+		if dec.err != nil {
+			return nil, dec.err
+		}
+	case bytes.Equal(magic, leadMagic):
+		buf, off, err := readHeaders(br)
+		if err != nil {
+			return nil, err
+		}
+		d.header = buf[off:]
+	default:
+		return nil, errorf("not a delta rpm file")
+	}
+
+	zr, compression, err := newDecompressor(br)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	d.Compression = compression
+	if err := d.readDelta(bufio.NewReader(zr)); err != nil {
+		return nil, err
+	}
+	if d.RPMOnly && d.Version != 3 {
+		return nil, errorf("unsupported rpm-only delta version: %d", d.Version)
+	}
+
+	if d.RPMOnly {
+		return d, nil
+	}
+	if d.Version >= 3 && d.headerLen != len(d.header) {
+		return nil, errorf("target header length does not match the delta")
+	}
+	d.headerLen = len(d.header)
+	target, err := d.readTarget(d.header)
+	if err != nil {
+		return nil, err
+	}
+	d.Target = target
+	d.TargetNEVR = nevr(target)
+	if d.Version == 1 {
+		d.TargetCompression = target.PayloadCompression()
+		if d.TargetCompression == "" {
+			d.TargetCompression = "gzip"
+		}
+	}
+	return d, nil
+}
+
+// Open opens a delta rpm package from the file system.
+func Open(name string) (*Delta, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// readTarget returns the new package with the given header, whose payload
+// format is restored if it was replaced by "drpm".
+func (d *Delta) readTarget(header []byte) (*rpm.Package, error) {
+	hdr := append([]byte(nil), header...)
+	if err := restorePayloadFormat(hdr, d.payloadFormatOffset); err != nil {
+		return nil, err
+	}
+	target, err := rpm.Read(bytes.NewReader(append(append([]byte(nil), d.lead...), hdr...)))
+	if err != nil {
+		return nil, errorf("error reading target headers: %v", err)
+	}
+	return target, nil
+}
+
+// SequenceID returns the identifier of the delta which is used to check if it
+// can be applied, in the form 'name-[epoch:]version-release-sequence', where
+// sequence is the hexadecimal encoding of Sequence.
+func (d *Delta) SequenceID() string {
+	return d.SourceNEVR + "-" + hex.EncodeToString(d.Sequence)
+}
+
+func (d *Delta) String() string {
+	return d.SourceNEVR + " -> " + d.TargetNEVR
+}
+
+// readDelta reads the decompressed delta data which follows the target
+// headers in a delta rpm file.
+func (d *Delta) readDelta(r io.Reader) error {
+	dec := &decoder{r: r}
+	switch magic := string(dec.read(4)); magic {
+	case "DLT1", "DLT2", "DLT3":
+		d.Version = int(magic[3] - '0')
+	default:
+		if dec.err != nil {
+			return dec.err
+		}
+		return errorf("unsupported delta version: %q", magic)
+	}
+	d.SourceNEVR = dec.string()
+	d.Sequence = dec.bytes()
+	d.TargetMD5 = dec.read(16)
+	if d.Version >= 2 {
+		d.TargetSize = int64(dec.uint32())
+		comp := dec.uint32()
+		compression, ok := compressions[int(comp&0xff)]
+		if !ok && dec.err == nil {
+			return errorf("unsupported target compression: %d", comp&0xff)
+		}
+		d.TargetCompression = compression
+		d.TargetCompressionLevel = int(comp >> 8 & 0xff)
+		d.compParams = dec.bytes()
+	}
+	if d.Version >= 3 {
+		d.headerLen = int(dec.uint32())
+		n := dec.uint32()
+		for i := uint32(0); i < 2*n && dec.err == nil; i++ {
+			d.offadj = append(d.offadj, dec.uint32())
+		}
+	}
+	d.lead = dec.bytes()
+	d.payloadFormatOffset = int(dec.uint32())
+	inn, outn := dec.uint32(), dec.uint32()
+	for i := uint32(0); i < inn && dec.err == nil; i++ {
+		d.in = append(d.in, inBlock{copies: dec.uint32()})
+	}
+	for i := range d.in {
+		d.in[i].length = dec.uint32()
+	}
+	for i := uint32(0); i < outn && dec.err == nil; i++ {
+		adjust := dec.uint32()
+		if adjust&0x80000000 != 0 {
+			d.out = append(d.out, outBlock{adjust: -int64(adjust ^ 0x80000000)})
+		} else {
+			d.out = append(d.out, outBlock{adjust: int64(adjust)})
+		}
+	}
+	for i := range d.out {
+		d.out[i].length = dec.uint32()
+	}
+	d.outLen = dec.length(d.Version)
+	if add := dec.bytes(); len(add) > 0 {
+		d.add = add
+	}
+	d.data = dec.readN(dec.length(d.Version))
+	if dec.err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return dec.err
+}
+
+// write writes d to w as a delta rpm file in version d.Version of the format.
+func (d *Delta) write(w io.Writer) error {
+	if d.Version < 1 || d.Version > 3 || d.RPMOnly && d.Version != 3 {
+		return errorf("unsupported delta version: %d", d.Version)
+	}
+	if d.Version < 3 && (len(d.offadj) > 0 || d.outLen > math.MaxUint32 || int64(len(d.data)) > math.MaxUint32) {
+		return errorf("delta exceeds the limits of version %d", d.Version)
+	}
+	if d.TargetSize > math.MaxUint32 {
+		return errorf("target size exceeds the maximum of %d", uint32(math.MaxUint32))
+	}
+	comp, err := compressionCode(d.TargetCompression)
+	if err != nil {
+		return err
+	}
+	enc := &encoder{w: w}
+	if d.RPMOnly {
+		// the add block of rpm-only deltas precedes the compressed data
+		enc.write([]byte("drpmDLT3"))
+		enc.string(d.TargetNEVR)
+		enc.bytes(d.add)
+	} else {
+		enc.write(d.lead)
+		enc.write(d.header)
+	}
+	if enc.err != nil {
+		return enc.err
+	}
+
+	c, err := newCompressor(d.Compression, 0, nil)
+	if err != nil {
+		return err
+	}
+	zw, err := c.newWriter(w)
+	if err != nil {
+		return err
+	}
+	enc = &encoder{w: zw}
+	enc.write([]byte("DLT" + strconv.Itoa(d.Version)))
+	enc.string(d.SourceNEVR)
+	enc.bytes(d.Sequence)
+	if len(d.TargetMD5) != md5.Size {
+		return errorf("invalid target MD5 checksum length: %d", len(d.TargetMD5))
+	}
+	enc.write(d.TargetMD5)
+	if d.Version >= 2 {
+		enc.uint32(uint32(d.TargetSize))
+		enc.uint32(uint32(comp | d.TargetCompressionLevel<<8))
+		enc.bytes(d.compParams)
+	}
+	if d.Version >= 3 {
+		enc.uint32(uint32(d.headerLen))
+		enc.uint32(uint32(len(d.offadj) / 2))
+		for _, v := range d.offadj {
+			enc.uint32(v)
+		}
+	}
+	enc.bytes(d.lead)
+	enc.uint32(uint32(d.payloadFormatOffset))
+	enc.uint32(uint32(len(d.in)))
+	enc.uint32(uint32(len(d.out)))
+	for _, in := range d.in {
+		enc.uint32(in.copies)
+	}
+	for _, in := range d.in {
+		enc.uint32(in.length)
+	}
+	for _, out := range d.out {
+		if out.adjust < 0 {
+			enc.uint32(uint32(-out.adjust) | 0x80000000)
+		} else {
+			enc.uint32(uint32(out.adjust))
+		}
+	}
+	for _, out := range d.out {
+		enc.uint32(out.length)
+	}
+	enc.length(d.Version, d.outLen)
+	if d.RPMOnly {
+		enc.bytes(nil)
+	} else {
+		enc.bytes(d.add)
+	}
+	enc.length(d.Version, int64(len(d.data)))
+	enc.write(d.data)
+	if enc.err != nil {
+		return enc.err
+	}
+	return zw.Close()
+}
+
+// newDelta returns a Delta for the new rpm package with the lead and headers
+// in buf, as returned by readHeaders, without instructions, a source or the
+// checksum and size of the new rpm file.
+func newDelta(buf []byte, off int) (*Delta, error) {
+	pkg, err := rpm.Read(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	d := &Delta{
+		Version:     3,
+		TargetNEVR:  nevr(pkg),
+		Target:      pkg,
+		Compression: "gzip",
+		lead:        buf[:off],
+		header:      append([]byte(nil), buf[off:]...),
+		headerLen:   len(buf) - off,
+	}
+	if d.payloadFormatOffset, err = payloadFormatOffset(d.header); err != nil {
+		return nil, err
+	}
+	if d.payloadFormatOffset > 0 {
+		copy(d.header[headerStore(d.header)+d.payloadFormatOffset:], "drpm")
+	}
+	return d, nil
+}
+
+// headerStore returns the offset of the data store of the given rpm header,
+// which begins after the index entries.
+func headerStore(hdr []byte) int {
+	return 16 + 16*int(binary.BigEndian.Uint32(hdr[8:12]))
+}
+
+// payloadFormatOffset returns the offset of the "cpio" payload format value in
+// the data store of the given rpm header, or zero if the header has no
+// payload format.
+func payloadFormatOffset(hdr []byte) (int, error) {
+	if len(hdr) < 16 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := int(binary.BigEndian.Uint32(hdr[8:12]))
+	store := headerStore(hdr)
+	if store > len(hdr) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	for i := 0; i < n; i++ {
+		index := hdr[16+16*i:]
+		if binary.BigEndian.Uint32(index[:4]) != 1124 { // RPMTAG_PAYLOADFORMAT
+			continue
+		}
+		off := int(binary.BigEndian.Uint32(index[8:12]))
+		if store+off+5 > len(hdr) || string(hdr[store+off:store+off+5]) != "cpio\x00" {
+			return 0, errorf("unsupported payload format")
+		}
+		return off, nil
+	}
+	return 0, nil
+}
+
+// restorePayloadFormat restores the "cpio" payload format of the given rpm
+// header if it was replaced by "drpm" at the given offset in its data store.
+func restorePayloadFormat(hdr []byte, off int) error {
+	if len(hdr) < 16 {
+		return io.ErrUnexpectedEOF
+	}
+	off += headerStore(hdr)
+	if off < 0 || off+4 > len(hdr) {
+		return errorf("payload format offset is out of range: %d", off)
+	}
+	if string(hdr[off:off+4]) == "drpm" {
+		copy(hdr[off:], "cpio")
+	}
+	return nil
+}
+
+// readHeaders reads the lead and both headers of an rpm package from r and
+// returns their bytes and the offset of the header.
+func readHeaders(r io.Reader) ([]byte, int, error) {
+	buf := make([]byte, 96+16)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(buf[:4], leadMagic) {
+		return nil, 0, rpm.ErrNotRPMFile
+	}
+	n, err := headerLength(buf[96:])
+	if err != nil {
+		return nil, 0, err
+	}
+	off := 96 + n + (8-n%8)%8
+	if buf, err = readMore(r, buf, off+16); err != nil {
+		return nil, 0, err
+	}
+	if n, err = headerLength(buf[off:]); err != nil {
+		return nil, 0, err
+	}
+	if buf, err = readMore(r, buf, off+n); err != nil {
+		return nil, 0, err
+	}
+	return buf, off, nil
+}
+
+// readMore reads from r until buf is n bytes long.
+func readMore(r io.Reader, buf []byte, n int) ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, r, int64(n-len(buf))); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return append(buf, b.Bytes()...), nil
+}
+
+// maxHeaderSize is the maximum size of an rpm header, as enforced by rpm.
+const maxHeaderSize = 33554432
+
+// headerLength returns the length in bytes of the rpm header which begins
+// with the given structure header, excluding any padding.
+func headerLength(b []byte) (int, error) {
+	if !bytes.Equal(b[:3], []byte{0x8e, 0xad, 0xe8}) {
+		return 0, errorf("invalid rpm header")
+	}
+	count := int(binary.BigEndian.Uint32(b[8:12]))
+	size := int(binary.BigEndian.Uint32(b[12:16]))
+	if size > maxHeaderSize || count > maxHeaderSize/16 {
+		return 0, errorf("header size exceeds the maximum of %d", maxHeaderSize)
+	}
+	return 16 + 16*count + size, nil
+}
+
+// nevr returns the name, epoch, version and release of p in the form
+// 'name-[epoch:]version-release'. The epoch is included if it is set in the
+// package header, even if it is zero.
+func nevr(p *rpm.Package) string {
+	if p.Header.GetTag(1003) != nil { // RPMTAG_EPOCH
+		return fmt.Sprintf("%s-%d:%s-%s", p.Name(), p.Epoch(), p.Version(), p.Release())
+	}
+	return p.Name() + "-" + p.Version() + "-" + p.Release()
+}
+
+// decoder reads the big-endian values of the delta format. Once a read fails,
+// all further reads return zero values and err is set.
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (c *decoder) read(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, c.err = io.ReadFull(c.r, b)
+	return b
+}
+
+// readN reads n bytes, allocating memory as they are read so that a corrupt
+// length cannot exhaust memory.
+func (c *decoder) readN(n int64) []byte {
+	if c.err != nil {
+		return nil
+	}
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, c.r, n); err != nil {
+		c.err = err
+		return nil
+	}
+	return b.Bytes()
+}
+
+func (c *decoder) uint32() uint32 {
+	b := c.read(4)
+	if c.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (c *decoder) uint64() uint64 {
+	b := c.read(8)
+	if c.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// length reads a length, which is 64 bits in version 3 of the format.
+func (c *decoder) length(version int) int64 {
+	if version >= 3 {
+		n := c.uint64()
+		if n > math.MaxInt64 && c.err == nil {
+			c.err = errorf("length is out of range: %d", n)
+		}
+		return int64(n)
+	}
+	return int64(c.uint32())
+}
+
+// bytes reads a byte slice prefixed with its 32 bit length.
+func (c *decoder) bytes() []byte {
+	return c.readN(int64(c.uint32()))
+}
+
+// string reads a string prefixed with its 32 bit length, which includes a
+// terminating zero byte.
+func (c *decoder) string() string {
+	return strings.TrimSuffix(string(c.bytes()), "\x00")
+}
+
+// encoder writes the big-endian values of the delta format. Once a write
+// fails, all further writes are ignored and err is set.
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+func (c *encoder) write(b []byte) {
+	if c.err == nil {
+		_, c.err = c.w.Write(b)
+	}
+}
+
+func (c *encoder) uint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	c.write(b[:])
+}
+
+func (c *encoder) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	c.write(b[:])
+}
+
+// length writes a length, which is 64 bits in version 3 of the format.
+func (c *encoder) length(version int, n int64) {
+	if version >= 3 {
+		c.uint64(uint64(n))
+	} else {
+		c.uint32(uint32(n))
+	}
+}
+
+// bytes writes b prefixed with its 32 bit length.
+func (c *encoder) bytes(b []byte) {
+	c.uint32(uint32(len(b)))
+	c.write(b)
+}
+
+// string writes s with a terminating zero byte, prefixed with its 32 bit
+// length.
+func (c *encoder) string(s string) {
+	c.bytes(append([]byte(s), 0))
+}
@@ -0,0 +1,379 @@
+package drpm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/cavaliergopher/rpm/payload"
+)
+
+const (
+	testOld = "../testdata/centos-release-6-0.el6.centos.5.x86_64.rpm"
+	testNew = "../testdata/centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm"
+
+	// testMakedeltarpm is an rpm-only delta created by makedeltarpm, from the
+	// test data of github.com/gabriel-vasile/mimetype (MIT license).
+	testMakedeltarpm = "testdata/hello-1-1_2-1.drpm"
+)
+
+// newTestDelta returns a delta from testOld to testNew, which contains the new
+// payload data as literal delta data. The new rpm file is also returned.
+func newTestDelta(t *testing.T, rpmOnly bool) (*Delta, []byte) {
+	target, header, data := readTestPackage(t, testNew)
+	buf, off, err := readHeaders(bytes.NewReader(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := newDelta(buf, off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPkg, err := rpm.Open(testOld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(target)
+	d.TargetMD5 = sum[:]
+	d.TargetSize = int64(len(target))
+	d.TargetCompression = "xz"
+	d.TargetCompressionLevel = 2
+	d.SourceNEVR = nevr(oldPkg)
+	if rpmOnly {
+		_, oldHeader, oldData := readTestPackage(t, testOld)
+		old := append(oldHeader, oldData...)
+		sum := md5.Sum(old)
+		d.RPMOnly = true
+		d.Target = nil
+		d.header = nil
+		d.Sequence = sum[:]
+		d.outLen = int64(len(old))
+		data = append(header, data...)
+	} else {
+		old, files := oldData(t)
+		d.Sequence = encodeSequence(files)
+		d.outLen = int64(len(old))
+	}
+	d.in = []inBlock{{length: uint32(len(data))}}
+	d.data = data
+	return d, target
+}
+
+// readTestPackage returns the content of the rpm file with the given name, its
+// header and its uncompressed payload.
+func readTestPackage(t *testing.T, name string) (b, header, data []byte) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, off, err := readHeaders(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := rpm.Read(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := payload.Decompress(bytes.NewReader(b[len(buf):]), pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if data, err = ioutil.ReadAll(zr); err != nil {
+		t.Fatal(err)
+	}
+	return b, append([]byte(nil), buf[off:]...), data
+}
+
+// rewrite writes and reads d.
+func rewrite(t *testing.T, d *Delta) *Delta {
+	var buf bytes.Buffer
+	if err := d.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return actual
+}
+
+// oldData returns the old data of standard deltas from testOld, and the files
+// which make it up.
+func oldData(t *testing.T) ([]byte, []*seqFile) {
+	f, err := os.Open(testOld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	pkg, err := rpm.Read(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := deltaFiles(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := payloadData(r, pkg, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, files
+}
+
+func TestReadDelta(t *testing.T) {
+	for _, rpmOnly := range []bool{false, true} {
+		d, target := newTestDelta(t, rpmOnly)
+		d.Compression = "xz"
+		actual := rewrite(t, d)
+		tests := []struct {
+			Name   string
+			Actual interface{}
+			Expect interface{}
+		}{
+			{"Version", actual.Version, 3},
+			{"RPMOnly", actual.RPMOnly, rpmOnly},
+			{"SourceNEVR", actual.SourceNEVR, "centos-release-6-0.el6.centos.5"},
+			{"TargetNEVR", actual.TargetNEVR, "centos-release-7-2.1511.el7.centos.2.10"},
+			{"Sequence", actual.Sequence, d.Sequence},
+			{"TargetMD5", actual.TargetMD5, d.TargetMD5},
+			{"TargetSize", actual.TargetSize, int64(len(target))},
+			{"TargetCompression", actual.TargetCompression, "xz"},
+			{"TargetCompressionLevel", actual.TargetCompressionLevel, 2},
+			{"Compression", actual.Compression, "xz"},
+			{"headerLen", actual.headerLen, d.headerLen},
+			{"in", actual.in, d.in},
+			{"data", actual.data, d.data},
+		}
+		for _, test := range tests {
+			if !reflect.DeepEqual(test.Actual, test.Expect) {
+				t.Errorf("Expected %s %v, got: %v", test.Name, test.Expect, test.Actual)
+			}
+		}
+		if rpmOnly {
+			if actual.Target != nil {
+				t.Errorf("Expected no target package for rpm-only delta")
+			}
+		} else if s := actual.Target.String(); s != "centos-release-7-2.1511.el7.centos.2.10.x86_64" {
+			t.Errorf("Expected target centos-release-7-2.1511.el7.centos.2.10.x86_64, got: %s", s)
+		} else if s := actual.Target.PayloadFormat(); s != "cpio" {
+			t.Errorf("Expected target payload format cpio, got: %s", s)
+		}
+	}
+
+	if _, err := Read(bytes.NewReader([]byte("not a delta rpm"))); err == nil {
+		t.Errorf("Expected error reading invalid delta")
+	}
+}
+
+func TestReadMakedeltarpm(t *testing.T) {
+	d, err := Open(testMakedeltarpm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Name   string
+		Actual interface{}
+		Expect interface{}
+	}{
+		{"Version", d.Version, 3},
+		{"RPMOnly", d.RPMOnly, true},
+		{"SourceNEVR", d.SourceNEVR, "hello-1-1"},
+		{"TargetNEVR", d.TargetNEVR, "hello-2-1"},
+		{"Sequence", hex.EncodeToString(d.Sequence), "f81b3e3553355c71303a3fafc82443f8"},
+		{"TargetMD5", hex.EncodeToString(d.TargetMD5), "f9a38eeea18d2c0bf9811385e0cc56fb"},
+		{"TargetSize", d.TargetSize, int64(2040)},
+		{"TargetCompression", d.TargetCompression, "xz"},
+		{"TargetCompressionLevel", d.TargetCompressionLevel, 2},
+		{"Compression", d.Compression, "xz"},
+		{"Target", d.Target, (*rpm.Package)(nil)},
+		{"headerLen", d.headerLen, 1556},
+		{"lead", len(d.lead), 280},
+		{"payloadFormatOffset", d.payloadFormatOffset, 614},
+		{"in", d.in, []inBlock{{1, 18}}},
+		{"out", d.out, []outBlock{{0, 1834}}},
+		{"outLen", d.outLen, int64(1848)},
+		{"add", len(d.add), 182},
+		{"data", string(d.data), "0000TRAILER!!!\x00\x00\x00\x00"},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.Actual, test.Expect) {
+			t.Errorf("Expected %s %v, got: %v", test.Name, test.Expect, test.Actual)
+		}
+	}
+
+	// the delta is written as it was read
+	if actual := rewrite(t, d); !reflect.DeepEqual(actual, d) {
+		t.Errorf("Expected rewritten delta to match")
+	}
+}
+
+func TestReadDeltaVersions(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		d, target := newTestDelta(t, false)
+		d.Version = version
+		d.outLen = 3
+		d.in = []inBlock{{0, 2}, {1, uint32(len(d.data) - 2)}}
+		d.out = []outBlock{{1, 2}}
+		actual := rewrite(t, d)
+		expectSize := int64(len(target))
+		if version == 1 {
+			// version 1 deltas have no target size and use the compression of
+			// the target header
+			expectSize = 0
+		}
+		tests := []struct {
+			Name   string
+			Actual interface{}
+			Expect interface{}
+		}{
+			{"Version", actual.Version, version},
+			{"SourceNEVR", actual.SourceNEVR, "centos-release-6-0.el6.centos.5"},
+			{"TargetNEVR", actual.TargetNEVR, "centos-release-7-2.1511.el7.centos.2.10"},
+			{"Sequence", actual.Sequence, d.Sequence},
+			{"TargetMD5", actual.TargetMD5, d.TargetMD5},
+			{"TargetSize", actual.TargetSize, expectSize},
+			{"TargetCompression", actual.TargetCompression, "xz"},
+			{"Target", actual.Target.String(), "centos-release-7-2.1511.el7.centos.2.10.x86_64"},
+			{"in", actual.in, d.in},
+			{"out", actual.out, d.out},
+			{"outLen", actual.outLen, d.outLen},
+			{"data", actual.data, d.data},
+		}
+		for _, test := range tests {
+			if !reflect.DeepEqual(test.Actual, test.Expect) {
+				t.Errorf("Expected version %d %s %v, got: %v", version, test.Name, test.Expect, test.Actual)
+			}
+		}
+	}
+
+	// rpm-only deltas only exist in version 3
+	d, _ := newTestDelta(t, true)
+	d.Version = 2
+	if err := d.write(ioutil.Discard); err == nil {
+		t.Errorf("Expected error writing version 2 rpm-only delta")
+	}
+}
+
+func TestSequence(t *testing.T) {
+	tests := [][]int{
+		nil,
+		{0},
+		{0, 1, 2, 3},
+		{3, 4, 5},
+		{0, 2, 4, 100, 101, 5000},
+		{7, 8, 2, 3, 9, 1},
+	}
+	for _, indexes := range tests {
+		files := make([]*seqFile, len(indexes))
+		for i, index := range indexes {
+			files[i] = &seqFile{index: index}
+		}
+		seq := encodeSequence(files)
+		actual, err := decodeSequence(seq)
+		if err != nil {
+			t.Errorf("Error decoding sequence %v: %v", indexes, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, indexes) {
+			t.Errorf("Expected sequence %v, got: %v", indexes, actual)
+		}
+	}
+
+	// take 2 files, skip 3, take 1 and jump back to 1 to take 2
+	seq := append(make([]byte, md5.Size), 0x23, 0x10, 0x12)
+	actual, err := decodeSequence(seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []int{0, 1, 5, 1, 2}; !reflect.DeepEqual(actual, expect) {
+		t.Errorf("Expected sequence %v, got: %v", expect, actual)
+	}
+}
+
+func TestApply(t *testing.T) {
+	for _, rpmOnly := range []bool{false, true} {
+		for _, version := range []int{2, 3} {
+			if rpmOnly && version < 3 {
+				continue
+			}
+			d, target := newTestDelta(t, rpmOnly)
+			d.Version = version
+			d = rewrite(t, d)
+			f, err := os.Open(testOld)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = d.Apply(f, &buf)
+			f.Close()
+			if err != nil {
+				t.Errorf("Error applying version %d delta with rpm-only %v: %v", version, rpmOnly, err)
+				continue
+			}
+			if !bytes.Equal(buf.Bytes(), target) {
+				t.Errorf("Expected reconstructed package to match with version %d and rpm-only %v", version, rpmOnly)
+			}
+		}
+	}
+
+	// the delta does not apply to the new package
+	d, _ := newTestDelta(t, false)
+	g, err := os.Open(testNew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if err := d.Apply(g, ioutil.Discard); err == nil {
+		t.Errorf("Expected error applying delta to the wrong package")
+	}
+}
+
+func TestApplyFiles(t *testing.T) {
+	old, err := rpm.Open(testOld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldFile, err := ioutil.ReadFile(testOld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	installTestFiles(t, oldFile, root)
+	d, target := newTestDelta(t, false)
+	d = rewrite(t, d)
+	var buf bytes.Buffer
+	if err := d.ApplyFiles(old, root, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), target) {
+		t.Errorf("Expected reconstructed package to match")
+	}
+
+	// corrupt delta data fails verification
+	d.data = append([]byte{d.data[0] + 1}, d.data[1:]...)
+	buf.Reset()
+	if err := d.ApplyFiles(old, root, &buf); err != ErrVerifyFailed {
+		t.Errorf("Expected ErrVerifyFailed, got: %v", err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Expected nothing to be written when verification fails")
+	}
+
+	// modified files do not match the file digests
+	name := filepath.Join(root, "etc/pki/rpm-gpg/RPM-GPG-KEY-CentOS-6")
+	if err := ioutil.WriteFile(name, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ApplyFiles(old, root, ioutil.Discard); err == nil || err == ErrVerifyFailed {
+		t.Errorf("Expected file digest mismatch error, got: %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package liblzma
+
+import "hash/crc32"
+
+// This file is a port of the hash chain match finders of liblzma, which find
+// earlier occurrences of the data at the read position.
+
+const (
+	hash2Size    = 1 << 10
+	hash3Size    = 1 << 16
+	hash2Mask    = hash2Size - 1
+	hash3Mask    = hash3Size - 1
+	fix3HashSize = hash2Size
+	fix4HashSize = hash2Size + hash3Size
+)
+
+// A match is a match of the given length at distance dist + 1.
+type match struct {
+	len  int
+	dist uint32
+}
+
+// A matchFinder holds the data which is being compressed and finds matches
+// in it. Positions are offsets in the uncompressed data.
+type matchFinder struct {
+	buf  []byte // data from position base
+	base int
+
+	readPos   int // position of the next byte to run through the finder
+	readAhead int // number of bytes run through the finder but not encoded
+	readLimit int // position up to which the encoder may read
+	writePos  int // end of the data
+	finish    bool
+	pending   int
+
+	hashBytes   int
+	niceLen     int
+	depth       int
+	hashMask    uint32
+	hash        []uint32
+	son         []uint32
+	cyclicPos   uint32
+	cyclicSize  uint32
+	offset      uint32 // added to positions so that zero is never a position
+	matchLenMax int
+}
+
+func newMatchFinder(opts *Options) *matchFinder {
+	var hs uint32
+	if opts.HashBytes == 2 {
+		hs = 0xffff
+	} else {
+		// round the dictionary size up to the next 2^n - 1
+		hs = opts.DictSize - 1
+		hs |= hs >> 1
+		hs |= hs >> 2
+		hs |= hs >> 4
+		hs |= hs >> 8
+		hs >>= 1
+		hs |= 0xffff
+		if hs > 1<<24 {
+			if opts.HashBytes == 3 {
+				hs = 1<<24 - 1
+			} else {
+				hs >>= 1
+			}
+		}
+	}
+	mf := &matchFinder{
+		hashBytes:   opts.HashBytes,
+		niceLen:     opts.NiceLen,
+		depth:       opts.Depth,
+		hashMask:    hs,
+		cyclicSize:  opts.DictSize + 1,
+		matchLenMax: matchLenMax,
+	}
+	hs++
+	if opts.HashBytes > 2 {
+		hs += hash2Size
+	}
+	if opts.HashBytes > 3 {
+		hs += hash3Size
+	}
+	mf.hash = make([]uint32, hs)
+	mf.son = make([]uint32, mf.cyclicSize)
+	mf.offset = mf.cyclicSize
+	if mf.depth == 0 {
+		mf.depth = 4 + mf.niceLen/4
+	}
+	return mf
+}
+
+// avail returns the number of bytes after the read position.
+func (mf *matchFinder) avail() int {
+	return mf.writePos - mf.readPos
+}
+
+// unencoded returns the number of bytes which have not been encoded.
+func (mf *matchFinder) unencoded() int {
+	return mf.writePos - mf.readPos + mf.readAhead
+}
+
+// position returns the position of the next byte to encode.
+func (mf *matchFinder) position() int {
+	return mf.readPos - mf.readAhead
+}
+
+// at returns the byte at position pos.
+func (mf *matchFinder) at(pos int) byte {
+	return mf.buf[pos-mf.base]
+}
+
+// cmpLen returns the length of the match between the data at positions a and
+// b, which is known to be at least n, up to limit.
+func (mf *matchFinder) cmpLen(a, b, n, limit int) int {
+	a -= mf.base
+	b -= mf.base
+	for n < limit && mf.buf[a+n] == mf.buf[b+n] {
+		n++
+	}
+	return n
+}
+
+// write appends data after the write position.
+func (mf *matchFinder) write(p []byte, keep int) {
+	// drop the data that can no longer be referenced
+	if drop := mf.readPos - mf.readAhead - keep - mf.base; drop > len(mf.buf)/2 && drop > 1<<20 {
+		mf.buf = append(mf.buf[:0], mf.buf[drop:]...)
+		mf.base += drop
+	}
+	mf.buf = append(mf.buf, p...)
+	mf.writePos += len(p)
+}
+
+func (mf *matchFinder) movePos() {
+	mf.cyclicPos++
+	if mf.cyclicPos == mf.cyclicSize {
+		mf.cyclicPos = 0
+	}
+	mf.readPos++
+}
+
+func (mf *matchFinder) movePending() {
+	mf.readPos++
+	mf.pending++
+}
+
+// hashes returns the hash values of the bytes at the read position.
+func (mf *matchFinder) hashes() (h2, h3, h uint32) {
+	cur := mf.buf[mf.readPos-mf.base:]
+	t := crc32.IEEETable
+	temp := t[cur[0]] ^ uint32(cur[1])
+	h2 = temp & hash2Mask
+	if mf.hashBytes == 3 {
+		h = (temp ^ uint32(cur[2])<<8) & mf.hashMask
+		return
+	}
+	h3 = (temp ^ uint32(cur[2])<<8) & hash3Mask
+	h = (temp ^ uint32(cur[2])<<8 ^ t[cur[3]]<<5) & mf.hashMask
+	return
+}
+
+// lenLimit returns the maximum length of a match at the read position, or
+// zero if there are too few bytes left for the hash.
+func (mf *matchFinder) lenLimit() int {
+	limit := mf.avail()
+	if mf.niceLen <= limit {
+		return mf.niceLen
+	}
+	if limit < mf.hashBytes {
+		return 0
+	}
+	return limit
+}
+
+// find finds the matches at the read position, which are stored in matches
+// in increasing order of length, and moves to the next position.
+func (mf *matchFinder) find(matches []match) int {
+	lenLimit := mf.lenLimit()
+	if lenLimit == 0 {
+		mf.movePending()
+		return 0
+	}
+	pos := uint32(mf.readPos) + mf.offset
+	cur := mf.readPos
+	count := 0
+	h2, h3, h := mf.hashes()
+	var curMatch uint32
+	lenBest := 0
+	if mf.hashBytes == 3 {
+		delta2 := pos - mf.hash[h2]
+		curMatch = mf.hash[fix3HashSize+h]
+		mf.hash[h2] = pos
+		mf.hash[fix3HashSize+h] = pos
+		lenBest = 2
+		if delta2 < mf.cyclicSize && mf.at(cur-int(delta2)) == mf.at(cur) {
+			lenBest = mf.cmpLen(cur-int(delta2), cur, lenBest, lenLimit)
+			matches[0] = match{lenBest, delta2 - 1}
+			count = 1
+			if lenBest == lenLimit {
+				mf.son[mf.cyclicPos] = curMatch
+				mf.movePos()
+				return count
+			}
+		}
+	} else {
+		delta2 := pos - mf.hash[h2]
+		delta3 := pos - mf.hash[fix3HashSize+h3]
+		curMatch = mf.hash[fix4HashSize+h]
+		mf.hash[h2] = pos
+		mf.hash[fix3HashSize+h3] = pos
+		mf.hash[fix4HashSize+h] = pos
+		lenBest = 1
+		if delta2 < mf.cyclicSize && mf.at(cur-int(delta2)) == mf.at(cur) {
+			lenBest = 2
+			matches[0] = match{2, delta2 - 1}
+			count = 1
+		}
+		if delta2 != delta3 && delta3 < mf.cyclicSize && mf.at(cur-int(delta3)) == mf.at(cur) {
+			lenBest = 3
+			matches[count].dist = delta3 - 1
+			count++
+			delta2 = delta3
+		}
+		if count != 0 {
+			lenBest = mf.cmpLen(cur-int(delta2), cur, lenBest, lenLimit)
+			matches[count-1].len = lenBest
+			if lenBest == lenLimit {
+				mf.son[mf.cyclicPos] = curMatch
+				mf.movePos()
+				return count
+			}
+		}
+		if lenBest < 3 {
+			lenBest = 3
+		}
+	}
+	count += mf.hcFind(lenLimit, pos, curMatch, lenBest, matches[count:])
+	mf.movePos()
+	return count
+}
+
+// hcFind follows the hash chain from curMatch for matches longer than
+// lenBest.
+func (mf *matchFinder) hcFind(lenLimit int, pos, curMatch uint32, lenBest int, matches []match) int {
+	cur := mf.readPos
+	mf.son[mf.cyclicPos] = curMatch
+	count := 0
+	for depth := mf.depth; ; depth-- {
+		delta := pos - curMatch
+		if depth == 0 || delta >= mf.cyclicSize {
+			return count
+		}
+		pb := cur - int(delta)
+		i := mf.cyclicPos - delta
+		if delta > mf.cyclicPos {
+			i += mf.cyclicSize
+		}
+		curMatch = mf.son[i]
+		if mf.at(pb+lenBest) == mf.at(cur+lenBest) && mf.at(pb) == mf.at(cur) {
+			n := mf.cmpLen(pb, cur, 1, lenLimit)
+			if lenBest < n {
+				lenBest = n
+				matches[count] = match{n, delta - 1}
+				count++
+				if n == lenLimit {
+					return count
+				}
+			}
+		}
+	}
+}
+
+// skip runs amount bytes through the match finder without finding matches.
+func (mf *matchFinder) skip(amount int) {
+	for ; amount > 0; amount-- {
+		if mf.lenLimit() == 0 {
+			mf.movePending()
+			continue
+		}
+		pos := uint32(mf.readPos) + mf.offset
+		h2, h3, h := mf.hashes()
+		var curMatch uint32
+		if mf.hashBytes == 3 {
+			curMatch = mf.hash[fix3HashSize+h]
+			mf.hash[h2] = pos
+			mf.hash[fix3HashSize+h] = pos
+		} else {
+			curMatch = mf.hash[fix4HashSize+h]
+			mf.hash[h2] = pos
+			mf.hash[fix3HashSize+h3] = pos
+			mf.hash[fix4HashSize+h] = pos
+		}
+		mf.son[mf.cyclicPos] = curMatch
+		mf.movePos()
+	}
+}
+
+// mfFind runs the match finder at the read position and returns the length of
+// the longest match, extended beyond the nice length if possible.
+func (mf *matchFinder) mfFind(matches []match) (int, int) {
+	count := mf.find(matches)
+	lenBest := 0
+	if count > 0 {
+		lenBest = matches[count-1].len
+		if lenBest == mf.niceLen {
+			limit := mf.avail() + 1
+			if limit > mf.matchLenMax {
+				limit = mf.matchLenMax
+			}
+			p1 := mf.readPos - 1
+			p2 := p1 - int(matches[count-1].dist) - 1
+			lenBest = mf.cmpLen(p1, p2, lenBest, limit)
+		}
+	}
+	mf.readAhead++
+	return lenBest, count
+}
+
+// mfSkip skips amount bytes which are read ahead.
+func (mf *matchFinder) mfSkip(amount int) {
+	if amount != 0 {
+		mf.skip(amount)
+		mf.readAhead += amount
+	}
+}
@@ -0,0 +1,540 @@
+package liblzma
+
+import "math/bits"
+
+// This file is a port of the range encoder and the LZMA encoder of liblzma in
+// its fast mode.
+
+const (
+	probBits     = 11
+	probInit     = 1 << probBits >> 1
+	moveBits     = 5
+	topValue     = 1 << 24
+	states       = 12
+	posStatesMax = 1 << 4
+	reps         = 4
+
+	matchLenMin   = 2
+	matchLenMax   = 273
+	lenLowBits    = 3
+	lenMidBits    = 3
+	lenHighBits   = 8
+	lenLowSymbols = 1 << lenLowBits
+	lenMidSymbols = 1 << lenMidBits
+
+	distStates     = 4
+	distSlotBits   = 6
+	distModelStart = 4
+	distModelEnd   = 14
+	fullDistances  = 1 << (distModelEnd / 2)
+	alignBits      = 4
+	alignMask      = 1<<alignBits - 1
+)
+
+type prob uint16
+
+// A rangeEncoder encodes bits with adaptive probabilities.
+type rangeEncoder struct {
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize uint64
+	out       []byte
+}
+
+func (rc *rangeEncoder) reset() {
+	rc.low = 0
+	rc.rng = 0xffffffff
+	rc.cache = 0
+	rc.cacheSize = 1
+}
+
+func (rc *rangeEncoder) shiftLow() {
+	if uint32(rc.low) < 0xff000000 || rc.low>>32 != 0 {
+		for {
+			rc.out = append(rc.out, rc.cache+byte(rc.low>>32))
+			rc.cache = 0xff
+			rc.cacheSize--
+			if rc.cacheSize == 0 {
+				break
+			}
+		}
+		rc.cache = byte(rc.low >> 24)
+	}
+	rc.cacheSize++
+	rc.low = (rc.low & 0x00ffffff) << 8
+}
+
+// normalize is done before each bit, as in liblzma, so that the pending size
+// of the encoder matches between bits.
+func (rc *rangeEncoder) normalize() {
+	if rc.rng < topValue {
+		rc.shiftLow()
+		rc.rng <<= 8
+	}
+}
+
+func (rc *rangeEncoder) bit(p *prob, bit uint32) {
+	rc.normalize()
+	bound := (rc.rng >> probBits) * uint32(*p)
+	if bit == 0 {
+		rc.rng = bound
+		*p += (1<<probBits - *p) >> moveBits
+	} else {
+		rc.low += uint64(bound)
+		rc.rng -= bound
+		*p -= *p >> moveBits
+	}
+}
+
+func (rc *rangeEncoder) bitTree(probs []prob, bitCount int, symbol uint32) {
+	m := uint32(1)
+	for bitCount != 0 {
+		bitCount--
+		bit := symbol >> uint(bitCount) & 1
+		rc.bit(&probs[m], bit)
+		m = m<<1 + bit
+	}
+}
+
+func (rc *rangeEncoder) bitTreeReverse(probs []prob, off int, bitCount int, symbol uint32) {
+	m := uint32(1)
+	for ; bitCount != 0; bitCount-- {
+		bit := symbol & 1
+		symbol >>= 1
+		rc.bit(&probs[off+int(m)], bit)
+		m = m<<1 + bit
+	}
+}
+
+func (rc *rangeEncoder) direct(value uint32, bitCount int) {
+	for bitCount != 0 {
+		bitCount--
+		rc.normalize()
+		rc.rng >>= 1
+		if value>>uint(bitCount)&1 != 0 {
+			rc.low += uint64(rc.rng)
+		}
+	}
+}
+
+// flush writes the remaining bytes of the encoder and resets it.
+func (rc *rangeEncoder) flush() {
+	rc.normalize()
+	rc.rng = 0xffffffff
+	for i := 0; i < 5; i++ {
+		rc.shiftLow()
+	}
+	rc.reset()
+}
+
+// pending returns the maximum number of bytes that flush may write.
+func (rc *rangeEncoder) pending() int {
+	return int(rc.cacheSize) + 5 - 1
+}
+
+type lengthEncoder struct {
+	choice  prob
+	choice2 prob
+	low     [posStatesMax][lenLowSymbols]prob
+	mid     [posStatesMax][lenMidSymbols]prob
+	high    [1 << lenHighBits]prob
+}
+
+func (lc *lengthEncoder) reset() {
+	lc.choice, lc.choice2 = probInit, probInit
+	for i := range lc.low {
+		for j := range lc.low[i] {
+			lc.low[i][j] = probInit
+			lc.mid[i][j] = probInit
+		}
+	}
+	for i := range lc.high {
+		lc.high[i] = probInit
+	}
+}
+
+func (lc *lengthEncoder) encode(rc *rangeEncoder, length int, posState uint32) {
+	l := uint32(length - matchLenMin)
+	if l < lenLowSymbols {
+		rc.bit(&lc.choice, 0)
+		rc.bitTree(lc.low[posState][:], lenLowBits, l)
+		return
+	}
+	rc.bit(&lc.choice, 1)
+	l -= lenLowSymbols
+	if l < lenMidSymbols {
+		rc.bit(&lc.choice2, 0)
+		rc.bitTree(lc.mid[posState][:], lenMidBits, l)
+		return
+	}
+	rc.bit(&lc.choice2, 1)
+	rc.bitTree(lc.high[:], lenHighBits, l-lenMidSymbols)
+}
+
+// An lzmaEncoder encodes literals and matches found by the fast optimizer.
+type lzmaEncoder struct {
+	rc    rangeEncoder
+	state int
+	reps  [reps]uint32
+
+	isMatch     [states][posStatesMax]prob
+	isRep       [states]prob
+	isRep0      [states]prob
+	isRep1      [states]prob
+	isRep2      [states]prob
+	isRep0Long  [states][posStatesMax]prob
+	literal     [][0x300]prob
+	distSlot    [distStates][1 << distSlotBits]prob
+	distSpecial [fullDistances - distModelEnd]prob
+	distAlign   [1 << alignBits]prob
+	matchLen    lengthEncoder
+	repLen      lengthEncoder
+
+	lc          uint
+	lpMask      int
+	posMask     int
+	initialized bool
+
+	matches            [matchLenMax + 1]match
+	matchesCount       int
+	longestMatchLength int
+}
+
+func newLZMAEncoder(opts *Options) *lzmaEncoder {
+	e := &lzmaEncoder{
+		lc:      uint(opts.LC),
+		lpMask:  1<<uint(opts.LP) - 1,
+		posMask: 1<<uint(opts.PB) - 1,
+		literal: make([][0x300]prob, 1<<uint(opts.LC+opts.LP)),
+	}
+	e.reset()
+	return e
+}
+
+// reset resets the state and the probabilities of the encoder.
+func (e *lzmaEncoder) reset() {
+	e.rc.reset()
+	e.state = 0
+	e.reps = [reps]uint32{}
+	for i := range e.isMatch {
+		for j := range e.isMatch[i] {
+			e.isMatch[i][j] = probInit
+			e.isRep0Long[i][j] = probInit
+		}
+		e.isRep[i] = probInit
+		e.isRep0[i] = probInit
+		e.isRep1[i] = probInit
+		e.isRep2[i] = probInit
+	}
+	for i := range e.literal {
+		for j := range e.literal[i] {
+			e.literal[i][j] = probInit
+		}
+	}
+	for i := range e.distSlot {
+		for j := range e.distSlot[i] {
+			e.distSlot[i][j] = probInit
+		}
+	}
+	for i := range e.distSpecial {
+		e.distSpecial[i] = probInit
+	}
+	for i := range e.distAlign {
+		e.distAlign[i] = probInit
+	}
+	e.matchLen.reset()
+	e.repLen.reset()
+}
+
+func updateLiteral(state int) int {
+	switch {
+	case state < 4:
+		return 0
+	case state < 10:
+		return state - 3
+	}
+	return state - 6
+}
+
+func updateMatch(state int) int {
+	if state < 7 {
+		return 7
+	}
+	return 10
+}
+
+func updateLongRep(state int) int {
+	if state < 7 {
+		return 8
+	}
+	return 11
+}
+
+func updateShortRep(state int) int {
+	if state < 7 {
+		return 9
+	}
+	return 11
+}
+
+func distSlot(dist uint32) uint32 {
+	if dist < 4 {
+		return dist
+	}
+	n := uint32(bits.Len32(dist)) - 1
+	return 2*n + dist>>(n-1)&1
+}
+
+// encodeInit encodes the first byte, which is always a literal. It reports
+// false if there is no input yet.
+func (e *lzmaEncoder) encodeInit(mf *matchFinder) bool {
+	if mf.readPos == mf.readLimit {
+		if !mf.finish {
+			return false
+		}
+	} else {
+		mf.mfSkip(1)
+		mf.readAhead = 0
+		e.rc.bit(&e.isMatch[0][0], 0)
+		e.rc.bitTree(e.literal[0][:], 8, uint32(mf.at(0)))
+	}
+	e.initialized = true
+	return true
+}
+
+// encode encodes symbols until the input is exhausted, the read position
+// reaches limit, or the output approaches the maximum size of an LZMA2
+// chunk. It reports whether the chunk was finished, in which case the range
+// encoder has been flushed.
+func (e *lzmaEncoder) encode(mf *matchFinder, limit int) bool {
+	if !e.initialized && !e.encodeInit(mf) {
+		return false
+	}
+	position := mf.position()
+	for {
+		if mf.readPos-mf.readAhead >= limit || len(e.rc.out)+e.rc.pending() >= lzma2ChunkMax-loopInputMax {
+			break
+		}
+		if mf.readPos >= mf.readLimit {
+			if !mf.finish {
+				return false
+			}
+			if mf.readAhead == 0 {
+				break
+			}
+		}
+		back, length := e.optimumFast(mf)
+		e.encodeSymbol(mf, back, length, position)
+		position += length
+	}
+	e.rc.flush()
+	return true
+}
+
+const noBack = ^uint32(0)
+
+func (e *lzmaEncoder) encodeSymbol(mf *matchFinder, back uint32, length int, position int) {
+	posState := uint32(position & e.posMask)
+	if back == noBack {
+		e.rc.bit(&e.isMatch[e.state][posState], 0)
+		e.encodeLiteral(mf, position)
+	} else {
+		e.rc.bit(&e.isMatch[e.state][posState], 1)
+		if back < reps {
+			e.rc.bit(&e.isRep[e.state], 1)
+			e.encodeRepMatch(posState, back, length)
+		} else {
+			e.rc.bit(&e.isRep[e.state], 0)
+			e.encodeMatch(posState, back-reps, length)
+		}
+	}
+	mf.readAhead -= length
+}
+
+func (e *lzmaEncoder) encodeLiteral(mf *matchFinder, position int) {
+	cur := mf.readPos - mf.readAhead
+	b := uint32(mf.at(cur))
+	prev := mf.at(cur - 1)
+	probs := e.literal[(position&e.lpMask)<<e.lc+int(prev>>(8-e.lc))][:]
+	if e.state < 7 {
+		e.rc.bitTree(probs, 8, b)
+	} else {
+		// encode with the byte following the last match
+		matchByte := uint32(mf.at(cur - int(e.reps[0]) - 1))
+		offset := uint32(0x100)
+		symbol := b | 1<<8
+		for symbol < 1<<16 {
+			matchByte <<= 1
+			matchBit := matchByte & offset
+			e.rc.bit(&probs[offset+matchBit+symbol>>8], symbol>>7&1)
+			symbol <<= 1
+			offset &^= matchByte ^ symbol
+		}
+	}
+	e.state = updateLiteral(e.state)
+}
+
+func (e *lzmaEncoder) encodeMatch(posState, dist uint32, length int) {
+	e.state = updateMatch(e.state)
+	e.matchLen.encode(&e.rc, length, posState)
+	slot := distSlot(dist)
+	distState := length - matchLenMin
+	if distState >= distStates {
+		distState = distStates - 1
+	}
+	e.rc.bitTree(e.distSlot[distState][:], distSlotBits, slot)
+	if slot >= distModelStart {
+		footerBits := int(slot>>1) - 1
+		base := (2 | slot&1) << uint(footerBits)
+		reduced := dist - base
+		if slot < distModelEnd {
+			e.rc.bitTreeReverse(e.distSpecial[:], int(base)-int(slot)-1, footerBits, reduced)
+		} else {
+			e.rc.direct(reduced>>alignBits, footerBits-alignBits)
+			e.rc.bitTreeReverse(e.distAlign[:], 0, alignBits, reduced&alignMask)
+		}
+	}
+	e.reps[3] = e.reps[2]
+	e.reps[2] = e.reps[1]
+	e.reps[1] = e.reps[0]
+	e.reps[0] = dist
+}
+
+func (e *lzmaEncoder) encodeRepMatch(posState, rep uint32, length int) {
+	if rep == 0 {
+		e.rc.bit(&e.isRep0[e.state], 0)
+		var long uint32
+		if length != 1 {
+			long = 1
+		}
+		e.rc.bit(&e.isRep0Long[e.state][posState], long)
+	} else {
+		dist := e.reps[rep]
+		e.rc.bit(&e.isRep0[e.state], 1)
+		if rep == 1 {
+			e.rc.bit(&e.isRep1[e.state], 0)
+		} else {
+			e.rc.bit(&e.isRep1[e.state], 1)
+			e.rc.bit(&e.isRep2[e.state], rep-2)
+			if rep == 3 {
+				e.reps[3] = e.reps[2]
+			}
+			e.reps[2] = e.reps[1]
+		}
+		e.reps[1] = e.reps[0]
+		e.reps[0] = dist
+	}
+	if length == 1 {
+		e.state = updateShortRep(e.state)
+	} else {
+		e.repLen.encode(&e.rc, length, posState)
+		e.state = updateLongRep(e.state)
+	}
+}
+
+// changePair reports whether a match at bigDist is so much more distant than
+// one at smallDist that a match one byte shorter at smallDist is better.
+func changePair(smallDist, bigDist uint32) bool {
+	return bigDist>>7 > smallDist
+}
+
+// optimumFast chooses the next symbol to encode: a literal, if back is
+// noBack, a repeated match of one of the last distances, if back is less than
+// reps, or a match at distance back - reps + 1.
+func (e *lzmaEncoder) optimumFast(mf *matchFinder) (back uint32, length int) {
+	niceLen := mf.niceLen
+	var lenMain, matchesCount int
+	if mf.readAhead == 0 {
+		lenMain, matchesCount = mf.mfFind(e.matches[:])
+	} else {
+		lenMain = e.longestMatchLength
+		matchesCount = e.matchesCount
+	}
+
+	buf := mf.readPos - 1
+	bufAvail := mf.avail() + 1
+	if bufAvail > matchLenMax {
+		bufAvail = matchLenMax
+	}
+	if bufAvail < 2 {
+		return noBack, 1
+	}
+
+	// look for repeated matches
+	repLen, repIndex := 0, 0
+	for i := 0; i < reps; i++ {
+		back := buf - int(e.reps[i]) - 1
+		if mf.at(buf) != mf.at(back) || mf.at(buf+1) != mf.at(back+1) {
+			continue
+		}
+		n := mf.cmpLen(buf, back, 2, bufAvail)
+		if n >= niceLen {
+			mf.mfSkip(n - 1)
+			return uint32(i), n
+		}
+		if n > repLen {
+			repIndex, repLen = i, n
+		}
+	}
+
+	if lenMain >= niceLen {
+		mf.mfSkip(lenMain - 1)
+		return e.matches[matchesCount-1].dist + reps, lenMain
+	}
+
+	var backMain uint32
+	if lenMain >= 2 {
+		backMain = e.matches[matchesCount-1].dist
+		for matchesCount > 1 && lenMain == e.matches[matchesCount-2].len+1 {
+			if !changePair(e.matches[matchesCount-2].dist, backMain) {
+				break
+			}
+			matchesCount--
+			lenMain = e.matches[matchesCount-1].len
+			backMain = e.matches[matchesCount-1].dist
+		}
+		if lenMain == 2 && backMain >= 0x80 {
+			lenMain = 1
+		}
+	}
+
+	if repLen >= 2 {
+		if repLen+1 >= lenMain ||
+			repLen+2 >= lenMain && backMain > 1<<9 ||
+			repLen+3 >= lenMain && backMain > 1<<15 {
+			mf.mfSkip(repLen - 1)
+			return uint32(repIndex), repLen
+		}
+	}
+
+	if lenMain < 2 || bufAvail <= 2 {
+		return noBack, 1
+	}
+
+	// Get the matches for the next byte. If there is a better match, the
+	// current byte is encoded as a literal.
+	e.longestMatchLength, e.matchesCount = mf.mfFind(e.matches[:])
+	if e.longestMatchLength >= 2 {
+		newDist := e.matches[e.matchesCount-1].dist
+		if e.longestMatchLength >= lenMain && newDist < backMain ||
+			e.longestMatchLength == lenMain+1 && !changePair(backMain, newDist) ||
+			e.longestMatchLength > lenMain+1 ||
+			e.longestMatchLength+1 >= lenMain && lenMain >= 3 && changePair(newDist, backMain) {
+			return noBack, 1
+		}
+	}
+
+	buf++
+	limit := lenMain - 1
+	if limit < 2 {
+		limit = 2
+	}
+	for i := 0; i < reps; i++ {
+		if mf.cmpLen(buf, buf-int(e.reps[i])-1, 0, limit) == limit {
+			return noBack, 1
+		}
+	}
+	mf.mfSkip(lenMain - 2)
+	return backMain + reps, lenMain
+}
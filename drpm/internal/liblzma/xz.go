@@ -0,0 +1,367 @@
+// Package liblzma implements the xz compressor of the liblzma library in its
+// fast mode.
+//
+// Unlike other implementations of xz, the output is identical to that of
+// liblzma for the same input and options, so that the xz compressed payloads
+// of rpm packages may be reproduced byte for byte. Only the fast mode of the
+// LZMA2 encoder, which liblzma uses for presets 0 to 3, is implemented, and
+// streams have a single block, as written by the single-threaded encoder.
+package liblzma
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+// Check types of the xz format.
+const (
+	CheckNone   = 0x00
+	CheckCRC32  = 0x01
+	CheckCRC64  = 0x04
+	CheckSHA256 = 0x0a
+)
+
+// Options are the options of the LZMA2 encoder, as in lzma_options_lzma, and
+// the check type of the stream.
+type Options struct {
+	DictSize  uint32
+	LC        int
+	LP        int
+	PB        int
+	HashBytes int // 3 or 4 for the HC3 or HC4 match finder
+	NiceLen   int
+	Depth     int // maximum search depth, or zero for the default
+	Check     byte
+}
+
+// Preset returns the options of the given preset level, from 0 to 3, and
+// check type, as in lzma_easy_encoder.
+func Preset(level int, check byte) (Options, error) {
+	if level < 0 || level > 3 {
+		return Options{}, fmt.Errorf("liblzma: unsupported preset: %d", level)
+	}
+	opts := Options{
+		DictSize:  1 << []uint{18, 20, 21, 22}[level],
+		LC:        3,
+		LP:        0,
+		PB:        2,
+		HashBytes: 4,
+		NiceLen:   273,
+		Depth:     []int{4, 8, 24, 48}[level],
+		Check:     check,
+	}
+	if level == 0 {
+		opts.HashBytes = 3
+	}
+	if level <= 1 {
+		opts.NiceLen = 128
+	}
+	return opts, nil
+}
+
+func (opts *Options) validate() error {
+	switch {
+	case opts.DictSize < 4096 || opts.DictSize > 1<<30+1<<29:
+		return fmt.Errorf("liblzma: unsupported dictionary size: %d", opts.DictSize)
+	case opts.LC < 0 || opts.LP < 0 || opts.LC+opts.LP > 4 || opts.PB < 0 || opts.PB > 4:
+		return fmt.Errorf("liblzma: unsupported lc, lp or pb: %d, %d, %d", opts.LC, opts.LP, opts.PB)
+	case opts.HashBytes != 3 && opts.HashBytes != 4:
+		return fmt.Errorf("liblzma: unsupported match finder: hc%d", opts.HashBytes)
+	case opts.NiceLen < opts.HashBytes || opts.NiceLen > matchLenMax:
+		return fmt.Errorf("liblzma: unsupported nice length: %d", opts.NiceLen)
+	case opts.Depth < 0:
+		return fmt.Errorf("liblzma: unsupported depth: %d", opts.Depth)
+	}
+	if checkSize(opts.Check) < 0 {
+		return fmt.Errorf("liblzma: unsupported check: %d", opts.Check)
+	}
+	return nil
+}
+
+func checkSize(check byte) int {
+	switch check {
+	case CheckNone:
+		return 0
+	case CheckCRC32:
+		return 4
+	case CheckCRC64:
+		return 8
+	case CheckSHA256:
+		return 32
+	}
+	return -1
+}
+
+const (
+	lzma2ChunkMax        = 1 << 16
+	lzma2UncompressedMax = 1 << 21
+	loopInputMax         = 1<<12 + 1
+)
+
+// A Writer compresses data written to it as an xz stream.
+type Writer struct {
+	w    io.Writer
+	opts Options
+	mf   *matchFinder
+	lzma *lzmaEncoder
+	err  error
+
+	check         hash.Hash
+	size          int64 // uncompressed size
+	blockSize     int64 // size of the block data
+	headerSize    int
+	needProps     bool
+	needReset     bool
+	needDictReset bool
+	inChunk       bool
+	chunkSize     int // uncompressed size of the current chunk
+	closed        bool
+}
+
+// NewWriter returns a Writer that compresses data written to it with the
+// given options and writes the xz stream to w.
+func NewWriter(w io.Writer, opts Options) (*Writer, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	z := &Writer{
+		w:             w,
+		opts:          opts,
+		mf:            newMatchFinder(&opts),
+		lzma:          newLZMAEncoder(&opts),
+		needProps:     true,
+		needReset:     true,
+		needDictReset: true,
+	}
+	switch opts.Check {
+	case CheckCRC32:
+		z.check = crc32.NewIEEE()
+	case CheckCRC64:
+		z.check = crc64.New(crc64.MakeTable(crc64.ECMA))
+	case CheckSHA256:
+		z.check = sha256.New()
+	}
+	flags := []byte{0, opts.Check}
+	header := append([]byte{0xfd, '7', 'z', 'X', 'Z', 0}, flags...)
+	header = appendUint32(header, crc32.ChecksumIEEE(flags))
+	z.write(header)
+	return z, z.err
+}
+
+func (z *Writer) write(p []byte) {
+	if z.err == nil {
+		_, z.err = z.w.Write(p)
+	}
+}
+
+// Write compresses p. Compressed chunks are written as they are completed.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, fmt.Errorf("liblzma: write to closed writer")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if z.size == 0 {
+		z.writeBlockHeader()
+	}
+	z.size += int64(len(p))
+	if z.check != nil {
+		z.check.Write(p)
+	}
+	z.mf.write(p, int(z.opts.DictSize)+lzma2UncompressedMax)
+
+	// Keep enough data after the read position for the longest match and
+	// for the data read ahead, as the encoder of liblzma does when it is not
+	// finishing.
+	if limit := z.mf.writePos - (loopInputMax + matchLenMax); limit > z.mf.readLimit {
+		z.mf.readLimit = limit
+	}
+	z.encode()
+	return len(p), z.err
+}
+
+// Close compresses any pending input and writes the end of the stream. It
+// does not close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed || z.err != nil {
+		return z.err
+	}
+	z.closed = true
+	var records []byte
+	if z.size > 0 {
+		z.mf.finish = true
+		z.mf.readLimit = z.mf.writePos
+		z.encode()
+
+		// end of the LZMA2 data, block padding and check
+		z.write([]byte{0})
+		z.blockSize++
+		if pad := (4 - z.blockSize%4) % 4; pad > 0 {
+			z.write(make([]byte, pad))
+		}
+		if z.check != nil {
+			// CRC32 and CRC64 are stored in little-endian order
+			sum := z.check.Sum(nil)
+			if z.opts.Check != CheckSHA256 {
+				for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+					sum[i], sum[j] = sum[j], sum[i]
+				}
+			}
+			z.write(sum)
+		}
+		unpadded := int64(z.headerSize) + z.blockSize + int64(checkSize(z.opts.Check))
+		records = appendVLI(records, uint64(unpadded))
+		records = appendVLI(records, uint64(z.size))
+	}
+
+	// index
+	index := []byte{0}
+	if z.size > 0 {
+		index = appendVLI(index, 1)
+	} else {
+		index = appendVLI(index, 0)
+	}
+	index = append(index, records...)
+	for len(index)%4 != 0 {
+		index = append(index, 0)
+	}
+	index = appendUint32(index, crc32.ChecksumIEEE(index))
+	z.write(index)
+
+	// footer
+	footer := appendUint32(nil, uint32(len(index)/4-1))
+	footer = append(footer, 0, z.opts.Check)
+	footer = append(appendUint32(nil, crc32.ChecksumIEEE(footer)), footer...)
+	footer = append(footer, 'Y', 'Z')
+	z.write(footer)
+	return z.err
+}
+
+func (z *Writer) writeBlockHeader() {
+	header := []byte{0, 0, 0x21, 1, dictSizeProp(z.opts.DictSize)}
+	for (len(header)+4)%4 != 0 {
+		header = append(header, 0)
+	}
+	header[0] = byte((len(header)+4)/4 - 1)
+	header = appendUint32(header, crc32.ChecksumIEEE(header))
+	z.headerSize = len(header)
+	z.write(header)
+}
+
+// dictSizeProp encodes the dictionary size of LZMA2, rounded up to 2^n or
+// 2^n + 2^(n-1).
+func dictSizeProp(size uint32) byte {
+	if size < 4096 {
+		size = 4096
+	}
+	d := size - 1
+	d |= d >> 2
+	d |= d >> 3
+	d |= d >> 4
+	d |= d >> 8
+	d |= d >> 16
+	if d == 0xffffffff {
+		return 40
+	}
+	return byte(distSlot(d+1) - 24)
+}
+
+// encode encodes LZMA2 chunks as far as the input allows.
+func (z *Writer) encode() {
+	mf := z.mf
+	for z.err == nil {
+		if !z.inChunk {
+			if mf.unencoded() == 0 {
+				return
+			}
+			if z.needReset {
+				z.lzma.reset()
+			}
+			z.chunkSize = 0
+			z.lzma.rc.out = z.lzma.rc.out[:0]
+			z.inChunk = true
+		}
+
+		left := lzma2UncompressedMax - z.chunkSize
+		limit := 0
+		if left >= mf.matchLenMax {
+			limit = mf.readPos - mf.readAhead + left - mf.matchLenMax
+		}
+		readStart := mf.readPos - mf.readAhead
+		done := z.lzma.encode(mf, limit)
+		z.chunkSize += mf.readPos - mf.readAhead - readStart
+		if !done {
+			return
+		}
+		z.inChunk = false
+
+		compressed := z.lzma.rc.out
+		if len(compressed) >= z.chunkSize {
+			// store the chunk uncompressed
+			z.chunkSize += mf.readAhead
+			mf.readAhead = 0
+			control := byte(2)
+			if z.needDictReset {
+				control = 1
+			}
+			z.needDictReset = false
+			z.needReset = true
+			n := z.chunkSize - 1
+			z.write([]byte{control, byte(n >> 8), byte(n)})
+			end := mf.readPos - mf.base
+			z.write(mf.buf[end-z.chunkSize : end])
+			z.blockSize += 3 + int64(z.chunkSize)
+			continue
+		}
+
+		var header []byte
+		switch {
+		case z.needProps && z.needDictReset:
+			header = []byte{0x80 + 3<<5}
+		case z.needProps:
+			header = []byte{0x80 + 2<<5}
+		case z.needReset:
+			header = []byte{0x80 + 1<<5}
+		default:
+			header = []byte{0x80}
+		}
+		z.needDictReset = false
+		n := z.chunkSize - 1
+		header[0] += byte(n >> 16)
+		header = append(header, byte(n>>8), byte(n))
+		n = len(compressed) - 1
+		header = append(header, byte(n>>8), byte(n))
+		if z.needProps {
+			header = append(header, byte((z.opts.PB*5+z.opts.LP)*9+z.opts.LC))
+		}
+		z.needProps = false
+		z.needReset = false
+		z.write(header)
+		z.write(compressed)
+		z.blockSize += int64(len(header) + len(compressed))
+	}
+}
+
+// appendVLI appends the variable length integer encoding of x.
+func appendVLI(b []byte, x uint64) []byte {
+	for x >= 0x80 {
+		b = append(b, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(b, byte(x))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,121 @@
+package liblzma
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/ulikunitz/xz"
+)
+
+// el6Options are the options of xz level 2 in the payloads of EL6 packages.
+var el6Options = Options{
+	DictSize:  1 << 19,
+	LC:        3,
+	PB:        2,
+	HashBytes: 4,
+	NiceLen:   32,
+	Depth:     16,
+	Check:     CheckSHA256,
+}
+
+// readPayload returns the compressed payload of the rpm file with the given
+// name and its uncompressed data.
+func readPayload(t *testing.T, name string) ([]byte, []byte) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := rpm.Read(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, end := pkg.HeaderRange()
+	zr, err := xz.NewReader(bytes.NewReader(b[end:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b[end:], data
+}
+
+func TestWriterPayloads(t *testing.T) {
+	preset, err := Preset(2, CheckSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Name    string
+		Options Options
+	}{
+		{"centos-release-6-0.el6.centos.5.i686.rpm", el6Options},
+		{"centos-release-6-0.el6.centos.5.x86_64.rpm", el6Options},
+		{"centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm", preset},
+		{"epel-release-7-5.noarch.rpm", preset},
+	}
+	for _, test := range tests {
+		expect, data := readPayload(t, "../../../testdata/"+test.Name)
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, test.Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect) {
+			t.Errorf("Expected payload of %s to be reproduced", test.Name)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 1<<17)
+	rnd.Read(random)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 50000)
+	mixed := append(append(append([]byte(nil), text[:70000]...), random[:30000]...), text...)
+	checks := []byte{CheckNone, CheckCRC32, CheckCRC64, CheckSHA256}
+	for _, data := range [][]byte{nil, []byte("a"), random, text, mixed} {
+		for level := 0; level <= 3; level++ {
+			opts, err := Preset(level, checks[level])
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			zr, err := xz.NewReader(&buf)
+			if err != nil {
+				t.Errorf("Error reading %d bytes at level %d: %v", len(data), level, err)
+				continue
+			}
+			actual, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Errorf("Error decompressing %d bytes at level %d: %v", len(data), level, err)
+			} else if !bytes.Equal(actual, data) {
+				t.Errorf("Expected %d bytes at level %d to be decompressed, got: %d", len(data), level, len(actual))
+			}
+		}
+	}
+
+	if _, err := Preset(4, CheckSHA256); err == nil {
+		t.Errorf("Expected error for preset 4")
+	}
+}
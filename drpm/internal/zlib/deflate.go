@@ -0,0 +1,529 @@
+// Package zlib implements the deflate compressor of the zlib library.
+//
+// Unlike compress/flate, the output is identical to that of zlib for the same
+// input and compression level, so that the compressed payloads of rpm packages
+// may be reproduced byte for byte. Only the default window size, memory level
+// and strategy are supported. The rsyncable variant, which rpm used on some
+// distributions, restarts blocks at boundaries that depend only on the nearby
+// input.
+package zlib
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	wSize        = 1 << 15
+	wMask        = wSize - 1
+	windowSize   = 2 * wSize
+	hashBits     = 15
+	hashSize     = 1 << hashBits
+	hashMask     = hashSize - 1
+	hashShift    = (hashBits + minMatch - 1) / minMatch
+	litBufSize   = 1 << 14
+	minMatch     = 3
+	maxMatch     = 258
+	minLookahead = maxMatch + minMatch + 1
+	maxDist      = wSize - minLookahead
+	tooFar       = 4096
+	winInit      = maxMatch
+
+	// rsyncWindow is the size of the rolling checksum of the rsyncable
+	// variant, which ends a block when the sum is a multiple of its size.
+	rsyncWindow = 4096
+)
+
+// A config holds the parameters of a compression level.
+type config struct {
+	goodLength int // reduce lazy search above this match length
+	maxLazy    int // do not perform lazy search above this match length
+	niceLength int // quit search above this match length
+	maxChain   int
+}
+
+var configs = [10]config{
+	{0, 0, 0, 0},
+	{4, 4, 8, 4},
+	{4, 5, 16, 8},
+	{4, 6, 32, 32},
+	{4, 4, 16, 16},
+	{8, 16, 32, 32},
+	{8, 16, 128, 128},
+	{8, 32, 128, 256},
+	{32, 128, 258, 1024},
+	{32, 258, 258, 4096},
+}
+
+// A symbol is a literal, if dist is zero, or a match.
+type symbol struct {
+	dist uint16
+	lc   uint8
+}
+
+// A deflater holds the state of the compressor, as in the deflate_state of
+// zlib.
+type deflater struct {
+	in  []byte // pending input
+	out []byte // pending output
+
+	window     [windowSize]byte
+	prev       [wSize]uint16
+	head       [hashSize]uint16
+	insH       int
+	highWater  int
+	blockStart int
+	strStart   int
+	lookahead  int
+	insert     int
+
+	matchLength    int
+	prevMatch      int
+	matchAvailable bool
+	matchStart     int
+	prevLength     int
+
+	level      int
+	cfg        config
+	rsync      bool
+	rsyncSum   uint32
+	rsyncPos   int // window position of the next byte to add to rsyncSum
+	rsyncCount int // number of bytes added to rsyncSum
+	rsyncEnd   int // position of the pending chunk boundary, or -1
+
+	dynLTree  [heapSize]node
+	dynDTree  [2*dCodes + 1]node
+	blTree    [2*blCodes + 1]node
+	lDesc     treeDesc
+	dDesc     treeDesc
+	blDesc    treeDesc
+	blCount   [maxBits + 1]int
+	heap      [2*lCodes + 1]int
+	heapLen   int
+	heapMax   int
+	depth     [2*lCodes + 1]uint8
+	syms      []symbol
+	optLen    uint64
+	staticLen uint64
+
+	bitBuf   uint64
+	bitCount uint
+}
+
+// A Writer compresses data written to it as a raw deflate stream.
+type Writer struct {
+	w      io.Writer
+	s      *deflater
+	err    error
+	closed bool
+}
+
+// NewWriter returns a Writer that compresses data written to it at the given
+// level, from 1 to 9, and writes the raw deflate stream to w. If rsyncable is
+// true, the rsyncable variant of the compressor is used.
+func NewWriter(w io.Writer, level int, rsyncable bool) (*Writer, error) {
+	if level < 1 || level > 9 {
+		return nil, fmt.Errorf("zlib: unsupported compression level: %d", level)
+	}
+	s := &deflater{
+		level:    level,
+		cfg:      configs[level],
+		rsync:    rsyncable,
+		rsyncEnd: -1,
+		syms:     make([]symbol, 0, litBufSize),
+	}
+	s.matchLength = minMatch - 1
+	s.prevLength = minMatch - 1
+	s.initTrees()
+	return &Writer{w: w, s: s}, nil
+}
+
+// Write compresses p. Output is written as complete blocks are compressed.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, fmt.Errorf("zlib: write to closed writer")
+	}
+	z.s.in = append(z.s.in, p...)
+	z.s.deflate(false)
+	z.flush()
+	return len(p), z.err
+}
+
+// Close compresses any pending input and writes the final block. It does not
+// close the underlying writer.
+func (z *Writer) Close() error {
+	if z.closed || z.err != nil {
+		return z.err
+	}
+	z.closed = true
+	z.s.deflate(true)
+	z.flush()
+	return z.err
+}
+
+func (z *Writer) flush() {
+	if z.err == nil && len(z.s.out) > 0 {
+		_, z.err = z.w.Write(z.s.out)
+	}
+	z.s.out = z.s.out[:0]
+}
+
+// deflate compresses as much of the pending input as possible, or all of it
+// if finish is true.
+func (s *deflater) deflate(finish bool) {
+	if s.level <= 3 {
+		s.deflateFast(finish)
+	} else {
+		s.deflateSlow(finish)
+	}
+}
+
+func (s *deflater) updateHash(h int, c byte) int {
+	return (h<<hashShift ^ int(c)) & hashMask
+}
+
+// insertString inserts the string at str in the dictionary and returns the
+// previous head of its hash chain.
+func (s *deflater) insertString(str int) int {
+	s.insH = s.updateHash(s.insH, s.window[str+minMatch-1])
+	head := int(s.head[s.insH])
+	s.prev[str&wMask] = uint16(head)
+	s.head[s.insH] = uint16(str)
+	return head
+}
+
+// slideHash moves the positions in the hash chains down by wSize.
+func (s *deflater) slideHash() {
+	for i, m := range s.head {
+		if int(m) >= wSize {
+			s.head[i] = m - wSize
+		} else {
+			s.head[i] = 0
+		}
+	}
+	for i, m := range s.prev {
+		if int(m) >= wSize {
+			s.prev[i] = m - wSize
+		} else {
+			s.prev[i] = 0
+		}
+	}
+}
+
+// fillWindow reads new input into the window when the lookahead is
+// insufficient, sliding the window down when its upper half is reached.
+func (s *deflater) fillWindow() {
+	for {
+		more := windowSize - s.lookahead - s.strStart
+		if s.strStart >= wSize+maxDist {
+			copy(s.window[:wSize-more], s.window[wSize:])
+			s.matchStart -= wSize
+			s.strStart -= wSize
+			s.blockStart -= wSize
+			s.rsyncPos -= wSize
+			if s.rsyncEnd >= 0 {
+				s.rsyncEnd -= wSize
+			}
+			if s.insert > s.strStart {
+				s.insert = s.strStart
+			}
+			s.slideHash()
+			more += wSize
+		}
+		if len(s.in) == 0 {
+			break
+		}
+		n := copy(s.window[s.strStart+s.lookahead:s.strStart+s.lookahead+more], s.in)
+		s.in = s.in[n:]
+		s.lookahead += n
+
+		if s.lookahead+s.insert >= minMatch {
+			str := s.strStart - s.insert
+			s.insH = int(s.window[str])
+			s.insH = s.updateHash(s.insH, s.window[str+1])
+			for s.insert > 0 {
+				s.insH = s.updateHash(s.insH, s.window[str+minMatch-1])
+				s.prev[str&wMask] = s.head[s.insH]
+				s.head[s.insH] = uint16(str)
+				str++
+				s.insert--
+				if s.lookahead+s.insert < minMatch {
+					break
+				}
+			}
+		}
+		if s.lookahead >= minLookahead || len(s.in) == 0 {
+			break
+		}
+	}
+
+	// zlib initializes the bytes after the input that longest match may read,
+	// so that they are not used uninitialized. They are zero here already, but
+	// the high water mark is kept since a slide does not clear them.
+	if s.highWater < windowSize {
+		curr := s.strStart + s.lookahead
+		if s.highWater < curr {
+			init := windowSize - curr
+			if init > winInit {
+				init = winInit
+			}
+			for i := curr; i < curr+init; i++ {
+				s.window[i] = 0
+			}
+			s.highWater = curr + init
+		} else if s.highWater < curr+winInit {
+			init := curr + winInit - s.highWater
+			if init > windowSize-s.highWater {
+				init = windowSize - s.highWater
+			}
+			for i := s.highWater; i < s.highWater+init; i++ {
+				s.window[i] = 0
+			}
+			s.highWater += init
+		}
+	}
+}
+
+// longestMatch returns the length of the longest match at strStart in the
+// hash chain starting at curMatch, and sets matchStart to its position.
+func (s *deflater) longestMatch(curMatch int) int {
+	chainLength := s.cfg.maxChain
+	scan := s.strStart
+	bestLen := s.prevLength
+	niceMatch := s.cfg.niceLength
+	limit := 0
+	if s.strStart > maxDist {
+		limit = s.strStart - maxDist
+	}
+	strEnd := s.strStart + maxMatch
+	w := s.window[:]
+	scanEnd1 := w[scan+bestLen-1]
+	scanEnd := w[scan+bestLen]
+
+	if s.prevLength >= s.cfg.goodLength {
+		chainLength >>= 2
+	}
+	if niceMatch > s.lookahead {
+		niceMatch = s.lookahead
+	}
+	for {
+		match := curMatch
+		if w[match+bestLen] == scanEnd && w[match+bestLen-1] == scanEnd1 &&
+			w[match] == w[scan] && w[match+1] == w[scan+1] {
+			i, j := scan+2, match+2
+			for i < strEnd && w[i] == w[j] {
+				i++
+				j++
+			}
+			length := i - scan
+			if length > bestLen {
+				s.matchStart = curMatch
+				bestLen = length
+				if length >= niceMatch {
+					break
+				}
+				scanEnd1 = w[scan+bestLen-1]
+				scanEnd = w[scan+bestLen]
+			}
+		}
+		curMatch = int(s.prev[curMatch&wMask])
+		if curMatch <= limit {
+			break
+		}
+		chainLength--
+		if chainLength == 0 {
+			break
+		}
+	}
+	if bestLen <= s.lookahead {
+		return bestLen
+	}
+	return s.lookahead
+}
+
+// rsyncRoll adds the bytes before end to the rolling checksum of the
+// rsyncable variant, and records the first position since the last chunk
+// boundary at which the checksum of the preceding window is a multiple of its
+// size.
+func (s *deflater) rsyncRoll(end int) {
+	for ; s.rsyncPos < end; s.rsyncPos++ {
+		s.rsyncSum += uint32(s.window[s.rsyncPos])
+		s.rsyncCount++
+		if s.rsyncCount <= rsyncWindow {
+			continue // before the window fills
+		}
+		s.rsyncSum -= uint32(s.window[s.rsyncPos-rsyncWindow])
+		if s.rsyncEnd < 0 && s.rsyncSum%rsyncWindow == 0 {
+			s.rsyncEnd = s.rsyncPos
+		}
+	}
+}
+
+// rsyncBoundary reports whether the symbols emitted so far, which end at
+// strStart, cover the end of a chunk of the rsyncable variant.
+func (s *deflater) rsyncBoundary() bool {
+	if !s.rsync {
+		return false
+	}
+	s.rsyncRoll(s.strStart)
+	if s.rsyncEnd >= 0 && s.strStart > s.rsyncEnd {
+		s.rsyncEnd = -1
+		return true
+	}
+	return false
+}
+
+// flushBlockOnly flushes the current block, which ends at strStart. If sync
+// is true, the block is followed by an empty stored block, as for a sync
+// flush in zlib, so that the following block begins on a byte boundary.
+func (s *deflater) flushBlockOnly(last, sync bool) {
+	var buf []byte
+	if s.blockStart >= 0 {
+		buf = s.window[s.blockStart:]
+	}
+	s.flushBlock(buf, s.strStart-s.blockStart, last)
+	if sync {
+		s.storedBlock(nil, false)
+	}
+	s.blockStart = s.strStart
+}
+
+// deflateFast compresses without lazy matching, as for levels 1 to 3.
+func (s *deflater) deflateFast(finish bool) {
+	for {
+		if s.lookahead < minLookahead {
+			s.fillWindow()
+			if s.lookahead < minLookahead && !finish {
+				return
+			}
+			if s.lookahead == 0 {
+				break
+			}
+		}
+		hashHead := 0
+		if s.lookahead >= minMatch {
+			hashHead = s.insertString(s.strStart)
+		}
+		if hashHead != 0 && s.strStart-hashHead <= maxDist {
+			s.matchLength = s.longestMatch(hashHead)
+		}
+		var flush bool
+		if s.matchLength >= minMatch {
+			flush = s.tally(s.strStart-s.matchStart, s.matchLength-minMatch)
+			s.lookahead -= s.matchLength
+			if s.matchLength <= s.cfg.maxLazy && s.lookahead >= minMatch {
+				s.matchLength--
+				for {
+					s.strStart++
+					s.insertString(s.strStart)
+					s.matchLength--
+					if s.matchLength == 0 {
+						break
+					}
+				}
+				s.strStart++
+			} else {
+				s.strStart += s.matchLength
+				s.matchLength = 0
+				s.insH = int(s.window[s.strStart])
+				s.insH = s.updateHash(s.insH, s.window[s.strStart+1])
+			}
+		} else {
+			flush = s.tally(0, int(s.window[s.strStart]))
+			s.lookahead--
+			s.strStart++
+		}
+		if sync := s.rsyncBoundary(); flush || sync {
+			s.flushBlockOnly(false, sync)
+		}
+	}
+	s.finish()
+}
+
+// deflateSlow compresses with lazy matching, as for levels 4 to 9: a match is
+// only emitted if there is no better match at the next position.
+func (s *deflater) deflateSlow(finish bool) {
+	for {
+		if s.lookahead < minLookahead {
+			s.fillWindow()
+			if s.lookahead < minLookahead && !finish {
+				return
+			}
+			if s.lookahead == 0 {
+				break
+			}
+		}
+		hashHead := 0
+		if s.lookahead >= minMatch {
+			hashHead = s.insertString(s.strStart)
+		}
+
+		s.prevLength, s.prevMatch = s.matchLength, s.matchStart
+		s.matchLength = minMatch - 1
+		if hashHead != 0 && s.prevLength < s.cfg.maxLazy && s.strStart-hashHead <= maxDist {
+			s.matchLength = s.longestMatch(hashHead)
+			if s.matchLength <= 5 && s.matchLength == minMatch && s.strStart-s.matchStart > tooFar {
+				// a match of length 3 is not worth it if it is too distant
+				s.matchLength = minMatch - 1
+			}
+		}
+
+		// If there was a match at the previous step and the current match is
+		// not better, output the previous match.
+		switch {
+		case s.prevLength >= minMatch && s.matchLength <= s.prevLength:
+			maxInsert := s.strStart + s.lookahead - minMatch
+			flush := s.tally(s.strStart-1-s.prevMatch, s.prevLength-minMatch)
+			s.lookahead -= s.prevLength - 1
+			s.prevLength -= 2
+			for {
+				s.strStart++
+				if s.strStart <= maxInsert {
+					s.insertString(s.strStart)
+				}
+				s.prevLength--
+				if s.prevLength == 0 {
+					break
+				}
+			}
+			s.matchAvailable = false
+			s.matchLength = minMatch - 1
+			s.strStart++
+			if sync := s.rsyncBoundary(); flush || sync {
+				s.flushBlockOnly(false, sync)
+			}
+		case s.matchAvailable:
+			// There is no better match: output the previous single literal.
+			flush := s.tally(0, int(s.window[s.strStart-1]))
+			if sync := s.rsyncBoundary(); flush || sync {
+				s.flushBlockOnly(false, sync)
+			}
+			s.strStart++
+			s.lookahead--
+		default:
+			// There is no previous match to compare with, wait for the next
+			// step to decide.
+			s.matchAvailable = true
+			s.strStart++
+			s.lookahead--
+		}
+	}
+	if s.matchAvailable {
+		s.tally(0, int(s.window[s.strStart-1]))
+		s.matchAvailable = false
+	}
+	s.finish()
+}
+
+// finish flushes the last block of the stream.
+func (s *deflater) finish() {
+	if s.strStart < minMatch-1 {
+		s.insert = s.strStart
+	} else {
+		s.insert = minMatch - 1
+	}
+	s.flushBlockOnly(true, false)
+}
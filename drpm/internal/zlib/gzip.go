@@ -0,0 +1,52 @@
+package zlib
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// A GzipWriter compresses data written to it as a gzip file.
+type GzipWriter struct {
+	w    io.Writer
+	z    *Writer
+	crc  uint32
+	size uint32
+}
+
+// NewGzipWriter returns a GzipWriter that compresses data written to it at the
+// given level and writes the gzip file to w. The gzip header has no name or
+// modification time, and its extra flags byte is xfl: gzip files written by
+// zlib 1.2.4 and later set it to 2 at level 9, while older versions of zlib
+// always set it to zero.
+func NewGzipWriter(w io.Writer, level int, rsyncable bool, xfl byte) (*GzipWriter, error) {
+	z, err := NewWriter(w, level, rsyncable)
+	if err != nil {
+		return nil, err
+	}
+	header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, xfl, 3} // OS is unix
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &GzipWriter{w: w, z: z}, nil
+}
+
+// Write compresses p.
+func (g *GzipWriter) Write(p []byte) (int, error) {
+	g.crc = crc32.Update(g.crc, crc32.IEEETable, p)
+	g.size += uint32(len(p))
+	return g.z.Write(p)
+}
+
+// Close finishes the compressed data and writes the gzip trailer. It does not
+// close the underlying writer.
+func (g *GzipWriter) Close() error {
+	if err := g.z.Close(); err != nil {
+		return err
+	}
+	var trailer [8]byte
+	binary.LittleEndian.PutUint32(trailer[:4], g.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], g.size)
+	_, err := g.w.Write(trailer[:])
+	return err
+}
@@ -0,0 +1,562 @@
+package zlib
+
+// This file is a port of trees.c of zlib, which encodes blocks of literals and
+// matches with fixed or dynamic Huffman codes.
+
+const (
+	maxBits      = 15  // maximum number of bits in a code
+	maxBLBits    = 7   // maximum number of bits in a bit length code
+	lengthCodes  = 29  // number of length codes, not counting the special end of block code
+	literals     = 256 // number of literal bytes 0..255
+	lCodes       = literals + 1 + lengthCodes
+	dCodes       = 30 // number of distance codes
+	blCodes      = 19 // number of codes used to transfer the bit lengths
+	heapSize     = 2*lCodes + 1
+	endBlock     = 256
+	rep3To6      = 16 // repeat previous bit length 3-6 times
+	repZero3To10 = 17 // repeat a zero length 3-10 times
+	repZero11To  = 18 // repeat a zero length 11-138 times
+
+	storedBlock  = 0
+	staticTrees  = 1
+	dynamicTrees = 2
+)
+
+var extraLBits = [lengthCodes]int{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+
+var extraDBits = [dCodes]int{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+var extraBLBits = [blCodes]int{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 3, 7}
+
+// blOrder is the order in which the bit length code lengths are sent.
+var blOrder = [blCodes]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+
+// A node is a node of a Huffman tree. As in zlib, fc holds the frequency or
+// the code of the node and dl holds the index of its parent or its length.
+type node struct {
+	fc uint16
+	dl uint16
+}
+
+var (
+	staticLTree [lCodes + 2]node
+	staticDTree [dCodes]node
+	distCode    [512]uint8 // distance codes, for distances 1..256 and then by 128
+	lengthCode  [maxMatch - minMatch + 1]uint8
+	baseLength  [lengthCodes]int
+	baseDist    [dCodes]int
+)
+
+func init() {
+	length := 0
+	code := 0
+	for code = 0; code < lengthCodes-1; code++ {
+		baseLength[code] = length
+		for n := 0; n < 1<<extraLBits[code]; n++ {
+			lengthCode[length] = uint8(code)
+			length++
+		}
+	}
+	// length 258 may be coded as 284 + 5 bits or as 285; use the shorter.
+	lengthCode[length-1] = uint8(code)
+
+	dist := 0
+	for code = 0; code < 16; code++ {
+		baseDist[code] = dist
+		for n := 0; n < 1<<extraDBits[code]; n++ {
+			distCode[dist] = uint8(code)
+			dist++
+		}
+	}
+	dist >>= 7
+	for ; code < dCodes; code++ {
+		baseDist[code] = dist << 7
+		for n := 0; n < 1<<(extraDBits[code]-7); n++ {
+			distCode[256+dist] = uint8(code)
+			dist++
+		}
+	}
+
+	var blCount [maxBits + 1]int
+	n := 0
+	for ; n <= 143; n++ {
+		staticLTree[n].dl = 8
+		blCount[8]++
+	}
+	for ; n <= 255; n++ {
+		staticLTree[n].dl = 9
+		blCount[9]++
+	}
+	for ; n <= 279; n++ {
+		staticLTree[n].dl = 7
+		blCount[7]++
+	}
+	for ; n <= 287; n++ {
+		staticLTree[n].dl = 8
+		blCount[8]++
+	}
+	genCodes(staticLTree[:], lCodes+1, &blCount)
+	for n := 0; n < dCodes; n++ {
+		staticDTree[n].dl = 5
+		staticDTree[n].fc = uint16(reverse(n, 5))
+	}
+}
+
+// dCode returns the distance code of dist, which is the match distance - 1.
+func dCode(dist int) int {
+	if dist < 256 {
+		return int(distCode[dist])
+	}
+	return int(distCode[256+dist>>7])
+}
+
+// A treeDesc describes a dynamic tree and its static counterpart.
+type treeDesc struct {
+	dynTree    []node
+	maxCode    int
+	staticTree []node
+	extraBits  []int
+	extraBase  int
+	elems      int
+	maxLength  int
+}
+
+// reverse reverses the first length bits of code.
+func reverse(code, length int) int {
+	res := 0
+	for ; length > 0; length-- {
+		res |= code & 1
+		code >>= 1
+		res <<= 1
+	}
+	return res >> 1
+}
+
+// genCodes generates the codes of a tree with the given bit lengths and
+// counts of codes of each length.
+func genCodes(tree []node, maxCode int, blCount *[maxBits + 1]int) {
+	var nextCode [maxBits + 1]int
+	code := 0
+	for bits := 1; bits <= maxBits; bits++ {
+		code = (code + blCount[bits-1]) << 1
+		nextCode[bits] = code
+	}
+	for n := 0; n <= maxCode; n++ {
+		length := int(tree[n].dl)
+		if length == 0 {
+			continue
+		}
+		tree[n].fc = uint16(reverse(nextCode[length], length))
+		nextCode[length]++
+	}
+}
+
+func (s *deflater) initTrees() {
+	s.lDesc = treeDesc{dynTree: s.dynLTree[:], staticTree: staticLTree[:], extraBits: extraLBits[:], extraBase: literals + 1, elems: lCodes, maxLength: maxBits}
+	s.dDesc = treeDesc{dynTree: s.dynDTree[:], staticTree: staticDTree[:], extraBits: extraDBits[:], elems: dCodes, maxLength: maxBits}
+	s.blDesc = treeDesc{dynTree: s.blTree[:], extraBits: extraBLBits[:], elems: blCodes, maxLength: maxBLBits}
+	s.initBlock()
+}
+
+func (s *deflater) initBlock() {
+	for n := 0; n < lCodes; n++ {
+		s.dynLTree[n].fc = 0
+	}
+	for n := 0; n < dCodes; n++ {
+		s.dynDTree[n].fc = 0
+	}
+	for n := 0; n < blCodes; n++ {
+		s.blTree[n].fc = 0
+	}
+	s.dynLTree[endBlock].fc = 1
+	s.optLen, s.staticLen = 0, 0
+	s.syms = s.syms[:0]
+}
+
+// smaller compares two subtrees, using the tree depth as tie breaker when
+// the subtrees have equal frequency.
+func (s *deflater) smaller(tree []node, n, m int) bool {
+	return tree[n].fc < tree[m].fc || tree[n].fc == tree[m].fc && s.depth[n] <= s.depth[m]
+}
+
+// downHeap restores the heap property by moving down the tree starting at
+// node k.
+func (s *deflater) downHeap(tree []node, k int) {
+	v := s.heap[k]
+	j := k << 1
+	for j <= s.heapLen {
+		if j < s.heapLen && s.smaller(tree, s.heap[j+1], s.heap[j]) {
+			j++
+		}
+		if s.smaller(tree, v, s.heap[j]) {
+			break
+		}
+		s.heap[k] = s.heap[j]
+		k = j
+		j <<= 1
+	}
+	s.heap[k] = v
+}
+
+// genBitLen computes the optimal bit lengths for a tree and updates the
+// lengths of the current block with the dynamic and static trees.
+func (s *deflater) genBitLen(desc *treeDesc) {
+	tree := desc.dynTree
+	for bits := range s.blCount {
+		s.blCount[bits] = 0
+	}
+	tree[s.heap[s.heapMax]].dl = 0 // root of the heap
+
+	overflow := 0
+	h := s.heapMax + 1
+	for ; h < heapSize; h++ {
+		n := s.heap[h]
+		bits := int(tree[tree[n].dl].dl) + 1
+		if bits > desc.maxLength {
+			bits = desc.maxLength
+			overflow++
+		}
+		tree[n].dl = uint16(bits)
+		if n > desc.maxCode {
+			continue // not a leaf node
+		}
+		s.blCount[bits]++
+		xbits := 0
+		if n >= desc.extraBase {
+			xbits = desc.extraBits[n-desc.extraBase]
+		}
+		f := uint64(tree[n].fc)
+		s.optLen += f * uint64(bits+xbits)
+		if desc.staticTree != nil {
+			s.staticLen += f * uint64(int(desc.staticTree[n].dl)+xbits)
+		}
+	}
+	if overflow == 0 {
+		return
+	}
+	for overflow > 0 {
+		bits := desc.maxLength - 1
+		for s.blCount[bits] == 0 {
+			bits--
+		}
+		s.blCount[bits]--
+		s.blCount[bits+1] += 2
+		s.blCount[desc.maxLength]--
+		overflow -= 2
+	}
+	for bits := desc.maxLength; bits != 0; bits-- {
+		n := s.blCount[bits]
+		for n != 0 {
+			h--
+			m := s.heap[h]
+			if m > desc.maxCode {
+				continue
+			}
+			if int(tree[m].dl) != bits {
+				s.optLen += uint64(bits-int(tree[m].dl)) * uint64(tree[m].fc)
+				tree[m].dl = uint16(bits)
+			}
+			n--
+		}
+	}
+}
+
+// buildTree constructs a Huffman tree and assigns the code bit strings and
+// lengths.
+func (s *deflater) buildTree(desc *treeDesc) {
+	tree := desc.dynTree
+	s.heapLen, s.heapMax = 0, heapSize
+	maxCode := -1
+	for n := 0; n < desc.elems; n++ {
+		if tree[n].fc != 0 {
+			s.heapLen++
+			s.heap[s.heapLen] = n
+			maxCode = n
+			s.depth[n] = 0
+		} else {
+			tree[n].dl = 0
+		}
+	}
+
+	// The pkzip format requires that at least one distance code exists, and
+	// that at least one bit should be sent even if there is only one possible
+	// code. So to avoid special checks later on we force at least two codes
+	// of non zero frequency.
+	for s.heapLen < 2 {
+		node := 0
+		if maxCode < 2 {
+			maxCode++
+			node = maxCode
+		}
+		s.heapLen++
+		s.heap[s.heapLen] = node
+		tree[node].fc = 1
+		s.depth[node] = 0
+		s.optLen--
+		if desc.staticTree != nil {
+			s.staticLen -= uint64(desc.staticTree[node].dl)
+		}
+	}
+	desc.maxCode = maxCode
+
+	for n := s.heapLen / 2; n >= 1; n-- {
+		s.downHeap(tree, n)
+	}
+
+	node := desc.elems
+	for {
+		n := s.heap[1]
+		s.heap[1] = s.heap[s.heapLen]
+		s.heapLen--
+		s.downHeap(tree, 1)
+		m := s.heap[1]
+
+		s.heapMax--
+		s.heap[s.heapMax] = n
+		s.heapMax--
+		s.heap[s.heapMax] = m
+
+		tree[node].fc = tree[n].fc + tree[m].fc
+		if s.depth[n] >= s.depth[m] {
+			s.depth[node] = s.depth[n] + 1
+		} else {
+			s.depth[node] = s.depth[m] + 1
+		}
+		tree[n].dl = uint16(node)
+		tree[m].dl = uint16(node)
+		s.heap[1] = node
+		node++
+		s.downHeap(tree, 1)
+		if s.heapLen < 2 {
+			break
+		}
+	}
+	s.heapMax--
+	s.heap[s.heapMax] = s.heap[1]
+
+	s.genBitLen(desc)
+	genCodes(tree, maxCode, &s.blCount)
+}
+
+// scanTree counts the frequencies of the codes of the bit length tree which
+// are needed to send the given tree.
+func (s *deflater) scanTree(tree []node, maxCode int) {
+	prevLen := -1
+	nextLen := int(tree[0].dl)
+	count := 0
+	maxCount, minCount := 7, 4
+	if nextLen == 0 {
+		maxCount, minCount = 138, 3
+	}
+	tree[maxCode+1].dl = 0xffff // guard
+
+	for n := 0; n <= maxCode; n++ {
+		curLen := nextLen
+		nextLen = int(tree[n+1].dl)
+		count++
+		if count < maxCount && curLen == nextLen {
+			continue
+		} else if count < minCount {
+			s.blTree[curLen].fc += uint16(count)
+		} else if curLen != 0 {
+			if curLen != prevLen {
+				s.blTree[curLen].fc++
+			}
+			s.blTree[rep3To6].fc++
+		} else if count <= 10 {
+			s.blTree[repZero3To10].fc++
+		} else {
+			s.blTree[repZero11To].fc++
+		}
+		count = 0
+		prevLen = curLen
+		if nextLen == 0 {
+			maxCount, minCount = 138, 3
+		} else if curLen == nextLen {
+			maxCount, minCount = 6, 3
+		} else {
+			maxCount, minCount = 7, 4
+		}
+	}
+}
+
+// sendTree sends a tree in compressed form using the bit length tree.
+func (s *deflater) sendTree(tree []node, maxCode int) {
+	prevLen := -1
+	nextLen := int(tree[0].dl)
+	count := 0
+	maxCount, minCount := 7, 4
+	if nextLen == 0 {
+		maxCount, minCount = 138, 3
+	}
+
+	for n := 0; n <= maxCode; n++ {
+		curLen := nextLen
+		nextLen = int(tree[n+1].dl)
+		count++
+		if count < maxCount && curLen == nextLen {
+			continue
+		} else if count < minCount {
+			for ; count != 0; count-- {
+				s.sendCode(curLen, s.blTree[:])
+			}
+		} else if curLen != 0 {
+			if curLen != prevLen {
+				s.sendCode(curLen, s.blTree[:])
+				count--
+			}
+			s.sendCode(rep3To6, s.blTree[:])
+			s.sendBits(count-3, 2)
+		} else if count <= 10 {
+			s.sendCode(repZero3To10, s.blTree[:])
+			s.sendBits(count-3, 3)
+		} else {
+			s.sendCode(repZero11To, s.blTree[:])
+			s.sendBits(count-11, 7)
+		}
+		count = 0
+		prevLen = curLen
+		if nextLen == 0 {
+			maxCount, minCount = 138, 3
+		} else if curLen == nextLen {
+			maxCount, minCount = 6, 3
+		} else {
+			maxCount, minCount = 7, 4
+		}
+	}
+}
+
+// buildBLTree builds the bit length tree and returns the index of the last
+// bit length code to send.
+func (s *deflater) buildBLTree() int {
+	s.scanTree(s.dynLTree[:], s.lDesc.maxCode)
+	s.scanTree(s.dynDTree[:], s.dDesc.maxCode)
+	s.buildTree(&s.blDesc)
+	maxIndex := blCodes - 1
+	for ; maxIndex >= 3; maxIndex-- {
+		if s.blTree[blOrder[maxIndex]].dl != 0 {
+			break
+		}
+	}
+	s.optLen += 3*uint64(maxIndex+1) + 5 + 5 + 4
+	return maxIndex
+}
+
+// sendAllTrees sends the header of a block using dynamic Huffman trees.
+func (s *deflater) sendAllTrees(lcodes, dcodes, blcodes int) {
+	s.sendBits(lcodes-257, 5)
+	s.sendBits(dcodes-1, 5)
+	s.sendBits(blcodes-4, 4)
+	for rank := 0; rank < blcodes; rank++ {
+		s.sendBits(int(s.blTree[blOrder[rank]].dl), 3)
+	}
+	s.sendTree(s.dynLTree[:], lcodes-1)
+	s.sendTree(s.dynDTree[:], dcodes-1)
+}
+
+// storedBlock sends a stored block.
+func (s *deflater) storedBlock(buf []byte, last bool) {
+	s.sendBits(storedBlock<<1+b2i(last), 3)
+	s.windup()
+	n := len(buf)
+	s.out = append(s.out, byte(n), byte(n>>8), ^byte(n), ^byte(n>>8))
+	s.out = append(s.out, buf...)
+}
+
+// flushBlock determines the best encoding for the current block: dynamic
+// trees, static trees or store, and writes out the encoded block. A nil buf
+// indicates that the input of the block is no longer in the window, in which
+// case it cannot be stored.
+func (s *deflater) flushBlock(buf []byte, storedLen int, last bool) {
+	s.buildTree(&s.lDesc)
+	s.buildTree(&s.dDesc)
+	maxIndex := s.buildBLTree()
+	optLenB := (s.optLen + 3 + 7) >> 3
+	staticLenB := (s.staticLen + 3 + 7) >> 3
+	if staticLenB <= optLenB {
+		optLenB = staticLenB
+	}
+
+	switch {
+	case uint64(storedLen)+4 <= optLenB && buf != nil:
+		s.storedBlock(buf[:storedLen], last)
+	case staticLenB == optLenB:
+		s.sendBits(staticTrees<<1+b2i(last), 3)
+		s.compressBlock(staticLTree[:], staticDTree[:])
+	default:
+		s.sendBits(dynamicTrees<<1+b2i(last), 3)
+		s.sendAllTrees(s.lDesc.maxCode+1, s.dDesc.maxCode+1, maxIndex+1)
+		s.compressBlock(s.dynLTree[:], s.dynDTree[:])
+	}
+	s.initBlock()
+	if last {
+		s.windup()
+	}
+}
+
+// tally saves a literal, if dist is zero, or a match of the given length -
+// minMatch and distance, and reports whether the block must be flushed.
+func (s *deflater) tally(dist, lc int) bool {
+	s.syms = append(s.syms, symbol{uint16(dist), uint8(lc)})
+	if dist == 0 {
+		s.dynLTree[lc].fc++
+	} else {
+		dist--
+		s.dynLTree[int(lengthCode[lc])+literals+1].fc++
+		s.dynDTree[dCode(dist)].fc++
+	}
+	return len(s.syms) == litBufSize-1
+}
+
+// compressBlock sends the block data compressed using the given trees.
+func (s *deflater) compressBlock(ltree, dtree []node) {
+	for _, sym := range s.syms {
+		dist, lc := int(sym.dist), int(sym.lc)
+		if dist == 0 {
+			s.sendCode(lc, ltree)
+			continue
+		}
+		code := int(lengthCode[lc])
+		s.sendCode(code+literals+1, ltree)
+		if extra := extraLBits[code]; extra != 0 {
+			s.sendBits(lc-baseLength[code], extra)
+		}
+		dist--
+		code = dCode(dist)
+		s.sendCode(code, dtree)
+		if extra := extraDBits[code]; extra != 0 {
+			s.sendBits(dist-baseDist[code], extra)
+		}
+	}
+	s.sendCode(endBlock, ltree)
+}
+
+func (s *deflater) sendCode(c int, tree []node) {
+	s.sendBits(int(tree[c].fc), int(tree[c].dl))
+}
+
+// sendBits writes the low length bits of value, least significant bit first.
+func (s *deflater) sendBits(value, length int) {
+	s.bitBuf |= uint64(value) << s.bitCount
+	s.bitCount += uint(length)
+	for s.bitCount >= 8 {
+		s.out = append(s.out, byte(s.bitBuf))
+		s.bitBuf >>= 8
+		s.bitCount -= 8
+	}
+}
+
+// windup pads the output with zero bits to a byte boundary.
+func (s *deflater) windup() {
+	if s.bitCount > 0 {
+		s.out = append(s.out, byte(s.bitBuf))
+	}
+	s.bitBuf, s.bitCount = 0, 0
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,113 @@
+package zlib
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// readPayload returns the compressed payload of the rpm file with the given
+// name and its uncompressed data.
+func readPayload(t *testing.T, name string) ([]byte, []byte) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := rpm.Read(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, end := pkg.HeaderRange()
+	zr, err := gzip.NewReader(bytes.NewReader(b[end:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b[end:], data
+}
+
+func TestGzipWriterPayloads(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Level     int
+		Rsyncable bool
+	}{
+		{"centos-release-3.1-1.i386.rpm", 9, false},
+		{"centos-release-4-0.1.i386.rpm", 9, false},
+		{"centos-release-4-0.1.x86_64.rpm", 9, false},
+		{"centos-release-5-0.0.el5.centos.2.i386.rpm", 9, true},
+		{"centos-release-5-0.0.el5.centos.2.x86_64.rpm", 9, true},
+		{"centos-release-as-2.1AS-4.noarch.rpm", 9, false},
+	}
+	for _, test := range tests {
+		expect, data := readPayload(t, "../../../testdata/"+test.Name)
+		var buf bytes.Buffer
+		w, err := NewGzipWriter(&buf, test.Level, test.Rsyncable, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// write in pieces which do not line up with the buffers of the
+		// compressor
+		for p := data; len(p) > 0; {
+			n := 7919
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), expect) {
+			t.Errorf("Expected payload of %s to be reproduced", test.Name)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 1<<17)
+	rnd.Read(random)
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 5000)
+	mixed := append(append(append([]byte(nil), text[:70000]...), random[:30000]...), text...)
+	for _, data := range [][]byte{nil, []byte("a"), random, text, mixed} {
+		for _, rsyncable := range []bool{false, true} {
+			for level := 1; level <= 9; level++ {
+				var buf bytes.Buffer
+				w, err := NewWriter(&buf, level, rsyncable)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := w.Write(data); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				actual, err := ioutil.ReadAll(flate.NewReader(&buf))
+				if err != nil {
+					t.Errorf("Error decompressing %d bytes at level %d: %v", len(data), level, err)
+				} else if !bytes.Equal(actual, data) {
+					t.Errorf("Expected %d bytes at level %d to be decompressed, got: %d", len(data), level, len(actual))
+				}
+			}
+		}
+	}
+
+	for _, level := range []int{0, 10} {
+		if _, err := NewWriter(ioutil.Discard, level, false); err == nil {
+			t.Errorf("Expected error for level %d", level)
+		}
+	}
+}
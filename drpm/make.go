@@ -0,0 +1,394 @@
+package drpm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/bits"
+	"strconv"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/cavaliergopher/rpm/payload"
+)
+
+// ErrDeltaTooLarge indicates that a delta rpm would not be smaller than the
+// new rpm package which it reconstructs.
+var ErrDeltaTooLarge = errors.New("drpm: delta is not smaller than the new package")
+
+// errNotReproduced indicates that compressing the payload data of the new
+// package again does not reproduce its payload.
+var errNotReproduced = errors.New("drpm: payload is not reproduced")
+
+const (
+	// blockSize is the minimum length of the data copied from the old package
+	// by each instruction of a delta.
+	blockSize = 32
+
+	// maxPending is the length of the pending delta data after which it is
+	// added to the delta, rather than kept to extend later matches backwards.
+	maxPending = 1 << 20
+)
+
+// MakeDelta creates a delta rpm package which reconstructs the new rpm
+// package read from new from the old rpm package read from old, and writes it
+// to w.
+//
+// The delta may be applied to the old rpm file or to the installed files of
+// the old package. Its old data is a normalized cpio archive of the files of
+// the old package, excluding config files, which may be modified once
+// installed, and hard links.
+//
+// The delta is computed against the uncompressed payload of the new package,
+// which is compressed again when the delta is applied. The compressor which
+// reproduces the payload of the new package is detected from the compression
+// and level of its header, and its parameters are stored in the delta. An
+// error is returned if no compressor of this package reproduces the payload
+// exactly. ErrDeltaTooLarge is returned if the delta is not smaller than the
+// new package. In either case, nothing is written to w.
+//
+// The old data is held in memory, with an index of 4 bytes for every 32 bytes
+// of old data, as well as the compressed payload of the new package.
+func MakeDelta(old, new io.Reader, w io.Writer) error {
+	br := bufio.NewReader(old)
+	oldPkg, err := rpm.Read(br)
+	if err != nil {
+		return err
+	}
+	files, err := deltaFiles(oldPkg)
+	if err != nil {
+		return err
+	}
+	oldData, err := payloadData(br, oldPkg, files)
+	if err != nil {
+		return err
+	}
+	if len(oldData) > math.MaxInt32 {
+		return errorf("old package content exceeds the maximum size of %d", math.MaxInt32)
+	}
+
+	nr := bufio.NewReader(new)
+	buf, off, err := readHeaders(nr)
+	if err != nil {
+		return err
+	}
+	d, err := newDelta(buf, off)
+	if err != nil {
+		return err
+	}
+	d.SourceNEVR = nevr(oldPkg)
+	d.Sequence = encodeSequence(files)
+	d.Compression = "xz"
+	d.outLen = int64(len(oldData))
+
+	p, err := ioutil.ReadAll(nr)
+	if err != nil {
+		return err
+	}
+	if err := d.diffPayload(oldData, p); err != nil {
+		return err
+	}
+	h := md5.New()
+	h.Write(buf)
+	h.Write(p)
+	d.TargetMD5 = h.Sum(nil)
+	d.TargetSize = int64(len(buf) + len(p))
+
+	return d.writeSmaller(w)
+}
+
+// writeSmaller writes d to w if the delta rpm file is smaller than the new
+// package. Otherwise, ErrDeltaTooLarge is returned and nothing is written.
+func (d *Delta) writeSmaller(w io.Writer) error {
+	lw := &limitWriter{max: d.TargetSize - 1}
+	if err := d.write(lw); err != nil {
+		return err
+	}
+	_, err := w.Write(lw.buf.Bytes())
+	return err
+}
+
+// diffPayload sets the instructions and delta data of d to reconstruct the
+// uncompressed data of p, the compressed payload of the new package of d, from
+// old, and sets the target compression of d to the compressor which
+// reproduces p.
+func (d *Delta) diffPayload(old, p []byte) error {
+	zr, err := payload.Decompress(bytes.NewReader(p), d.Target)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	if err := d.diff(old, zr); err != nil {
+		return err
+	}
+	compression := d.Target.PayloadCompression()
+	if compression == "" {
+		compression = "gzip"
+	}
+	level, _ := strconv.Atoi(d.Target.Header.GetTag(1126).String()) // RPMTAG_PAYLOADFLAGS
+	for _, c := range payloadCompressors(compression, level) {
+		ok, err := d.reproduces(c, p)
+		if err != nil {
+			return err
+		}
+		if ok {
+			d.TargetCompression, d.TargetCompressionLevel = c.compression, c.level
+			d.compParams = c.params()
+			return nil
+		}
+	}
+	return errorf("%s payload of %s is not reproduced by the compressors of this package", compression, d.TargetNEVR)
+}
+
+// reproduces reports whether compressing the uncompressed data of p, the
+// compressed payload of the new package of d, with c reproduces p.
+func (d *Delta) reproduces(c *compressor, p []byte) (bool, error) {
+	zr, err := payload.Decompress(bytes.NewReader(p), d.Target)
+	if err != nil {
+		return false, err
+	}
+	defer zr.Close()
+	cw := &compareWriter{b: p}
+	zw, err := c.newWriter(cw)
+	if err == nil {
+		_, err = io.Copy(zw, zr)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == errNotReproduced {
+		return false, nil
+	}
+	return err == nil && len(cw.b) == 0, err
+}
+
+// A compareWriter compares the bytes written to it with b, and fails with
+// errNotReproduced as soon as they differ.
+type compareWriter struct {
+	b []byte
+}
+
+func (c *compareWriter) Write(p []byte) (int, error) {
+	if len(p) > len(c.b) || !bytes.Equal(p, c.b[:len(p)]) {
+		return 0, errNotReproduced
+	}
+	c.b = c.b[len(p):]
+	return len(p), nil
+}
+
+// limitWriter buffers up to max bytes and fails with ErrDeltaTooLarge if more
+// are written.
+type limitWriter struct {
+	buf bytes.Buffer
+	max int64
+}
+
+func (c *limitWriter) Write(p []byte) (int, error) {
+	if int64(c.buf.Len()+len(p)) > c.max {
+		return 0, ErrDeltaTooLarge
+	}
+	return c.buf.Write(p)
+}
+
+// diff sets the instructions and delta data of d to reconstruct the data read
+// from target from old.
+//
+// The blocks of old at multiples of blockSize are indexed by a rolling hash of
+// their content. The hash is rolled over the target, so that matches of at
+// least blockSize bytes are found at any offset of the target, and matches are
+// extended in both directions. The bytes between matches are added to the
+// delta data.
+func (d *Delta) diff(old []byte, target io.Reader) error {
+	index := newBlockIndex(old)
+	d.in, d.out, d.data = nil, nil, nil
+	s := &stream{r: target}
+	var copies uint32
+	var off int64
+	var h uint32
+	i, hashed := 0, false // offset of the hashed block in s.buf
+	for {
+		if err := s.fill(i + blockSize + 1); err != nil {
+			return err
+		}
+		if len(s.buf) < i+blockSize {
+			break
+		}
+		if !hashed {
+			h, hashed = rollingHash(s.buf[i:i+blockSize]), true
+		}
+		o := index.lookup(h, s.buf[i:i+blockSize])
+		if o < 0 {
+			if len(s.buf) == i+blockSize {
+				break
+			}
+			h = h*hashBase + uint32(s.buf[i+blockSize]) - uint32(s.buf[i])*index.pow
+			i++
+			if i >= maxPending {
+				d.addData(copies, s.buf[:i])
+				copies = 0
+				s.buf, i = s.buf[i:], 0
+			}
+			continue
+		}
+
+		// extend the match backwards over the pending delta data and forwards
+		// as the target is read
+		for i > 0 && o > 0 && s.buf[i-1] == old[o-1] {
+			i--
+			o--
+		}
+		if i > 0 {
+			d.addData(copies, s.buf[:i])
+			copies = 0
+		}
+		n := 0
+		s.buf = s.buf[i:]
+		for {
+			k := 0
+			for k < len(s.buf) && o+n+k < len(old) && s.buf[k] == old[o+n+k] {
+				k++
+			}
+			n += k
+			s.buf = s.buf[k:]
+			if len(s.buf) > 0 || o+n == len(old) {
+				break
+			}
+			if err := s.fill(1); err != nil {
+				return err
+			}
+			if len(s.buf) == 0 {
+				break
+			}
+		}
+
+		// the old data is smaller than math.MaxInt32, so one block suffices
+		d.out = append(d.out, outBlock{adjust: int64(o) - off, length: uint32(n)})
+		copies++
+		off = int64(o + n)
+		i, hashed = 0, false
+	}
+	if copies > 0 || len(s.buf) > 0 {
+		d.addData(copies, s.buf)
+	}
+	return nil
+}
+
+// addData adds an instruction to copy the given number of out blocks followed
+// by b, which is added to the delta data. Data which follows the data of the
+// previous instruction is added to that instruction.
+func (d *Delta) addData(copies uint32, b []byte) {
+	if n := len(d.in); copies == 0 && n > 0 {
+		length := math.MaxInt32 - int(d.in[n-1].length)
+		if length > len(b) {
+			length = len(b)
+		}
+		d.in[n-1].length += uint32(length)
+		d.data = append(d.data, b[:length]...)
+		if b = b[length:]; len(b) == 0 {
+			return
+		}
+	}
+	for {
+		length := len(b)
+		if length > math.MaxInt32 {
+			length = math.MaxInt32
+		}
+		d.in = append(d.in, inBlock{copies: copies, length: uint32(length)})
+		d.data = append(d.data, b[:length]...)
+		if b = b[length:]; len(b) == 0 {
+			return
+		}
+		copies = 0
+	}
+}
+
+// stream buffers the data read from r which has not yet been consumed.
+type stream struct {
+	r   io.Reader
+	buf []byte
+	eof bool
+}
+
+// fill reads from the stream until n bytes are buffered or the end of the
+// stream is reached.
+func (c *stream) fill(n int) error {
+	for len(c.buf) < n && !c.eof {
+		if cap(c.buf)-len(c.buf) < 32*1024 {
+			buf := make([]byte, len(c.buf), 2*len(c.buf)+64*1024)
+			copy(buf, c.buf)
+			c.buf = buf
+		}
+		k, err := c.r.Read(c.buf[len(c.buf):cap(c.buf)])
+		c.buf = c.buf[:len(c.buf)+k]
+		if err == io.EOF {
+			c.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashBase is the base of the polynomial rolling hash of blocks.
+const hashBase = 16777619
+
+// rollingHash returns the polynomial hash of b, modulo 2^32.
+func rollingHash(b []byte) uint32 {
+	var h uint32
+	for _, c := range b {
+		h = h*hashBase + uint32(c)
+	}
+	return h
+}
+
+// A blockIndex is a hash table of the offsets of the blocks of old data. Each
+// slot holds the number of a block plus one, or zero if it is empty. Blocks
+// which collide with an indexed block are not indexed.
+type blockIndex struct {
+	old   []byte
+	slots []uint32
+	shift uint
+	pow   uint32 // hashBase^blockSize, to remove a byte from a rolled hash
+}
+
+func newBlockIndex(old []byte) *blockIndex {
+	n := len(old) / blockSize
+	b := bits.Len(uint(n))
+	index := &blockIndex{
+		old:   old,
+		slots: make([]uint32, 1<<b),
+		shift: uint(32 - b),
+		pow:   1,
+	}
+	for i := 0; i < blockSize; i++ {
+		index.pow *= hashBase
+	}
+	for i := 0; i < n; i++ {
+		slot := index.slot(rollingHash(old[i*blockSize : (i+1)*blockSize]))
+		if index.slots[slot] == 0 {
+			index.slots[slot] = uint32(i + 1)
+		}
+	}
+	return index
+}
+
+func (c *blockIndex) slot(h uint32) uint32 {
+	return uint32(uint64(h*0x9e3779b1) >> c.shift)
+}
+
+// lookup returns the offset of a block of old data with the given hash and
+// content, or -1 if none is indexed.
+func (c *blockIndex) lookup(h uint32, b []byte) int {
+	i := int(c.slots[c.slot(h)])
+	if i == 0 {
+		return -1
+	}
+	o := (i - 1) * blockSize
+	if !bytes.Equal(c.old[o:o+blockSize], b) {
+		return -1
+	}
+	return o
+}
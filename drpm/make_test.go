@@ -0,0 +1,218 @@
+package drpm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/cavaliergopher/rpm/drpm/internal/liblzma"
+	"github.com/cavaliergopher/rpm/payload"
+)
+
+func TestDiff(t *testing.T) {
+	old := make([]byte, 1<<16)
+	rand.New(rand.NewSource(1)).Read(old)
+	insert := []byte("inserted data")
+	large := make([]byte, 3*maxPending)
+	rand.New(rand.NewSource(2)).Read(large)
+	tests := []struct {
+		Name     string
+		Target   []byte
+		MaxDelta int
+	}{
+		{"Identical", old, 0},
+		{"Empty", nil, 0},
+		{"Insert", append(append(append([]byte(nil), old[:1000]...), insert...), old[1000:]...), len(insert)},
+		{"Delete", append(append([]byte(nil), old[:1000]...), old[5000:]...), 0},
+		{"Move", append(append([]byte(nil), old[40000:]...), old[:40000]...), 0},
+		{"Change", append(append(append([]byte(nil), old[:999]...), 'x'), old[1000:]...), 2 * blockSize},
+		{"New", insert, len(insert)},
+		{"Large", append(append(append([]byte(nil), old[:1000]...), large...), old...), len(large)},
+	}
+	for _, test := range tests {
+		d := &Delta{}
+		if err := d.diff(old, bytes.NewReader(test.Target)); err != nil {
+			t.Errorf("%s: %v", test.Name, err)
+			continue
+		}
+		actual, err := d.reconstruct(old)
+		if err != nil {
+			t.Errorf("%s: %v", test.Name, err)
+			continue
+		}
+		if !bytes.Equal(actual, test.Target) {
+			t.Errorf("%s: Expected reconstructed data to match", test.Name)
+		}
+		if len(d.data) > test.MaxDelta {
+			t.Errorf("%s: Expected at most %d bytes of delta data, got: %d", test.Name, test.MaxDelta, len(d.data))
+		}
+	}
+}
+
+func TestMakeDelta(t *testing.T) {
+	tests := []struct {
+		Old         string
+		New         string
+		Compression string
+		Params      bool
+	}{
+		{testOld, testNew, "xz", false},
+		{testNew, testNew, "xz", false},
+		{"../testdata/centos-release-6-0.el6.centos.5.i686.rpm", testOld, "xz", true},
+		{
+			"../testdata/centos-release-5-0.0.el5.centos.2.i386.rpm",
+			"../testdata/centos-release-5-0.0.el5.centos.2.x86_64.rpm",
+			"gzip-rsync",
+			false,
+		},
+		{"../testdata/centos-release-4-0.1.i386.rpm", "../testdata/centos-release-4-0.1.x86_64.rpm", "gzip", false},
+		{"../testdata/centos-release-3.1-1.i386.rpm", "../testdata/centos-release-4-0.1.i386.rpm", "gzip", false},
+	}
+	for _, test := range tests {
+		oldFile, err := ioutil.ReadFile(test.Old)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newFile, err := ioutil.ReadFile(test.New)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := MakeDelta(bytes.NewReader(oldFile), bytes.NewReader(newFile), &buf); err != nil {
+			t.Errorf("Error making delta from %s to %s: %v", test.Old, test.New, err)
+			continue
+		}
+		if buf.Len() >= len(newFile) {
+			t.Errorf("Expected delta to %s smaller than %d bytes, got: %d", test.New, len(newFile), buf.Len())
+		}
+		d, err := Read(&buf)
+		if err != nil {
+			t.Errorf("Error reading delta from %s to %s: %v", test.Old, test.New, err)
+			continue
+		}
+		if d.TargetCompression != test.Compression {
+			t.Errorf("Expected target compression %s for %s, got: %s", test.Compression, test.New, d.TargetCompression)
+		}
+		if params := len(d.compParams) > 0; params != test.Params {
+			t.Errorf("Expected compression parameters %v for %s, got: %x", test.Params, test.New, d.compParams)
+		}
+
+		var actual bytes.Buffer
+		if err := d.Apply(bytes.NewReader(oldFile), &actual); err != nil {
+			t.Errorf("Error applying delta from %s to %s: %v", test.Old, test.New, err)
+		} else if !bytes.Equal(actual.Bytes(), newFile) {
+			t.Errorf("Expected delta from %s to reconstruct %s", test.Old, test.New)
+		}
+
+		old, err := rpm.Read(bytes.NewReader(oldFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := t.TempDir()
+		installTestFiles(t, oldFile, root)
+		actual.Reset()
+		if err := d.ApplyFiles(old, root, &actual); err != nil {
+			t.Errorf("Error applying delta from %s files to %s: %v", test.Old, test.New, err)
+		} else if !bytes.Equal(actual.Bytes(), newFile) {
+			t.Errorf("Expected delta from %s files to reconstruct %s", test.Old, test.New)
+		}
+	}
+
+	// payloads which are not compressed as their header records are not
+	// reproduced
+	b, _, data := readTestPackage(t, testNew)
+	headers, _, err := readHeaders(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := liblzma.Preset(1, liblzma.CheckSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newFile := bytes.NewBuffer(append([]byte(nil), headers...))
+	zw, err := liblzma.NewWriter(newFile, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	oldFile, err := ioutil.ReadFile(testOld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := MakeDelta(bytes.NewReader(oldFile), newFile, &buf); err == nil {
+		t.Errorf("Expected error making delta to a package which is not reproduced")
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Expected nothing to be written when making a delta fails")
+	}
+
+	// deltas which contain the whole compressed payload are not smaller
+	d, _ := newTestDelta(t, false)
+	if err := d.writeSmaller(&buf); err != ErrDeltaTooLarge {
+		t.Errorf("Expected ErrDeltaTooLarge, got: %v", err)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Expected nothing to be written for a delta which is too large")
+	}
+}
+
+// installTestFiles writes the regular files and symbolic links in the payload
+// of the rpm file b to root.
+func installTestFiles(t *testing.T, b []byte, root string) {
+	r := bytes.NewReader(b)
+	pkg, err := rpm.Read(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := payload.NewReader(r, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	for {
+		fi, err := pr.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(root, filepath.FromSlash(fi.Name()))
+		if fi.Mode()&os.ModeSymlink != 0 || fi.Mode().IsRegular() {
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Symlink(fi.Linkname(), name); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(f, pr); err != nil {
+			f.Close()
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+package drpm
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/cavaliergopher/rpm/payload"
+)
+
+// The old data of a standard delta is a cpio archive of a subset of the files
+// of the old package, in the order of its sequence, which is normalized so
+// that it may be assembled either from the payload of the old rpm file or
+// from the installed files: every entry has the mode, size and device number
+// of the package header, the name of the payload, and zero for all other
+// fields.
+//
+// The sequence of the delta begins with the MD5 checksum of the metadata of
+// these files in the package header: the name of each file without its
+// leading slash and a terminating zero byte, the mode, size and device number
+// of the file as 32 bit big-endian integers, and then either the target of a
+// symbolic link with a terminating zero byte or the binary digest of a
+// regular file. The sequence continues with the indexes of the files in the
+// header, as a list of numbers in nibbles, most significant nibble of each
+// byte first. Each number is written in groups of three bits, least
+// significant group first, with the fourth bit of each nibble set if more
+// groups follow. The numbers are alternately the count of consecutive files
+// which are included, starting at the current index, and the count of files
+// which are skipped. A count of zero skipped files is followed by the index
+// at which the next files are included.
+
+// A seqFile is a file of the old package which is included in the old data of
+// standard deltas.
+type seqFile struct {
+	index  int
+	name   string // without the leading slash
+	mode   uint32
+	size   uint32
+	rdev   uint32
+	linkto string
+	digest []byte
+}
+
+// dataSize returns the size of the content of f in the old data.
+func (f *seqFile) dataSize() int {
+	switch f.mode & 0170000 {
+	case 0100000: // S_IFREG
+		return int(f.size)
+	case 0120000: // S_IFLNK
+		return len(f.linkto)
+	}
+	return 0
+}
+
+// headerFiles returns the files of pkg which may be included in the old data
+// of standard deltas, by their index in the header. Config files, which may
+// be modified once installed, ghost files, which are not in the payload, and
+// hard links, whose content is only stored once in the payload, are
+// excluded.
+func headerFiles(pkg *rpm.Package) ([]*seqFile, error) {
+	files := pkg.Files()
+	n := len(files)
+	modes := pkg.Header.GetTag(1030).Int64Slice() // RPMTAG_FILEMODES
+	rdevs := pkg.Header.GetTag(1033).Int64Slice() // RPMTAG_FILERDEVS
+	devs := pkg.Header.GetTag(1095).Int64Slice()  // RPMTAG_FILEDEVICES
+	inos := pkg.Header.GetTag(1096).Int64Slice()  // RPMTAG_FILEINODES
+	if len(modes) != n || len(rdevs) != n {
+		return nil, errorf("inconsistent file list in package header")
+	}
+	type inode struct{ dev, ino int64 }
+	links := make(map[inode]int, n)
+	if len(devs) == n && len(inos) == n {
+		for i := range files {
+			links[inode{devs[i], inos[i]}]++
+		}
+	}
+	a := make([]*seqFile, n)
+	for i, fi := range files {
+		if fi.Flags()&(rpm.FileFlagConfig|rpm.FileFlagGhost) != 0 {
+			continue
+		}
+		if len(links) > 0 && links[inode{devs[i], inos[i]}] > 1 && modes[i]&0170000 == 0100000 {
+			continue
+		}
+		if fi.Size() > 0xffffffff {
+			continue
+		}
+		f := &seqFile{
+			index: i,
+			name:  strings.TrimPrefix(fi.Name(), "/"),
+			mode:  uint32(modes[i]),
+			size:  uint32(fi.Size()),
+			rdev:  uint32(rdevs[i]),
+		}
+		switch f.mode & 0170000 {
+		case 0100000:
+			digest, err := hex.DecodeString(fi.Digest())
+			if err != nil {
+				return nil, errorf("invalid digest of %s: %v", fi.Name(), err)
+			}
+			f.digest = digest
+		case 0120000:
+			f.linkto = fi.Linkname()
+		}
+		a[i] = f
+	}
+	return a, nil
+}
+
+// deltaFiles returns the files of pkg which are included in the old data of
+// standard deltas, in the order of the header.
+func deltaFiles(pkg *rpm.Package) ([]*seqFile, error) {
+	all, err := headerFiles(pkg)
+	if err != nil {
+		return nil, err
+	}
+	var files []*seqFile
+	for _, f := range all {
+		if f != nil {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// sequenceFiles returns the files of pkg with the indexes of the given
+// sequence.
+func sequenceFiles(pkg *rpm.Package, seq []byte) ([]*seqFile, error) {
+	indexes, err := decodeSequence(seq)
+	if err != nil {
+		return nil, err
+	}
+	all, err := headerFiles(pkg)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*seqFile, len(indexes))
+	for i, index := range indexes {
+		if index >= len(all) || all[index] == nil {
+			return nil, errorf("delta sequence does not match the old package")
+		}
+		files[i] = all[index]
+	}
+	sum := sequenceMD5(files)
+	if !bytes.Equal(sum, seq[:md5.Size]) {
+		return nil, errorf("delta sequence does not match the old package")
+	}
+	return files, nil
+}
+
+// sequenceMD5 returns the MD5 checksum of the metadata of the given files.
+func sequenceMD5(files []*seqFile) []byte {
+	h := md5.New()
+	var b [12]byte
+	for _, f := range files {
+		io.WriteString(h, f.name)
+		h.Write([]byte{0})
+		binary.BigEndian.PutUint32(b[0:4], f.mode)
+		binary.BigEndian.PutUint32(b[4:8], f.size)
+		binary.BigEndian.PutUint32(b[8:12], f.rdev)
+		h.Write(b[:])
+		switch f.mode & 0170000 {
+		case 0120000:
+			io.WriteString(h, f.linkto)
+			h.Write([]byte{0})
+		case 0100000:
+			h.Write(f.digest)
+		}
+	}
+	return h.Sum(nil)
+}
+
+// encodeSequence returns the sequence of the given files.
+func encodeSequence(files []*seqFile) []byte {
+	e := &nibbleWriter{b: sequenceMD5(files)}
+	next, take := 0, true // index of the next file and state of the count
+	for i := 0; i < len(files); {
+		start := files[i].index
+		n := 1
+		for i+n < len(files) && files[i+n].index == start+n {
+			n++
+		}
+		if take && start != next {
+			e.writeNumber(0)
+			take = false
+		}
+		if !take {
+			if start > next {
+				e.writeNumber(start - next)
+			} else {
+				e.writeNumber(0)
+				e.writeNumber(start)
+			}
+		}
+		e.writeNumber(n)
+		take = false
+		next = start + n
+		i += n
+	}
+	return e.b
+}
+
+// decodeSequence returns the file indexes of the given sequence.
+func decodeSequence(seq []byte) ([]int, error) {
+	if len(seq) < md5.Size {
+		return nil, errorf("invalid sequence length: %d", len(seq))
+	}
+	var indexes []int
+	next, take, jump := 0, true, false
+	var n, shift uint
+	for i := 2 * md5.Size; i < 2*len(seq); i++ {
+		x := uint(seq[i/2] & 15)
+		if i%2 == 0 {
+			x = uint(seq[i/2] >> 4)
+		}
+		if shift > 24 {
+			return nil, errorf("invalid sequence")
+		}
+		n |= (x & 7) << shift
+		if x&8 != 0 {
+			shift += 3
+			continue
+		}
+		v := int(n)
+		n, shift = 0, 0
+		switch {
+		case jump:
+			next, jump, take = v, false, true
+		case take:
+			if v > maxHeaderSize {
+				return nil, errorf("invalid sequence")
+			}
+			for j := 0; j < v; j++ {
+				indexes = append(indexes, next+j)
+			}
+			next += v
+			take = false
+		case v == 0:
+			jump = true
+		default:
+			next += v
+			take = true
+		}
+	}
+	if shift > 0 {
+		return nil, errorf("invalid sequence")
+	}
+	return indexes, nil
+}
+
+// nibbleWriter appends nibbles to b, most significant nibble first.
+type nibbleWriter struct {
+	b   []byte
+	odd bool
+}
+
+// writeNumber writes n in groups of three bits, least significant first.
+func (c *nibbleWriter) writeNumber(n int) {
+	for {
+		x := byte(n & 7)
+		n >>= 3
+		if n > 0 {
+			x |= 8
+		}
+		if c.odd {
+			c.b[len(c.b)-1] |= x
+		} else {
+			c.b = append(c.b, x<<4)
+		}
+		c.odd = !c.odd
+		if n == 0 {
+			return
+		}
+	}
+}
+
+// oldDataSize returns the size of the old data of the given files.
+func oldDataSize(files []*seqFile) int64 {
+	var n int64
+	for _, f := range files {
+		n += int64(pad4(110+len(f.name)+3) + pad4(f.dataSize()))
+	}
+	return n + int64(pad4(110+len(cpioTrailer)+1))
+}
+
+// pad4 returns n rounded up to a multiple of 4.
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+const cpioTrailer = "TRAILER!!!"
+
+// appendEntry appends the cpio entry of f with the given content to b, or the
+// trailer of the archive if f is nil.
+func appendEntry(b []byte, f *seqFile, content []byte) []byte {
+	name := cpioTrailer
+	var mode, major, minor uint32
+	if f != nil {
+		name = "./" + f.name
+		mode, major, minor = f.mode, f.rdev>>8&0xff, f.rdev&0xff
+	}
+	b = append(b, fmt.Sprintf("070701%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		0, mode, 0, 0, 1, 0, len(content), 0, 0, major, minor, len(name)+1, 0)...)
+	b = append(b, name...)
+	b = append(b, make([]byte, pad4(110+len(name)+1)-110-len(name))...)
+	b = append(b, content...)
+	return append(b, make([]byte, pad4(len(content))-len(content))...)
+}
+
+// content returns the content of f in the old data. The content of regular
+// files is read from r, and checked against the size and digest of the
+// package header, which uses the given digest algorithm.
+func (f *seqFile) content(r io.Reader, algo int64) ([]byte, error) {
+	switch f.mode & 0170000 {
+	case 0120000:
+		return []byte(f.linkto), nil
+	case 0100000:
+	default:
+		return nil, nil
+	}
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, r, int64(f.size)+1); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if b.Len() != int(f.size) {
+		return nil, errorf("size of /%s does not match the old package", f.name)
+	}
+	h, err := newDigest(algo)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(b.Bytes())
+	if !bytes.Equal(h.Sum(nil), f.digest) {
+		return nil, errorf("digest of /%s does not match the old package", f.name)
+	}
+	return b.Bytes(), nil
+}
+
+// fileDigestAlgo returns the hash algorithm of the file digests of pkg.
+// Packages which predate RPMTAG_FILEDIGESTALGO use MD5.
+func fileDigestAlgo(pkg *rpm.Package) int64 {
+	if algo := pkg.Header.GetTag(5011).Int64(); algo != 0 { // RPMTAG_FILEDIGESTALGO
+		return algo
+	}
+	return 1
+}
+
+// payloadData reads the payload of pkg from r and returns the old data of the
+// given files.
+func payloadData(r io.Reader, pkg *rpm.Package, files []*seqFile) ([]byte, error) {
+	algo := fileDigestAlgo(pkg)
+	regular := make(map[string]*seqFile, len(files))
+	for _, f := range files {
+		if f.mode&0170000 == 0100000 {
+			regular["/"+f.name] = f
+		}
+	}
+	content := make(map[*seqFile][]byte, len(regular))
+	pr, err := payload.NewReader(r, pkg)
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+	for {
+		fi, err := pr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		f, ok := regular[fi.Name()]
+		if !ok {
+			continue
+		}
+		if content[f], err = f.content(pr, algo); err != nil {
+			return nil, err
+		}
+		delete(regular, fi.Name())
+	}
+	for name := range regular {
+		return nil, errorf("file not found in payload: %s", name)
+	}
+	data := make([]byte, 0, oldDataSize(files))
+	for _, f := range files {
+		b, ok := content[f]
+		if !ok {
+			b, _ = f.content(nil, algo)
+		}
+		data = appendEntry(data, f, b)
+	}
+	return appendEntry(data, nil, nil), nil
+}
+
+// installedData returns the old data of the given files of pkg, which are
+// installed in root.
+func installedData(pkg *rpm.Package, root string, files []*seqFile) ([]byte, error) {
+	algo := fileDigestAlgo(pkg)
+	data := make([]byte, 0, oldDataSize(files))
+	for _, f := range files {
+		name := filepath.Join(root, filepath.FromSlash(f.name))
+		var b []byte
+		switch f.mode & 0170000 {
+		case 0100000:
+			r, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			b, err = f.content(r, algo)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+		case 0120000:
+			linkto, err := os.Readlink(name)
+			if err != nil {
+				return nil, err
+			}
+			if linkto != f.linkto {
+				return nil, errorf("link target of /%s does not match the old package", f.name)
+			}
+			b = []byte(linkto)
+		}
+		data = appendEntry(data, f, b)
+	}
+	return appendEntry(data, nil, nil), nil
+}
@@ -0,0 +1,7 @@
+package drpm
+
+import "fmt"
+
+func errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("drpm: "+format, a...)
+}
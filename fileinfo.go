@@ -14,6 +14,7 @@ const (
 	FileFlagIcon      = (1 << 2)  // %%donotuse
 	FileFlagMissingOk = (1 << 3)  // %%config(missingok)
 	FileFlagNoReplace = (1 << 4)  // %%config(noreplace)
+	FileFlagSpecFile  = (1 << 5)  // %%spec
 	FileFlagGhost     = (1 << 6)  // %%ghost
 	FileFlagLicense   = (1 << 7)  // %%license
 	FileFlagReadme    = (1 << 8)  // %%readme
@@ -39,6 +40,19 @@ type FileInfo struct {
 // compile-time check that rpm.FileInfo implements os.FileInfo interface
 var _ os.FileInfo = new(FileInfo)
 
+// NewFileInfo returns a FileInfo for a file that is not described by a package
+// header, such as a file found in a payload but missing from the file list of
+// the package. Its flags, owner, group and digest are empty.
+func NewFileInfo(name string, size int64, mode os.FileMode, modTime time.Time, linkname string) *FileInfo {
+	return &FileInfo{
+		name:     name,
+		size:     size,
+		mode:     mode,
+		modTime:  modTime,
+		linkname: linkname,
+	}
+}
+
 func (f *FileInfo) String() string {
 	return f.Name()
 }
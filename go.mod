@@ -2,4 +2,10 @@ module github.com/cavaliergopher/rpm
 
 go 1.17
 
-require golang.org/x/crypto v0.6.0
+require (
+	github.com/cavaliergopher/cpio v1.0.1
+	github.com/klauspost/compress v1.15.15
+	github.com/ulikunitz/xz v0.5.11
+	golang.org/x/crypto v0.6.0
+	gopkg.in/yaml.v3 v3.0.1
+)
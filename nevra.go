@@ -0,0 +1,142 @@
+package rpm
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// NEVRA identifies a build of a package by its Name, Epoch, Version, Release
+// and Architecture. NEVRA implements Version so that it may be compared with
+// Compare.
+type NEVRA struct {
+	name    string
+	epoch   int
+	version string
+	release string
+	arch    string
+}
+
+// NewNEVRA returns a NEVRA with the given components.
+func NewNEVRA(name string, epoch int, version, release, arch string) *NEVRA {
+	return &NEVRA{
+		name:    name,
+		epoch:   epoch,
+		version: version,
+		release: release,
+		arch:    arch,
+	}
+}
+
+// ParseNEVRA parses a package identifier in the form
+// 'name-[epoch:]version-release.arch'. The epoch may also precede the name, as
+// in 'epoch:name-version-release.arch'.
+//
+// The file name of a package, such as 'bash-4.4.19-7.el8.x86_64.rpm' or
+// 'bash-4.4.19-7.el8.src.rpm', may also be given. Any leading directories are
+// ignored.
+func ParseNEVRA(s string) (*NEVRA, error) {
+	v := s
+	if strings.HasSuffix(v, ".rpm") {
+		v = strings.TrimSuffix(path.Base(v), ".rpm")
+	}
+
+	// arch follows the last dot of the release
+	i := strings.LastIndexByte(v, '.')
+	if i < 0 || i < strings.LastIndexByte(v, '-') {
+		return nil, errorf("missing architecture in NEVRA: %q", s)
+	}
+	n := &NEVRA{arch: v[i+1:]}
+	v = v[:i]
+
+	// release and version are the last two hyphenated fields
+	i = strings.LastIndexByte(v, '-')
+	if i < 0 {
+		return nil, errorf("missing release in NEVRA: %q", s)
+	}
+	n.release, v = v[i+1:], v[:i]
+	i = strings.LastIndexByte(v, '-')
+	if i < 0 {
+		return nil, errorf("missing version in NEVRA: %q", s)
+	}
+	n.name, n.version = v[:i], v[i+1:]
+
+	// epoch precedes either the version or the name
+	var epoch string
+	if i := strings.IndexByte(n.version, ':'); i >= 0 {
+		epoch, n.version = n.version[:i], n.version[i+1:]
+	} else if i := strings.IndexByte(n.name, ':'); i >= 0 {
+		epoch, n.name = n.name[:i], n.name[i+1:]
+	}
+	if epoch != "" {
+		e, err := strconv.Atoi(epoch)
+		if err != nil || e < 0 {
+			return nil, errorf("invalid epoch in NEVRA: %q", s)
+		}
+		n.epoch = e
+	}
+	if n.name == "" || n.version == "" || n.release == "" || n.arch == "" {
+		return nil, errorf("invalid NEVRA: %q", s)
+	}
+	return n, nil
+}
+
+// NEVRA returns the Name, Epoch, Version, Release and Architecture of the
+// package.
+func (c *Package) NEVRA() *NEVRA {
+	return NewNEVRA(c.Name(), c.Epoch(), c.Version(), c.Release(), c.Architecture())
+}
+
+// Name returns the package name.
+func (c *NEVRA) Name() string {
+	return c.name
+}
+
+// Epoch returns the package epoch, or zero if the package has no epoch.
+func (c *NEVRA) Epoch() int {
+	return c.epoch
+}
+
+// Version returns the package version.
+func (c *NEVRA) Version() string {
+	return c.version
+}
+
+// Release returns the package release.
+func (c *NEVRA) Release() string {
+	return c.release
+}
+
+// Architecture returns the package architecture, such as 'x86_64', 'noarch'
+// or 'src'.
+func (c *NEVRA) Architecture() string {
+	return c.arch
+}
+
+// EVR returns the epoch, version and release in the form
+// '[epoch:]version-release'. The epoch is omitted if it is zero.
+func (c *NEVRA) EVR() string {
+	if c.epoch > 0 {
+		return fmt.Sprintf("%d:%s-%s", c.epoch, c.version, c.release)
+	}
+	return c.version + "-" + c.release
+}
+
+// String returns the NEVRA in the form 'name-[epoch:]version-release.arch'.
+// The epoch is omitted if it is zero.
+func (c *NEVRA) String() string {
+	return c.name + "-" + c.EVR() + "." + c.arch
+}
+
+// FullString returns the NEVRA in the form 'name-epoch:version-release.arch',
+// including the epoch even if it is zero.
+func (c *NEVRA) FullString() string {
+	return fmt.Sprintf("%s-%d:%s-%s.%s", c.name, c.epoch, c.version, c.release, c.arch)
+}
+
+// Filename returns the conventional file name of the package in the form
+// 'name-version-release.arch.rpm'. File names do not include the epoch.
+func (c *NEVRA) Filename() string {
+	return fmt.Sprintf("%s-%s-%s.%s.rpm", c.name, c.version, c.release, c.arch)
+}
@@ -0,0 +1,96 @@
+package rpm
+
+import "testing"
+
+func TestParseNEVRA(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect string
+	}{
+		{"bash-4.4.19-7.el8.x86_64", "bash-0:4.4.19-7.el8.x86_64"},
+		{"bash-4.4.19-7.el8.x86_64.rpm", "bash-0:4.4.19-7.el8.x86_64"},
+		{"Packages/b/bash-4.4.19-7.el8.x86_64.rpm", "bash-0:4.4.19-7.el8.x86_64"},
+		{"bash-4.4.19-7.el8.src.rpm", "bash-0:4.4.19-7.el8.src"},
+		{"perl-IO-Socket-SSL-2.066-4.module+el8+1+2.noarch", "perl-IO-Socket-SSL-0:2.066-4.module+el8+1+2.noarch"},
+		{"openssl-1:1.1.1g-15.el8.x86_64", "openssl-1:1.1.1g-15.el8.x86_64"},
+		{"1:openssl-1.1.1g-15.el8.x86_64", "openssl-1:1.1.1g-15.el8.x86_64"},
+		{"openssl-0:1.1.1g-15.el8.x86_64", "openssl-0:1.1.1g-15.el8.x86_64"},
+	}
+	for _, test := range tests {
+		n, err := ParseNEVRA(test.in)
+		if err != nil {
+			t.Errorf("Error parsing %q: %v", test.in, err)
+			continue
+		}
+		if s := n.FullString(); s != test.expect {
+			t.Errorf("Expected %q for %q, got: %q", test.expect, test.in, s)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"bash",
+		"bash-4.4.19",
+		"bash-4.4.19-7",
+		"bash-4.4.19-7.",
+		"bash-x:4.4.19-7.x86_64",
+		"-4.4.19-7.x86_64",
+	}
+	for _, s := range invalid {
+		if n, err := ParseNEVRA(s); err == nil {
+			t.Errorf("Expected error parsing %q, got: %v", s, n)
+		}
+	}
+}
+
+func TestNEVRAString(t *testing.T) {
+	tests := []struct {
+		nevra    *NEVRA
+		str      string
+		evr      string
+		filename string
+	}{
+		{
+			NewNEVRA("bash", 0, "4.4.19", "7.el8", "x86_64"),
+			"bash-4.4.19-7.el8.x86_64",
+			"4.4.19-7.el8",
+			"bash-4.4.19-7.el8.x86_64.rpm",
+		},
+		{
+			NewNEVRA("openssl", 1, "1.1.1g", "15.el8", "src"),
+			"openssl-1:1.1.1g-15.el8.src",
+			"1:1.1.1g-15.el8",
+			"openssl-1.1.1g-15.el8.src.rpm",
+		},
+	}
+	for _, test := range tests {
+		if s := test.nevra.String(); s != test.str {
+			t.Errorf("Expected %q, got: %q", test.str, s)
+		}
+		if s := test.nevra.EVR(); s != test.evr {
+			t.Errorf("Expected EVR %q, got: %q", test.evr, s)
+		}
+		if s := test.nevra.Filename(); s != test.filename {
+			t.Errorf("Expected filename %q, got: %q", test.filename, s)
+		}
+		n, err := ParseNEVRA(test.nevra.Filename())
+		if err != nil {
+			t.Errorf("Error parsing %q: %v", test.nevra.Filename(), err)
+		} else if Compare(n, test.nevra) != 0 && test.nevra.Epoch() == 0 {
+			t.Errorf("Expected %v to equal %v", n, test.nevra)
+		}
+	}
+}
+
+func TestPackageNEVRA(t *testing.T) {
+	p := newTestPackage(map[int]interface{}{
+		1000: []string{"foo"},
+		1001: []string{"1.0"},
+		1002: []string{"2"},
+		1003: []int64{3},
+		1022: []string{"noarch"},
+	})
+	if s := p.NEVRA().String(); s != "foo-3:1.0-2.noarch" {
+		t.Errorf("Expected foo-3:1.0-2.noarch, got: %s", s)
+	}
+}
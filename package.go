@@ -2,6 +2,7 @@ package rpm
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -60,26 +61,184 @@ func Open(name string) (*Package, error) {
 	return Read(bufio.NewReader(f))
 }
 
+// OpenReaderAt reads the headers of the rpm package in r, which is size bytes
+// long.
+//
+// Only the lead and headers are read, using three calls to r.ReadAt, so r may
+// be a remote file that is read on demand, such as with HTTP range requests.
+// The payload of the package begins at the end offset of Package.HeaderRange.
+func OpenReaderAt(r io.ReaderAt, size int64) (*Package, error) {
+	buf, err := readHeadersAt(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return Read(bytes.NewReader(buf))
+}
+
+// readHeadersAt reads the lead and both headers of an rpm package from r and
+// returns their bytes.
+func readHeadersAt(r io.ReaderAt, size int64) ([]byte, error) {
+	// lead and the structure header of the signature
+	buf := make([]byte, 96+16)
+	if err := readFullAt(r, buf, 0, size); err != nil {
+		return nil, err
+	}
+	n, err := headerLength(buf[96:])
+	if err != nil {
+		return nil, err
+	}
+
+	// signature, padding and the structure header of the header
+	off := len(buf)
+	n = 96 + n + (8-n%8)%8 + 16
+	buf = append(buf, make([]byte, n-off)...)
+	if err := readFullAt(r, buf[off:], int64(off), size); err != nil {
+		return nil, err
+	}
+	if n, err = headerLength(buf[n-16:]); err != nil {
+		return nil, err
+	}
+
+	// header
+	off = len(buf)
+	buf = append(buf, make([]byte, n-16)...)
+	if err := readFullAt(r, buf[off:], int64(off), size); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// headerLength returns the length in bytes of the header which begins with the
+// given structure header, excluding any padding.
+func headerLength(b []byte) (int, error) {
+	var hdr rpmHeader
+	copy(hdr[:], b)
+	if hdr.Size() > r_MaxHeaderSize || hdr.IndexCount()*len(hdr) > r_MaxHeaderSize {
+		return 0, errorf("header size exceeds the maximum of %d", r_MaxHeaderSize)
+	}
+	return len(hdr) + hdr.IndexCount()*len(hdr) + hdr.Size(), nil
+}
+
+// readFullAt reads len(p) bytes from r at offset off, which must not exceed
+// size.
+func readFullAt(r io.ReaderAt, p []byte, off, size int64) error {
+	if off+int64(len(p)) > size {
+		return io.ErrUnexpectedEOF
+	}
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
 // dependencies translates the given tag values into a slice of package
 // relationships such as provides, conflicts, obsoletes and requires.
-func (c *Package) dependencies(nevrsTagID, flagsTagID, namesTagID, versionsTagID int) []Dependency {
-	// TODO: Implement NEVRS tags
-	// TODO: error handling
-	flgs := c.Header.GetTag(flagsTagID).Int64Slice()
+//
+// Dependencies without a flags or versions tag match any version of the named
+// capability, as in rpm. An error is returned if either tag is present but is
+// not the same length as the names array.
+func (c *Package) dependencies(flagsTagID, namesTagID, versionsTagID int) ([]Dependency, error) {
 	names := c.Header.GetTag(namesTagID).StringSlice()
+	flgs := c.Header.GetTag(flagsTagID).Int64Slice()
+	if c.Header.GetTag(flagsTagID) != nil && len(flgs) != len(names) {
+		return nil, errorf(
+			"tag %d has %d dependency flags for %d names",
+			flagsTagID,
+			len(flgs),
+			len(names),
+		)
+	}
 	vers := c.Header.GetTag(versionsTagID).StringSlice()
+	if c.Header.GetTag(versionsTagID) != nil && len(vers) != len(names) {
+		return nil, errorf(
+			"tag %d has %d dependency versions for %d names",
+			versionsTagID,
+			len(vers),
+			len(names),
+		)
+	}
 	deps := make([]Dependency, len(names))
 	for i := 0; i < len(names); i++ {
-		epoch, ver, rel := parseVersion(vers[i])
-		deps[i] = &dependency{
-			flags:   int(flgs[i]),
-			name:    names[i],
-			epoch:   epoch,
-			version: ver,
-			release: rel,
+		dep := &dependency{name: names[i]}
+		if len(flgs) > 0 {
+			dep.flags = int(flgs[i])
+		}
+		if len(vers) > 0 {
+			dep.epoch, dep.version, dep.release = parseVersion(vers[i])
 		}
+		deps[i] = dep
 	}
-	return deps
+	return deps, nil
+}
+
+// weakDependencies returns the weak dependencies stored in the given tags.
+//
+// Packages built before rpm 4.12 have no dedicated tags for Recommends and
+// Supplements. Instead, weak dependencies are stored in the legacy Suggests
+// and Enhances tags, or as Requires with the DepFlagMissingOk flag. The
+// DepFlagStrong flag distinguishes Recommends from Suggests and Supplements
+// from Enhances. If the given tags are empty, the legacy tags are checked for
+// dependencies whose strong flag matches strong.
+func (c *Package) weakDependencies(flagsTagID, namesTagID, versionsTagID int, legacy []int, strong bool) ([]Dependency, error) {
+	deps, err := c.dependencies(flagsTagID, namesTagID, versionsTagID)
+	if err != nil || len(deps) > 0 {
+		return deps, err
+	}
+	for i := 0; i+2 < len(legacy); i += 3 {
+		old, err := c.dependencies(legacy[i], legacy[i+1], legacy[i+2])
+		if err != nil {
+			return nil, err
+		}
+		for _, dep := range old {
+			if legacy[i] == 1048 && dep.Flags()&DepFlagMissingOk == 0 {
+				continue // a strong requirement
+			}
+			if (dep.Flags()&DepFlagStrong != 0) == strong {
+				deps = append(deps, dep)
+			}
+		}
+	}
+	return deps, nil
+}
+
+// Validate returns an error if the dependency, trigger or changelog tags of
+// the package header are inconsistent, such as a dependency flags array which
+// is not the same length as the names array. Read does not validate packages, and the
+// accessors of such tags return nil if they are inconsistent. CheckClosure
+// reports packages which fail validation.
+func (c *Package) Validate() error {
+	for _, f := range []func() ([]Dependency, error){
+		c.requires,
+		c.provides,
+		c.conflicts,
+		c.obsoletes,
+		c.suggests,
+		c.enhances,
+		c.recommends,
+		c.supplements,
+		c.orderWithRequires,
+	} {
+		if _, err := f(); err != nil {
+			return err
+		}
+	}
+	for _, tags := range []triggerTags{
+		packageTriggerTags,
+		fileTriggerTags,
+		transTriggerTags,
+	} {
+		if _, err := c.triggers(tags); err != nil {
+			return err
+		}
+	}
+	if _, err := c.changelog(); err != nil {
+		return err
+	}
+	return nil
 }
 
 // String returns the package identifier in the form
@@ -118,36 +277,156 @@ func (c *Package) HeaderRange() (start, end int) {
 	return start, end
 }
 
+// Legacy tags for weak dependencies in packages built before rpm 4.12, in the
+// order flags, names, versions.
+var (
+	legacySuggestsTags = []int{1158, 1156, 1157, 1048, 1049, 1050}
+	legacyEnhancesTags = []int{1161, 1159, 1160}
+)
+
+func (c *Package) requires() ([]Dependency, error) {
+	deps, err := c.dependencies(1048, 1049, 1050)
+	if err != nil {
+		return nil, err
+	}
+	a := deps[:0]
+	for _, dep := range deps {
+		// weak dependencies in packages built before rpm 4.12
+		if dep.Flags()&DepFlagMissingOk == 0 {
+			a = append(a, dep)
+		}
+	}
+	return a, nil
+}
+
+func (c *Package) provides() ([]Dependency, error) {
+	return c.dependencies(1112, 1047, 1113)
+}
+
+func (c *Package) conflicts() ([]Dependency, error) {
+	return c.dependencies(1053, 1054, 1055)
+}
+
+func (c *Package) obsoletes() ([]Dependency, error) {
+	return c.dependencies(1114, 1090, 1115)
+}
+
+func (c *Package) suggests() ([]Dependency, error) {
+	return c.weakDependencies(5051, 5049, 5050, legacySuggestsTags, false)
+}
+
+func (c *Package) enhances() ([]Dependency, error) {
+	return c.weakDependencies(5057, 5055, 5056, legacyEnhancesTags, false)
+}
+
+func (c *Package) recommends() ([]Dependency, error) {
+	return c.weakDependencies(5048, 5046, 5047, legacySuggestsTags, true)
+}
+
+func (c *Package) supplements() ([]Dependency, error) {
+	return c.weakDependencies(5054, 5052, 5053, legacyEnhancesTags, true)
+}
+
+func (c *Package) orderWithRequires() ([]Dependency, error) {
+	return c.dependencies(5037, 5035, 5036)
+}
+
+// Requires returns the packages or capabilities required by this package.
+//
+// Requires, Provides, Conflicts, Obsoletes, Suggests, Enhances, Recommends,
+// Supplements and OrderWithRequires return nil if the dependency tags in the
+// package header are inconsistent. Use Validate to check for such packages.
 func (c *Package) Requires() []Dependency {
-	return c.dependencies(5041, 1048, 1049, 1050)
+	deps, _ := c.requires()
+	return deps
 }
 
+// Provides returns the capabilities provided by this package.
 func (c *Package) Provides() []Dependency {
-	return c.dependencies(5042, 1112, 1047, 1113)
+	deps, _ := c.provides()
+	return deps
 }
 
+// Conflicts returns the packages or capabilities that may not be installed
+// with this package.
 func (c *Package) Conflicts() []Dependency {
-	return c.dependencies(5044, 1053, 1054, 1055)
+	deps, _ := c.conflicts()
+	return deps
 }
 
+// Obsoletes returns the packages that are replaced by this package.
 func (c *Package) Obsoletes() []Dependency {
-	return c.dependencies(5043, 1114, 1090, 1115)
+	deps, _ := c.obsoletes()
+	return deps
 }
 
+// Suggests returns the weak, reverse-unrelated dependencies of this package
+// which are not installed by default.
 func (c *Package) Suggests() []Dependency {
-	return c.dependencies(5059, 5051, 5049, 5050)
+	deps, _ := c.suggests()
+	return deps
 }
 
+// Enhances returns the packages that this package suggests itself for.
 func (c *Package) Enhances() []Dependency {
-	return c.dependencies(5061, 5057, 5055, 5056)
+	deps, _ := c.enhances()
+	return deps
 }
 
+// Recommends returns the weak dependencies of this package which are
+// installed by default if they are available.
 func (c *Package) Recommends() []Dependency {
-	return c.dependencies(5058, 5048, 5046, 5047)
+	deps, _ := c.recommends()
+	return deps
 }
 
+// Supplements returns the packages that this package recommends itself for.
 func (c *Package) Supplements() []Dependency {
-	return c.dependencies(5060, 5051, 5052, 5053)
+	deps, _ := c.supplements()
+	return deps
+}
+
+// OrderWithRequires returns the packages which must be installed before this
+// package if they are installed in the same transaction. Unlike Requires,
+// they are not required to be installed.
+func (c *Package) OrderWithRequires() []Dependency {
+	deps, _ := c.orderWithRequires()
+	return deps
+}
+
+// Satisfies returns true if the given requirement is satisfied by this package.
+//
+// A requirement is satisfied if it matches one of the package's Provides, the
+// implicit self-provide of the package's name at its exact epoch, version and
+// release, or, for requirements that start with '/', one of the package's
+// files.
+func (c *Package) Satisfies(req Dependency) bool {
+	if req == nil {
+		return false
+	}
+	self := &dependency{
+		flags:   DepFlagEqual,
+		name:    c.Name(),
+		epoch:   c.Epoch(),
+		version: c.Version(),
+		release: c.Release(),
+	}
+	if Satisfies(req, self) {
+		return true
+	}
+	for _, p := range c.Provides() {
+		if Satisfies(req, p) {
+			return true
+		}
+	}
+	if strings.HasPrefix(req.Name(), "/") {
+		for _, fi := range c.Files() {
+			if fi.Name() == req.Name() {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 // Files returns file information for each file that is installed by this RPM
@@ -357,6 +636,19 @@ func (c *Package) Platform() string {
 	return c.Header.GetTag(1132).String()
 }
 
+// ModularityLabel returns the label of the module stream which the package was
+// built for, in the form 'name:stream:version:context'. An empty string is
+// returned for packages which are not part of a module.
+func (c *Package) ModularityLabel() string {
+	return c.Header.GetTag(5096).String()
+}
+
+// Prefixes returns the installation prefixes of a relocatable package. Nil is
+// returned if the package is not relocatable.
+func (c *Package) Prefixes() []string {
+	return c.Header.GetTag(1098).StringSlice()
+}
+
 // PayloadFormat returns the name of the format used for the package payload.
 // Typically cpio.
 func (c *Package) PayloadFormat() string {
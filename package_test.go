@@ -88,6 +88,47 @@ func TestReadRPMFile(t *testing.T) {
 	t.Logf("Validated %d rpm files", valid)
 }
 
+// countingReaderAt counts the calls to ReadAt and the bytes read.
+type countingReaderAt struct {
+	r     *bytes.Reader
+	calls int
+	n     int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.calls++
+	n, err := c.r.ReadAt(p, off)
+	c.n += n
+	return n, err
+}
+
+func TestOpenReaderAt(t *testing.T) {
+	for path, b := range getTestFiles() {
+		expect, err := Read(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &countingReaderAt{r: bytes.NewReader(b)}
+		pkg, err := OpenReaderAt(r, int64(len(b)))
+		if err != nil {
+			t.Errorf("Error reading %s: %v", path, err)
+			continue
+		}
+		if pkg.String() != expect.String() || len(pkg.Header.Tags) != len(expect.Header.Tags) {
+			t.Errorf("Expected %v, got: %v", expect, pkg)
+		}
+		_, end := expect.HeaderRange()
+		if r.calls != 3 || r.n != end {
+			t.Errorf("Expected 3 reads of %d bytes for %s, got: %d reads of %d bytes", end, path, r.calls, r.n)
+		}
+		for _, size := range []int{0, 100, end - 1} {
+			if _, err := OpenReaderAt(bytes.NewReader(b), int64(size)); err == nil {
+				t.Errorf("Expected error reading %d bytes of %s", size, path)
+			}
+		}
+	}
+}
+
 func TestPackageFiles(t *testing.T) {
 	names := []string{
 		"/etc/pki/rpm-gpg/RPM-GPG-KEY-EPEL-7",
@@ -219,3 +260,180 @@ func ExamplePackage_Files() {
 	// -rwxr-xr-x root root  4096 Nov 25 16:26 /usr/share/doc/epel-release-7
 	// -rw-r--r-- root root 18385 Nov 25 16:23 /usr/share/doc/epel-release-7/GPL
 }
+
+func TestPackageSatisfies(t *testing.T) {
+	p := openPackage("./testdata/centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm")
+	tests := []struct {
+		req    Dependency
+		expect bool
+	}{
+		{&dependency{DepFlagAny, "centos-release", 0, "", ""}, true},
+		{&dependency{DepFlagEqual, "centos-release", 0, "7", "2.1511.el7.centos.2.10"}, true},
+		{&dependency{DepFlagGreater, "centos-release", 0, "7", ""}, false},
+		{&dependency{DepFlagGreaterOrEqual, "redhat-release", 0, "7", ""}, true},
+		{&dependency{DepFlagGreaterOrEqual, "redhat-release", 0, "8", ""}, false},
+		{&dependency{DepFlagEqual, "system-release(releasever)", 0, "7", ""}, true},
+		{&dependency{DepFlagAny, "/etc/centos-release", 0, "", ""}, true},
+		{&dependency{DepFlagAny, "/etc/fedora-release", 0, "", ""}, false},
+		{&dependency{DepFlagAny, "fedora-release", 0, "", ""}, false},
+	}
+	for _, test := range tests {
+		if ok := p.Satisfies(test.req); ok != test.expect {
+			t.Errorf("Expected %v to satisfy %v: %v, got: %v", p, test.req, test.expect, ok)
+		}
+	}
+}
+
+// newTestPackage returns a package with a header containing the given tag
+// values.
+func newTestPackage(values map[int]interface{}) *Package {
+	tags := make(map[int]*Tag, len(values))
+	for id, v := range values {
+		tag := &Tag{ID: id, Value: v}
+		switch v.(type) {
+		case []string:
+			tag.Type = TagTypeStringArray
+		case []int64:
+			tag.Type = TagTypeInt32
+		case []byte:
+			tag.Type = TagTypeBinary
+		}
+		tags[id] = tag
+	}
+	return &Package{Header: Header{Tags: tags}}
+}
+
+func depStrings(deps []Dependency) []string {
+	a := make([]string, len(deps))
+	for i, dep := range deps {
+		a[i] = formatRequirement(dep)
+	}
+	return a
+}
+
+func TestWeakDependencies(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkg     *Package
+		getDeps func(*Package) []Dependency
+		expect  []string
+	}{
+		{
+			name: "Supplements",
+			pkg: newTestPackage(map[int]interface{}{
+				5051: []int64{DepFlagEqual},
+				5052: []string{"foo", "bar"},
+				5053: []string{"1.0", "2.0"},
+				5054: []int64{DepFlagGreaterOrEqual, DepFlagLesser},
+			}),
+			getDeps: (*Package).Supplements,
+			expect:  []string{"foo >= 1.0", "bar < 2.0"},
+		},
+		{
+			name: "Requires with legacy weak dependencies",
+			pkg: newTestPackage(map[int]interface{}{
+				1048: []int64{0, DepFlagMissingOk | DepFlagStrong, DepFlagMissingOk},
+				1049: []string{"strong", "recommended", "suggested"},
+				1050: []string{"", "", ""},
+			}),
+			getDeps: (*Package).Requires,
+			expect:  []string{"strong"},
+		},
+		{
+			name: "Recommends from legacy Requires",
+			pkg: newTestPackage(map[int]interface{}{
+				1048: []int64{0, DepFlagMissingOk | DepFlagStrong, DepFlagMissingOk},
+				1049: []string{"strong", "recommended", "suggested"},
+				1050: []string{"", "", ""},
+			}),
+			getDeps: (*Package).Recommends,
+			expect:  []string{"recommended"},
+		},
+		{
+			name: "Suggests from legacy Requires",
+			pkg: newTestPackage(map[int]interface{}{
+				1048: []int64{0, DepFlagMissingOk | DepFlagStrong, DepFlagMissingOk},
+				1049: []string{"strong", "recommended", "suggested"},
+				1050: []string{"", "", ""},
+			}),
+			getDeps: (*Package).Suggests,
+			expect:  []string{"suggested"},
+		},
+		{
+			name: "Recommends from legacy Suggests",
+			pkg: newTestPackage(map[int]interface{}{
+				1156: []string{"recommended", "suggested"},
+				1157: []string{"1.0", ""},
+				1158: []int64{DepFlagStrong | DepFlagGreaterOrEqual, 0},
+			}),
+			getDeps: (*Package).Recommends,
+			expect:  []string{"recommended >= 1.0"},
+		},
+		{
+			name: "Supplements from legacy Enhances",
+			pkg: newTestPackage(map[int]interface{}{
+				1159: []string{"supplemented", "enhanced"},
+				1160: []string{"", ""},
+				1161: []int64{DepFlagStrong, 0},
+			}),
+			getDeps: (*Package).Supplements,
+			expect:  []string{"supplemented"},
+		},
+		{
+			name: "Enhances from legacy Enhances",
+			pkg: newTestPackage(map[int]interface{}{
+				1159: []string{"supplemented", "enhanced"},
+				1160: []string{"", ""},
+				1161: []int64{DepFlagStrong, 0},
+			}),
+			getDeps: (*Package).Enhances,
+			expect:  []string{"enhanced"},
+		},
+	}
+	for _, test := range tests {
+		deps := depStrings(test.getDeps(test.pkg))
+		if strings.Join(deps, ", ") != strings.Join(test.expect, ", ") {
+			t.Errorf("%s: expected %q, got: %q", test.name, test.expect, deps)
+		}
+	}
+}
+
+func TestInconsistentDependencies(t *testing.T) {
+	tests := []map[int]interface{}{
+		{1048: []int64{0}, 1049: []string{"foo", "bar"}, 1050: []string{"", ""}},
+		{1048: []int64{0, 0}, 1049: []string{"foo", "bar"}, 1050: []string{""}},
+		{1048: []int64{}, 1049: []string{"foo"}},
+	}
+	for i, values := range tests {
+		p := newTestPackage(values)
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected error for inconsistent dependencies in test %d", i+1)
+		}
+		if deps := p.Requires(); deps != nil {
+			t.Errorf("Expected no dependencies for test %d, got: %v", i+1, deps)
+		}
+	}
+
+	// names without flags or versions require any version
+	p := newTestPackage(map[int]interface{}{1049: []string{"foo", "bar"}})
+	if err := p.Validate(); err != nil {
+		t.Errorf("Error validating dependencies without flags or versions: %v", err)
+	}
+	if deps := depStrings(p.Requires()); strings.Join(deps, ", ") != "foo, bar" {
+		t.Errorf("Expected foo, bar, got: %q", deps)
+	}
+
+	names, err := filepath.Glob("./testdata/*.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		p, err := Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Validate(); err != nil {
+			t.Errorf("Error validating %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Package payload reads the compressed cpio payloads of rpm packages.
+
+The headers of an rpm package are read with the rpm package, which leaves the
+reader positioned at the beginning of the payload. Use NewReader with the same
+reader to iterate over the files in the payload and read their content:
+
+	pkg, err := rpm.Read(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+	pr, err := payload.NewReader(r, pkg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer pr.Close()
+	for {
+		fi, err := pr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(fi.Name())
+	}
+
+The spec file and sources of a source package may be read with
+ReadSourcePackage, SourcePackage.Spec and SourcePackage.ExtractSources.
+*/
+package payload
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/cavaliergopher/rpm"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// A Reader provides sequential access to the files archived in the payload of
+// an rpm package.
+//
+// Call Next to advance to each file in the payload. The Reader may then
+// be read like an io.Reader to read the content of the current file.
+type Reader struct {
+	pkg   *rpm.Package
+	files map[string]*rpm.FileInfo
+	zr    io.ReadCloser
+	cr    *cpio.Reader
+}
+
+// NewReader returns a Reader for the payload of pkg, which is read from r.
+// Typically, r is the reader that pkg was read from using rpm.Read.
+//
+// Payloads compressed with gzip, bzip2, xz, lzma or zstd and archived in cpio
+// format are supported.
+func NewReader(r io.Reader, pkg *rpm.Package) (*Reader, error) {
+	if format := pkg.PayloadFormat(); format != "" && format != "cpio" {
+		return nil, errorf("unsupported payload format: %s", format)
+	}
+	zr, err := Decompress(r, pkg)
+	if err != nil {
+		return nil, err
+	}
+	files := pkg.Files()
+	c := &Reader{
+		pkg:   pkg,
+		files: make(map[string]*rpm.FileInfo, len(files)),
+		zr:    zr,
+		cr:    cpio.NewReader(zr),
+	}
+	for i := range files {
+		c.files[payloadName(files[i].Name())] = &files[i]
+	}
+	return c, nil
+}
+
+// Next advances to the next file in the payload and returns its file
+// information from the package header. io.EOF is returned at the end of the
+// payload.
+func (c *Reader) Next() (*rpm.FileInfo, error) {
+	hdr, err := c.cr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if fi, ok := c.files[payloadName(hdr.Name)]; ok {
+		return fi, nil
+	}
+
+	// the file is not listed in the package header
+	name := "/" + payloadName(hdr.Name)
+	return rpm.NewFileInfo(name, hdr.Size, hdr.FileInfo().Mode(), hdr.ModTime, hdr.Linkname), nil
+}
+
+// Read reads from the current file in the payload. It returns io.EOF at the
+// end of the file.
+func (c *Reader) Read(p []byte) (int, error) {
+	return c.cr.Read(p)
+}
+
+// Close releases the resources of the decompressor. It does not close the
+// underlying reader.
+func (c *Reader) Close() error {
+	return c.zr.Close()
+}
+
+// Decompress returns a reader of the uncompressed payload of pkg, which is read
+// from r. Unlike a Reader, the payload is not unarchived.
+//
+// The caller is responsible for closing the returned reader, which does not
+// close r.
+func Decompress(r io.Reader, pkg *rpm.Package) (io.ReadCloser, error) {
+	return decompress(pkg.PayloadCompression(), r)
+}
+
+// payloadName normalizes a file name in a cpio payload or package header for
+// comparison. Payloads store file names relative to the root directory.
+func payloadName(name string) string {
+	return strings.TrimLeft(path.Clean("/"+name), "/")
+}
+
+// decompress returns a reader that decompresses r using the given rpm payload
+// compression. If no compression is given, gzip is assumed.
+func decompress(compression string, r io.Reader) (io.ReadCloser, error) {
+	switch compression {
+	case "", "gzip":
+		return gzip.NewReader(r)
+	case "bzip2":
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case "xz":
+		zr, err := xz.NewReader(bufio.NewReader(r))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(zr), nil
+	case "lzma":
+		zr, err := lzma.NewReader(bufio.NewReader(r))
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(zr), nil
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, errorf("unsupported payload compression: %s", compression)
+}
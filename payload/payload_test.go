@@ -0,0 +1,99 @@
+package payload
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+func TestReader(t *testing.T) {
+	names, err := filepath.Glob("../testdata/*.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bufio.NewReader(f)
+		pkg, err := rpm.Read(r)
+		if err != nil {
+			f.Close()
+			t.Fatal(err)
+		}
+		pr, err := NewReader(r, pkg)
+		if err != nil {
+			f.Close()
+			t.Errorf("Error reading payload of %s: %v", name, err)
+			continue
+		}
+		files := make(map[string]bool)
+		for _, fi := range pkg.Files() {
+			if fi.Flags()&rpm.FileFlagGhost == 0 {
+				files[fi.Name()] = true
+			}
+		}
+		count := 0
+		for {
+			fi, err := pr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("Error reading payload of %s: %v", name, err)
+				break
+			}
+			count++
+			if !files[fi.Name()] {
+				t.Errorf("Unexpected file in payload of %s: %s", name, fi.Name())
+			}
+			if !fi.Mode().IsRegular() {
+				continue
+			}
+			b, err := ioutil.ReadAll(pr)
+			if err != nil {
+				t.Errorf("Error reading %s in %s: %v", fi.Name(), name, err)
+			} else if int64(len(b)) != fi.Size() {
+				t.Errorf("Expected %d bytes for %s in %s, got: %d", fi.Size(), fi.Name(), name, len(b))
+			}
+		}
+		if count != len(files) {
+			t.Errorf("Expected %d files in payload of %s, got: %d", len(files), name, count)
+		}
+		pr.Close()
+		f.Close()
+	}
+}
+
+func TestCompression(t *testing.T) {
+	pkg := newTestPackage(map[int]interface{}{
+		1124: []string{"cpio"},
+		1125: []string{"lzip"},
+	})
+	if _, err := NewReader(nil, pkg); err == nil {
+		t.Errorf("Expected error for unsupported payload compression")
+	}
+}
+
+// newTestPackage returns a package with a header containing the given tag
+// values.
+func newTestPackage(values map[int]interface{}) *rpm.Package {
+	tags := make(map[int]*rpm.Tag, len(values))
+	for id, v := range values {
+		tag := &rpm.Tag{ID: id, Value: v}
+		switch v.(type) {
+		case []string:
+			tag.Type = rpm.TagTypeStringArray
+		case []int64:
+			tag.Type = rpm.TagTypeInt32
+		}
+		tags[id] = tag
+	}
+	return &rpm.Package{Header: rpm.Header{Tags: tags}}
+}
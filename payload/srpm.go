@@ -0,0 +1,116 @@
+package payload
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// A SourcePackage is a source rpm package (src.rpm) whose payload may be
+// read on demand.
+type SourcePackage struct {
+	*rpm.Package
+
+	r      io.ReaderAt
+	offset int64 // offset of the payload in r
+}
+
+// ReadSourcePackage reads the headers of a source package from r. The payload
+// is not read until it is required by Spec or ExtractSources.
+//
+// An error is returned if the package is not a source package.
+func ReadSourcePackage(r io.ReaderAt) (*SourcePackage, error) {
+	pkg, err := rpm.OpenReaderAt(r, math.MaxInt64)
+	if err != nil {
+		return nil, err
+	}
+	if !pkg.IsSource() {
+		return nil, errorf("not a source package: %v", pkg)
+	}
+	_, end := pkg.HeaderRange()
+	return &SourcePackage{Package: pkg, r: r, offset: int64(end)}, nil
+}
+
+// payload returns a reader for the payload of the package.
+func (c *SourcePackage) payload() (*Reader, error) {
+	return NewReader(io.NewSectionReader(c.r, c.offset, math.MaxInt64-c.offset), c.Package)
+}
+
+// Spec returns the content of the spec file of the source package. Only the
+// payload preceding the spec file is decompressed.
+func (c *SourcePackage) Spec() ([]byte, error) {
+	pr, err := c.payload()
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+	for {
+		fi, err := pr.Next()
+		if err == io.EOF {
+			return nil, errorf("spec file not found in payload of %v", c.Package)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if isSpecFile(fi) {
+			return ioutil.ReadAll(pr)
+		}
+	}
+}
+
+// ExtractSources writes each source and patch file in the payload of the
+// source package to dir, which must exist. The spec file is not extracted.
+// Sources excluded from the package with NoSource or NoPatch are not present
+// in the payload and cannot be extracted.
+func (c *SourcePackage) ExtractSources(dir string) error {
+	pr, err := c.payload()
+	if err != nil {
+		return err
+	}
+	defer pr.Close()
+	for {
+		fi, err := pr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || isSpecFile(fi) {
+			continue
+		}
+		name := path.Base(fi.Name())
+		if name == "/" || name == "." || name == ".." {
+			return errorf("invalid file name in payload: %s", fi.Name())
+		}
+		if err := extractFile(filepath.Join(dir, name), pr, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(name string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm|0o200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isSpecFile returns true if fi is the spec file of a source package. Packages
+// built by old versions of rpm do not flag the spec file, so it is identified
+// by its extension.
+func isSpecFile(fi *rpm.FileInfo) bool {
+	return fi.Flags()&rpm.FileFlagSpecFile != 0 ||
+		(fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), ".spec"))
+}
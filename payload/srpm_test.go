@@ -0,0 +1,130 @@
+package payload
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/cavaliergopher/rpm"
+)
+
+// testSourcePackage returns a source package with the given files in its
+// payload. Files with the .spec extension are flagged as spec files.
+func testSourcePackage(t *testing.T, files map[string]string) *SourcePackage {
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	n := len(names)
+	flags := make([]int64, n)
+	ixs := make([]int64, n)
+	for i, name := range names {
+		if filepath.Ext(name) == ".spec" {
+			flags[i] = rpm.FileFlagSpecFile
+		}
+	}
+	pkg := newTestPackage(map[int]interface{}{
+		1106: []int64{1},
+		1124: []string{"cpio"},
+		1125: []string{"gzip"},
+		1116: ixs,
+		1117: names,
+		1118: []string{""},
+		1030: make([]int64, n),
+		1028: make([]int64, n),
+		1034: make([]int64, n),
+		1037: flags,
+		1039: make([]string, n),
+		1040: make([]string, n),
+		1035: make([]string, n),
+		1036: make([]string, n),
+	})
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	cw := cpio.NewWriter(zw)
+	for _, name := range names {
+		hdr := &cpio.Header{Name: name, Mode: 0o100644, Size: int64(len(files[name]))}
+		if err := cw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &SourcePackage{Package: pkg, r: bytes.NewReader(buf.Bytes())}
+}
+
+func TestSourcePackage(t *testing.T) {
+	files := map[string]string{
+		"foo-1.0.tar.gz":      "tarball",
+		"foo.spec":            "Name: foo\n",
+		"foo-fix-build.patch": "patch",
+	}
+	spkg := testSourcePackage(t, files)
+	spec, err := spkg.Spec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(spec) != files["foo.spec"] {
+		t.Errorf("Expected spec %q, got: %q", files["foo.spec"], spec)
+	}
+
+	dir := t.TempDir()
+	if err := spkg.ExtractSources(dir); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if name == "foo.spec" {
+			if !os.IsNotExist(err) {
+				t.Errorf("Expected spec file not to be extracted")
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Error reading %s: %v", name, err)
+		} else if string(b) != content {
+			t.Errorf("Expected %q in %s, got: %q", content, name, b)
+		}
+	}
+
+	delete(files, "foo.spec")
+	if _, err := testSourcePackage(t, files).Spec(); err == nil {
+		t.Errorf("Expected error for source package without spec file")
+	}
+}
+
+func TestReadSourcePackage(t *testing.T) {
+	b, err := ioutil.ReadFile("../testdata/epel-release-7-5.noarch.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSourcePackage(bytes.NewReader(b)); err == nil {
+		t.Errorf("Expected error reading binary package as source package")
+	}
+
+	// mark the package as a source package in its lead to read the payload
+	b[7] = 1
+	spkg, err := ReadSourcePackage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := spkg.ExtractSources(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "RPM-GPG-KEY-EPEL-7")); err != nil {
+		t.Errorf("Expected file to be extracted: %v", err)
+	}
+}
@@ -0,0 +1,7 @@
+package payload
+
+import "fmt"
+
+func errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("payload: "+format, a...)
+}
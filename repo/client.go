@@ -0,0 +1,368 @@
+package repo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/cavaliergopher/rpm"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ErrSignatureCheckFailed indicates that repomd.xml failed signature
+// validation.
+var ErrSignatureCheckFailed = errorf("repomd.xml signature validation failed")
+
+// A Client fetches metadata and packages from a remote repository.
+//
+// The repository is located by exactly one of BaseURL, MirrorList or
+// Metalink. Files are fetched from the first mirror which responds
+// successfully and later requests prefer the same mirror.
+//
+// A Client is safe for concurrent use.
+type Client struct {
+	// BaseURL is the URL of the repository root, which contains the repodata
+	// directory.
+	BaseURL string
+
+	// MirrorList is the URL of a plain text list of repository base URLs.
+	MirrorList string
+
+	// Metalink is the URL of a metalink document listing the mirrors of the
+	// repository. The checksum of repomd.xml is verified against the
+	// metalink.
+	Metalink string
+
+	// KeyRing, if set, is used to verify the detached signature of
+	// repomd.xml, which is fetched from repodata/repomd.xml.asc.
+	KeyRing openpgp.KeyRing
+
+	// HTTPClient is the client used for requests. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	mirrors   []string
+	checksums []Checksum
+	current   int
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// Mirrors returns the base URLs of the repository mirrors. Mirror lists and
+// metalinks are fetched once and cached.
+func (c *Client) Mirrors(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mirrors != nil {
+		return c.mirrors, nil
+	}
+	var mirrors []string
+	switch {
+	case c.BaseURL != "":
+		mirrors = []string{c.BaseURL}
+	case c.MirrorList != "":
+		err := c.get(ctx, c.MirrorList, "", func(r io.Reader) (err error) {
+			mirrors, err = readMirrorList(r)
+			return
+		})
+		if err != nil {
+			return nil, err
+		}
+	case c.Metalink != "":
+		err := c.get(ctx, c.Metalink, "", func(r io.Reader) (err error) {
+			mirrors, c.checksums, err = readMetalink(r)
+			return
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errorf("no BaseURL, MirrorList or Metalink given")
+	}
+	for i, mirror := range mirrors {
+		mirrors[i] = joinURL(mirror, "")
+	}
+	c.mirrors = mirrors
+	return mirrors, nil
+}
+
+// Repomd fetches and validates repodata/repomd.xml.
+//
+// If the client has a KeyRing, the detached signature in
+// repodata/repomd.xml.asc must be signed by a key in the keyring, or
+// ErrSignatureCheckFailed is returned. If the repository is located by a
+// metalink, the checksum of repomd.xml must match the metalink.
+func (c *Client) Repomd(ctx context.Context) (*Repomd, error) {
+	var repomd *Repomd
+	err := c.fetch(ctx, "repodata/repomd.xml", func(mirror string, r io.Reader) error {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := c.verifyMetalink(b); err != nil {
+			return err
+		}
+		if c.KeyRing != nil {
+			if err := c.verifySignature(ctx, mirror, b); err != nil {
+				return err
+			}
+		}
+		repomd, err = ReadRepomd(bytes.NewReader(b))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repomd, nil
+}
+
+// verifyMetalink returns an error if the metalink lists checksums for
+// repomd.xml and none match b.
+func (c *Client) verifyMetalink(b []byte) error {
+	c.mu.Lock()
+	checksums := c.checksums
+	c.mu.Unlock()
+	if len(checksums) == 0 {
+		return nil
+	}
+	for _, checksum := range checksums {
+		h, err := newHash(checksum.Type)
+		if err != nil {
+			continue
+		}
+		h.Write(b)
+		if hex.EncodeToString(h.Sum(nil)) == checksum.Value {
+			return nil
+		}
+	}
+	return errorf("repomd.xml does not match the checksums in the metalink")
+}
+
+// verifySignature fetches repomd.xml.asc from the given mirror and verifies
+// it as a signature of repomd.xml.
+func (c *Client) verifySignature(ctx context.Context, mirror string, b []byte) error {
+	return c.get(ctx, mirror+"repodata/repomd.xml.asc", "", func(r io.Reader) error {
+		sig, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(sig, []byte("-----BEGIN PGP SIGNATURE-----")) {
+			_, err = openpgp.CheckArmoredDetachedSignature(c.KeyRing, bytes.NewReader(b), bytes.NewReader(sig))
+		} else {
+			_, err = openpgp.CheckDetachedSignature(c.KeyRing, bytes.NewReader(b), bytes.NewReader(sig))
+		}
+		if err != nil {
+			return ErrSignatureCheckFailed
+		}
+		return nil
+	})
+}
+
+// Metadata fetches repomd.xml and the metadata of the repository. Primary
+// metadata is always fetched. Other metadata types, such as "filelists" and
+// "other", are fetched if they are given. The checksums of each metadata file
+// are verified.
+func (c *Client) Metadata(ctx context.Context, types ...string) (*Metadata, error) {
+	repomd, err := c.Repomd(ctx)
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{Repomd: repomd}
+	for _, typ := range append([]string{"primary"}, types...) {
+		data := repomd.Get(typ)
+		if data == nil {
+			return nil, errorf("repository has no %s metadata", typ)
+		}
+		err := c.fetchLocation(ctx, data.Location, "", func(r io.Reader) error {
+			return md.read(r, data)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return md, nil
+}
+
+// Download downloads the package file of p and writes it to w. The size and
+// checksum of the file are verified against the metadata once the download is
+// complete. If verification fails, an error is returned and the content
+// written to w should be discarded.
+//
+// Other mirrors are tried only if the download fails before any content is
+// written to w.
+func (c *Client) Download(ctx context.Context, p *Package, w io.Writer) error {
+	checksum := p.Checksum()
+	return c.fetchLocation(ctx, p.Location(), "", func(r io.Reader) error {
+		cr, err := newChecksumReader(r, &checksum, p.PackageSize())
+		if err != nil {
+			return err
+		}
+		if n, err := io.Copy(w, cr); err != nil {
+			if n > 0 {
+				return &abortError{err}
+			}
+			return err
+		}
+		if err := cr.verify(); err != nil {
+			return &abortError{errorf("%s: %v", p.Location().Href, err)}
+		}
+		return nil
+	})
+}
+
+// abortError is returned by a fetch function to stop other mirrors from being
+// tried.
+type abortError struct {
+	err error
+}
+
+func (c *abortError) Error() string { return c.err.Error() }
+
+// ReadHeader fetches and reads the headers of the package file of p, using a
+// range request for the bytes described by its rpm:header-range. The payload
+// of the package is not downloaded.
+//
+// As the package file is not downloaded in full, its checksum cannot be
+// verified. Instead, an error is returned if the name, version, release or
+// architecture of the headers do not match p.
+func (c *Client) ReadHeader(ctx context.Context, p *Package) (*rpm.Package, error) {
+	_, end := p.HeaderRange()
+	if end <= 0 {
+		return nil, errorf("%s: no header range in metadata", p)
+	}
+	var pkg *rpm.Package
+	byteRange := fmt.Sprintf("bytes=0-%d", end-1)
+	err := c.fetchLocation(ctx, p.Location(), byteRange, func(r io.Reader) (err error) {
+		// servers which ignore the range send the whole file
+		pkg, err = rpm.Read(bufio.NewReader(io.LimitReader(r, int64(end))))
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pkg.Name() != p.Name() || rpm.Compare(pkg, p) != 0 || packageArch(pkg) != p.Architecture() {
+		return nil, errorf("expected package %s, got: %s", p, pkg)
+	}
+	return pkg, nil
+}
+
+// ReaderAt returns an HTTPReaderAt for the package file of p, which may be
+// used with rpm.OpenReaderAt or payload.ReadSourcePackage to read parts of the
+// file on demand. The first mirror which supports range requests is used.
+//
+// The checksum of the package file is not verified.
+func (c *Client) ReaderAt(ctx context.Context, p *Package) (*HTTPReaderAt, error) {
+	location := p.Location()
+	if location.Base != "" {
+		return NewHTTPReaderAt(ctx, c.HTTPClient, joinURL(location.Base, location.Href))
+	}
+	mirrors, err := c.Mirrors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, mirror := range mirrors {
+		var r *HTTPReaderAt
+		if r, err = NewHTTPReaderAt(ctx, c.HTTPClient, mirror+location.Href); err == nil {
+			return r, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// fetchLocation fetches the file at the given location, from its base URL if
+// it has one, or from the repository mirrors.
+func (c *Client) fetchLocation(ctx context.Context, location Location, byteRange string, fn func(r io.Reader) error) error {
+	if location.Base != "" {
+		err := c.get(ctx, joinURL(location.Base, location.Href), byteRange, fn)
+		if abort, ok := err.(*abortError); ok {
+			return abort.err
+		}
+		return err
+	}
+	return c.fetchRange(ctx, location.Href, byteRange, func(mirror string, r io.Reader) error {
+		return fn(r)
+	})
+}
+
+// fetch fetches the file at the given path relative to the repository root,
+// trying each mirror in turn until fn succeeds. If all mirrors fail, the last
+// error is returned.
+func (c *Client) fetch(ctx context.Context, path string, fn func(mirror string, r io.Reader) error) error {
+	return c.fetchRange(ctx, path, "", fn)
+}
+
+// fetchRange is fetch with an optional Range header.
+func (c *Client) fetchRange(ctx context.Context, path, byteRange string, fn func(mirror string, r io.Reader) error) error {
+	mirrors, err := c.Mirrors(ctx)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	current := c.current
+	c.mu.Unlock()
+	for i := 0; i < len(mirrors); i++ {
+		n := (current + i) % len(mirrors)
+		mirror := mirrors[n]
+		err = c.get(ctx, mirror+path, byteRange, func(r io.Reader) error {
+			return fn(mirror, r)
+		})
+		if err == nil {
+			c.mu.Lock()
+			c.current = n
+			c.mu.Unlock()
+			return nil
+		}
+		if abort, ok := err.(*abortError); ok {
+			return abort.err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// get sends a GET request for url and calls fn with the response body. If
+// byteRange is given, it is sent as the Range header of the request.
+func (c *Client) get(ctx context.Context, url, byteRange string, fn func(r io.Reader) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return errorf("GET %s: %s", url, resp.Status)
+	}
+	return fn(resp.Body)
+}
+
+// joinURL joins a base URL and a relative path with a single slash.
+func joinURL(base, path string) string {
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return base + path
+}
@@ -0,0 +1,256 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// testServer serves a repository generated from the rpm testdata and records
+// the requests it receives.
+type testServer struct {
+	*httptest.Server
+	dir    string
+	entity *openpgp.Entity
+
+	mu       sync.Mutex
+	requests []*http.Request
+	extra    map[string]string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	dir := newTestRepo(t)
+	if _, err := Create(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	entity := newTestEntity(t)
+	signRepomd(t, dir, entity)
+	s := &testServer{dir: dir, entity: entity, extra: make(map[string]string)}
+	files := http.FileServer(http.Dir(dir))
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r)
+		body, ok := s.extra[r.URL.Path]
+		s.mu.Unlock()
+		if ok {
+			fmt.Fprint(w, body)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) lastRequest() *http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func newTestEntity(t *testing.T) *openpgp.Entity {
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+func signRepomd(t *testing.T, dir string, entity *openpgp.Entity) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "repodata", "repomd.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(b), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "repodata", "repomd.xml.asc"), sig.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	c := &Client{
+		BaseURL: s.URL,
+		KeyRing: openpgp.EntityList{s.entity},
+	}
+	md, err := c.Metadata(ctx, "filelists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations, err := FindPackages(s.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Packages) != len(locations) {
+		t.Fatalf("Expected %d packages, got: %d", len(locations), len(md.Packages))
+	}
+	for _, p := range md.Packages {
+		b, err := ioutil.ReadFile(filepath.Join(s.dir, p.Location().Href))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := c.Download(ctx, p, &buf); err != nil {
+			t.Errorf("Error downloading %s: %v", p, err)
+		} else if !bytes.Equal(buf.Bytes(), b) {
+			t.Errorf("Expected downloaded %s to match", p)
+		}
+
+		pkg, err := c.ReadHeader(ctx, p)
+		if err != nil {
+			t.Errorf("Error reading header of %s: %v", p, err)
+			continue
+		}
+		if pkg.String() != p.String() {
+			t.Errorf("Expected %s, got: %s", p, pkg)
+		}
+		_, end := p.HeaderRange()
+		if r := s.lastRequest().Header.Get("Range"); r != fmt.Sprintf("bytes=0-%d", end-1) {
+			t.Errorf("Unexpected range: %s", r)
+		}
+		if end >= len(b) {
+			t.Errorf("Expected header range to exclude the payload of %s", p)
+		}
+	}
+}
+
+func TestClientDownloadVerification(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	c := &Client{BaseURL: s.URL}
+	md, err := c.Metadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := md.Packages[0]
+	p.p.Checksum.Value = strings.Repeat("0", 64)
+	if err := c.Download(ctx, p, ioutil.Discard); err == nil {
+		t.Errorf("Expected checksum error")
+	}
+
+	p = md.Packages[1]
+	p.p.Name = "wrong"
+	if _, err := c.ReadHeader(ctx, p); err == nil {
+		t.Errorf("Expected error reading header of mismatched package")
+	}
+
+	// packages with a base URL are downloaded from the base URL
+	p = md.Packages[2]
+	p.p.Location.Base = s.URL
+	c = &Client{BaseURL: "http://127.0.0.1:1/"}
+	if err := c.Download(ctx, p, ioutil.Discard); err != nil {
+		t.Errorf("Error downloading from base URL: %v", err)
+	}
+}
+
+func TestClientSignature(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	c := &Client{
+		BaseURL: s.URL,
+		KeyRing: openpgp.EntityList{newTestEntity(t)},
+	}
+	if _, err := c.Repomd(ctx); err != ErrSignatureCheckFailed {
+		t.Errorf("Expected ErrSignatureCheckFailed, got: %v", err)
+	}
+
+	s.mu.Lock()
+	s.extra["/repodata/repomd.xml"] = "<repomd/>"
+	s.mu.Unlock()
+	c.KeyRing = openpgp.EntityList{s.entity}
+	if _, err := c.Repomd(ctx); err != ErrSignatureCheckFailed {
+		t.Errorf("Expected ErrSignatureCheckFailed for modified repomd.xml, got: %v", err)
+	}
+}
+
+func TestClientMirrorList(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	s.extra["/mirrorlist"] = fmt.Sprintf("# mirrors\n\n%s/missing\n%s/\n", s.URL, s.URL)
+	c := &Client{
+		MirrorList: s.URL + "/mirrorlist",
+		KeyRing:    openpgp.EntityList{s.entity},
+	}
+	mirrors, err := c.Mirrors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{s.URL + "/missing/", s.URL + "/"}; fmt.Sprint(mirrors) != fmt.Sprint(expect) {
+		t.Errorf("Expected mirrors %v, got: %v", expect, mirrors)
+	}
+	if _, err := c.Metadata(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if c.current != 1 {
+		t.Errorf("Expected working mirror to be preferred")
+	}
+}
+
+func TestClientMetalink(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, "repodata", "repomd.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(b)
+	metalink := `<?xml version="1.0" encoding="utf-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+ <files>
+  <file name="repomd.xml">
+   <verification>
+    <hash type="md5">00000000000000000000000000000000</hash>
+    <hash type="sha256">%s</hash>
+   </verification>
+   <resources maxconnections="1">
+    <url protocol="rsync" type="rsync" preference="100">rsync://mirror.example.com/repo/repodata/repomd.xml</url>
+    <url protocol="http" type="http" preference="90">%s/repodata/repomd.xml</url>
+    <url protocol="http" type="http" preference="99">%s/missing/repodata/repomd.xml</url>
+   </resources>
+  </file>
+ </files>
+</metalink>
+`
+	s.extra["/metalink"] = fmt.Sprintf(metalink, hex.EncodeToString(sum[:]), s.URL, s.URL)
+	s.extra["/bad-metalink"] = fmt.Sprintf(metalink, strings.Repeat("0", 64), s.URL, s.URL)
+
+	c := &Client{Metalink: s.URL + "/metalink"}
+	mirrors, err := c.Mirrors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{s.URL + "/missing/", s.URL + "/"}; fmt.Sprint(mirrors) != fmt.Sprint(expect) {
+		t.Errorf("Expected mirrors %v, got: %v", expect, mirrors)
+	}
+	if _, err := c.Repomd(ctx); err != nil {
+		t.Errorf("Error fetching repomd.xml: %v", err)
+	}
+
+	c = &Client{Metalink: s.URL + "/bad-metalink"}
+	if _, err := c.Repomd(ctx); err == nil {
+		t.Errorf("Expected error for repomd.xml checksum mismatch")
+	}
+}
+
+func TestClientNoLocation(t *testing.T) {
+	if _, err := (&Client{}).Repomd(context.Background()); err == nil {
+		t.Errorf("Expected error")
+	}
+}
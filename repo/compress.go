@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression types supported for repository metadata files.
+const (
+	CompressionGzip = "gz"
+	CompressionXZ   = "xz"
+	CompressionZstd = "zst"
+)
+
+// Checksum types supported for repository metadata and packages.
+const (
+	ChecksumSHA1   = "sha1"
+	ChecksumSHA224 = "sha224"
+	ChecksumSHA256 = "sha256"
+	ChecksumSHA384 = "sha384"
+	ChecksumSHA512 = "sha512"
+)
+
+// newHash returns a new hash.Hash for the given checksum type. Yum uses "sha"
+// as an alias for sha1.
+func newHash(checksumType string) (hash.Hash, error) {
+	switch checksumType {
+	case ChecksumSHA1, "sha":
+		return sha1.New(), nil
+	case ChecksumSHA224:
+		return sha256.New224(), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumSHA384:
+		return sha512.New384(), nil
+	case ChecksumSHA512:
+		return sha512.New(), nil
+	}
+	return nil, errorf("unsupported checksum type: %s", checksumType)
+}
+
+// newCompressor returns a WriteCloser that compresses data written to w with
+// the given compression type. If compression is empty, data is written as is.
+func newCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "":
+		return nopWriteCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	case CompressionXZ:
+		return xz.NewWriter(w)
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, errorf("unsupported compression type: %s", compression)
+}
+
+// newDecompressor returns a ReadCloser that decompresses data read from r,
+// according to the file extension of name. Files with no known compression
+// extension are read as is.
+func newDecompressor(r io.Reader, name string) (io.ReadCloser, error) {
+	switch path.Ext(name) {
+	case ".gz":
+		return gzip.NewReader(r)
+	case ".bz2":
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	case ".xz":
+		z, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(z), nil
+	case ".zst":
+		z, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return z.IOReadCloser(), nil
+	}
+	return ioutil.NopCloser(r), nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,405 @@
+package repo
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Membership types of the packages in a group.
+const (
+	// Mandatory packages are always installed with the group.
+	GroupPackageMandatory = "mandatory"
+
+	// Default packages are installed with the group unless excluded.
+	GroupPackageDefault = "default"
+
+	// Optional packages are only installed if requested.
+	GroupPackageOptional = "optional"
+
+	// Conditional packages are installed if the package they require is also
+	// installed.
+	GroupPackageConditional = "conditional"
+)
+
+// Comps is the package group metadata of a repository, in the format of
+// comps.xml. Groups are sets of packages, such as "core" or "development
+// tools". Categories and environments are sets of groups.
+//
+// Translated names and descriptions are not retained.
+type Comps struct {
+	Groups       []*Group
+	Categories   []*Category
+	Environments []*Environment
+}
+
+// A Group is a named set of packages which may be installed together.
+type Group struct {
+	ID          string
+	Name        string
+	Description string
+
+	// Default indicates that the group is selected by default in installers.
+	Default bool
+
+	// UserVisible indicates that the group is shown in installers. Groups
+	// which are not visible are usually included by environments.
+	UserVisible bool
+
+	Packages []GroupPackage
+}
+
+// A GroupPackage is a package in a group.
+type GroupPackage struct {
+	Name string
+
+	// Type is the membership type of the package, such as
+	// GroupPackageMandatory.
+	Type string
+
+	// Requires is the name of the package which a conditional package
+	// depends on.
+	Requires string
+}
+
+// A Category is a named set of groups, used to organize groups in installers.
+type Category struct {
+	ID           string
+	Name         string
+	Description  string
+	DisplayOrder int
+	Groups       []string
+}
+
+// An Environment is a named set of groups which describes the purpose of a
+// system, such as "server" or "workstation".
+type Environment struct {
+	ID           string
+	Name         string
+	Description  string
+	DisplayOrder int
+
+	// Groups are the IDs of the groups which are always installed with the
+	// environment.
+	Groups []string
+
+	// Options are the groups which may optionally be installed with the
+	// environment.
+	Options []EnvironmentOption
+}
+
+// An EnvironmentOption is an optional group of an environment.
+type EnvironmentOption struct {
+	Group string
+
+	// Default indicates that the group is selected by default.
+	Default bool
+}
+
+// Group returns the group with the given ID, or nil if it is not found.
+func (c *Comps) Group(id string) *Group {
+	for _, g := range c.Groups {
+		if g.ID == id {
+			return g
+		}
+	}
+	return nil
+}
+
+// Category returns the category with the given ID, or nil if it is not
+// found.
+func (c *Comps) Category(id string) *Category {
+	for _, cat := range c.Categories {
+		if cat.ID == id {
+			return cat
+		}
+	}
+	return nil
+}
+
+// Environment returns the environment with the given ID, or nil if it is not
+// found.
+func (c *Comps) Environment(id string) *Environment {
+	for _, env := range c.Environments {
+		if env.ID == id {
+			return env
+		}
+	}
+	return nil
+}
+
+// CategoryGroups returns the groups in the given category. Groups which are
+// not defined in c are omitted.
+func (c *Comps) CategoryGroups(cat *Category) []*Group {
+	return c.groups(cat.Groups)
+}
+
+// EnvironmentGroups returns the groups which are installed with the given
+// environment. If defaults is true, optional groups which are selected by
+// default are included. Groups which are not defined in c are omitted.
+func (c *Comps) EnvironmentGroups(env *Environment, defaults bool) []*Group {
+	ids := env.Groups
+	if defaults {
+		ids = append([]string(nil), ids...)
+		for _, opt := range env.Options {
+			if opt.Default {
+				ids = append(ids, opt.Group)
+			}
+		}
+	}
+	return c.groups(ids)
+}
+
+func (c *Comps) groups(ids []string) []*Group {
+	var a []*Group
+	for _, id := range ids {
+		if g := c.Group(id); g != nil {
+			a = append(a, g)
+		}
+	}
+	return a
+}
+
+// Resolve returns the names of the packages in available which are members of
+// the group with one of the given membership types, in the order they are
+// listed in the group. Available lists the names of the packages that may be
+// installed, such as the packages of a repository or a directory of rpm files.
+// If no types are given, mandatory, default and conditional packages are
+// returned, as when the group is installed.
+//
+// A conditional package is returned only if the package it requires is
+// installed or installed with the group: if it is named in installed, which
+// lists the packages installed on the system or otherwise being installed,
+// or if it is a member of the group of the given types in available. The
+// names of mandatory, default and optional packages of the given types which
+// are not in available are returned as missing.
+func (c *Group) Resolve(available, installed []string, types ...string) (members, missing []string) {
+	if len(types) == 0 {
+		types = []string{GroupPackageMandatory, GroupPackageDefault, GroupPackageConditional}
+	}
+	found := make(map[string]bool, len(available))
+	for _, name := range available {
+		found[name] = true
+	}
+	present := make(map[string]bool, len(installed))
+	for _, name := range installed {
+		present[name] = true
+	}
+	for _, gp := range c.Packages {
+		if gp.Type != GroupPackageConditional && hasString(types, gp.Type) && found[gp.Name] {
+			present[gp.Name] = true
+		}
+	}
+	for _, gp := range c.Packages {
+		if !hasString(types, gp.Type) || hasString(members, gp.Name) {
+			continue
+		}
+		switch {
+		case gp.Type == GroupPackageConditional:
+			if found[gp.Name] && present[gp.Requires] {
+				members = append(members, gp.Name)
+			}
+		case found[gp.Name]:
+			members = append(members, gp.Name)
+		default:
+			missing = append(missing, gp.Name)
+		}
+	}
+	return members, missing
+}
+
+func hasString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// compsDoctype is the document type declaration of comps.xml.
+const compsDoctype = `<!DOCTYPE comps PUBLIC "-//Red Hat, Inc.//DTD Comps info//EN" "comps.dtd">`
+
+// xmlComps encodes comps.xml.
+type xmlComps struct {
+	XMLName      xml.Name         `xml:"comps"`
+	Groups       []xmlGroup       `xml:"group"`
+	Categories   []xmlCategory    `xml:"category"`
+	Environments []xmlEnvironment `xml:"environment"`
+}
+
+type xmlGroup struct {
+	ID           string          `xml:"id"`
+	Names        []xmlLangText   `xml:"name"`
+	Descriptions []xmlLangText   `xml:"description"`
+	Default      bool            `xml:"default"`
+	UserVisible  *bool           `xml:"uservisible"`
+	Packages     []xmlPackageReq `xml:"packagelist>packagereq"`
+}
+
+// xmlLangText is an element which may be repeated with translations of its
+// text in other languages.
+type xmlLangText struct {
+	Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr,omitempty"`
+	Text string `xml:",chardata"`
+}
+
+type xmlPackageReq struct {
+	Name     string `xml:",chardata"`
+	Type     string `xml:"type,attr,omitempty"`
+	Requires string `xml:"requires,attr,omitempty"`
+}
+
+type xmlCategory struct {
+	ID           string        `xml:"id"`
+	Names        []xmlLangText `xml:"name"`
+	Descriptions []xmlLangText `xml:"description"`
+	DisplayOrder *int          `xml:"display_order"`
+	Groups       []string      `xml:"grouplist>groupid"`
+}
+
+type xmlEnvironment struct {
+	ID           string        `xml:"id"`
+	Names        []xmlLangText `xml:"name"`
+	Descriptions []xmlLangText `xml:"description"`
+	DisplayOrder *int          `xml:"display_order"`
+	Groups       []string      `xml:"grouplist>groupid"`
+	Options      []xmlOption   `xml:"optionlist>groupid"`
+}
+
+type xmlOption struct {
+	Group   string `xml:",chardata"`
+	Default bool   `xml:"default,attr,omitempty"`
+}
+
+// untranslated returns the text of the element with no language attribute.
+func untranslated(a []xmlLangText) string {
+	for _, v := range a {
+		if v.Lang == "" {
+			return v.Text
+		}
+	}
+	return ""
+}
+
+func newLangText(s string) []xmlLangText {
+	return []xmlLangText{{Text: s}}
+}
+
+func newDisplayOrder(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+func displayOrder(n *int) int {
+	if n == nil {
+		return 0
+	}
+	return *n
+}
+
+// ReadComps reads the comps.xml document from r.
+func ReadComps(r io.Reader) (*Comps, error) {
+	var v xmlComps
+	if err := xml.NewDecoder(r).Decode(&v); err != nil {
+		return nil, errorf("error reading comps document: %v", err)
+	}
+	comps := &Comps{}
+	for _, g := range v.Groups {
+		group := &Group{
+			ID:          g.ID,
+			Name:        untranslated(g.Names),
+			Description: untranslated(g.Descriptions),
+			Default:     g.Default,
+			UserVisible: g.UserVisible == nil || *g.UserVisible,
+		}
+		for _, req := range g.Packages {
+			typ := req.Type
+			if typ == "" {
+				typ = GroupPackageMandatory
+			}
+			group.Packages = append(group.Packages, GroupPackage{
+				Name:     req.Name,
+				Type:     typ,
+				Requires: req.Requires,
+			})
+		}
+		comps.Groups = append(comps.Groups, group)
+	}
+	for _, cat := range v.Categories {
+		comps.Categories = append(comps.Categories, &Category{
+			ID:           cat.ID,
+			Name:         untranslated(cat.Names),
+			Description:  untranslated(cat.Descriptions),
+			DisplayOrder: displayOrder(cat.DisplayOrder),
+			Groups:       cat.Groups,
+		})
+	}
+	for _, env := range v.Environments {
+		environment := &Environment{
+			ID:           env.ID,
+			Name:         untranslated(env.Names),
+			Description:  untranslated(env.Descriptions),
+			DisplayOrder: displayOrder(env.DisplayOrder),
+			Groups:       env.Groups,
+		}
+		for _, opt := range env.Options {
+			environment.Options = append(environment.Options, EnvironmentOption(opt))
+		}
+		comps.Environments = append(comps.Environments, environment)
+	}
+	return comps, nil
+}
+
+// WriteComps writes comps to w as a comps.xml document.
+func WriteComps(w io.Writer, comps *Comps) error {
+	v := &xmlComps{}
+	for _, g := range comps.Groups {
+		userVisible := g.UserVisible
+		group := xmlGroup{
+			ID:           g.ID,
+			Names:        newLangText(g.Name),
+			Descriptions: newLangText(g.Description),
+			Default:      g.Default,
+			UserVisible:  &userVisible,
+		}
+		for _, p := range g.Packages {
+			group.Packages = append(group.Packages, xmlPackageReq(p))
+		}
+		v.Groups = append(v.Groups, group)
+	}
+	for _, cat := range comps.Categories {
+		v.Categories = append(v.Categories, xmlCategory{
+			ID:           cat.ID,
+			Names:        newLangText(cat.Name),
+			Descriptions: newLangText(cat.Description),
+			DisplayOrder: newDisplayOrder(cat.DisplayOrder),
+			Groups:       cat.Groups,
+		})
+	}
+	for _, env := range comps.Environments {
+		environment := xmlEnvironment{
+			ID:           env.ID,
+			Names:        newLangText(env.Name),
+			Descriptions: newLangText(env.Description),
+			DisplayOrder: newDisplayOrder(env.DisplayOrder),
+			Groups:       env.Groups,
+		}
+		for _, opt := range env.Options {
+			environment.Options = append(environment.Options, xmlOption(opt))
+		}
+		v.Environments = append(v.Environments, environment)
+	}
+
+	if _, err := io.WriteString(w, xml.Header+compsDoctype+"\n"); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
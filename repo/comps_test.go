@@ -0,0 +1,271 @@
+package repo
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+const testComps = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE comps PUBLIC "-//Red Hat, Inc.//DTD Comps info//EN" "comps.dtd">
+<comps>
+  <group>
+    <id>core</id>
+    <name>Core</name>
+    <name xml:lang="de">Kern</name>
+    <description>Smallest possible installation</description>
+    <description xml:lang="de">Kleinstmögliche Installation</description>
+    <default>true</default>
+    <uservisible>false</uservisible>
+    <packagelist>
+      <packagereq type="mandatory">centos-release</packagereq>
+      <packagereq>epel-release</packagereq>
+      <packagereq type="default">hello</packagereq>
+      <packagereq type="optional">centos-release-as</packagereq>
+      <packagereq type="conditional" requires="epel-release">world</packagereq>
+      <packagereq type="conditional" requires="centos-release">centos-release-as</packagereq>
+    </packagelist>
+  </group>
+  <group>
+    <id>extras</id>
+    <name>Extras</name>
+    <description/>
+    <packagelist>
+      <packagereq type="default">epel-release</packagereq>
+    </packagelist>
+  </group>
+  <category>
+    <id>base-system</id>
+    <name>Base System</name>
+    <description>Basic system components.</description>
+    <display_order>10</display_order>
+    <grouplist>
+      <groupid>core</groupid>
+      <groupid>missing</groupid>
+    </grouplist>
+  </category>
+  <environment>
+    <id>minimal-environment</id>
+    <name>Minimal Install</name>
+    <description>Basic functionality.</description>
+    <display_order>5</display_order>
+    <grouplist>
+      <groupid>core</groupid>
+    </grouplist>
+    <optionlist>
+      <groupid default="true">extras</groupid>
+      <groupid>missing</groupid>
+    </optionlist>
+  </environment>
+</comps>
+`
+
+func TestReadComps(t *testing.T) {
+	comps, err := ReadComps(strings.NewReader(testComps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &Comps{
+		Groups: []*Group{
+			{
+				ID:          "core",
+				Name:        "Core",
+				Description: "Smallest possible installation",
+				Default:     true,
+				Packages: []GroupPackage{
+					{Name: "centos-release", Type: GroupPackageMandatory},
+					{Name: "epel-release", Type: GroupPackageMandatory},
+					{Name: "hello", Type: GroupPackageDefault},
+					{Name: "centos-release-as", Type: GroupPackageOptional},
+					{Name: "world", Type: GroupPackageConditional, Requires: "epel-release"},
+					{Name: "centos-release-as", Type: GroupPackageConditional, Requires: "centos-release"},
+				},
+			},
+			{
+				ID:          "extras",
+				Name:        "Extras",
+				UserVisible: true,
+				Packages: []GroupPackage{
+					{Name: "epel-release", Type: GroupPackageDefault},
+				},
+			},
+		},
+		Categories: []*Category{{
+			ID:           "base-system",
+			Name:         "Base System",
+			Description:  "Basic system components.",
+			DisplayOrder: 10,
+			Groups:       []string{"core", "missing"},
+		}},
+		Environments: []*Environment{{
+			ID:           "minimal-environment",
+			Name:         "Minimal Install",
+			Description:  "Basic functionality.",
+			DisplayOrder: 5,
+			Groups:       []string{"core"},
+			Options: []EnvironmentOption{
+				{Group: "extras", Default: true},
+				{Group: "missing"},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(comps, expect) {
+		t.Errorf("Expected %+v, got: %+v", expect, comps)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteComps(&buf, comps); err != nil {
+		t.Fatal(err)
+	}
+	actual, err := ReadComps(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, comps) {
+		t.Errorf("Expected written comps to match, got: %+v", actual)
+	}
+}
+
+func TestCompsGroups(t *testing.T) {
+	comps, err := ReadComps(strings.NewReader(testComps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := func(groups []*Group) []string {
+		var a []string
+		for _, g := range groups {
+			a = append(a, g.ID)
+		}
+		return a
+	}
+	tests := []struct {
+		Groups []*Group
+		Expect []string
+	}{
+		{comps.CategoryGroups(comps.Category("base-system")), []string{"core"}},
+		{comps.EnvironmentGroups(comps.Environment("minimal-environment"), false), []string{"core"}},
+		{comps.EnvironmentGroups(comps.Environment("minimal-environment"), true), []string{"core", "extras"}},
+	}
+	for i, test := range tests {
+		if actual := ids(test.Groups); !reflect.DeepEqual(actual, test.Expect) {
+			t.Errorf("%d: Expected %v, got: %v", i, test.Expect, actual)
+		}
+	}
+	if comps.Group("missing") != nil || comps.Category("missing") != nil || comps.Environment("missing") != nil {
+		t.Errorf("Expected nil for undefined IDs")
+	}
+}
+
+func TestCreateComps(t *testing.T) {
+	dir := newTestRepo(t)
+	comps, err := ReadComps(strings.NewReader(testComps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repomd, err := Create(dir, &Options{Comps: comps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{"group", "group_gz"} {
+		data := repomd.Get(typ)
+		if data == nil {
+			t.Errorf("Expected %s metadata", typ)
+			continue
+		}
+		actual, err := ReadComps(bytes.NewReader(readMetadata(t, dir, data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, comps) {
+			t.Errorf("Expected %s to match, got: %+v", typ, actual)
+		}
+	}
+
+	md, err := Open(dir, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Comps == nil {
+		t.Fatalf("Expected comps to be read")
+	}
+	tests := []struct {
+		Installed []string
+		Types     []string
+		Members   []string
+		Missing   []string
+	}{
+		{
+			// centos-release is installed with the group
+			nil,
+			nil,
+			[]string{"centos-release", "epel-release", "centos-release-as"},
+			[]string{"hello"},
+		},
+		{
+			nil,
+			[]string{GroupPackageOptional},
+			[]string{"centos-release-as"},
+			nil,
+		},
+		{
+			// centos-release is not installed
+			nil,
+			[]string{GroupPackageConditional},
+			nil,
+			nil,
+		},
+		{
+			// world is not in the repository
+			[]string{"centos-release", "epel-release"},
+			[]string{GroupPackageConditional},
+			[]string{"centos-release-as"},
+			nil,
+		},
+	}
+	var available []string
+	for _, p := range md.Packages {
+		available = append(available, p.Name())
+	}
+	for _, test := range tests {
+		members, missing := md.Comps.Group("core").Resolve(available, test.Installed, test.Types...)
+		if !reflect.DeepEqual(members, test.Members) {
+			t.Errorf("Expected %v members of type %v, got: %v", test.Members, test.Types, members)
+		}
+		if !reflect.DeepEqual(missing, test.Missing) {
+			t.Errorf("Expected %v missing of type %v, got: %v", test.Missing, test.Types, missing)
+		}
+	}
+}
+
+func TestResolveRPMPackages(t *testing.T) {
+	comps, err := ReadComps(strings.NewReader(testComps))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var available []string
+	for _, name := range []string{
+		"epel-release-7-5.noarch.rpm",
+		"centos-release-as-2.1AS-4.noarch.rpm",
+	} {
+		p, err := rpm.Open("../testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		available = append(available, p.Name())
+	}
+	group := comps.Group("core")
+	members, missing := group.Resolve(available, nil)
+	if expect := []string{"epel-release"}; !reflect.DeepEqual(members, expect) {
+		t.Errorf("Expected members %v, got: %v", expect, members)
+	}
+	if expect := []string{"centos-release", "hello"}; !reflect.DeepEqual(missing, expect) {
+		t.Errorf("Expected missing %v, got: %v", expect, missing)
+	}
+	members, _ = group.Resolve(available, []string{"centos-release"})
+	if expect := []string{"epel-release", "centos-release-as"}; !reflect.DeepEqual(members, expect) {
+		t.Errorf("Expected members %v with centos-release installed, got: %v", expect, members)
+	}
+}
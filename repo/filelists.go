@@ -0,0 +1,29 @@
+package repo
+
+import "encoding/xml"
+
+// filelistsPackage is a package entry in filelists.xml.
+type filelistsPackage struct {
+	XMLName xml.Name   `xml:"package"`
+	PkgID   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version xmlVersion `xml:"version"`
+	Files   []xmlFile  `xml:"file"`
+}
+
+// newFilelistsPackage returns the filelists.xml entry for p.
+func newFilelistsPackage(p *PackageFile) *filelistsPackage {
+	files := p.Files()
+	a := make([]xmlFile, len(files))
+	for i, f := range files {
+		a[i] = newXMLFile(f)
+	}
+	return &filelistsPackage{
+		PkgID:   p.Checksum.Value,
+		Name:    p.Name(),
+		Arch:    packageArch(p.Package),
+		Version: newXMLVersion(p.Package),
+		Files:   a,
+	}
+}
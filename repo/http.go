@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// An HTTPReaderAt reads a remote file using HTTP range requests. Each call to
+// ReadAt makes one request.
+//
+// HTTPReaderAt may be used with rpm.OpenReaderAt to read the headers of a
+// remote package without downloading its payload.
+type HTTPReaderAt struct {
+	ctx    context.Context
+	client *http.Client
+	url    string
+	size   int64
+}
+
+var _ io.ReaderAt = &HTTPReaderAt{}
+
+// NewHTTPReaderAt returns an HTTPReaderAt for the file at url. The size of the
+// file is determined with a request for its first byte. An error is returned
+// if the server does not support range requests.
+//
+// If client is nil, http.DefaultClient is used. The given context applies to
+// all requests made by the returned reader.
+func NewHTTPReaderAt(ctx context.Context, client *http.Client, url string) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &HTTPReaderAt{ctx: ctx, client: client, url: url}
+	resp, err := c.get(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	// Content-Range: bytes 0-0/12345
+	s := resp.Header.Get("Content-Range")
+	i := strings.LastIndexByte(s, '/')
+	if i < 0 {
+		return nil, errorf("GET %s: invalid Content-Range: %s", url, s)
+	}
+	if c.size, err = strconv.ParseInt(s[i+1:], 10, 64); err != nil {
+		return nil, errorf("GET %s: unknown file size in Content-Range: %s", url, s)
+	}
+	return c, nil
+}
+
+// Size returns the size of the remote file in bytes.
+func (c *HTTPReaderAt) Size() int64 { return c.size }
+
+// ReadAt reads len(p) bytes from the remote file at offset off.
+func (c *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errorf("negative offset: %d", off)
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := off + int64(len(p))
+	if end > c.size {
+		end = c.size
+	}
+	resp, err := c.get(off, end-1)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// get requests the bytes from start to end inclusive. An error is returned
+// unless the server responds with partial content.
+func (c *HTTPReaderAt) get(start, end int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return nil, errorf("GET %s: server does not support range requests", c.url)
+		}
+		return nil, errorf("GET %s: %s", c.url, resp.Status)
+	}
+	return resp, nil
+}
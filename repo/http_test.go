@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+func TestHTTPReaderAt(t *testing.T) {
+	ctx := context.Background()
+	s := newTestServer(t)
+	c := &Client{BaseURL: s.URL}
+	md, err := c.Metadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range md.Packages {
+		s.mu.Lock()
+		s.requests = nil
+		s.mu.Unlock()
+
+		r, err := c.ReaderAt(ctx, p)
+		if err != nil {
+			t.Errorf("Error opening %s: %v", p, err)
+			continue
+		}
+		if r.Size() != p.PackageSize() {
+			t.Errorf("Expected size %d for %s, got: %d", p.PackageSize(), p, r.Size())
+		}
+		pkg, err := rpm.OpenReaderAt(r, r.Size())
+		if err != nil {
+			t.Errorf("Error reading %s: %v", p, err)
+			continue
+		}
+		if pkg.String() != p.String() {
+			t.Errorf("Expected %s, got: %s", p, pkg)
+		}
+
+		// one request for the size and three for the headers
+		s.mu.Lock()
+		n := len(s.requests)
+		s.mu.Unlock()
+		if n != 4 {
+			t.Errorf("Expected 4 requests for %s, got: %d", p, n)
+		}
+	}
+}
+
+func TestHTTPReaderAtReadAt(t *testing.T) {
+	body := "0123456789"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}))
+	defer srv.Close()
+
+	r, err := NewHTTPReaderAt(context.Background(), nil, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		Off  int64
+		Len  int
+		Want string
+		Err  error
+	}{
+		{0, 4, "0123", nil},
+		{6, 4, "6789", nil},
+		{8, 4, "89", io.EOF},
+		{10, 4, "", io.EOF},
+	}
+	for _, test := range tests {
+		p := make([]byte, test.Len)
+		n, err := r.ReadAt(p, test.Off)
+		if err != test.Err {
+			t.Errorf("Expected error %v reading %d bytes at %d, got: %v", test.Err, test.Len, test.Off, err)
+		}
+		if s := string(p[:n]); s != test.Want {
+			t.Errorf("Expected %q reading %d bytes at %d, got: %q", test.Want, test.Len, test.Off, s)
+		}
+	}
+}
+
+func TestHTTPReaderAtNoRanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "0123456789")
+	}))
+	defer srv.Close()
+	if _, err := NewHTTPReaderAt(context.Background(), nil, srv.URL); err == nil {
+		t.Errorf("Expected error for server without range support")
+	}
+}
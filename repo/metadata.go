@@ -0,0 +1,193 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// A Package is a package record read from repository metadata.
+//
+// Package exposes the same accessors as rpm.Package for the fields which are
+// included in repository metadata, so that packages may be queried without
+// downloading them.
+type Package struct {
+	p         primaryRecord
+	deps      [8][]rpm.Dependency
+	files     []File
+	changelog []rpm.ChangelogEntry
+}
+
+var _ rpm.Version = &Package{}
+
+// Indexes of each dependency type in Package.deps.
+const (
+	depProvides = iota
+	depRequires
+	depConflicts
+	depObsoletes
+	depSuggests
+	depEnhances
+	depRecommends
+	depSupplements
+)
+
+// A File is a file listed in repository metadata.
+type File struct {
+	// Name is the absolute path of the file.
+	Name string
+
+	// Type is "dir" for directories, "ghost" for files which are not included
+	// in the package payload, or empty for other files.
+	Type string
+}
+
+// IsDir returns true if the file is a directory.
+func (f File) IsDir() bool { return f.Type == "dir" }
+
+// String returns the package identifier in the form
+// '[name]-[version]-[release].[architecture]'.
+func (c *Package) String() string {
+	return fmt.Sprintf("%s-%s-%s.%s", c.Name(), c.Version(), c.Release(), c.Architecture())
+}
+
+func (c *Package) Name() string { return c.p.Name }
+
+func (c *Package) Epoch() int { return c.p.Version.Epoch }
+
+func (c *Package) Version() string { return c.p.Version.Version }
+
+func (c *Package) Release() string { return c.p.Version.Release }
+
+// Architecture returns the architecture of the package. Source packages have
+// the architecture "src".
+func (c *Package) Architecture() string { return c.p.Arch }
+
+// NEVRA returns the name, epoch, version, release and architecture of the
+// package.
+func (c *Package) NEVRA() *rpm.NEVRA {
+	return rpm.NewNEVRA(c.Name(), c.Epoch(), c.Version(), c.Release(), c.Architecture())
+}
+
+// Checksum returns the checksum of the package file, which identifies the
+// package in repository metadata.
+func (c *Package) Checksum() Checksum {
+	return Checksum{Type: c.p.Checksum.Type, Value: c.p.Checksum.Value}
+}
+
+// Location returns the location of the package file, relative to the root of
+// the repository or to Location.Base if it is set.
+func (c *Package) Location() Location { return c.p.Location }
+
+// PackageSize returns the size of the package file in bytes.
+func (c *Package) PackageSize() int64 { return c.p.Size.Package }
+
+// FileTime returns the modification time of the package file when the
+// metadata was generated.
+func (c *Package) FileTime() time.Time { return time.Unix(c.p.Time.File, 0) }
+
+func (c *Package) Summary() string { return c.p.Summary }
+
+func (c *Package) Description() string { return c.p.Description }
+
+func (c *Package) Packager() string { return c.p.Packager }
+
+func (c *Package) URL() string { return c.p.URL }
+
+func (c *Package) License() string { return c.p.Format.License }
+
+func (c *Package) Vendor() string { return c.p.Format.Vendor }
+
+func (c *Package) Groups() []string {
+	if c.p.Format.Group == "" {
+		return nil
+	}
+	return []string{c.p.Format.Group}
+}
+
+func (c *Package) BuildHost() string { return c.p.Format.BuildHost }
+
+func (c *Package) BuildTime() time.Time { return time.Unix(c.p.Time.Build, 0) }
+
+func (c *Package) SourceRPM() string { return c.p.Format.SourceRPM }
+
+// Size specifies the disk space consumed by installation of the package.
+func (c *Package) Size() uint64 { return c.p.Size.Installed }
+
+// ArchiveSize specifies the size of the archived payload of the package in
+// bytes.
+func (c *Package) ArchiveSize() uint64 { return c.p.Size.Archive }
+
+// HeaderRange returns the byte offsets of the rpm header in the package file.
+func (c *Package) HeaderRange() (start, end int) {
+	return c.p.Format.HeaderRange.Start, c.p.Format.HeaderRange.End
+}
+
+// IsSource returns true if the package is a source package.
+func (c *Package) IsSource() bool { return c.p.Arch == "src" }
+
+// Requires returns the requirements of the package. Requirements on rpmlib()
+// features and on files in the package itself are omitted from repository
+// metadata. Requirements which must be installed before the package have the
+// rpm.DepFlagPrereq flag.
+func (c *Package) Requires() []rpm.Dependency { return c.deps[depRequires] }
+
+func (c *Package) Provides() []rpm.Dependency { return c.deps[depProvides] }
+
+func (c *Package) Conflicts() []rpm.Dependency { return c.deps[depConflicts] }
+
+func (c *Package) Obsoletes() []rpm.Dependency { return c.deps[depObsoletes] }
+
+func (c *Package) Suggests() []rpm.Dependency { return c.deps[depSuggests] }
+
+func (c *Package) Enhances() []rpm.Dependency { return c.deps[depEnhances] }
+
+func (c *Package) Recommends() []rpm.Dependency { return c.deps[depRecommends] }
+
+func (c *Package) Supplements() []rpm.Dependency { return c.deps[depSupplements] }
+
+// Satisfies returns true if the package, or one of the capabilities it
+// provides, satisfies the given requirement. File requirements are satisfied
+// by the files listed in the metadata.
+func (c *Package) Satisfies(req rpm.Dependency) bool {
+	if req == nil {
+		return false
+	}
+	self := rpm.NewDependency(rpm.DepFlagEqual, c.Name(), c.Epoch(), c.Version(), c.Release())
+	if rpm.Satisfies(req, self) {
+		return true
+	}
+	for _, p := range c.Provides() {
+		if rpm.Satisfies(req, p) {
+			return true
+		}
+	}
+	if strings.HasPrefix(req.Name(), "/") {
+		for _, f := range c.Files() {
+			if f.Name == req.Name() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Files returns the files in the package. Only the files listed in
+// primary.xml, such as those in /etc and bin directories, are included unless
+// filelists.xml has been read.
+func (c *Package) Files() []File {
+	if c.files != nil {
+		return c.files
+	}
+	a := make([]File, len(c.p.Format.Files))
+	for i, f := range c.p.Format.Files {
+		a[i] = File{Name: f.Name, Type: f.Type}
+	}
+	return a
+}
+
+// Changelog returns the changelog entries of the package, most recent first.
+// Changelogs are only available if other.xml has been read.
+func (c *Package) Changelog() []rpm.ChangelogEntry { return c.changelog }
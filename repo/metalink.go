@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// metalink is a metalink document listing the mirrors of repomd.xml and its
+// expected checksums.
+type metalink struct {
+	Files []struct {
+		Name         string               `xml:"name,attr"`
+		Verification metalinkVerification `xml:"verification"`
+		Alternates   []struct {
+			Verification metalinkVerification `xml:"verification"`
+		} `xml:"alternates>alternate"`
+		URLs []struct {
+			Protocol   string `xml:"protocol,attr"`
+			Preference int    `xml:"preference,attr"`
+			Value      string `xml:",chardata"`
+		} `xml:"resources>url"`
+	} `xml:"files>file"`
+}
+
+// metalinkVerification lists the checksums of a file. Alternates list the
+// checksums of recent versions of the file, which mirrors may still serve.
+type metalinkVerification struct {
+	Hashes []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"hash"`
+}
+
+func (c *metalinkVerification) checksums() []Checksum {
+	a := make([]Checksum, len(c.Hashes))
+	for i, h := range c.Hashes {
+		a[i] = Checksum{Type: h.Type, Value: strings.TrimSpace(h.Value)}
+	}
+	return a
+}
+
+// readMetalink reads a metalink document from r and returns the base URLs of
+// the listed mirrors, in order of preference, and the accepted checksums of
+// repomd.xml.
+func readMetalink(r io.Reader) (mirrors []string, checksums []Checksum, err error) {
+	var ml metalink
+	if err := xml.NewDecoder(r).Decode(&ml); err != nil {
+		return nil, nil, errorf("error reading metalink: %v", err)
+	}
+	for _, f := range ml.Files {
+		if f.Name != "repomd.xml" {
+			continue
+		}
+		checksums = append(checksums, f.Verification.checksums()...)
+		for _, alt := range f.Alternates {
+			checksums = append(checksums, alt.Verification.checksums()...)
+		}
+		urls := f.URLs
+		sort.SliceStable(urls, func(i, j int) bool {
+			return urls[i].Preference > urls[j].Preference
+		})
+		for _, u := range urls {
+			if u.Protocol != "" && u.Protocol != "http" && u.Protocol != "https" {
+				continue
+			}
+			s := strings.TrimSpace(u.Value)
+			if !strings.HasSuffix(s, "/repodata/repomd.xml") {
+				continue
+			}
+			mirrors = append(mirrors, strings.TrimSuffix(s, "repodata/repomd.xml"))
+		}
+	}
+	if len(mirrors) == 0 {
+		return nil, nil, errorf("metalink lists no mirrors for repomd.xml")
+	}
+	return mirrors, checksums, nil
+}
+
+// readMirrorList reads a plain text mirror list, with one base URL per line,
+// from r. Empty lines and comments are ignored.
+func readMirrorList(r io.Reader) ([]string, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var mirrors []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		mirrors = append(mirrors, line)
+	}
+	if len(mirrors) == 0 {
+		return nil, errorf("mirror list is empty")
+	}
+	return mirrors, nil
+}
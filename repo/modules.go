@@ -0,0 +1,438 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+	"gopkg.in/yaml.v3"
+)
+
+// A ModuleIndex is the modularity metadata of a repository, stored in
+// modules.yaml. Modules are alternative streams of a set of packages, such as
+// nodejs:10 and nodejs:14, of which only one may be installed.
+type ModuleIndex struct {
+	Modules   []*Module
+	Defaults  []*ModuleDefaults
+	Obsoletes []*ModuleObsoletes
+}
+
+// A Module is a build of a module stream, described by a modulemd version 2
+// document.
+type Module struct {
+	Name        string
+	Stream      string
+	Version     uint64
+	Context     string
+	Arch        string
+	Summary     string
+	Description string
+
+	// Dependencies lists alternative sets of module streams which the module
+	// requires at build and run time.
+	Dependencies []ModuleDependencies
+
+	// Profiles are the named sets of packages which may be installed from the
+	// module, such as "common" or "minimal".
+	Profiles map[string][]string
+
+	// Artifacts are the packages built for the module, in the form
+	// 'name-epoch:version-release.arch'.
+	Artifacts []string
+}
+
+// ModuleDependencies are the module streams which a module requires. Each
+// key is a module name. An empty list of streams means any stream.
+type ModuleDependencies struct {
+	BuildRequires map[string][]string
+	Requires      map[string][]string
+}
+
+// ModuleDefaults are the default stream and profiles of a module.
+type ModuleDefaults struct {
+	Module string
+
+	// Stream is the default stream of the module, if any.
+	Stream string
+
+	// Profiles are the profiles installed by default, by stream.
+	Profiles map[string][]string
+}
+
+// ModuleObsoletes marks a module stream as end of life and may name the
+// stream which replaces it.
+type ModuleObsoletes struct {
+	Module   string
+	Stream   string
+	Context  string
+	Modified time.Time
+	Reset    bool
+	EOLDate  time.Time
+	Message  string
+
+	// ObsoletedByModule and ObsoletedByStream name the replacement stream,
+	// if any.
+	ObsoletedByModule string
+	ObsoletedByStream string
+}
+
+// String returns the module name, stream, version, context and architecture
+// in the form 'name:stream:version:context:arch'.
+func (c *Module) String() string {
+	return fmt.Sprintf("%s:%s:%d:%s:%s", c.Name, c.Stream, c.Version, c.Context, c.Arch)
+}
+
+// Label returns the modularity label of the packages built for the module,
+// in the form 'name:stream:version:context'.
+func (c *Module) Label() string {
+	return fmt.Sprintf("%s:%s:%d:%s", c.Name, c.Stream, c.Version, c.Context)
+}
+
+// DefaultStream returns the default stream of the named module, or an empty
+// string if it has none.
+func (c *ModuleIndex) DefaultStream(name string) string {
+	for _, d := range c.Defaults {
+		if d.Module == name {
+			return d.Stream
+		}
+	}
+	return ""
+}
+
+// PackageModules returns the modules which list p as an artifact.
+func (c *ModuleIndex) PackageModules(p *Package) []*Module {
+	return c.artifactModules(p.NEVRA())
+}
+
+// LabelModules returns the modules with the given modularity label, as
+// returned by rpm.Package.ModularityLabel. Modules of each architecture share
+// the same label.
+func (c *ModuleIndex) LabelModules(label string) []*Module {
+	var a []*Module
+	for _, m := range c.Modules {
+		if m.Label() == label {
+			a = append(a, m)
+		}
+	}
+	return a
+}
+
+func (c *ModuleIndex) artifactModules(nevra *rpm.NEVRA) []*Module {
+	key := nevra.FullString()
+	var a []*Module
+	for _, m := range c.Modules {
+		for _, artifact := range m.Artifacts {
+			if n, err := rpm.ParseNEVRA(artifact); err == nil && n.FullString() == key {
+				a = append(a, m)
+				break
+			}
+		}
+	}
+	return a
+}
+
+// Filter returns the packages in pkgs which are visible when the default
+// stream of each module is active, as dnf does.
+//
+// A modular package, which is listed as an artifact of a module, is only
+// visible if its module stream is active. A non-modular package is hidden if
+// a package with the same name belongs to an active module stream, so that
+// modular packages take precedence.
+//
+// Enabled streams, given in the form 'name:stream', replace the default
+// streams of their modules. Modules with no default stream are inactive unless
+// enabled.
+func (c *ModuleIndex) Filter(pkgs []*Package, enabled ...string) []*Package {
+	f := c.newModuleFilter(enabled)
+	streams := make([][]moduleStream, len(pkgs))
+	for i, p := range pkgs {
+		streams[i] = f.artifactStreams(p.NEVRA())
+		f.addPackage(p.Name(), streams[i])
+	}
+	var a []*Package
+	for i, p := range pkgs {
+		if f.visible(p.Name(), streams[i]) {
+			a = append(a, p)
+		}
+	}
+	return a
+}
+
+// FilterRPMPackages is like Filter, for packages read from rpm files. The
+// module of a package is determined by its modularity label or, if it has
+// none, by the artifacts of each module.
+func (c *ModuleIndex) FilterRPMPackages(pkgs []*rpm.Package, enabled ...string) []*rpm.Package {
+	f := c.newModuleFilter(enabled)
+	streams := make([][]moduleStream, len(pkgs))
+	for i, p := range pkgs {
+		if label := p.ModularityLabel(); label != "" {
+			streams[i] = []moduleStream{parseModuleStream(label)}
+		} else {
+			streams[i] = f.artifactStreams(p.NEVRA())
+		}
+		f.addPackage(p.Name(), streams[i])
+	}
+	var a []*rpm.Package
+	for i, p := range pkgs {
+		if f.visible(p.Name(), streams[i]) {
+			a = append(a, p)
+		}
+	}
+	return a
+}
+
+// moduleStream identifies a module stream.
+type moduleStream struct {
+	name   string
+	stream string
+}
+
+// parseModuleStream returns the module stream in a string in the form
+// 'name:stream', optionally followed by other fields, as in a modularity
+// label.
+func parseModuleStream(s string) moduleStream {
+	a := strings.SplitN(s, ":", 3)
+	if len(a) < 2 {
+		return moduleStream{name: a[0]}
+	}
+	return moduleStream{name: a[0], stream: a[1]}
+}
+
+// moduleFilter determines which packages are visible when certain module
+// streams are active.
+type moduleFilter struct {
+	active    map[string]string         // stream of each active module
+	artifacts map[string][]moduleStream // module streams by artifact
+	names     map[string]bool           // names of active modular packages
+}
+
+func (c *ModuleIndex) newModuleFilter(enabled []string) *moduleFilter {
+	f := &moduleFilter{
+		active:    make(map[string]string),
+		artifacts: make(map[string][]moduleStream),
+		names:     make(map[string]bool),
+	}
+	for _, d := range c.Defaults {
+		if d.Stream != "" {
+			f.active[d.Module] = d.Stream
+		}
+	}
+	for _, s := range enabled {
+		if ms := parseModuleStream(s); ms.stream != "" {
+			f.active[ms.name] = ms.stream
+		}
+	}
+	for _, m := range c.Modules {
+		ms := moduleStream{name: m.Name, stream: m.Stream}
+		for _, artifact := range m.Artifacts {
+			n, err := rpm.ParseNEVRA(artifact)
+			if err != nil {
+				continue
+			}
+			f.artifacts[n.FullString()] = append(f.artifacts[n.FullString()], ms)
+			if f.active[ms.name] == ms.stream {
+				f.names[n.Name()] = true
+			}
+		}
+	}
+	return f
+}
+
+// artifactStreams returns the module streams which list the given package as
+// an artifact.
+func (f *moduleFilter) artifactStreams(nevra *rpm.NEVRA) []moduleStream {
+	return f.artifacts[nevra.FullString()]
+}
+
+// addPackage records the name of a package if it belongs to an active module
+// stream.
+func (f *moduleFilter) addPackage(name string, streams []moduleStream) {
+	for _, ms := range streams {
+		if f.active[ms.name] == ms.stream {
+			f.names[name] = true
+		}
+	}
+}
+
+// visible returns true if a package with the given name, which belongs to the
+// given module streams, is visible.
+func (f *moduleFilter) visible(name string, streams []moduleStream) bool {
+	if len(streams) == 0 {
+		return !f.names[name]
+	}
+	for _, ms := range streams {
+		if f.active[ms.name] == ms.stream {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlDocument is a document in modules.yaml. The type of its data depends on
+// the document type.
+type yamlDocument struct {
+	Document string    `yaml:"document"`
+	Version  int       `yaml:"version"`
+	Data     yaml.Node `yaml:"data"`
+}
+
+type yamlModule struct {
+	Name         string `yaml:"name"`
+	Stream       string `yaml:"stream"`
+	Version      uint64 `yaml:"version"`
+	Context      string `yaml:"context"`
+	Arch         string `yaml:"arch"`
+	Summary      string `yaml:"summary"`
+	Description  string `yaml:"description"`
+	Dependencies []struct {
+		BuildRequires map[string][]string `yaml:"buildrequires"`
+		Requires      map[string][]string `yaml:"requires"`
+	} `yaml:"dependencies"`
+	Profiles map[string]struct {
+		RPMs []string `yaml:"rpms"`
+	} `yaml:"profiles"`
+	Artifacts struct {
+		RPMs []string `yaml:"rpms"`
+	} `yaml:"artifacts"`
+}
+
+type yamlModuleDefaults struct {
+	Module   string              `yaml:"module"`
+	Stream   string              `yaml:"stream"`
+	Profiles map[string][]string `yaml:"profiles"`
+}
+
+type yamlModuleObsoletes struct {
+	Modified    string `yaml:"modified"`
+	Reset       bool   `yaml:"reset"`
+	Module      string `yaml:"module"`
+	Stream      string `yaml:"stream"`
+	Context     string `yaml:"context"`
+	EOLDate     string `yaml:"eol_date"`
+	Message     string `yaml:"message"`
+	ObsoletedBy struct {
+		Module string `yaml:"module"`
+		Stream string `yaml:"stream"`
+	} `yaml:"obsoleted_by"`
+}
+
+// ReadModules reads the modules.yaml document from r. Module documents must
+// be modulemd version 2. Other document types, such as translations, are
+// ignored.
+func ReadModules(r io.Reader) (*ModuleIndex, error) {
+	index := &ModuleIndex{}
+	d := yaml.NewDecoder(r)
+	for {
+		var doc yamlDocument
+		if err := d.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return index, nil
+			}
+			return nil, errorf("error reading modules document: %v", err)
+		}
+		var err error
+		switch doc.Document {
+		case "modulemd":
+			err = index.addModule(&doc)
+		case "modulemd-defaults":
+			err = index.addDefaults(&doc)
+		case "modulemd-obsoletes":
+			err = index.addObsoletes(&doc)
+		}
+		if err != nil {
+			return nil, errorf("error reading %s document: %v", doc.Document, err)
+		}
+	}
+}
+
+func (c *ModuleIndex) addModule(doc *yamlDocument) error {
+	if doc.Version != 2 {
+		return fmt.Errorf("unsupported version: %d", doc.Version)
+	}
+	var v yamlModule
+	if err := doc.Data.Decode(&v); err != nil {
+		return err
+	}
+	m := &Module{
+		Name:        v.Name,
+		Stream:      v.Stream,
+		Version:     v.Version,
+		Context:     v.Context,
+		Arch:        v.Arch,
+		Summary:     v.Summary,
+		Description: v.Description,
+		Artifacts:   v.Artifacts.RPMs,
+	}
+	for _, deps := range v.Dependencies {
+		m.Dependencies = append(m.Dependencies, ModuleDependencies(deps))
+	}
+	if len(v.Profiles) > 0 {
+		m.Profiles = make(map[string][]string, len(v.Profiles))
+		for name, profile := range v.Profiles {
+			m.Profiles[name] = profile.RPMs
+		}
+	}
+	c.Modules = append(c.Modules, m)
+	return nil
+}
+
+func (c *ModuleIndex) addDefaults(doc *yamlDocument) error {
+	if doc.Version != 1 {
+		return fmt.Errorf("unsupported version: %d", doc.Version)
+	}
+	var v yamlModuleDefaults
+	if err := doc.Data.Decode(&v); err != nil {
+		return err
+	}
+	c.Defaults = append(c.Defaults, &ModuleDefaults{
+		Module:   v.Module,
+		Stream:   v.Stream,
+		Profiles: v.Profiles,
+	})
+	return nil
+}
+
+func (c *ModuleIndex) addObsoletes(doc *yamlDocument) error {
+	if doc.Version != 1 {
+		return fmt.Errorf("unsupported version: %d", doc.Version)
+	}
+	var v yamlModuleObsoletes
+	if err := doc.Data.Decode(&v); err != nil {
+		return err
+	}
+	o := &ModuleObsoletes{
+		Module:            v.Module,
+		Stream:            v.Stream,
+		Context:           v.Context,
+		Reset:             v.Reset,
+		Message:           v.Message,
+		ObsoletedByModule: v.ObsoletedBy.Module,
+		ObsoletedByStream: v.ObsoletedBy.Stream,
+	}
+	var err error
+	if o.Modified, err = parseModuleTime(v.Modified); err != nil {
+		return err
+	}
+	if o.EOLDate, err = parseModuleTime(v.EOLDate); err != nil {
+		return err
+	}
+	c.Obsoletes = append(c.Obsoletes, o)
+	return nil
+}
+
+// parseModuleTime parses a time in modules.yaml, in the form
+// '2006-01-02T15:04Z'.
+func parseModuleTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04Z", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", s)
+}
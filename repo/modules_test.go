@@ -0,0 +1,263 @@
+package repo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+const testModules = `---
+document: modulemd
+version: 2
+data:
+  name: nodejs
+  stream: 10
+  version: 8030020210304194401
+  context: 30b713e6
+  arch: x86_64
+  summary: Javascript runtime
+  description: >-
+    Node.js is a platform for network applications.
+  license:
+    module:
+    - MIT
+  dependencies:
+  - buildrequires:
+      platform: [el8.3.0]
+    requires:
+      platform: [el8]
+  profiles:
+    common:
+      rpms:
+      - nodejs
+      - npm
+  artifacts:
+    rpms:
+    - nodejs-1:10.23.1-1.module_el8.3.0+625+cf33f4d8.src
+    - nodejs-1:10.23.1-1.module_el8.3.0+625+cf33f4d8.x86_64
+    - npm-1:6.14.10-1.10.23.1.1.module_el8.3.0+625+cf33f4d8.x86_64
+...
+---
+document: modulemd
+version: 2
+data:
+  name: nodejs
+  stream: 14
+  version: 8030020210304194402
+  context: bd1311ed
+  arch: x86_64
+  summary: Javascript runtime
+  description: Node.js is a platform for network applications.
+  artifacts:
+    rpms:
+    - nodejs-1:14.15.4-2.module_el8.3.0+624+8fd2a823.x86_64
+...
+---
+document: modulemd
+version: 2
+data:
+  name: epel
+  stream: "7"
+  version: 1
+  context: 00000000
+  arch: noarch
+  summary: EPEL
+  description: EPEL release
+  artifacts:
+    rpms:
+    - epel-release-0:7-5.noarch
+...
+---
+document: modulemd-defaults
+version: 1
+data:
+  module: nodejs
+  stream: 10
+  profiles:
+    10: [common]
+...
+---
+document: modulemd-obsoletes
+version: 1
+data:
+  modified: 2022-01-24T08:00Z
+  module: nodejs
+  stream: 10
+  eol_date: 2021-04-30T00:00Z
+  message: Node.js 10 is end of life
+  obsoleted_by:
+    module: nodejs
+    stream: 14
+...
+---
+document: modulemd-translations
+version: 1
+data:
+  module: nodejs
+  stream: 10
+  modified: 201901010000
+...
+`
+
+func TestReadModules(t *testing.T) {
+	index, err := ReadModules(strings.NewReader(testModules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Modules) != 3 {
+		t.Fatalf("Expected 3 modules, got: %d", len(index.Modules))
+	}
+	m := index.Modules[0]
+	expect := &Module{
+		Name:        "nodejs",
+		Stream:      "10",
+		Version:     8030020210304194401,
+		Context:     "30b713e6",
+		Arch:        "x86_64",
+		Summary:     "Javascript runtime",
+		Description: "Node.js is a platform for network applications.",
+		Dependencies: []ModuleDependencies{{
+			BuildRequires: map[string][]string{"platform": {"el8.3.0"}},
+			Requires:      map[string][]string{"platform": {"el8"}},
+		}},
+		Profiles: map[string][]string{"common": {"nodejs", "npm"}},
+		Artifacts: []string{
+			"nodejs-1:10.23.1-1.module_el8.3.0+625+cf33f4d8.src",
+			"nodejs-1:10.23.1-1.module_el8.3.0+625+cf33f4d8.x86_64",
+			"npm-1:6.14.10-1.10.23.1.1.module_el8.3.0+625+cf33f4d8.x86_64",
+		},
+	}
+	if !reflect.DeepEqual(m, expect) {
+		t.Errorf("Expected %+v, got: %+v", expect, m)
+	}
+	if s := m.String(); s != "nodejs:10:8030020210304194401:30b713e6:x86_64" {
+		t.Errorf("Unexpected module string: %s", s)
+	}
+	if s := index.DefaultStream("nodejs"); s != "10" {
+		t.Errorf("Expected default stream 10, got: %s", s)
+	}
+	if s := index.DefaultStream("epel"); s != "" {
+		t.Errorf("Expected no default stream, got: %s", s)
+	}
+	if a := index.LabelModules("nodejs:14:8030020210304194402:bd1311ed"); len(a) != 1 || a[0] != index.Modules[1] {
+		t.Errorf("Expected nodejs:14 for label, got: %v", a)
+	}
+
+	expectDefaults := []*ModuleDefaults{{
+		Module:   "nodejs",
+		Stream:   "10",
+		Profiles: map[string][]string{"10": {"common"}},
+	}}
+	if !reflect.DeepEqual(index.Defaults, expectDefaults) {
+		t.Errorf("Expected %+v, got: %+v", expectDefaults, index.Defaults)
+	}
+	expectObsoletes := []*ModuleObsoletes{{
+		Module:            "nodejs",
+		Stream:            "10",
+		Modified:          time.Date(2022, 1, 24, 8, 0, 0, 0, time.UTC),
+		EOLDate:           time.Date(2021, 4, 30, 0, 0, 0, 0, time.UTC),
+		Message:           "Node.js 10 is end of life",
+		ObsoletedByModule: "nodejs",
+		ObsoletedByStream: "14",
+	}}
+	if !reflect.DeepEqual(index.Obsoletes, expectObsoletes) {
+		t.Errorf("Expected %+v, got: %+v", expectObsoletes, index.Obsoletes)
+	}
+}
+
+func TestReadModulesErrors(t *testing.T) {
+	tests := []string{
+		"document: modulemd\nversion: 1\ndata:\n  name: foo\n",
+		"document: modulemd\nversion: 2\ndata:\n  version: foo\n",
+		"document: modulemd-obsoletes\nversion: 1\ndata:\n  modified: yesterday\n",
+		"document: [",
+	}
+	for _, test := range tests {
+		if _, err := ReadModules(strings.NewReader(test)); err == nil {
+			t.Errorf("Expected error reading %q", test)
+		}
+	}
+}
+
+// testModulePrimary is a primary.xml document of modular and non-modular
+// packages.
+const testModulePrimary = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" packages="8">
+  <package type="rpm"><name>nodejs</name><arch>x86_64</arch><version epoch="1" ver="10.23.1" rel="1.module_el8.3.0+625+cf33f4d8"/></package>
+  <package type="rpm"><name>nodejs</name><arch>src</arch><version epoch="1" ver="10.23.1" rel="1.module_el8.3.0+625+cf33f4d8"/></package>
+  <package type="rpm"><name>npm</name><arch>x86_64</arch><version epoch="1" ver="6.14.10" rel="1.10.23.1.1.module_el8.3.0+625+cf33f4d8"/></package>
+  <package type="rpm"><name>nodejs</name><arch>x86_64</arch><version epoch="1" ver="14.15.4" rel="2.module_el8.3.0+624+8fd2a823"/></package>
+  <package type="rpm"><name>nodejs</name><arch>x86_64</arch><version epoch="1" ver="16.0.0" rel="1.el8"/></package>
+  <package type="rpm"><name>epel-release</name><arch>noarch</arch><version epoch="0" ver="7" rel="5"/></package>
+  <package type="rpm"><name>epel-release</name><arch>noarch</arch><version epoch="0" ver="8" rel="1"/></package>
+  <package type="rpm"><name>bash</name><arch>x86_64</arch><version epoch="0" ver="4.4.19" rel="7.el8"/></package>
+</metadata>
+`
+
+func TestModuleFilter(t *testing.T) {
+	index, err := ReadModules(strings.NewReader(testModules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgs, err := ReadPrimary(strings.NewReader(testModulePrimary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := index.PackageModules(pkgs[2]); len(a) != 1 || a[0] != index.Modules[0] {
+		t.Errorf("Expected nodejs:10 for %s, got: %v", pkgs[2], a)
+	}
+	if a := index.PackageModules(pkgs[7]); len(a) != 0 {
+		t.Errorf("Expected no modules for %s, got: %v", pkgs[7], a)
+	}
+
+	tests := []struct {
+		Enabled []string
+		Expect  []int
+	}{
+		// nodejs:10 is the default stream and hides the non-modular nodejs;
+		// epel has no default stream
+		{nil, []int{0, 1, 2, 6, 7}},
+		{[]string{"nodejs:14"}, []int{3, 6, 7}},
+		{[]string{"epel:7"}, []int{0, 1, 2, 5, 7}},
+		{[]string{"nodejs"}, []int{0, 1, 2, 6, 7}},
+	}
+	for _, test := range tests {
+		var expect []*Package
+		for _, i := range test.Expect {
+			expect = append(expect, pkgs[i])
+		}
+		if actual := index.Filter(pkgs, test.Enabled...); !reflect.DeepEqual(actual, expect) {
+			t.Errorf("Expected %v with %v enabled, got: %v", expect, test.Enabled, actual)
+		}
+	}
+}
+
+func TestModuleFilterRPMPackages(t *testing.T) {
+	index, err := ReadModules(strings.NewReader(testModules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pkgs []*rpm.Package
+	for _, name := range []string{
+		"centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm",
+		"epel-release-7-5.noarch.rpm",
+	} {
+		p, err := rpm.Open("../testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ModularityLabel() != "" {
+			t.Errorf("Expected no modularity label for %s, got: %s", p, p.ModularityLabel())
+		}
+		pkgs = append(pkgs, p)
+	}
+	if actual := index.FilterRPMPackages(pkgs); len(actual) != 1 || actual[0] != pkgs[0] {
+		t.Errorf("Expected only %s, got: %v", pkgs[0], actual)
+	}
+	if actual := index.FilterRPMPackages(pkgs, "epel:7"); len(actual) != 2 {
+		t.Errorf("Expected both packages with epel:7 enabled, got: %v", actual)
+	}
+}
@@ -0,0 +1,58 @@
+package repo
+
+import "encoding/xml"
+
+// otherPackage is a package entry in other.xml.
+type otherPackage struct {
+	XMLName   xml.Name       `xml:"package"`
+	PkgID     string         `xml:"pkgid,attr"`
+	Name      string         `xml:"name,attr"`
+	Arch      string         `xml:"arch,attr"`
+	Version   xmlVersion     `xml:"version"`
+	Changelog []xmlChangelog `xml:"changelog"`
+}
+
+type xmlChangelog struct {
+	Author string `xml:"author,attr"`
+	Date   int64  `xml:"date,attr"`
+	Text   string `xml:",chardata"`
+}
+
+// newOtherPackage returns the other.xml entry for p. At most limit of the most
+// recent changelog entries are included, oldest first. If limit is zero, all
+// entries are included.
+//
+// The author of each entry is the full changelog name line, including the
+// EVR, as in other metadata generators.
+func newOtherPackage(p *PackageFile, limit int) *otherPackage {
+	times := p.Header.GetTag(1080).Int64Slice()
+	names := p.Header.GetTag(1081).StringSlice()
+	texts := p.Header.GetTag(1082).StringSlice()
+	n := len(times)
+	if len(names) < n {
+		n = len(names)
+	}
+	if len(texts) < n {
+		n = len(texts)
+	}
+	if limit > 0 && limit < n {
+		n = limit
+	}
+
+	// the header stores the most recent entries first
+	changelog := make([]xmlChangelog, n)
+	for i := 0; i < n; i++ {
+		changelog[n-i-1] = xmlChangelog{
+			Author: names[i],
+			Date:   times[i],
+			Text:   texts[i],
+		}
+	}
+	return &otherPackage{
+		PkgID:     p.Checksum.Value,
+		Name:      p.Name(),
+		Arch:      packageArch(p.Package),
+		Version:   newXMLVersion(p.Package),
+		Changelog: changelog,
+	}
+}
@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// A PackageFile is an rpm package file in a repository.
+type PackageFile struct {
+	*rpm.Package
+
+	// Location is the slash-separated path of the package file relative to the
+	// root of the repository.
+	Location string
+
+	// Size is the size of the package file in bytes.
+	Size int64
+
+	// ModTime is the modification time of the package file.
+	ModTime time.Time
+
+	// Checksum is the checksum of the package file. Its value identifies the
+	// package in repository metadata.
+	Checksum Checksum
+}
+
+// OpenPackageFile reads the rpm package at the given location, relative to
+// the repository root, and computes its checksum of the given type.
+func OpenPackageFile(root, location, checksumType string) (*PackageFile, error) {
+	h, err := newHash(checksumType)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(root, filepath.FromSlash(location)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// every byte read from f is hashed exactly once, including those buffered
+	// ahead while reading the headers
+	pkg, err := rpm.Read(bufio.NewReader(io.TeeReader(f, h)))
+	if err != nil {
+		return nil, errorf("%s: %v", location, err)
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return &PackageFile{
+		Package:  pkg,
+		Location: location,
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime(),
+		Checksum: Checksum{
+			Type:  checksumType,
+			Value: hex.EncodeToString(h.Sum(nil)),
+		},
+	}, nil
+}
@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// A DeltaPackage is a package which may be reconstructed from delta rpms in a
+// repository, in the format of prestodelta.xml.
+type DeltaPackage struct {
+	Name    string
+	Epoch   int
+	Version string
+	Release string
+	Arch    string
+
+	// Deltas are the delta rpms which reconstruct the package from older
+	// versions of the package.
+	Deltas []PackageDelta
+}
+
+// A PackageDelta is a delta rpm which reconstructs a package from an older
+// version of the package.
+type PackageDelta struct {
+	OldEpoch   int
+	OldVersion string
+	OldRelease string
+
+	// Filename is the location of the delta rpm relative to the root of the
+	// repository.
+	Filename string
+
+	// Sequence identifies the content of the old package which the delta
+	// applies to, as returned by drpm.Delta.SequenceID.
+	Sequence string
+
+	Size     int64
+	Checksum Checksum
+}
+
+// NEVRA returns the name, epoch, version, release and architecture of the
+// package.
+func (c *DeltaPackage) NEVRA() *rpm.NEVRA {
+	return rpm.NewNEVRA(c.Name, c.Epoch, c.Version, c.Release, c.Arch)
+}
+
+func (c *DeltaPackage) String() string {
+	return c.NEVRA().String()
+}
+
+// Delta returns the delta which reconstructs the package from the given
+// version of the package, or nil if there is none.
+func (c *DeltaPackage) Delta(epoch int, version, release string) *PackageDelta {
+	for i := range c.Deltas {
+		d := &c.Deltas[i]
+		if d.OldEpoch == epoch && d.OldVersion == version && d.OldRelease == release {
+			return d
+		}
+	}
+	return nil
+}
+
+// xmlNewPackage encodes a package in prestodelta.xml.
+type xmlNewPackage struct {
+	XMLName xml.Name   `xml:"newpackage"`
+	Name    string     `xml:"name,attr"`
+	Epoch   int        `xml:"epoch,attr"`
+	Version string     `xml:"version,attr"`
+	Release string     `xml:"release,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Deltas  []xmlDelta `xml:"delta"`
+}
+
+type xmlDelta struct {
+	OldEpoch   int      `xml:"oldepoch,attr"`
+	OldVersion string   `xml:"oldversion,attr"`
+	OldRelease string   `xml:"oldrelease,attr"`
+	Filename   string   `xml:"filename"`
+	Sequence   string   `xml:"sequence"`
+	Size       int64    `xml:"size"`
+	Checksum   Checksum `xml:"checksum"`
+}
+
+// ReadPrestoDelta reads the delta rpms of a prestodelta.xml document from r.
+func ReadPrestoDelta(r io.Reader) ([]*DeltaPackage, error) {
+	var pkgs []*DeltaPackage
+	err := decodeElements(r, "prestodelta", "newpackage", func(d *xml.Decoder, start *xml.StartElement) error {
+		var v xmlNewPackage
+		if err := d.DecodeElement(&v, start); err != nil {
+			return errorf("error reading prestodelta document: %v", err)
+		}
+		p := &DeltaPackage{
+			Name:    v.Name,
+			Epoch:   v.Epoch,
+			Version: v.Version,
+			Release: v.Release,
+			Arch:    v.Arch,
+		}
+		for _, delta := range v.Deltas {
+			p.Deltas = append(p.Deltas, PackageDelta(delta))
+		}
+		pkgs = append(pkgs, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// WritePrestoDelta writes the given packages to w as a prestodelta.xml
+// document.
+func WritePrestoDelta(w io.Writer, pkgs []*DeltaPackage) error {
+	if _, err := io.WriteString(w, xml.Header+"<prestodelta>\n"); err != nil {
+		return err
+	}
+	for _, p := range pkgs {
+		v := xmlNewPackage{
+			Name:    p.Name,
+			Epoch:   p.Epoch,
+			Version: p.Version,
+			Release: p.Release,
+			Arch:    p.Arch,
+		}
+		for _, delta := range p.Deltas {
+			v.Deltas = append(v.Deltas, xmlDelta(delta))
+		}
+		b, err := xml.MarshalIndent(v, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</prestodelta>\n")
+	return err
+}
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testPrestoDelta = `<?xml version="1.0" encoding="UTF-8"?>
+<prestodelta>
+  <newpackage name="centos-release" epoch="0" version="7" release="2.1511.el7.centos.2.10" arch="x86_64">
+    <delta oldepoch="0" oldversion="6" oldrelease="0.el6.centos.5">
+      <filename>drpms/centos-release-6-0.el6.centos.5_7-2.1511.el7.centos.2.10.x86_64.drpm</filename>
+      <sequence>centos-release-6-0.el6.centos.5-d41d8cd98f00b204e9800998ecf8427e00</sequence>
+      <size>1024</size>
+      <checksum type="sha256">e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855</checksum>
+    </delta>
+  </newpackage>
+</prestodelta>
+`
+
+func TestReadPrestoDelta(t *testing.T) {
+	pkgs, err := ReadPrestoDelta(strings.NewReader(testPrestoDelta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []*DeltaPackage{{
+		Name:    "centos-release",
+		Version: "7",
+		Release: "2.1511.el7.centos.2.10",
+		Arch:    "x86_64",
+		Deltas: []PackageDelta{{
+			OldVersion: "6",
+			OldRelease: "0.el6.centos.5",
+			Filename:   "drpms/centos-release-6-0.el6.centos.5_7-2.1511.el7.centos.2.10.x86_64.drpm",
+			Sequence:   "centos-release-6-0.el6.centos.5-d41d8cd98f00b204e9800998ecf8427e00",
+			Size:       1024,
+			Checksum: Checksum{
+				Type:  ChecksumSHA256,
+				Value: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+			},
+		}},
+	}}
+	if !reflect.DeepEqual(pkgs, expect) {
+		t.Fatalf("Expected %+v, got: %+v", expect, pkgs)
+	}
+	if d := pkgs[0].Delta(0, "6", "0.el6.centos.5"); d != &pkgs[0].Deltas[0] {
+		t.Errorf("Expected delta from 6-0.el6.centos.5, got: %+v", d)
+	}
+	if d := pkgs[0].Delta(1, "6", "0.el6.centos.5"); d != nil {
+		t.Errorf("Expected no delta from 1:6-0.el6.centos.5, got: %+v", d)
+	}
+
+	var buf bytes.Buffer
+	if err := WritePrestoDelta(&buf, pkgs); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != testPrestoDelta {
+		t.Errorf("Expected written prestodelta.xml to match, got:\n%s", buf.String())
+	}
+}
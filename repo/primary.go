@@ -0,0 +1,237 @@
+package repo
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// primaryPackage is a package entry in primary.xml.
+//
+// Elements in the rpm namespace are named with a literal "rpm:" prefix, as
+// many metadata consumers match element names without resolving namespaces.
+type primaryPackage struct {
+	XMLName     xml.Name      `xml:"package"`
+	Type        string        `xml:"type,attr"`
+	Name        string        `xml:"name"`
+	Arch        string        `xml:"arch"`
+	Version     xmlVersion    `xml:"version"`
+	Checksum    xmlPackageID  `xml:"checksum"`
+	Summary     string        `xml:"summary"`
+	Description string        `xml:"description"`
+	Packager    string        `xml:"packager"`
+	URL         string        `xml:"url"`
+	Time        xmlTime       `xml:"time"`
+	Size        xmlSize       `xml:"size"`
+	Location    Location      `xml:"location"`
+	Format      primaryFormat `xml:"format"`
+}
+
+type primaryFormat struct {
+	License     string         `xml:"rpm:license"`
+	Vendor      string         `xml:"rpm:vendor"`
+	Group       string         `xml:"rpm:group"`
+	BuildHost   string         `xml:"rpm:buildhost"`
+	SourceRPM   string         `xml:"rpm:sourcerpm"`
+	HeaderRange xmlHeaderRange `xml:"rpm:header-range"`
+	Provides    *xmlEntries    `xml:"rpm:provides,omitempty"`
+	Requires    *xmlEntries    `xml:"rpm:requires,omitempty"`
+	Conflicts   *xmlEntries    `xml:"rpm:conflicts,omitempty"`
+	Obsoletes   *xmlEntries    `xml:"rpm:obsoletes,omitempty"`
+	Suggests    *xmlEntries    `xml:"rpm:suggests,omitempty"`
+	Enhances    *xmlEntries    `xml:"rpm:enhances,omitempty"`
+	Recommends  *xmlEntries    `xml:"rpm:recommends,omitempty"`
+	Supplements *xmlEntries    `xml:"rpm:supplements,omitempty"`
+	Files       []xmlFile      `xml:"file"`
+}
+
+type xmlVersion struct {
+	Epoch   int    `xml:"epoch,attr"`
+	Version string `xml:"ver,attr"`
+	Release string `xml:"rel,attr"`
+}
+
+type xmlPackageID struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlTime struct {
+	File  int64 `xml:"file,attr"`
+	Build int64 `xml:"build,attr"`
+}
+
+type xmlSize struct {
+	Package   int64  `xml:"package,attr"`
+	Installed uint64 `xml:"installed,attr"`
+	Archive   uint64 `xml:"archive,attr"`
+}
+
+type xmlHeaderRange struct {
+	Start int `xml:"start,attr"`
+	End   int `xml:"end,attr"`
+}
+
+type xmlEntries struct {
+	Entries []xmlEntry `xml:"rpm:entry"`
+}
+
+type xmlEntry struct {
+	Name    string `xml:"name,attr"`
+	Flags   string `xml:"flags,attr,omitempty"`
+	Epoch   string `xml:"epoch,attr,omitempty"`
+	Version string `xml:"ver,attr,omitempty"`
+	Release string `xml:"rel,attr,omitempty"`
+	Pre     string `xml:"pre,attr,omitempty"`
+}
+
+type xmlFile struct {
+	Type string `xml:"type,attr,omitempty"`
+	Name string `xml:",chardata"`
+}
+
+// newPrimaryPackage returns the primary.xml entry for p.
+func newPrimaryPackage(p *PackageFile, base string) *primaryPackage {
+	start, end := p.HeaderRange()
+	group := ""
+	if groups := p.Groups(); len(groups) > 0 {
+		group = groups[0]
+	}
+	files := p.Files()
+	own := make(map[string]bool, len(files))
+	for _, f := range files {
+		own[f.Name()] = true
+	}
+	var primaryFiles []xmlFile
+	for _, f := range files {
+		if isPrimaryFile(f.Name()) {
+			primaryFiles = append(primaryFiles, newXMLFile(f))
+		}
+	}
+	return &primaryPackage{
+		Type:        "rpm",
+		Name:        p.Name(),
+		Arch:        packageArch(p.Package),
+		Version:     newXMLVersion(p.Package),
+		Checksum:    xmlPackageID{Type: p.Checksum.Type, PkgID: "YES", Value: p.Checksum.Value},
+		Summary:     p.Summary(),
+		Description: p.Description(),
+		Packager:    p.Packager(),
+		URL:         p.URL(),
+		Time:        xmlTime{File: p.ModTime.Unix(), Build: p.BuildTime().Unix()},
+		Size:        xmlSize{Package: p.Size, Installed: p.Package.Size(), Archive: p.ArchiveSize()},
+		Location:    Location{Href: p.Location, Base: base},
+		Format: primaryFormat{
+			License:     p.License(),
+			Vendor:      p.Vendor(),
+			Group:       group,
+			BuildHost:   p.BuildHost(),
+			SourceRPM:   p.SourceRPM(),
+			HeaderRange: xmlHeaderRange{Start: start, End: end},
+			Provides:    newXMLEntries(p.Provides(), nil),
+			Requires:    newXMLEntries(p.Requires(), own),
+			Conflicts:   newXMLEntries(p.Conflicts(), nil),
+			Obsoletes:   newXMLEntries(p.Obsoletes(), nil),
+			Suggests:    newXMLEntries(p.Suggests(), nil),
+			Enhances:    newXMLEntries(p.Enhances(), nil),
+			Recommends:  newXMLEntries(p.Recommends(), nil),
+			Supplements: newXMLEntries(p.Supplements(), nil),
+			Files:       primaryFiles,
+		},
+	}
+}
+
+// packageArch returns the architecture of pkg as it appears in repository
+// metadata, where source packages have the architecture "src".
+func packageArch(pkg *rpm.Package) string {
+	if pkg.IsSource() {
+		return "src"
+	}
+	return pkg.Architecture()
+}
+
+func newXMLVersion(pkg *rpm.Package) xmlVersion {
+	return xmlVersion{
+		Epoch:   pkg.Epoch(),
+		Version: pkg.Version(),
+		Release: pkg.Release(),
+	}
+}
+
+func newXMLFile(f rpm.FileInfo) xmlFile {
+	file := xmlFile{Name: f.Name()}
+	if f.Flags()&rpm.FileFlagGhost != 0 {
+		file.Type = "ghost"
+	} else if f.IsDir() {
+		file.Type = "dir"
+	}
+	return file
+}
+
+// isPrimaryFile returns true if the named file is listed in primary.xml as
+// well as filelists.xml. These are the files most commonly required by other
+// packages.
+func isPrimaryFile(name string) bool {
+	return strings.HasPrefix(name, "/etc/") ||
+		strings.Contains(name, "bin/") ||
+		name == "/usr/lib/sendmail"
+}
+
+// newXMLEntries returns the metadata entries for the given dependencies.
+// Duplicates, rpmlib() dependencies and requirements on files in own are
+// omitted, as they are not useful to dependency solvers.
+func newXMLEntries(deps []rpm.Dependency, own map[string]bool) *xmlEntries {
+	var entries []xmlEntry
+	seen := make(map[xmlEntry]bool, len(deps))
+	for _, dep := range deps {
+		if own != nil && (own[dep.Name()] || strings.HasPrefix(dep.Name(), "rpmlib(")) {
+			continue
+		}
+		entry := xmlEntry{Name: dep.Name()}
+		if flags := depFlagsString(dep.Flags()); flags != "" && dep.Version() != "" {
+			entry.Flags = flags
+			entry.Epoch = strconv.Itoa(dep.Epoch())
+			entry.Version = dep.Version()
+			entry.Release = dep.Release()
+		}
+		if own != nil && isPreReq(dep.Flags()) {
+			entry.Pre = "1"
+		}
+		if seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	return &xmlEntries{Entries: entries}
+}
+
+// depFlagsString returns the comparison operator of the given dependency
+// flags in the form used in repository metadata.
+func depFlagsString(flags int) string {
+	switch flags & (rpm.DepFlagLesser | rpm.DepFlagGreater | rpm.DepFlagEqual) {
+	case rpm.DepFlagLesser:
+		return "LT"
+	case rpm.DepFlagLesserOrEqual:
+		return "LE"
+	case rpm.DepFlagGreater:
+		return "GT"
+	case rpm.DepFlagGreaterOrEqual:
+		return "GE"
+	case rpm.DepFlagEqual:
+		return "EQ"
+	}
+	return ""
+}
+
+// isPreReq returns true if a requirement with the given flags must be
+// installed before the requiring package.
+func isPreReq(flags int) bool {
+	return flags&(rpm.DepFlagPrereq|rpm.DepFlagPreTrans|rpm.DepFlagScriptPre|rpm.DepFlagScriptPost) != 0
+}
@@ -0,0 +1,418 @@
+package repo
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// Metadata is the metadata of a repository.
+type Metadata struct {
+	Repomd   *Repomd
+	Packages []*Package
+
+	// Advisories are the advisories in updateinfo.xml, if it was read.
+	Advisories []*Advisory
+
+	// Comps is the package group metadata, if it was read.
+	Comps *Comps
+
+	// Modules is the modularity metadata, if it was read.
+	Modules *ModuleIndex
+
+	// Deltas are the delta rpms in prestodelta.xml, if it was read.
+	Deltas []*DeltaPackage
+}
+
+// Open reads the metadata of the repository in dir, which must contain
+// repodata/repomd.xml. Primary metadata is always read. Other metadata types,
+// such as "filelists", "other", "updateinfo", "group", "modules" and
+// "prestodelta", are read if they are given. The checksums of each metadata
+// file are verified.
+func Open(dir string, types ...string) (*Metadata, error) {
+	f, err := os.Open(filepath.Join(dir, "repodata", "repomd.xml"))
+	if err != nil {
+		return nil, err
+	}
+	repomd, err := ReadRepomd(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{Repomd: repomd}
+	for _, typ := range append([]string{"primary"}, types...) {
+		data := repomd.Get(typ)
+		if data == nil {
+			return nil, errorf("repository has no %s metadata", typ)
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(data.Location.Href)))
+		if err != nil {
+			return nil, err
+		}
+		err = md.read(f, data)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return md, nil
+}
+
+// read reads the given metadata file from r.
+func (c *Metadata) read(r io.Reader, data *RepomdData) error {
+	mr, err := NewMetadataReader(r, data)
+	if err != nil {
+		return err
+	}
+	defer mr.Close()
+	switch data.Type {
+	case "primary":
+		c.Packages, err = ReadPrimary(mr)
+	case "filelists":
+		err = ReadFilelists(mr, c.Packages)
+	case "other":
+		err = ReadOther(mr, c.Packages)
+	case "updateinfo":
+		c.Advisories, err = ReadUpdateinfo(mr)
+	case "group", "group_gz":
+		c.Comps, err = ReadComps(mr)
+	case "modules":
+		c.Modules, err = ReadModules(mr)
+	case "prestodelta":
+		c.Deltas, err = ReadPrestoDelta(mr)
+	default:
+		err = errorf("unsupported metadata type: %s", data.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	// read to the end of the file to verify its checksums
+	_, err = io.Copy(ioutil.Discard, mr)
+	return err
+}
+
+// primaryRecord decodes a package entry in primary.xml. Unlike
+// primaryPackage, elements are matched by name regardless of their namespace
+// prefix.
+type primaryRecord struct {
+	Name        string       `xml:"name"`
+	Arch        string       `xml:"arch"`
+	Version     xmlVersion   `xml:"version"`
+	Checksum    xmlPackageID `xml:"checksum"`
+	Summary     string       `xml:"summary"`
+	Description string       `xml:"description"`
+	Packager    string       `xml:"packager"`
+	URL         string       `xml:"url"`
+	Time        xmlTime      `xml:"time"`
+	Size        xmlSize      `xml:"size"`
+	Location    Location     `xml:"location"`
+	Format      struct {
+		License     string         `xml:"license"`
+		Vendor      string         `xml:"vendor"`
+		Group       string         `xml:"group"`
+		BuildHost   string         `xml:"buildhost"`
+		SourceRPM   string         `xml:"sourcerpm"`
+		HeaderRange xmlHeaderRange `xml:"header-range"`
+		Provides    []xmlEntry     `xml:"provides>entry"`
+		Requires    []xmlEntry     `xml:"requires>entry"`
+		Conflicts   []xmlEntry     `xml:"conflicts>entry"`
+		Obsoletes   []xmlEntry     `xml:"obsoletes>entry"`
+		Suggests    []xmlEntry     `xml:"suggests>entry"`
+		Enhances    []xmlEntry     `xml:"enhances>entry"`
+		Recommends  []xmlEntry     `xml:"recommends>entry"`
+		Supplements []xmlEntry     `xml:"supplements>entry"`
+		Files       []xmlFile      `xml:"file"`
+	} `xml:"format"`
+}
+
+// ReadPrimary reads the package records in the uncompressed primary.xml
+// document from r.
+func ReadPrimary(r io.Reader) ([]*Package, error) {
+	var pkgs []*Package
+	err := decodePackages(r, "metadata", func(d *xml.Decoder, start *xml.StartElement) error {
+		p := &Package{}
+		if err := d.DecodeElement(&p.p, start); err != nil {
+			return err
+		}
+		f := &p.p.Format
+		for i, entries := range [][]xmlEntry{
+			f.Provides,
+			f.Requires,
+			f.Conflicts,
+			f.Obsoletes,
+			f.Suggests,
+			f.Enhances,
+			f.Recommends,
+			f.Supplements,
+		} {
+			deps, err := parseXMLEntries(entries)
+			if err != nil {
+				return errorf("error reading %s: %v", p, err)
+			}
+			p.deps[i] = deps
+		}
+		pkgs = append(pkgs, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pkgs, nil
+}
+
+// ReadFilelists reads the uncompressed filelists.xml document from r and adds
+// the files of each package to the matching record in pkgs. Records are
+// matched by checksum.
+func ReadFilelists(r io.Reader, pkgs []*Package) error {
+	index := indexPackages(pkgs)
+	return decodePackages(r, "filelists", func(d *xml.Decoder, start *xml.StartElement) error {
+		var v struct {
+			PkgID string    `xml:"pkgid,attr"`
+			Files []xmlFile `xml:"file"`
+		}
+		if err := d.DecodeElement(&v, start); err != nil {
+			return err
+		}
+		files := make([]File, len(v.Files))
+		for i, f := range v.Files {
+			files[i] = File{Name: f.Name, Type: f.Type}
+		}
+		for _, p := range index[v.PkgID] {
+			p.files = files
+		}
+		return nil
+	})
+}
+
+// ReadOther reads the uncompressed other.xml document from r and adds the
+// changelog of each package to the matching record in pkgs. Records are
+// matched by checksum.
+func ReadOther(r io.Reader, pkgs []*Package) error {
+	index := indexPackages(pkgs)
+	return decodePackages(r, "otherdata", func(d *xml.Decoder, start *xml.StartElement) error {
+		var v struct {
+			PkgID     string         `xml:"pkgid,attr"`
+			Changelog []xmlChangelog `xml:"changelog"`
+		}
+		if err := d.DecodeElement(&v, start); err != nil {
+			return err
+		}
+
+		// other.xml lists the oldest entries first
+		n := len(v.Changelog)
+		changelog := make([]rpm.ChangelogEntry, n)
+		for i, entry := range v.Changelog {
+			changelog[n-i-1] = rpm.NewChangelogEntry(time.Unix(entry.Date, 0), entry.Author, entry.Text)
+		}
+		for _, p := range index[v.PkgID] {
+			p.changelog = changelog
+		}
+		return nil
+	})
+}
+
+func indexPackages(pkgs []*Package) map[string][]*Package {
+	index := make(map[string][]*Package, len(pkgs))
+	for _, p := range pkgs {
+		index[p.p.Checksum.Value] = append(index[p.p.Checksum.Value], p)
+	}
+	return index
+}
+
+// decodePackages calls fn for each package element in a metadata document
+// with the given root element.
+func decodePackages(r io.Reader, root string, fn func(d *xml.Decoder, start *xml.StartElement) error) error {
+	return decodeElements(r, root, "package", fn)
+}
+
+// decodeElements calls fn for each child element of the root element of an
+// XML document with the given name.
+func decodeElements(r io.Reader, root, name string, fn func(d *xml.Decoder, start *xml.StartElement) error) error {
+	d := xml.NewDecoder(r)
+	depth := 0
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			if depth != 0 {
+				return errorf("unexpected end of %s document", root)
+			}
+			return nil
+		}
+		if err != nil {
+			return errorf("error reading %s document: %v", root, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && t.Name.Local != root {
+				return errorf("expected %s document, got: %s", root, t.Name.Local)
+			}
+			if depth == 2 && t.Name.Local == name {
+				if err := fn(d, &t); err != nil {
+					return err
+				}
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// parseXMLEntries returns the dependencies described by metadata entries.
+func parseXMLEntries(entries []xmlEntry) ([]rpm.Dependency, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	deps := make([]rpm.Dependency, len(entries))
+	for i, entry := range entries {
+		flags, err := parseDepFlags(entry.Flags)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Pre == "1" {
+			flags |= rpm.DepFlagPrereq
+		}
+		epoch := 0
+		if entry.Epoch != "" {
+			if epoch, err = strconv.Atoi(entry.Epoch); err != nil {
+				return nil, fmt.Errorf("invalid epoch for %s: %s", entry.Name, entry.Epoch)
+			}
+		}
+		deps[i] = rpm.NewDependency(flags, entry.Name, epoch, entry.Version, entry.Release)
+	}
+	return deps, nil
+}
+
+// parseDepFlags is the inverse of depFlagsString.
+func parseDepFlags(s string) (int, error) {
+	switch s {
+	case "":
+		return rpm.DepFlagAny, nil
+	case "LT":
+		return rpm.DepFlagLesser, nil
+	case "LE":
+		return rpm.DepFlagLesserOrEqual, nil
+	case "GT":
+		return rpm.DepFlagGreater, nil
+	case "GE":
+		return rpm.DepFlagGreaterOrEqual, nil
+	case "EQ":
+		return rpm.DepFlagEqual, nil
+	}
+	return 0, fmt.Errorf("invalid dependency flags: %s", s)
+}
+
+// metadataReader decompresses a metadata file and verifies its checksums and
+// sizes when the end of the file is reached.
+type metadataReader struct {
+	data     *RepomdData
+	src      *checksumReader
+	z        io.ReadCloser
+	open     *checksumReader
+	verified bool
+}
+
+// NewMetadataReader returns a reader that decompresses the metadata file
+// described by data, read from r. The compression type is determined by the
+// file extension of its location.
+//
+// The checksum and size of the file, and of its decompressed content, are
+// verified when the end of the file is reached. If either does not match
+// data, Read returns an error instead of io.EOF. Callers should read until
+// io.EOF, as XML decoders may stop reading at the end of the root element.
+func NewMetadataReader(r io.Reader, data *RepomdData) (io.ReadCloser, error) {
+	src, err := newChecksumReader(r, &data.Checksum, data.Size)
+	if err != nil {
+		return nil, err
+	}
+	z, err := newDecompressor(src, data.Location.Href)
+	if err != nil {
+		return nil, errorf("error reading %s: %v", data.Location.Href, err)
+	}
+	c := &metadataReader{data: data, src: src, z: z}
+	if data.OpenChecksum != nil {
+		if c.open, err = newChecksumReader(z, data.OpenChecksum, data.OpenSize); err != nil {
+			z.Close()
+			return nil, err
+		}
+	} else {
+		c.open = &checksumReader{r: z}
+	}
+	return c, nil
+}
+
+func (c *metadataReader) Read(p []byte) (int, error) {
+	n, err := c.open.Read(p)
+	if err == io.EOF && !c.verified {
+		c.verified = true
+		if verr := c.open.verify(); verr != nil {
+			return n, errorf("%s: %v", c.data.Location.Href, verr)
+		}
+		// the decompressor may not consume trailing input
+		if _, err := io.Copy(ioutil.Discard, c.src); err != nil {
+			return n, err
+		}
+		if verr := c.src.verify(); verr != nil {
+			return n, errorf("%s: %v", c.data.Location.Href, verr)
+		}
+	}
+	return n, err
+}
+
+func (c *metadataReader) Close() error {
+	return c.z.Close()
+}
+
+// checksumReader computes the checksum and size of the data read from r.
+type checksumReader struct {
+	r        io.Reader
+	h        hash.Hash
+	n        int64
+	checksum Checksum
+	size     int64
+}
+
+// newChecksumReader returns a reader which verifies that data read from r
+// has the given checksum and size. If size is zero, it is not verified.
+func newChecksumReader(r io.Reader, checksum *Checksum, size int64) (*checksumReader, error) {
+	h, err := newHash(checksum.Type)
+	if err != nil {
+		return nil, err
+	}
+	return &checksumReader{r: r, h: h, checksum: *checksum, size: size}, nil
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.h != nil {
+		c.h.Write(p[:n])
+	}
+	c.n += int64(n)
+	return n, err
+}
+
+// verify returns an error if the data read so far does not match the
+// expected checksum and size.
+func (c *checksumReader) verify() error {
+	if c.h == nil {
+		return nil
+	}
+	if c.size != 0 && c.n != c.size {
+		return fmt.Errorf("expected size %d, got: %d", c.size, c.n)
+	}
+	if sum := hex.EncodeToString(c.h.Sum(nil)); sum != c.checksum.Value {
+		return fmt.Errorf("expected %s checksum %s, got: %s", c.checksum.Type, c.checksum.Value, sum)
+	}
+	return nil
+}
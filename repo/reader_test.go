@@ -0,0 +1,279 @@
+package repo
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+func depStrings(deps []rpm.Dependency) []string {
+	a := make([]string, len(deps))
+	for i, dep := range deps {
+		a[i] = (&rpm.RichDependency{Dependency: dep}).String()
+	}
+	return a
+}
+
+func TestOpen(t *testing.T) {
+	md, err := Open("./testdata/repo", "filelists", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Repomd.Revision != "1646395200" {
+		t.Errorf("Expected revision 1646395200, got: %s", md.Repomd.Revision)
+	}
+	if len(md.Packages) != 2 {
+		t.Fatalf("Expected 2 packages, got: %d", len(md.Packages))
+	}
+
+	p := md.Packages[0]
+	if s := p.String(); s != "hello-2.10-3.fc36.x86_64" {
+		t.Errorf("Expected hello-2.10-3.fc36.x86_64, got: %s", s)
+	}
+	if s := p.NEVRA().FullString(); s != "hello-1:2.10-3.fc36.x86_64" {
+		t.Errorf("Expected hello-1:2.10-3.fc36.x86_64, got: %s", s)
+	}
+	if p.IsSource() || !md.Packages[1].IsSource() {
+		t.Errorf("Expected only the second package to be a source package")
+	}
+	if p.Checksum().Value != strings.Repeat("1", 64) || p.Checksum().Type != ChecksumSHA256 {
+		t.Errorf("Unexpected checksum: %v", p.Checksum())
+	}
+	expectLocation := Location{
+		Href: "Packages/h/hello-2.10-3.fc36.x86_64.rpm",
+		Base: "https://mirror.example.com/fedora/",
+	}
+	if p.Location() != expectLocation {
+		t.Errorf("Expected location %v, got: %v", expectLocation, p.Location())
+	}
+	if p.Description() != "The GNU Hello program produces a familiar, friendly greeting.\nVersion 2.10." {
+		t.Errorf("Unexpected description: %q", p.Description())
+	}
+	if p.License() != "GPLv3+ and GFDL" || p.SourceRPM() != "hello-2.10-3.fc36.src.rpm" {
+		t.Errorf("Unexpected license or source rpm: %s, %s", p.License(), p.SourceRPM())
+	}
+	if p.PackageSize() != 78213 || p.Size() != 186542 || p.ArchiveSize() != 190000 {
+		t.Errorf("Unexpected sizes: %d, %d, %d", p.PackageSize(), p.Size(), p.ArchiveSize())
+	}
+	if !p.BuildTime().Equal(time.Unix(1646136000, 0)) || !p.FileTime().Equal(time.Unix(1646395200, 0)) {
+		t.Errorf("Unexpected times: %v, %v", p.BuildTime(), p.FileTime())
+	}
+	if start, end := p.HeaderRange(); start != 4504 || end != 12345 {
+		t.Errorf("Expected header range 4504-12345, got: %d-%d", start, end)
+	}
+
+	tests := []struct {
+		name   string
+		deps   []rpm.Dependency
+		expect []string
+	}{
+		{"provides", p.Provides(), []string{
+			"hello = 1:2.10-3.fc36",
+			"hello(x86-64) = 1:2.10-3.fc36",
+			"greeting = 2.10",
+		}},
+		{"requires", p.Requires(), []string{
+			"/bin/sh",
+			"info",
+			"libc.so.6(GLIBC_2.34)(64bit)",
+			"(hello-libs if systemd)",
+			"hello-libs >= 1:2.10",
+		}},
+		{"conflicts", p.Conflicts(), []string{}},
+		{"obsoletes", p.Obsoletes(), []string{"hello-old < 2.0"}},
+		{"recommends", p.Recommends(), []string{"hello-doc"}},
+		{"source requires", md.Packages[1].Requires(), []string{"gcc", "make >= 4.0"}},
+	}
+	for _, test := range tests {
+		if a := depStrings(test.deps); !reflect.DeepEqual(a, test.expect) {
+			t.Errorf("Expected %s %q, got: %q", test.name, test.expect, a)
+		}
+	}
+	if flags := p.Requires()[0].Flags(); flags&rpm.DepFlagPrereq == 0 {
+		t.Errorf("Expected prereq flag for /bin/sh, got: %#x", flags)
+	}
+	if flags := p.Requires()[2].Flags(); flags&rpm.DepFlagPrereq != 0 {
+		t.Errorf("Expected no prereq flag for libc, got: %#x", flags)
+	}
+
+	expectFiles := []File{
+		{Name: "/usr/bin/hello"},
+		{Name: "/usr/share/doc/hello", Type: "dir"},
+		{Name: "/usr/share/doc/hello/README"},
+		{Name: "/var/log/hello.log", Type: "ghost"},
+	}
+	if !reflect.DeepEqual(p.Files(), expectFiles) {
+		t.Errorf("Expected files %v, got: %v", expectFiles, p.Files())
+	}
+	if !p.Files()[1].IsDir() {
+		t.Errorf("Expected directory")
+	}
+	for _, req := range []rpm.Dependency{
+		rpm.NewDependency(rpm.DepFlagAny, "/var/log/hello.log", 0, "", ""),
+		rpm.NewDependency(rpm.DepFlagGreaterOrEqual, "hello", 1, "2.0", ""),
+		rpm.NewDependency(rpm.DepFlagEqual, "greeting", 0, "2.10", ""),
+	} {
+		if !p.Satisfies(req) {
+			t.Errorf("Expected %s to satisfy %v", p, req)
+		}
+	}
+	if p.Satisfies(rpm.NewDependency(rpm.DepFlagGreater, "hello", 1, "2.10", "")) {
+		t.Errorf("Expected %s not to satisfy hello > 1:2.10", p)
+	}
+
+	expectChangelog := []rpm.ChangelogEntry{
+		{
+			Time:   time.Unix(1646136000, 0),
+			Author: "Jane Doe <jane@example.com>",
+			EVR:    "1:2.10-3",
+			Text:   "- Fix crash on startup (#123)\n- Rebuild",
+		},
+		{
+			Time:   time.Unix(1641211200, 0),
+			Author: "John Doe <john@example.com>",
+			EVR:    "2.10-1",
+			Text:   "- Update to 2.10",
+		},
+	}
+	if !reflect.DeepEqual(p.Changelog(), expectChangelog) {
+		t.Errorf("Expected changelog %v, got: %v", expectChangelog, p.Changelog())
+	}
+}
+
+func TestOpenPrimary(t *testing.T) {
+	md, err := Open("./testdata/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := md.Packages[0]
+	if expect := []File{{Name: "/usr/bin/hello"}}; !reflect.DeepEqual(p.Files(), expect) {
+		t.Errorf("Expected primary files %v, got: %v", expect, p.Files())
+	}
+	if p.Changelog() != nil {
+		t.Errorf("Expected no changelog, got: %v", p.Changelog())
+	}
+	if _, err := Open("./testdata/repo", "updateinfo"); err == nil {
+		t.Errorf("Expected error opening missing metadata type")
+	}
+}
+
+func TestNewMetadataReader(t *testing.T) {
+	f, err := os.Open("./testdata/repo/repodata/repomd.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repomd, err := ReadRepomd(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{"primary", "filelists", "other"} {
+		data := repomd.Get(typ)
+		b, err := ioutil.ReadFile(filepath.Join("./testdata/repo", data.Location.Href))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tests := []struct {
+			name   string
+			modify func(data *RepomdData)
+			ok     bool
+		}{
+			{"valid", func(data *RepomdData) {}, true},
+			{"checksum", func(data *RepomdData) { data.Checksum.Value = strings.Repeat("0", 64) }, false},
+			{"open checksum", func(data *RepomdData) { data.OpenChecksum = &Checksum{Type: "sha256", Value: "00"} }, false},
+			{"size", func(data *RepomdData) { data.Size++ }, false},
+			{"open size", func(data *RepomdData) { data.OpenSize-- }, false},
+			{"no open checksum", func(data *RepomdData) { data.OpenChecksum = nil }, true},
+		}
+		for _, test := range tests {
+			d := *data
+			test.modify(&d)
+			r, err := NewMetadataReader(strings.NewReader(string(b)), &d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = io.Copy(ioutil.Discard, r)
+			r.Close()
+			if test.ok && err != nil {
+				t.Errorf("%s %s: unexpected error: %v", typ, test.name, err)
+			} else if !test.ok && err == nil {
+				t.Errorf("%s %s: expected error", typ, test.name)
+			}
+		}
+	}
+}
+
+func TestReadPrimaryErrors(t *testing.T) {
+	tests := []string{
+		`<filelists/>`,
+		`<metadata><package><name>foo</name>`,
+		`<metadata><package><format><provides><entry name="foo" flags="XX"/></provides></format></package></metadata>`,
+		`<metadata><package><format><provides><entry name="foo" flags="EQ" epoch="x" ver="1"/></provides></format></package></metadata>`,
+	}
+	for _, test := range tests {
+		if _, err := ReadPrimary(strings.NewReader(test)); err == nil {
+			t.Errorf("Expected error reading %s", test)
+		}
+	}
+}
+
+// TestCreateOpen checks that metadata generated by Create is read back with
+// the same fields as the packages it was generated from.
+func TestCreateOpen(t *testing.T) {
+	dir := newTestRepo(t)
+	if _, err := Create(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	md, err := Open(dir, "filelists", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range md.Packages {
+		pkg, err := rpm.Open(filepath.Join(dir, p.Location().Href))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rpm.Compare(p, pkg) != 0 || p.Name() != pkg.Name() || p.Architecture() != pkg.Architecture() {
+			t.Errorf("Expected %s, got: %s", pkg, p)
+		}
+		if p.Summary() != pkg.Summary() || p.BuildTime() != pkg.BuildTime() || p.Size() != pkg.Size() {
+			t.Errorf("Unexpected fields for %s", p)
+		}
+		if a, b := depStrings(p.Provides()), depStrings(pkg.Provides()); !reflect.DeepEqual(a, b) {
+			t.Errorf("Expected provides %q, got: %q", b, a)
+		}
+		for _, req := range pkg.Requires() {
+			if strings.HasPrefix(req.Name(), "rpmlib(") {
+				continue
+			}
+			found := false
+			for _, r := range p.Requires() {
+				if r.Name() == req.Name() && rpm.Compare(r, req) == 0 {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected %s to require %v", p, req)
+			}
+		}
+		files := pkg.Files()
+		if len(p.Files()) != len(files) {
+			t.Fatalf("Expected %d files, got: %d", len(files), len(p.Files()))
+		}
+		for i, f := range p.Files() {
+			if f.Name != files[i].Name() || f.IsDir() != files[i].IsDir() {
+				t.Errorf("Expected file %s, got: %s", files[i].Name(), f.Name)
+			}
+		}
+		if !reflect.DeepEqual(p.Changelog(), pkg.Changelog()) {
+			t.Errorf("Expected changelog of %s to match", p)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+/*
+Package repo reads and generates yum and dnf repository metadata.
+
+	repomd, err := repo.Create("/srv/repo/el8/x86_64", &repo.Options{
+		Compression: repo.CompressionXZ,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Revision:", repomd.Revision)
+
+Create searches the directory recursively for rpm packages and writes
+repodata/repomd.xml along with the primary, filelists and other metadata
+files. Metadata files are named with their checksum and may be compressed with
+gzip, xz or zstd. With Options.Update, entries for unchanged packages are
+copied from the existing metadata, so only new or modified packages are read.
+The new repodata directory is written alongside the old one and replaces it
+only once it is complete, so clients never observe partially written metadata.
+
+Advisories given in Options.Advisories are written to updateinfo.xml.
+ApplicableAdvisories reports which advisories fix a set of installed packages.
+Package groups given in Options.Comps are written to the group metadata, in
+the comps.xml format. SQLite databases, prestodelta.xml and other optional
+metadata are not generated.
+
+# Reading metadata
+
+Open reads the metadata of a repository on disk. Each package record has the
+same accessors as rpm.Package for the fields available in the metadata, such as
+Requires and Provides, and the checksum and location of the package file:
+
+	md, err := repo.Open("/srv/repo/el8/x86_64", "filelists")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range md.Packages {
+		fmt.Println(p, p.Location().Href, len(p.Files()))
+	}
+
+ReadPrimary, ReadFilelists and ReadOther read metadata from any source, such
+as an HTTP response. ReadUpdateinfo, ReadComps, ReadModules and ReadPrestoDelta
+read advisories, package groups, modularity metadata and delta rpms. A
+ModuleIndex filters a package set to hide packages of inactive module streams,
+as dnf does. Use NewMetadataReader to decompress metadata files and verify
+their checksums against repomd.xml.
+
+# Remote repositories
+
+A Client fetches metadata and packages from a remote repository, located by a
+base URL, mirror list or metalink. If a keyring is given, the signature of
+repomd.xml is verified before any metadata is used:
+
+	keyring, err := rpm.OpenKeyRing("/etc/pki/rpm-gpg/RPM-GPG-KEY-EPEL-8")
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := &repo.Client{
+		Metalink: "https://mirrors.fedoraproject.org/metalink?repo=epel-8&arch=x86_64",
+		KeyRing:  keyring,
+	}
+	md, err := c.Metadata(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range md.Packages {
+		// read the package headers without downloading the payload
+		pkg, err := c.ReadHeader(ctx, p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(pkg, pkg.BuildHost())
+	}
+*/
+package repo
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures the generation of repository metadata.
+type Options struct {
+	// ChecksumType is the checksum algorithm used to identify packages and
+	// metadata files. The default is ChecksumSHA256.
+	ChecksumType string
+
+	// Compression is the compression type of the metadata files. The default
+	// is CompressionGzip.
+	Compression string
+
+	// BaseURL, if set, is the base URL of the package locations in primary.xml.
+	BaseURL string
+
+	// ChangelogLimit is the maximum number of changelog entries per package
+	// in other.xml. If zero, all entries are included.
+	ChangelogLimit int
+
+	// Revision is the revision of the repository in repomd.xml. The default
+	// is the current Unix time.
+	Revision string
+
+	// Update enables reuse of the existing metadata of a repository. Entries
+	// for packages whose location, size and modification time are unchanged
+	// are copied from the existing metadata instead of reading the package
+	// headers. Entries are only reused if they have the same checksum type.
+	//
+	// Other options which affect package entries, such as BaseURL and
+	// ChangelogLimit, apply only to packages that are read.
+	Update bool
+
+	// Advisories, if not empty, are written to updateinfo.xml. Existing
+	// advisories are not preserved, even if Update is true.
+	Advisories []*Advisory
+
+	// Comps, if set, is written to the group metadata files, both
+	// uncompressed and gzip compressed.
+	Comps *Comps
+}
+
+func (c *Options) checksumType() string {
+	if c == nil || c.ChecksumType == "" {
+		return ChecksumSHA256
+	}
+	return c.ChecksumType
+}
+
+func (c *Options) compression() string {
+	if c == nil || c.Compression == "" {
+		return CompressionGzip
+	}
+	return c.Compression
+}
+
+func (c *Options) baseURL() string {
+	if c == nil {
+		return ""
+	}
+	return c.BaseURL
+}
+
+func (c *Options) changelogLimit() int {
+	if c == nil {
+		return 0
+	}
+	return c.ChangelogLimit
+}
+
+func (c *Options) update() bool {
+	return c != nil && c.Update
+}
+
+func (c *Options) advisories() []*Advisory {
+	if c == nil {
+		return nil
+	}
+	return c.Advisories
+}
+
+func (c *Options) comps() *Comps {
+	if c == nil {
+		return nil
+	}
+	return c.Comps
+}
+
+func (c *Options) revision() string {
+	if c == nil || c.Revision == "" {
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	}
+	return c.Revision
+}
+
+// Create generates the metadata for all rpm packages found in dir and its
+// subdirectories and writes it to dir/repodata. Any existing metadata is
+// replaced.
+//
+// If opts.Update is true, unchanged package entries are copied from the
+// existing metadata and only new or modified packages are read. Entries for
+// packages that no longer exist are removed.
+func Create(dir string, opts *Options) (*Repomd, error) {
+	locations, err := FindPackages(dir)
+	if err != nil {
+		return nil, err
+	}
+	cache := metadataCache{}
+	if opts.update() {
+		if cache, err = readMetadataCache(dir, opts.checksumType()); err != nil {
+			return nil, err
+		}
+	}
+	return writeRepodata(dir, len(locations), opts, func(w *metadataWriter) error {
+		for _, location := range locations {
+			cached, err := cache.get(dir, location)
+			if err != nil {
+				return err
+			}
+			if cached != nil {
+				if err := w.addEntries(cached.primary, cached.filelists, cached.other); err != nil {
+					return err
+				}
+				continue
+			}
+			p, err := OpenPackageFile(dir, location, opts.checksumType())
+			if err != nil {
+				return err
+			}
+			if err := w.add(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Write generates the metadata for the given packages and writes it to
+// dir/repodata. Any existing metadata is replaced.
+//
+// The checksum of each package must be of the type given in opts.
+func Write(dir string, pkgs []*PackageFile, opts *Options) (*Repomd, error) {
+	for _, p := range pkgs {
+		if p.Checksum.Type != opts.checksumType() {
+			return nil, errorf("%s: expected %s checksum, got: %s", p.Location, opts.checksumType(), p.Checksum.Type)
+		}
+	}
+	return writeRepodata(dir, len(pkgs), opts, func(w *metadataWriter) error {
+		for _, p := range pkgs {
+			if err := w.add(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindPackages returns the slash-separated paths, relative to dir, of all rpm
+// packages in dir and its subdirectories, in lexical order. Hidden files and
+// directories and the repodata directory are skipped.
+func FindPackages(dir string) ([]string, error) {
+	return findFiles(dir, ".rpm")
+}
+
+// findFiles returns the slash-separated paths, relative to dir, of all files
+// with the given suffix in dir and its subdirectories, in lexical order.
+func findFiles(dir, suffix string) ([]string, error) {
+	var a []string
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(fi.Name(), ".") || rel == "repodata" {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Mode().IsRegular() && strings.HasSuffix(fi.Name(), suffix) {
+			a = append(a, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(a)
+	return a, nil
+}
+
+// writeRepodata writes metadata for n packages to a temporary directory using
+// the add function, then replaces dir/repodata with the temporary directory.
+//
+// The temporary directory, dir/.repodata, also serves as a lock. An error is
+// returned if it exists, as another process may be updating the repository.
+func writeRepodata(dir string, n int, opts *Options, add func(w *metadataWriter) error) (*Repomd, error) {
+	tmp := filepath.Join(dir, ".repodata")
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		if os.IsExist(err) {
+			return nil, errorf("%s exists; is another process updating the repository?", tmp)
+		}
+		return nil, err
+	}
+	repomd, err := writeMetadata(tmp, n, opts, add)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	// replace the old metadata
+	repodata := filepath.Join(dir, "repodata")
+	old := filepath.Join(dir, ".repodata.old")
+	if err := os.RemoveAll(old); err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := os.Rename(repodata, old); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, repodata); err != nil {
+		os.Rename(old, repodata)
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+	if err := os.RemoveAll(old); err != nil {
+		return nil, err
+	}
+	return repomd, nil
+}
+
+// writeMetadata writes the metadata files and repomd.xml to dir.
+func writeMetadata(dir string, n int, opts *Options, add func(w *metadataWriter) error) (*Repomd, error) {
+	w, err := newMetadataWriter(dir, n, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(w); err != nil {
+		w.abort()
+		return nil, err
+	}
+	data, err := w.close()
+	if err != nil {
+		return nil, err
+	}
+	if advisories := opts.advisories(); len(advisories) > 0 {
+		d, err := writeMDFile(dir, "updateinfo", opts.checksumType(), opts.compression(), func(w io.Writer) error {
+			return WriteUpdateinfo(w, advisories)
+		})
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, d)
+	}
+	if comps := opts.comps(); comps != nil {
+		// dnf and yum read either the uncompressed or the gzip compressed file
+		for _, compression := range []string{"", CompressionGzip} {
+			typ := "group"
+			if compression != "" {
+				typ += "_" + compression
+			}
+			d, err := writeMDFile(dir, typ, opts.checksumType(), compression, func(w io.Writer) error {
+				return WriteComps(w, comps)
+			})
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, d)
+		}
+	}
+	repomd := &Repomd{
+		Revision: opts.revision(),
+		Data:     data,
+	}
+	f, err := os.Create(filepath.Join(dir, "repomd.xml"))
+	if err != nil {
+		return nil, err
+	}
+	if err := writeRepomd(f, repomd); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return repomd, nil
+}
@@ -0,0 +1,284 @@
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// newTestRepo returns a temporary repository containing the rpm packages in
+// the testdata directory of the rpm package.
+func newTestRepo(t *testing.T) string {
+	dir := t.TempDir()
+	names, err := filepath.Glob("../testdata/*.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "Packages"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(dir, "Packages", filepath.Base(name))
+		if err := ioutil.WriteFile(dst, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readMetadata returns the decompressed content of a metadata file after
+// verifying its checksums and sizes.
+func readMetadata(t *testing.T, dir string, data *RepomdData) []byte {
+	b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(data.Location.Href)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(b)) != data.Size {
+		t.Errorf("Expected %s size %d, got: %d", data.Type, data.Size, len(b))
+	}
+	if sum := checksum(t, data.Checksum.Type, b); sum != data.Checksum.Value {
+		t.Errorf("Expected %s checksum %s, got: %s", data.Type, data.Checksum.Value, sum)
+	}
+	if !strings.HasPrefix(filepath.Base(data.Location.Href), data.Checksum.Value+"-"+data.Type+".xml") {
+		t.Errorf("Expected %s location to include its checksum, got: %s", data.Type, data.Location.Href)
+	}
+	var r io.Reader
+	switch filepath.Ext(data.Location.Href) {
+	case ".gz":
+		r, err = gzip.NewReader(bytes.NewReader(b))
+	case ".xz":
+		r, err = xz.NewReader(bytes.NewReader(b))
+	case ".zst":
+		r, err = zstd.NewReader(bytes.NewReader(b))
+	case ".xml":
+		if data.OpenChecksum != nil {
+			t.Errorf("Expected no open checksum for uncompressed %s", data.Type)
+		}
+		return b
+	default:
+		t.Fatalf("Unexpected location: %s", data.Location.Href)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(b)) != data.OpenSize {
+		t.Errorf("Expected %s open size %d, got: %d", data.Type, data.OpenSize, len(b))
+	}
+	if sum := checksum(t, data.OpenChecksum.Type, b); sum != data.OpenChecksum.Value {
+		t.Errorf("Expected %s open checksum %s, got: %s", data.Type, data.OpenChecksum.Value, sum)
+	}
+	return b
+}
+
+func checksum(t *testing.T, typ string, b []byte) string {
+	h, err := newHash(typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// testPrimary decodes the fields of primary.xml checked by tests.
+type testPrimary struct {
+	Packages []struct {
+		Name     string `xml:"name"`
+		Arch     string `xml:"arch"`
+		Checksum struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"checksum"`
+		Location Location `xml:"location"`
+		Size     struct {
+			Package int64 `xml:"package,attr"`
+		} `xml:"size"`
+		Format struct {
+			HeaderRange struct {
+				Start int `xml:"start,attr"`
+				End   int `xml:"end,attr"`
+			} `xml:"header-range"`
+			Provides []struct {
+				Name  string `xml:"name,attr"`
+				Flags string `xml:"flags,attr"`
+				Ver   string `xml:"ver,attr"`
+			} `xml:"provides>entry"`
+			Requires []struct {
+				Name string `xml:"name,attr"`
+				Pre  string `xml:"pre,attr"`
+			} `xml:"requires>entry"`
+			Files []string `xml:"file"`
+		} `xml:"format"`
+	} `xml:"package"`
+	Count int `xml:"packages,attr"`
+}
+
+func TestCreate(t *testing.T) {
+	for _, compression := range []string{CompressionGzip, CompressionXZ, CompressionZstd} {
+		t.Run(compression, func(t *testing.T) {
+			dir := newTestRepo(t)
+			repomd, err := Create(dir, &Options{Compression: compression, Revision: "42"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// repomd.xml
+			f, err := os.Open(filepath.Join(dir, "repodata", "repomd.xml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var actual Repomd
+			if err := xml.NewDecoder(f).Decode(&actual); err != nil {
+				t.Fatal(err)
+			}
+			if actual.Revision != "42" {
+				t.Errorf("Expected revision 42, got: %s", actual.Revision)
+			}
+			for _, typ := range []string{"primary", "filelists", "other"} {
+				if actual.Get(typ) == nil || repomd.Get(typ) == nil {
+					t.Fatalf("Missing %s metadata", typ)
+				}
+				if *actual.Get(typ).OpenChecksum != *repomd.Get(typ).OpenChecksum {
+					t.Errorf("Expected %s in repomd.xml to match returned Repomd", typ)
+				}
+				readMetadata(t, dir, actual.Get(typ))
+			}
+
+			// primary.xml
+			var primary testPrimary
+			b := readMetadata(t, dir, actual.Get("primary"))
+			if err := xml.Unmarshal(b, &primary); err != nil {
+				t.Fatal(err)
+			}
+			locations, err := FindPackages(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if primary.Count != len(locations) || len(primary.Packages) != len(locations) {
+				t.Fatalf("Expected %d packages, got: %d (%d)", len(locations), len(primary.Packages), primary.Count)
+			}
+			for i, p := range primary.Packages {
+				name := filepath.Join(dir, filepath.FromSlash(p.Location.Href))
+				if p.Location.Href != locations[i] {
+					t.Errorf("Expected location %s, got: %s", locations[i], p.Location.Href)
+				}
+				b, err := ioutil.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if sum := checksum(t, p.Checksum.Type, b); sum != p.Checksum.Value {
+					t.Errorf("Expected checksum %s for %s, got: %s", sum, p.Location.Href, p.Checksum.Value)
+				}
+				if p.Size.Package != int64(len(b)) {
+					t.Errorf("Expected package size %d, got: %d", len(b), p.Size.Package)
+				}
+				pkg, err := rpm.Open(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.Name != pkg.Name() || p.Arch != pkg.Architecture() {
+					t.Errorf("Expected %s.%s, got: %s.%s", pkg.Name(), pkg.Architecture(), p.Name, p.Arch)
+				}
+				start, end := pkg.HeaderRange()
+				if p.Format.HeaderRange.Start != start || p.Format.HeaderRange.End != end {
+					t.Errorf("Expected header range %d-%d, got: %d-%d", start, end,
+						p.Format.HeaderRange.Start, p.Format.HeaderRange.End)
+				}
+				found := false
+				for _, entry := range p.Format.Provides {
+					if entry.Name == pkg.Name() && entry.Flags == "EQ" && entry.Ver == pkg.Version() {
+						found = true
+					}
+				}
+				if !found {
+					t.Errorf("Expected %s to provide itself", p.Name)
+				}
+				for _, entry := range p.Format.Requires {
+					if strings.HasPrefix(entry.Name, "rpmlib(") {
+						t.Errorf("Unexpected requirement in %s: %s", p.Name, entry.Name)
+					}
+				}
+				for _, name := range p.Format.Files {
+					if !isPrimaryFile(name) {
+						t.Errorf("Unexpected primary file in %s: %s", p.Name, name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCreateReplacesMetadata(t *testing.T) {
+	dir := newTestRepo(t)
+	if _, err := Create(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	repomd, err := Create(dir, &Options{ChecksumType: ChecksumSHA1, ChangelogLimit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := repomd.Get("primary").Checksum; sum.Type != ChecksumSHA1 || len(sum.Value) != 40 {
+		t.Errorf("Expected sha1 checksum, got: %s %s", sum.Type, sum.Value)
+	}
+	names, err := ioutil.ReadDir(filepath.Join(dir, "repodata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 4 {
+		t.Errorf("Expected 4 files in repodata, got: %d", len(names))
+	}
+	for _, name := range []string{".repodata", ".repodata.old"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", name)
+		}
+	}
+
+	// other.xml
+	var other struct {
+		Packages []struct {
+			Changelog []struct {
+				Author string `xml:"author,attr"`
+			} `xml:"changelog"`
+		} `xml:"package"`
+	}
+	if err := xml.Unmarshal(readMetadata(t, dir, repomd.Get("other")), &other); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range other.Packages {
+		if len(p.Changelog) > 1 {
+			t.Errorf("Expected at most one changelog entry, got: %d", len(p.Changelog))
+		}
+	}
+}
+
+func TestCreateLocked(t *testing.T) {
+	dir := newTestRepo(t)
+	if err := os.Mkdir(filepath.Join(dir, ".repodata"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(dir, nil); err == nil {
+		t.Errorf("Expected error when .repodata exists")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "repodata")); !os.IsNotExist(err) {
+		t.Errorf("Expected no repodata to be written")
+	}
+}
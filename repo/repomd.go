@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// XML namespaces used in repository metadata.
+const (
+	NamespaceRepo      = "http://linux.duke.edu/metadata/repo"
+	NamespaceCommon    = "http://linux.duke.edu/metadata/common"
+	NamespaceRPM       = "http://linux.duke.edu/metadata/rpm"
+	NamespaceFilelists = "http://linux.duke.edu/metadata/filelists"
+	NamespaceOther     = "http://linux.duke.edu/metadata/other"
+)
+
+// Repomd is the index of a repository's metadata files, stored in
+// repodata/repomd.xml.
+type Repomd struct {
+	XMLName  xml.Name      `xml:"http://linux.duke.edu/metadata/repo repomd"`
+	Revision string        `xml:"revision"`
+	Data     []*RepomdData `xml:"data"`
+}
+
+// Get returns the metadata file of the given type, such as "primary", or nil
+// if the repository has no such file.
+func (c *Repomd) Get(typ string) *RepomdData {
+	for _, data := range c.Data {
+		if data.Type == typ {
+			return data
+		}
+	}
+	return nil
+}
+
+// RepomdData describes a metadata file listed in repomd.xml.
+type RepomdData struct {
+	Type         string    `xml:"type,attr"`
+	Checksum     Checksum  `xml:"checksum"`
+	OpenChecksum *Checksum `xml:"open-checksum,omitempty"`
+	Location     Location  `xml:"location"`
+	Timestamp    int64     `xml:"timestamp"`
+	Size         int64     `xml:"size"`
+	OpenSize     int64     `xml:"open-size,omitempty"`
+}
+
+// Checksum is the checksum of a file in the form used in repository metadata.
+type Checksum struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Location is the location of a file relative to the root of a repository, or
+// to Base if it is set.
+type Location struct {
+	Href string `xml:"href,attr"`
+	Base string `xml:"http://www.w3.org/XML/1998/namespace base,attr,omitempty"`
+}
+
+// writeRepomd writes repomd to w as an XML document.
+func writeRepomd(w io.Writer, repomd *Repomd) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(repomd); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadRepomd reads the repomd.xml document from r.
+func ReadRepomd(r io.Reader) (*Repomd, error) {
+	repomd := &Repomd{}
+	if err := xml.NewDecoder(r).Decode(repomd); err != nil {
+		return nil, errorf("error reading repomd.xml: %v", err)
+	}
+	return repomd, nil
+}
@@ -0,0 +1,190 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// cachedPackage is a package entry read from existing repository metadata,
+// which may be reused if the package file has not changed.
+type cachedPackage struct {
+	pkgid     string
+	size      int64
+	mtime     int64
+	primary   []byte
+	filelists []byte
+	other     []byte
+}
+
+// metadataCache indexes the package entries of existing metadata by location.
+type metadataCache map[string]*cachedPackage
+
+// get returns the cached entry for the package at location if the size and
+// modification time of the package file are unchanged. Otherwise, nil is
+// returned.
+func (c metadataCache) get(dir, location string) (*cachedPackage, error) {
+	p := c[location]
+	if p == nil || p.filelists == nil || p.other == nil {
+		return nil, nil
+	}
+	fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(location)))
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() != p.size || fi.ModTime().Unix() != p.mtime {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// readMetadataCache reads the package entries of the existing metadata in
+// dir/repodata. Only entries with the given checksum type are included. An
+// empty cache is returned if the repository has no metadata.
+func readMetadataCache(dir, checksumType string) (metadataCache, error) {
+	repodata := filepath.Join(dir, "repodata")
+	f, err := os.Open(filepath.Join(repodata, "repomd.xml"))
+	if os.IsNotExist(err) {
+		return metadataCache{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	repomd, err := ReadRepomd(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, typ := range []string{"primary", "filelists", "other"} {
+		if repomd.Get(typ) == nil {
+			return metadataCache{}, nil
+		}
+	}
+
+	cache := make(metadataCache)
+	byID := make(map[string][]*cachedPackage)
+	err = readCacheEntries(dir, repomd.Get("primary"), func(b []byte) error {
+		var v struct {
+			Checksum xmlPackageID `xml:"checksum"`
+			Time     xmlTime      `xml:"time"`
+			Size     xmlSize      `xml:"size"`
+			Location Location     `xml:"location"`
+		}
+		if err := xml.Unmarshal(b, &v); err != nil {
+			return err
+		}
+		if v.Checksum.Type != checksumType {
+			return nil
+		}
+		p := &cachedPackage{
+			pkgid:   v.Checksum.Value,
+			size:    v.Size.Package,
+			mtime:   v.Time.File,
+			primary: b,
+		}
+		cache[v.Location.Href] = p
+		byID[p.pkgid] = append(byID[p.pkgid], p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, typ := range []string{"filelists", "other"} {
+		err := readCacheEntries(dir, repomd.Get(typ), func(b []byte) error {
+			var v struct {
+				PkgID string `xml:"pkgid,attr"`
+			}
+			if err := xml.Unmarshal(b, &v); err != nil {
+				return err
+			}
+			for _, p := range byID[v.PkgID] {
+				if typ == "filelists" {
+					p.filelists = b
+				} else {
+					p.other = b
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cache, nil
+}
+
+// readCacheEntries calls fn with the encoded XML of each package entry in the
+// given metadata file.
+func readCacheEntries(dir string, data *RepomdData, fn func(b []byte) error) error {
+	f, err := os.Open(filepath.Join(dir, filepath.FromSlash(data.Location.Href)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := newDecompressor(f, data.Location.Href)
+	if err != nil {
+		return errorf("error reading %s: %v", data.Location.Href, err)
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errorf("error reading %s: %v", data.Location.Href, err)
+	}
+	if err := splitPackages(b, data.Type == "primary", fn); err != nil {
+		return errorf("error reading %s: %v", data.Location.Href, err)
+	}
+	return nil
+}
+
+// splitPackages calls fn with the encoded XML of each package element in the
+// metadata document b.
+//
+// If rpmPrefix is true, the document must declare the "rpm" namespace prefix
+// used in package entries written by this package. Otherwise, the entries
+// could not be copied verbatim into new metadata.
+func splitPackages(b []byte, rpmPrefix bool, fn func(b []byte) error) error {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	depth := 0
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && rpmPrefix && !hasRPMPrefix(t) {
+				return errors.New("root element does not declare the rpm namespace prefix")
+			}
+			if depth != 2 || t.Name.Local != "package" {
+				continue
+			}
+			if err := d.Skip(); err != nil {
+				return err
+			}
+			depth--
+			if err := fn(b[offset:d.InputOffset()]); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+func hasRPMPrefix(root xml.StartElement) bool {
+	for _, attr := range root.Attr {
+		if attr.Name.Space == "xmlns" && attr.Name.Local == "rpm" {
+			return attr.Value == NamespaceRPM
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package repo
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCreateUpdate(t *testing.T) {
+	dir := newTestRepo(t)
+	repomd, err := Create(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unchanged metadata is reproduced exactly
+	updated, err := Create(dir, &Options{Update: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, typ := range []string{"primary", "filelists", "other"} {
+		if *updated.Get(typ).OpenChecksum != *repomd.Get(typ).OpenChecksum {
+			t.Errorf("Expected unchanged %s metadata", typ)
+		}
+	}
+
+	// replace a package with junk of the same size and modification time,
+	// which must not be read
+	junk := filepath.Join(dir, "Packages", "centos-release-3.1-1.i386.rpm")
+	fi, err := os.Stat(junk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(junk, make([]byte, fi.Size()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(junk, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	// touch a package, which must be read again
+	touched := filepath.Join(dir, "Packages", "epel-release-7-5.noarch.rpm")
+	mtime := time.Unix(1500000000, 0)
+	if err := os.Chtimes(touched, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	// add and remove packages
+	if err := os.Rename(
+		filepath.Join(dir, "Packages", "centos-release-4-0.1.x86_64.rpm"),
+		filepath.Join(dir, "centos-release-4-0.1.x86_64.rpm"),
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "Packages", "centos-release-6-0.el6.centos.5.i686.rpm")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Create(dir, nil); err == nil {
+		t.Fatalf("Expected error reading junk package without update")
+	}
+	updated, err = Create(dir, &Options{Update: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var primary testPrimary
+	if err := xml.Unmarshal(readMetadata(t, dir, updated.Get("primary")), &primary); err != nil {
+		t.Fatal(err)
+	}
+	locations, err := FindPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.Count != len(locations) || len(primary.Packages) != len(locations) {
+		t.Fatalf("Expected %d packages, got: %d (%d)", len(locations), len(primary.Packages), primary.Count)
+	}
+	pkgids := make(map[string]bool)
+	added := false
+	for i, p := range primary.Packages {
+		if p.Location.Href != locations[i] {
+			t.Errorf("Expected location %s, got: %s", locations[i], p.Location.Href)
+		}
+		if p.Location.Href == "centos-release-4-0.1.x86_64.rpm" {
+			added = true
+		}
+		pkgids[p.Checksum.Value] = true
+	}
+	if !added {
+		t.Errorf("Expected moved package to be added")
+	}
+
+	var times struct {
+		Packages []struct {
+			Location Location `xml:"location"`
+			Time     xmlTime  `xml:"time"`
+		} `xml:"package"`
+	}
+	if err := xml.Unmarshal(readMetadata(t, dir, updated.Get("primary")), &times); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range times.Packages {
+		if p.Location.Href == "Packages/epel-release-7-5.noarch.rpm" && p.Time.File != mtime.Unix() {
+			t.Errorf("Expected touched package to be read, got time: %d", p.Time.File)
+		}
+	}
+
+	// filelists.xml and other.xml must list the same packages
+	for _, typ := range []string{"filelists", "other"} {
+		var v struct {
+			Count    int `xml:"packages,attr"`
+			Packages []struct {
+				PkgID string `xml:"pkgid,attr"`
+			} `xml:"package"`
+		}
+		if err := xml.Unmarshal(readMetadata(t, dir, updated.Get(typ)), &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Count != len(locations) || len(v.Packages) != len(locations) {
+			t.Errorf("Expected %d packages in %s, got: %d (%d)", len(locations), typ, len(v.Packages), v.Count)
+		}
+		for _, p := range v.Packages {
+			if !pkgids[p.PkgID] {
+				t.Errorf("Unexpected package in %s: %s", typ, p.PkgID)
+			}
+		}
+	}
+}
+
+func TestCreateUpdateChecksumType(t *testing.T) {
+	dir := newTestRepo(t)
+	if _, err := Create(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := readMetadataCache(dir, ChecksumSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache) != 0 {
+		t.Errorf("Expected no cached entries for a different checksum type, got: %d", len(cache))
+	}
+	cache, err = readMetadataCache(dir, ChecksumSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locations, err := FindPackages(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, location := range locations {
+		p, err := cache.get(dir, location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil {
+			t.Errorf("Expected cached entry for %s", location)
+		}
+	}
+}
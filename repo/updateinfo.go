@@ -0,0 +1,393 @@
+package repo
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// Advisory types used in updateinfo.xml.
+const (
+	AdvisorySecurity    = "security"
+	AdvisoryBugfix      = "bugfix"
+	AdvisoryEnhancement = "enhancement"
+	AdvisoryNewPackage  = "newpackage"
+)
+
+// An Advisory is an update notice, also known as an erratum, listed in the
+// updateinfo.xml metadata of a repository. It describes an issue such as a
+// security vulnerability and the packages which fix it.
+type Advisory struct {
+	// ID uniquely identifies the advisory, as in "RHSA-2022:1234".
+	ID string
+
+	// Type is the type of the advisory, such as AdvisorySecurity.
+	Type string
+
+	// Status is the status of the advisory, usually "final" or "stable".
+	Status string
+
+	// From is the contact address of the advisory's publisher.
+	From string
+
+	// Version is the revision of the advisory.
+	Version string
+
+	Title       string
+	Severity    string
+	Release     string
+	Issued      time.Time
+	Updated     time.Time
+	Rights      string
+	Summary     string
+	Description string
+	Solution    string
+
+	// References are links to related bug reports and CVE entries.
+	References []Reference
+
+	// Collections are the sets of packages which fix the issue.
+	Collections []Collection
+}
+
+// A Reference is a link from an advisory to a bug report, CVE entry or other
+// document.
+type Reference struct {
+	// Type is the type of the referenced document, such as "cve", "bugzilla"
+	// or "self".
+	Type  string
+	ID    string
+	Href  string
+	Title string
+}
+
+// A Collection is a set of packages listed by an advisory, usually for a
+// single product release.
+type Collection struct {
+	Short    string
+	Name     string
+	Packages []AdvisoryPackage
+}
+
+// An AdvisoryPackage is a package listed by an advisory. Installed packages
+// with the same name and architecture, and an older version, are fixed by
+// updating to this package.
+type AdvisoryPackage struct {
+	Name    string
+	Epoch   int
+	Version string
+	Release string
+	Arch    string
+
+	// Src is the file name of the source package.
+	Src string
+
+	// Filename is the file name of the package.
+	Filename string
+
+	// Checksum is the checksum of the package file, if known.
+	Checksum *Checksum
+
+	// RebootSuggested indicates that the system should be restarted after the
+	// package is installed.
+	RebootSuggested bool
+}
+
+// NewAdvisoryPackage returns the advisory entry for p.
+func NewAdvisoryPackage(p *rpm.Package) AdvisoryPackage {
+	return AdvisoryPackage{
+		Name:     p.Name(),
+		Epoch:    p.Epoch(),
+		Version:  p.Version(),
+		Release:  p.Release(),
+		Arch:     packageArch(p),
+		Src:      p.SourceRPM(),
+		Filename: fmt.Sprintf("%s-%s-%s.%s.rpm", p.Name(), p.Version(), p.Release(), packageArch(p)),
+	}
+}
+
+// NEVRA returns the name, epoch, version, release and architecture of the
+// package.
+func (c *AdvisoryPackage) NEVRA() *rpm.NEVRA {
+	return rpm.NewNEVRA(c.Name, c.Epoch, c.Version, c.Release, c.Arch)
+}
+
+// String returns the package name, version, release and architecture in the
+// form name-version-release.arch.
+func (c *AdvisoryPackage) String() string {
+	return fmt.Sprintf("%s-%s-%s.%s", c.Name, c.Version, c.Release, c.Arch)
+}
+
+// AddPackages adds entries for the given packages to the first collection of
+// the advisory. A collection is created if the advisory has none.
+func (c *Advisory) AddPackages(pkgs ...*rpm.Package) {
+	if len(c.Collections) == 0 {
+		c.Collections = []Collection{{}}
+	}
+	for _, p := range pkgs {
+		c.Collections[0].Packages = append(c.Collections[0].Packages, NewAdvisoryPackage(p))
+	}
+}
+
+// Packages returns the packages in all collections of the advisory.
+func (c *Advisory) Packages() []AdvisoryPackage {
+	var a []AdvisoryPackage
+	for _, collection := range c.Collections {
+		a = append(a, collection.Packages...)
+	}
+	return a
+}
+
+// ApplicableAdvisories returns the advisories which fix any of the installed
+// packages, in the order given.
+//
+// An advisory applies if it lists a package with the same name and
+// architecture as an installed package, and the newest installed version of
+// that package is older than the one listed. Source packages are ignored.
+func ApplicableAdvisories(installed []*rpm.Package, advisories []*Advisory) []*Advisory {
+	newest := make(map[string]*rpm.Package, len(installed))
+	for _, p := range installed {
+		if p.IsSource() {
+			continue
+		}
+		key := p.Name() + "." + p.Architecture()
+		if q, ok := newest[key]; !ok || rpm.Compare(p, q) > 0 {
+			newest[key] = p
+		}
+	}
+	var a []*Advisory
+	for _, advisory := range advisories {
+		for _, p := range advisory.Packages() {
+			if p.Arch == "src" {
+				continue
+			}
+			q, ok := newest[p.Name+"."+p.Arch]
+			if ok && rpm.Compare(q, p.NEVRA()) < 0 {
+				a = append(a, advisory)
+				break
+			}
+		}
+	}
+	return a
+}
+
+// updateinfoTimeFormat is the format of dates written to updateinfo.xml.
+const updateinfoTimeFormat = "2006-01-02 15:04:05"
+
+// xmlUpdate encodes an advisory in updateinfo.xml.
+type xmlUpdate struct {
+	XMLName     xml.Name        `xml:"update"`
+	From        string          `xml:"from,attr,omitempty"`
+	Status      string          `xml:"status,attr,omitempty"`
+	Type        string          `xml:"type,attr"`
+	Version     string          `xml:"version,attr,omitempty"`
+	ID          string          `xml:"id"`
+	Title       string          `xml:"title"`
+	Severity    string          `xml:"severity,omitempty"`
+	Release     string          `xml:"release,omitempty"`
+	Issued      *xmlDate        `xml:"issued"`
+	Updated     *xmlDate        `xml:"updated"`
+	Rights      string          `xml:"rights,omitempty"`
+	Summary     string          `xml:"summary,omitempty"`
+	Description string          `xml:"description"`
+	Solution    string          `xml:"solution,omitempty"`
+	References  []xmlReference  `xml:"references>reference"`
+	Collections []xmlCollection `xml:"pkglist>collection"`
+}
+
+type xmlDate struct {
+	Date string `xml:"date,attr"`
+}
+
+type xmlReference struct {
+	Type  string `xml:"type,attr"`
+	ID    string `xml:"id,attr,omitempty"`
+	Href  string `xml:"href,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+}
+
+type xmlCollection struct {
+	Short    string               `xml:"short,attr,omitempty"`
+	Name     string               `xml:"name"`
+	Packages []xmlAdvisoryPackage `xml:"package"`
+}
+
+type xmlAdvisoryPackage struct {
+	Name            string    `xml:"name,attr"`
+	Version         string    `xml:"version,attr"`
+	Release         string    `xml:"release,attr"`
+	Epoch           string    `xml:"epoch,attr"`
+	Arch            string    `xml:"arch,attr"`
+	Src             string    `xml:"src,attr,omitempty"`
+	Filename        string    `xml:"filename"`
+	Checksum        *Checksum `xml:"sum,omitempty"`
+	RebootSuggested string    `xml:"reboot_suggested,omitempty"`
+}
+
+func newXMLUpdate(a *Advisory) *xmlUpdate {
+	v := &xmlUpdate{
+		From:        a.From,
+		Status:      a.Status,
+		Type:        a.Type,
+		Version:     a.Version,
+		ID:          a.ID,
+		Title:       a.Title,
+		Severity:    a.Severity,
+		Release:     a.Release,
+		Issued:      newXMLDate(a.Issued),
+		Updated:     newXMLDate(a.Updated),
+		Rights:      a.Rights,
+		Summary:     a.Summary,
+		Description: a.Description,
+		Solution:    a.Solution,
+	}
+	for _, ref := range a.References {
+		v.References = append(v.References, xmlReference(ref))
+	}
+	for _, collection := range a.Collections {
+		c := xmlCollection{Short: collection.Short, Name: collection.Name}
+		for _, p := range collection.Packages {
+			entry := xmlAdvisoryPackage{
+				Name:     p.Name,
+				Version:  p.Version,
+				Release:  p.Release,
+				Epoch:    strconv.Itoa(p.Epoch),
+				Arch:     p.Arch,
+				Src:      p.Src,
+				Filename: p.Filename,
+				Checksum: p.Checksum,
+			}
+			if p.RebootSuggested {
+				entry.RebootSuggested = "1"
+			}
+			c.Packages = append(c.Packages, entry)
+		}
+		v.Collections = append(v.Collections, c)
+	}
+	return v
+}
+
+func newXMLDate(t time.Time) *xmlDate {
+	if t.IsZero() {
+		return nil
+	}
+	return &xmlDate{Date: t.UTC().Format(updateinfoTimeFormat)}
+}
+
+// advisory returns the advisory encoded by v.
+func (v *xmlUpdate) advisory() (*Advisory, error) {
+	a := &Advisory{
+		ID:          v.ID,
+		Type:        v.Type,
+		Status:      v.Status,
+		From:        v.From,
+		Version:     v.Version,
+		Title:       v.Title,
+		Severity:    v.Severity,
+		Release:     v.Release,
+		Rights:      v.Rights,
+		Summary:     v.Summary,
+		Description: v.Description,
+		Solution:    v.Solution,
+	}
+	var err error
+	if a.Issued, err = parseUpdateinfoDate(v.Issued); err != nil {
+		return nil, err
+	}
+	if a.Updated, err = parseUpdateinfoDate(v.Updated); err != nil {
+		return nil, err
+	}
+	for _, ref := range v.References {
+		a.References = append(a.References, Reference(ref))
+	}
+	for _, c := range v.Collections {
+		collection := Collection{Short: c.Short, Name: c.Name}
+		for _, entry := range c.Packages {
+			p := AdvisoryPackage{
+				Name:     entry.Name,
+				Version:  entry.Version,
+				Release:  entry.Release,
+				Arch:     entry.Arch,
+				Src:      entry.Src,
+				Filename: entry.Filename,
+				Checksum: entry.Checksum,
+			}
+			if entry.Epoch != "" {
+				if p.Epoch, err = strconv.Atoi(entry.Epoch); err != nil {
+					return nil, fmt.Errorf("invalid epoch for %s: %s", entry.Name, entry.Epoch)
+				}
+			}
+			switch strings.ToLower(strings.TrimSpace(entry.RebootSuggested)) {
+			case "1", "true":
+				p.RebootSuggested = true
+			}
+			collection.Packages = append(collection.Packages, p)
+		}
+		a.Collections = append(a.Collections, collection)
+	}
+	return a, nil
+}
+
+// parseUpdateinfoDate parses a date in updateinfo.xml. Dates may be given in
+// the form "2006-01-02 15:04:05", "2006-01-02" or as a Unix timestamp, and
+// are assumed to be in UTC.
+func parseUpdateinfoDate(v *xmlDate) (time.Time, error) {
+	if v == nil || v.Date == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseInt(v.Date, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	for _, layout := range []string{updateinfoTimeFormat, "2006-01-02"} {
+		if t, err := time.Parse(layout, v.Date); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %s", v.Date)
+}
+
+// ReadUpdateinfo reads the advisories in the uncompressed updateinfo.xml
+// document from r.
+func ReadUpdateinfo(r io.Reader) ([]*Advisory, error) {
+	var advisories []*Advisory
+	err := decodeElements(r, "updates", "update", func(d *xml.Decoder, start *xml.StartElement) error {
+		var v xmlUpdate
+		if err := d.DecodeElement(&v, start); err != nil {
+			return errorf("error reading updateinfo document: %v", err)
+		}
+		a, err := v.advisory()
+		if err != nil {
+			return errorf("error reading advisory %s: %v", v.ID, err)
+		}
+		advisories = append(advisories, a)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return advisories, nil
+}
+
+// WriteUpdateinfo writes the given advisories to w as an updateinfo.xml
+// document.
+func WriteUpdateinfo(w io.Writer, advisories []*Advisory) error {
+	if _, err := io.WriteString(w, xml.Header+"<updates>\n"); err != nil {
+		return err
+	}
+	for _, a := range advisories {
+		b, err := xml.MarshalIndent(newXMLUpdate(a), "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</updates>\n")
+	return err
+}
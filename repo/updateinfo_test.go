@@ -0,0 +1,222 @@
+package repo
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+const testUpdateinfo = `<?xml version="1.0" encoding="UTF-8"?>
+<updates>
+  <update from="updates@fedoraproject.org" status="stable" type="security" version="2.0">
+    <id>FEDORA-2022-0001</id>
+    <title>hello-2.12-2.fc36</title>
+    <severity>Important</severity>
+    <release>Fedora 36</release>
+    <issued date="2022-03-01 12:00:00"/>
+    <updated date="1646395200"/>
+    <description>Fixes CVE-2022-0001.</description>
+    <references>
+      <reference href="https://bugzilla.redhat.com/1" id="1" type="bugzilla" title="CVE-2022-0001 hello: overflow"/>
+      <reference id="CVE-2022-0001" type="cve"/>
+    </references>
+    <pkglist>
+      <collection short="F36">
+        <name>Fedora 36</name>
+        <package name="hello" version="2.12" release="2.fc36" epoch="0" arch="x86_64" src="hello-2.12-2.fc36.src.rpm">
+          <filename>hello-2.12-2.fc36.x86_64.rpm</filename>
+          <sum type="sha256">0123</sum>
+          <reboot_suggested>True</reboot_suggested>
+        </package>
+      </collection>
+    </pkglist>
+  </update>
+  <update type="bugfix">
+    <id>FEDORA-2022-0002</id>
+    <title>world</title>
+    <issued date="2022-03-02"/>
+    <pkglist>
+      <collection>
+        <package name="world" version="1.0" release="1" arch="noarch">
+          <filename>world-1.0-1.noarch.rpm</filename>
+        </package>
+      </collection>
+    </pkglist>
+  </update>
+</updates>
+`
+
+func TestReadUpdateinfo(t *testing.T) {
+	advisories, err := ReadUpdateinfo(strings.NewReader(testUpdateinfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []*Advisory{
+		{
+			ID:          "FEDORA-2022-0001",
+			Type:        AdvisorySecurity,
+			Status:      "stable",
+			From:        "updates@fedoraproject.org",
+			Version:     "2.0",
+			Title:       "hello-2.12-2.fc36",
+			Severity:    "Important",
+			Release:     "Fedora 36",
+			Issued:      time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+			Updated:     time.Unix(1646395200, 0),
+			Description: "Fixes CVE-2022-0001.",
+			References: []Reference{
+				{Type: "bugzilla", ID: "1", Href: "https://bugzilla.redhat.com/1", Title: "CVE-2022-0001 hello: overflow"},
+				{Type: "cve", ID: "CVE-2022-0001"},
+			},
+			Collections: []Collection{{
+				Short: "F36",
+				Name:  "Fedora 36",
+				Packages: []AdvisoryPackage{{
+					Name:            "hello",
+					Version:         "2.12",
+					Release:         "2.fc36",
+					Arch:            "x86_64",
+					Src:             "hello-2.12-2.fc36.src.rpm",
+					Filename:        "hello-2.12-2.fc36.x86_64.rpm",
+					Checksum:        &Checksum{Type: ChecksumSHA256, Value: "0123"},
+					RebootSuggested: true,
+				}},
+			}},
+		},
+		{
+			ID:     "FEDORA-2022-0002",
+			Type:   AdvisoryBugfix,
+			Title:  "world",
+			Issued: time.Date(2022, 3, 2, 0, 0, 0, 0, time.UTC),
+			Collections: []Collection{{
+				Packages: []AdvisoryPackage{{
+					Name:     "world",
+					Version:  "1.0",
+					Release:  "1",
+					Arch:     "noarch",
+					Filename: "world-1.0-1.noarch.rpm",
+				}},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(advisories, expect) {
+		t.Errorf("Expected %+v, got: %+v", expect, advisories)
+	}
+}
+
+func TestReadUpdateinfoErrors(t *testing.T) {
+	tests := []string{
+		`<metadata/>`,
+		`<updates><update><issued date="yesterday"/></update></updates>`,
+		`<updates><update><pkglist><collection><package epoch="x"/></collection></pkglist></update></updates>`,
+		`<updates><update>`,
+	}
+	for _, test := range tests {
+		if _, err := ReadUpdateinfo(strings.NewReader(test)); err == nil {
+			t.Errorf("Expected error reading %s", test)
+		}
+	}
+}
+
+func TestWriteUpdateinfo(t *testing.T) {
+	advisories, err := ReadUpdateinfo(strings.NewReader(testUpdateinfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteUpdateinfo(&buf, advisories); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<issued date="2022-03-01 12:00:00"></issued>`) {
+		t.Errorf("Expected issued date in updateinfo.xml:\n%s", buf.String())
+	}
+	actual, err := ReadUpdateinfo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// timestamps are written in UTC
+	advisories[0].Updated = advisories[0].Updated.UTC()
+	if !reflect.DeepEqual(actual, advisories) {
+		t.Errorf("Expected %+v, got: %+v", advisories, actual)
+	}
+}
+
+func TestApplicableAdvisories(t *testing.T) {
+	var installed []*rpm.Package
+	for _, name := range []string{
+		"centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm",
+		"centos-release-6-0.el6.centos.5.i686.rpm",
+		"epel-release-7-5.noarch.rpm",
+	} {
+		p, err := rpm.Open("../testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		installed = append(installed, p)
+	}
+	advisory := func(id string, pkgs ...AdvisoryPackage) *Advisory {
+		return &Advisory{ID: id, Collections: []Collection{{Packages: pkgs}}}
+	}
+	advisories := []*Advisory{
+		advisory("newer", AdvisoryPackage{Name: "epel-release", Version: "7", Release: "6", Arch: "noarch"}),
+		advisory("same", AdvisoryPackage{Name: "epel-release", Version: "7", Release: "5", Arch: "noarch"}),
+		advisory("older", AdvisoryPackage{Name: "centos-release", Version: "6", Release: "1", Arch: "x86_64"}),
+		advisory("epoch", AdvisoryPackage{Name: "centos-release", Epoch: 1, Version: "6", Release: "0", Arch: "i686"}),
+		advisory("arch", AdvisoryPackage{Name: "epel-release", Version: "8", Release: "1", Arch: "x86_64"}),
+		advisory("src", AdvisoryPackage{Name: "epel-release", Version: "8", Release: "1", Arch: "src"}),
+		advisory("missing", AdvisoryPackage{Name: "hello", Version: "1", Release: "1", Arch: "noarch"}),
+		advisory("any",
+			AdvisoryPackage{Name: "hello", Version: "1", Release: "1", Arch: "noarch"},
+			AdvisoryPackage{Name: "centos-release", Version: "7", Release: "3", Arch: "x86_64"},
+		),
+	}
+	var actual []string
+	for _, a := range ApplicableAdvisories(installed, advisories) {
+		actual = append(actual, a.ID)
+	}
+	expect := []string{"newer", "epoch", "any"}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("Expected %v, got: %v", expect, actual)
+	}
+}
+
+func TestCreateAdvisories(t *testing.T) {
+	dir := newTestRepo(t)
+	p, err := rpm.Open("../testdata/epel-release-7-5.noarch.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Advisory{
+		ID:     "TEST-2022-0001",
+		Type:   AdvisoryEnhancement,
+		Title:  "epel-release",
+		Issued: time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	a.AddPackages(p)
+	if _, err := Create(dir, &Options{Advisories: []*Advisory{a}}); err != nil {
+		t.Fatal(err)
+	}
+	md, err := Open(dir, "updateinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Advisories) != 1 || !reflect.DeepEqual(md.Advisories[0], a) {
+		t.Fatalf("Expected [%+v], got: %+v", a, md.Advisories)
+	}
+	expect := AdvisoryPackage{
+		Name:     "epel-release",
+		Version:  "7",
+		Release:  "5",
+		Arch:     "noarch",
+		Src:      "epel-release-7-5.src.rpm",
+		Filename: "epel-release-7-5.noarch.rpm",
+	}
+	if actual := a.Packages(); len(actual) != 1 || actual[0] != expect {
+		t.Errorf("Expected %+v, got: %+v", expect, actual)
+	}
+}
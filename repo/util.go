@@ -0,0 +1,7 @@
+package repo
+
+import "fmt"
+
+func errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("repo: "+format, a...)
+}
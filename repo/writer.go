@@ -0,0 +1,222 @@
+package repo
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// mdFile writes a compressed metadata file and computes the checksums and
+// sizes listed in repomd.xml.
+type mdFile struct {
+	typ          string
+	dir          string
+	checksumType string
+	compression  string
+	f            *os.File
+	z            io.WriteCloser
+	w            io.Writer
+	sum          hash.Hash
+	openSum      hash.Hash
+	size         countingWriter
+	openSize     countingWriter
+}
+
+// createMDFile creates a metadata file of the given type in dir. If
+// compression is empty, the file is not compressed.
+func createMDFile(dir, typ, checksumType, compression string) (*mdFile, error) {
+	sum, err := newHash(checksumType)
+	if err != nil {
+		return nil, err
+	}
+	openSum, _ := newHash(checksumType)
+	f, err := os.Create(filepath.Join(dir, mdFileName(typ, compression)))
+	if err != nil {
+		return nil, err
+	}
+	c := &mdFile{
+		typ:          typ,
+		dir:          dir,
+		checksumType: checksumType,
+		compression:  compression,
+		f:            f,
+		sum:          sum,
+		openSum:      openSum,
+	}
+	c.z, err = newCompressor(io.MultiWriter(f, c.sum, &c.size), c.compression)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	c.w = io.MultiWriter(c.z, c.openSum, &c.openSize)
+	return c, nil
+}
+
+func (c *mdFile) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// Close flushes the metadata file and renames it to include its checksum, as
+// in <checksum>-primary.xml.gz. The returned data describes the file in
+// repomd.xml.
+func (c *mdFile) Close() (*RepomdData, error) {
+	if err := c.z.Close(); err != nil {
+		c.f.Close()
+		return nil, err
+	}
+	if err := c.f.Close(); err != nil {
+		return nil, err
+	}
+	sum := hex.EncodeToString(c.sum.Sum(nil))
+	name := sum + "-" + mdFileName(c.typ, c.compression)
+	if err := os.Rename(c.f.Name(), filepath.Join(c.dir, name)); err != nil {
+		return nil, err
+	}
+	data := &RepomdData{
+		Type:      c.typ,
+		Checksum:  Checksum{Type: c.checksumType, Value: sum},
+		Location:  Location{Href: path.Join("repodata", name)},
+		Timestamp: time.Now().Unix(),
+		Size:      c.size.n,
+	}
+	if c.compression != "" {
+		data.OpenChecksum = &Checksum{Type: c.checksumType, Value: hex.EncodeToString(c.openSum.Sum(nil))}
+		data.OpenSize = c.openSize.n
+	}
+	return data, nil
+}
+
+// writeMDFile writes a metadata file of the given type to dir using the write
+// function, and returns its repomd.xml entry.
+func writeMDFile(dir, typ, checksumType, compression string, write func(w io.Writer) error) (*RepomdData, error) {
+	f, err := createMDFile(dir, typ, checksumType, compression)
+	if err != nil {
+		return nil, err
+	}
+	if err := write(f); err != nil {
+		f.f.Close()
+		return nil, err
+	}
+	return f.Close()
+}
+
+// mdFileName returns the name of a metadata file of the given type before it
+// is prefixed with its checksum.
+func mdFileName(typ, compression string) string {
+	if compression == "" {
+		return typ + ".xml"
+	}
+	return typ + ".xml." + compression
+}
+
+// metadataWriter writes the primary, filelists and other metadata files of a
+// repository, one package at a time.
+type metadataWriter struct {
+	opts  *Options
+	files []*mdFile
+}
+
+// metadataFiles are the metadata files of a repository and their root
+// elements, in the order package entries are written.
+var metadataFiles = []struct {
+	typ   string
+	elem  string
+	attrs string
+}{
+	{"primary", "metadata", `xmlns="` + NamespaceCommon + `" xmlns:rpm="` + NamespaceRPM + `"`},
+	{"filelists", "filelists", `xmlns="` + NamespaceFilelists + `"`},
+	{"other", "otherdata", `xmlns="` + NamespaceOther + `"`},
+}
+
+// newMetadataWriter creates the metadata files in dir for a repository of n
+// packages.
+func newMetadataWriter(dir string, n int, opts *Options) (*metadataWriter, error) {
+	w := &metadataWriter{opts: opts}
+	for _, md := range metadataFiles {
+		f, err := createMDFile(dir, md.typ, opts.checksumType(), opts.compression())
+		if err != nil {
+			w.abort()
+			return nil, err
+		}
+		w.files = append(w.files, f)
+		if _, err := fmt.Fprintf(f, "%s<%s %s packages=\"%d\">\n", xml.Header, md.elem, md.attrs, n); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// add writes the metadata of p.
+func (c *metadataWriter) add(p *PackageFile) error {
+	return c.addEntries(
+		newPrimaryPackage(p, c.opts.baseURL()),
+		newFilelistsPackage(p),
+		newOtherPackage(p, c.opts.changelogLimit()),
+	)
+}
+
+// addEntries writes a package entry to each metadata file. Entries are
+// either values to be encoded as XML, or byte slices of encoded XML.
+func (c *metadataWriter) addEntries(entries ...interface{}) error {
+	for i, v := range entries {
+		b, ok := v.([]byte)
+		if !ok {
+			var err error
+			if b, err = xml.MarshalIndent(v, "", "  "); err != nil {
+				return err
+			}
+		}
+		if _, err := c.files[i].Write(b); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(c.files[i], "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes each metadata file and returns their repomd.xml entries.
+func (c *metadataWriter) close() ([]*RepomdData, error) {
+	var a []*RepomdData
+	for i, md := range metadataFiles {
+		if _, err := fmt.Fprintf(c.files[i], "</%s>\n", md.elem); err != nil {
+			c.abort()
+			return nil, err
+		}
+	}
+	for _, f := range c.files {
+		data, err := f.Close()
+		if err != nil {
+			c.abort()
+			return nil, err
+		}
+		a = append(a, data)
+	}
+	return a, nil
+}
+
+// abort closes any metadata files that are still open. The caller is
+// responsible for removing the directory they were written to.
+func (c *metadataWriter) abort() {
+	for _, f := range c.files {
+		f.f.Close()
+	}
+}
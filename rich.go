@@ -0,0 +1,316 @@
+package rpm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rich dependency operators combine package relationships into boolean
+// expressions. Rich dependencies were introduced in rpm 4.13.
+const (
+	RichOpNone    RichOp = iota // A simple dependency with no operator
+	RichOpAnd                   // (A and B)
+	RichOpOr                    // (A or B)
+	RichOpIf                    // (A if B) or (A if B else C)
+	RichOpUnless                // (A unless B) or (A unless B else C)
+	RichOpWith                  // (A with B)
+	RichOpWithout               // (A without B)
+)
+
+var richOpNames = []string{
+	"",
+	"and",
+	"or",
+	"if",
+	"unless",
+	"with",
+	"without",
+}
+
+// RichOp is the boolean operator of a rich dependency expression.
+type RichOp int
+
+func (i RichOp) String() string {
+	if i > 0 && int(i) < len(richOpNames) {
+		return richOpNames[i]
+	}
+	return ""
+}
+
+// RichDependency is a parsed rich dependency expression such as
+// '(foo >= 1.0 or bar)'.
+//
+// If Op is RichOpNone, the expression is a simple dependency and is stored in
+// Dependency. Otherwise, Left and Right are the operands of Op. Else is the
+// optional third operand of RichOpIf and RichOpUnless.
+type RichDependency struct {
+	Op         RichOp
+	Dependency Dependency
+	Left       *RichDependency
+	Right      *RichDependency
+	Else       *RichDependency
+}
+
+// IsRich returns true if the given dependency is a rich dependency expression.
+// Rich dependencies are stored in the name of a dependency and are always
+// enclosed in parentheses.
+func IsRich(dep Dependency) bool {
+	return dep != nil && strings.HasPrefix(dep.Name(), "(")
+}
+
+// ParseRichDependency parses a rich dependency expression such as
+// '(foo >= 1.0 or (bar if baz))'.
+//
+// A simple dependency with no enclosing parentheses is returned as a
+// RichDependency with Op set to RichOpNone.
+func ParseRichDependency(s string) (*RichDependency, error) {
+	p := &richParser{s: s}
+	p.skipSpace()
+	var rd *RichDependency
+	var err error
+	if p.peek() == '(' {
+		rd, err = p.parseExpr()
+	} else {
+		rd, err = p.parseSimple()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected trailing characters")
+	}
+	return rd, nil
+}
+
+// String returns the rich dependency expression in the format used in rpm
+// package headers.
+func (c *RichDependency) String() string {
+	if c == nil {
+		return ""
+	}
+	if c.Op == RichOpNone {
+		return formatDependency(c.Dependency)
+	}
+	var sb strings.Builder
+	sb.WriteByte('(')
+	c.writeOperand(&sb, c.Left)
+	sb.WriteString(" " + c.Op.String() + " ")
+	c.writeOperand(&sb, c.Right)
+	if c.Else != nil {
+		sb.WriteString(" else ")
+		c.writeOperand(&sb, c.Else)
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// writeOperand writes an operand of c to sb. Chained operands of the same
+// associative operator are flattened, such that '(a or (b or c))' is written
+// as '(a or b or c)'.
+func (c *RichDependency) writeOperand(sb *strings.Builder, operand *RichDependency) {
+	s := operand.String()
+	if operand.Op == c.Op && c.Else == nil && operand.Else == nil {
+		switch c.Op {
+		case RichOpAnd, RichOpOr, RichOpWith:
+			s = s[1 : len(s)-1]
+		}
+	}
+	sb.WriteString(s)
+}
+
+// formatDependency formats a simple dependency as it would appear in a rich
+// dependency expression, including the epoch and release.
+func formatDependency(dep Dependency) string {
+	if dep == nil {
+		return ""
+	}
+	s := dep.Name()
+	if dep.Version() == "" {
+		return s
+	}
+	switch dep.Flags() & depFlagSenseMask {
+	case DepFlagLesserOrEqual:
+		s += " <= "
+	case DepFlagLesser:
+		s += " < "
+	case DepFlagGreaterOrEqual:
+		s += " >= "
+	case DepFlagGreater:
+		s += " > "
+	case DepFlagEqual:
+		s += " = "
+	default:
+		return s
+	}
+	if dep.Epoch() > 0 {
+		s += fmt.Sprintf("%d:", dep.Epoch())
+	}
+	s += dep.Version()
+	if dep.Release() != "" {
+		s += "-" + dep.Release()
+	}
+	return s
+}
+
+// richParser is a recursive descent parser for rich dependency expressions.
+type richParser struct {
+	s   string
+	pos int
+}
+
+func (p *richParser) errorf(format string, a ...interface{}) error {
+	return errorf("invalid rich dependency %q at offset %d: %s", p.s, p.pos, fmt.Sprintf(format, a...))
+}
+
+func (p *richParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *richParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// word reads the next sequence of characters up to a space or an unbalanced
+// closing parenthesis.
+func (p *richParser) word() string {
+	start, depth := p.pos, 0
+	for ; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		if c == ' ' || c == '\t' {
+			break
+		}
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+	}
+	return p.s[start:p.pos]
+}
+
+// parseExpr parses a parenthesized expression.
+func (p *richParser) parseExpr() (*RichDependency, error) {
+	if p.peek() != '(' {
+		return nil, p.errorf("expected '('")
+	}
+	p.pos++
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() == ')' {
+		p.pos++
+		return left, nil
+	}
+	opPos := p.pos
+	op := parseRichOp(p.word())
+	if op == RichOpNone {
+		p.pos = opPos
+		return nil, p.errorf("expected operator")
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	rd := &RichDependency{Op: op, Left: left, Right: right}
+	for {
+		p.skipSpace()
+		if p.peek() == ')' {
+			p.pos++
+			return rd, nil
+		}
+		opPos = p.pos
+		w := p.word()
+		switch {
+		case w == "else" && (op == RichOpIf || op == RichOpUnless) && rd.Else == nil:
+			if rd.Else, err = p.parseOperand(); err != nil {
+				return nil, err
+			}
+		case parseRichOp(w) == op && (op == RichOpAnd || op == RichOpOr || op == RichOpWith):
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			rd = &RichDependency{Op: op, Left: rd, Right: right}
+		default:
+			p.pos = opPos
+			if w == "" {
+				return nil, p.errorf("expected ')'")
+			}
+			return nil, p.errorf("unexpected %q after %s operand", w, op)
+		}
+	}
+}
+
+// parseOperand parses either a nested expression or a simple dependency.
+func (p *richParser) parseOperand() (*RichDependency, error) {
+	p.skipSpace()
+	if p.peek() == '(' {
+		return p.parseExpr()
+	}
+	return p.parseSimple()
+}
+
+// parseSimple parses a simple dependency in the form 'name [op version]'.
+func (p *richParser) parseSimple() (*RichDependency, error) {
+	name := p.word()
+	if name == "" {
+		return nil, p.errorf("expected dependency name")
+	}
+	if parseRichOp(name) != RichOpNone || name == "else" {
+		return nil, p.errorf("unexpected operator %q", name)
+	}
+	dep := &dependency{name: name}
+	save := p.pos
+	p.skipSpace()
+	flags := parseDepFlags(p.word())
+	if flags == 0 {
+		p.pos = save
+		return &RichDependency{Dependency: dep}, nil
+	}
+	p.skipSpace()
+	evr := p.word()
+	if evr == "" {
+		return nil, p.errorf("expected version after comparison operator")
+	}
+	dep.flags = flags
+	dep.epoch, dep.version, dep.release = parseVersion(evr)
+	return &RichDependency{Dependency: dep}, nil
+}
+
+func parseRichOp(s string) RichOp {
+	for i, name := range richOpNames {
+		if i > 0 && s == name {
+			return RichOp(i)
+		}
+	}
+	return RichOpNone
+}
+
+// parseDepFlags returns the dependency flags for a comparison operator such as
+// '>='. Zero is returned if s is not a comparison operator.
+func parseDepFlags(s string) int {
+	switch s {
+	case "<":
+		return DepFlagLesser
+	case "<=", "=<":
+		return DepFlagLesserOrEqual
+	case ">":
+		return DepFlagGreater
+	case ">=", "=>":
+		return DepFlagGreaterOrEqual
+	case "=", "==":
+		return DepFlagEqual
+	}
+	return 0
+}
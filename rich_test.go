@@ -0,0 +1,56 @@
+package rpm
+
+import "testing"
+
+func TestParseRichDependency(t *testing.T) {
+	tests := []struct {
+		in  string
+		op  RichOp
+		out string
+	}{
+		{"foo", RichOpNone, "foo"},
+		{"foo >= 1:1.0-2", RichOpNone, "foo >= 1:1.0-2"},
+		{"(foo)", RichOpNone, "foo"},
+		{"(foo and bar)", RichOpAnd, "(foo and bar)"},
+		{"(foo or bar or baz)", RichOpOr, "(foo or bar or baz)"},
+		{"(foo > 1.0 with foo < 2.0)", RichOpWith, "(foo > 1.0 with foo < 2.0)"},
+		{"(foo without bar)", RichOpWithout, "(foo without bar)"},
+		{"(foo if bar)", RichOpIf, "(foo if bar)"},
+		{"(foo if bar else baz)", RichOpIf, "(foo if bar else baz)"},
+		{"(foo unless bar else baz)", RichOpUnless, "(foo unless bar else baz)"},
+		{"(perl(Foo::Bar) >= 1.0 or python3dist(foo))", RichOpOr, "(perl(Foo::Bar) >= 1.0 or python3dist(foo))"},
+		{"((foo and bar) or (baz if qux))", RichOpOr, "((foo and bar) or (baz if qux))"},
+		{"(  foo   =   1.0  and  bar )", RichOpAnd, "(foo = 1.0 and bar)"},
+	}
+	for _, test := range tests {
+		rd, err := ParseRichDependency(test.in)
+		if err != nil {
+			t.Errorf("Error parsing %q: %v", test.in, err)
+			continue
+		}
+		if rd.Op != test.op {
+			t.Errorf("Expected operator %q for %q, got: %q", test.op, test.in, rd.Op)
+		}
+		if s := rd.String(); s != test.out {
+			t.Errorf("Expected %q for %q, got: %q", test.out, test.in, s)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"(",
+		"()",
+		"(foo",
+		"(foo bar)",
+		"(foo and)",
+		"(foo and bar or baz)",
+		"(foo if bar else baz else qux)",
+		"(foo >=)",
+		"(foo) bar",
+	}
+	for _, s := range invalid {
+		if _, err := ParseRichDependency(s); err == nil {
+			t.Errorf("Expected error parsing %q", s)
+		}
+	}
+}
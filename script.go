@@ -0,0 +1,112 @@
+package rpm
+
+import "strings"
+
+// Script flags describe how rpm prepares a scriptlet body before executing it.
+const (
+	ScriptFlagExpand   = (1 << 0) // macro expansion
+	ScriptFlagQFormat  = (1 << 1) // header queryformat expansion
+	ScriptFlagCritical = (1 << 2) // critical for success/failure
+)
+
+// Script types identify when rpm runs a scriptlet. They are named after the
+// spec file sections that define each scriptlet.
+const (
+	ScriptPreTrans    = "pretrans"
+	ScriptPre         = "pre"
+	ScriptPost        = "post"
+	ScriptPreUn       = "preun"
+	ScriptPostUn      = "postun"
+	ScriptPostTrans   = "posttrans"
+	ScriptPreUnTrans  = "preuntrans"
+	ScriptPostUnTrans = "postuntrans"
+	ScriptVerify      = "verifyscript"
+)
+
+// DefaultInterpreter is the interpreter used by rpm for scriptlets that do not
+// specify an interpreter.
+const DefaultInterpreter = "/bin/sh"
+
+// LuaInterpreter is the interpreter name rpm uses for scriptlets that run in
+// its embedded Lua interpreter.
+const LuaInterpreter = "<lua>"
+
+// A Script is an install, uninstall or verification scriptlet of a package.
+type Script struct {
+	// Type is one of the Script type constants, such as ScriptPost.
+	Type string
+
+	// Interpreter is the program that runs the scriptlet and its arguments,
+	// such as ["/bin/sh"] or ["<lua>"].
+	Interpreter []string
+
+	// Body is the content of the scriptlet. Body may be empty if the
+	// scriptlet only runs its interpreter, such as '%post -p /sbin/ldconfig'.
+	Body string
+
+	// Flags is a bitmask of ScriptFlag constants.
+	Flags int
+}
+
+// IsLua returns true if the scriptlet runs in rpm's embedded Lua interpreter.
+func (c *Script) IsLua() bool {
+	return len(c.Interpreter) > 0 && c.Interpreter[0] == LuaInterpreter
+}
+
+// String returns the scriptlet in a similar format to `rpm -q --scripts`.
+func (c *Script) String() string {
+	return c.Type + " scriptlet (using " + strings.Join(c.Interpreter, " ") + "):\n" + c.Body
+}
+
+// scriptTags identifies the header tags that describe each scriptlet type, in
+// the order that rpm runs them.
+var scriptTags = []struct {
+	typ   string
+	body  int
+	prog  int
+	flags int
+}{
+	{ScriptPreTrans, 1151, 1153, 5024},
+	{ScriptPre, 1023, 1085, 5020},
+	{ScriptPost, 1024, 1086, 5021},
+	{ScriptPreUn, 1025, 1087, 5022},
+	{ScriptPostUn, 1026, 1088, 5023},
+	{ScriptPostTrans, 1152, 1154, 5025},
+	{ScriptPreUnTrans, 5103, 5105, 5107},
+	{ScriptPostUnTrans, 5104, 5106, 5108},
+	{ScriptVerify, 1079, 1091, 5026},
+}
+
+// Scripts returns each scriptlet in the package, in the order that rpm runs
+// them.
+func (c *Package) Scripts() []Script {
+	a := make([]Script, 0)
+	for _, tags := range scriptTags {
+		body := c.Header.GetTag(tags.body)
+		prog := c.Header.GetTag(tags.prog).StringSlice()
+		if body == nil && len(prog) == 0 {
+			continue
+		}
+		if len(prog) == 0 {
+			prog = []string{DefaultInterpreter}
+		}
+		a = append(a, Script{
+			Type:        tags.typ,
+			Interpreter: prog,
+			Body:        body.String(),
+			Flags:       int(c.Header.GetTag(tags.flags).Int64()),
+		})
+	}
+	return a
+}
+
+// Script returns the scriptlet of the given type, such as ScriptPost. Nil is
+// returned if the package has no such scriptlet.
+func (c *Package) Script(typ string) *Script {
+	for _, script := range c.Scripts() {
+		if script.Type == typ {
+			return &script
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package rpm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScripts(t *testing.T) {
+	p := newTestPackage(map[int]interface{}{
+		1023: []string{"echo pre"},
+		1086: []string{"/sbin/ldconfig"},
+		1151: []string{"print('pretrans')"},
+		1153: []string{"<lua>"},
+		1026: []string{"echo %{name}"},
+		1088: []string{"/bin/bash", "-e"},
+		5023: []int64{ScriptFlagExpand},
+		1079: []string{"test -f /etc/foo"},
+	})
+	tests := []struct {
+		typ         string
+		interpreter string
+		body        string
+		flags       int
+	}{
+		{ScriptPreTrans, "<lua>", "print('pretrans')", 0},
+		{ScriptPre, "/bin/sh", "echo pre", 0},
+		{ScriptPost, "/sbin/ldconfig", "", 0},
+		{ScriptPostUn, "/bin/bash -e", "echo %{name}", ScriptFlagExpand},
+		{ScriptVerify, "/bin/sh", "test -f /etc/foo", 0},
+	}
+	scripts := p.Scripts()
+	if len(scripts) != len(tests) {
+		t.Fatalf("Expected %d scripts, got: %d", len(tests), len(scripts))
+	}
+	for i, test := range tests {
+		script := scripts[i]
+		if script.Type != test.typ {
+			t.Errorf("Expected script %d to be %q, got: %q", i, test.typ, script.Type)
+			continue
+		}
+		if s := strings.Join(script.Interpreter, " "); s != test.interpreter {
+			t.Errorf("Expected interpreter %q for %s, got: %q", test.interpreter, test.typ, s)
+		}
+		if script.Body != test.body {
+			t.Errorf("Expected body %q for %s, got: %q", test.body, test.typ, script.Body)
+		}
+		if script.Flags != test.flags {
+			t.Errorf("Expected flags %d for %s, got: %d", test.flags, test.typ, script.Flags)
+		}
+	}
+	if script := p.Script(ScriptPreTrans); script == nil || !script.IsLua() {
+		t.Errorf("Expected Lua pretrans script, got: %v", script)
+	}
+	if script := p.Script(ScriptPreUn); script != nil {
+		t.Errorf("Expected no preun script, got: %v", script)
+	}
+}
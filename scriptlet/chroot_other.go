@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package scriptlet
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setChroot(cmd *exec.Cmd, root string) error {
+	return errors.New("scriptlet: chroot is not supported on this platform")
+}
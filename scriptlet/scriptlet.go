@@ -0,0 +1,237 @@
+/*
+Package scriptlet runs the shell scriptlets of rpm packages for testing.
+
+A Runner executes scriptlets the way rpm would during a transaction, but
+without installing the package or modifying the rpm database. Each scriptlet is
+given the same arguments and environment variables that rpm provides, and its
+output and exit status are captured for inspection:
+
+	runner := &scriptlet.Runner{Root: t.TempDir()}
+	result, err := runner.Run(ctx, pkg, rpm.ScriptPost, scriptlet.Arg(rpm.ScriptPost, scriptlet.Install))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("%%post failed: %s", result.Stderr)
+	}
+
+Scriptlets that follow rpm's conventions for relocatable packages use
+RPM_INSTALL_PREFIX to locate installed files. The Runner sets this variable to
+each of the package's prefixes within Root, so that such scriptlets operate on
+Root instead of the host system. For stronger isolation, scriptlets may be run
+with Root as their root directory using Chroot, which requires privileges.
+
+Scriptlets that run in rpm's embedded Lua interpreter, or whose bodies require
+macro or queryformat expansion, are not supported.
+*/
+package scriptlet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+var (
+	// ErrUnsupported indicates that a scriptlet cannot be run by a Runner.
+	ErrUnsupported = errors.New("scriptlet: unsupported scriptlet")
+
+	// ErrNoScript indicates that a package has no scriptlet of the requested
+	// type.
+	ErrNoScript = errors.New("scriptlet: no such scriptlet")
+)
+
+// DefaultPath is the value of PATH in the environment of each scriptlet.
+const DefaultPath = "/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Operations describe the transaction in which a scriptlet runs.
+const (
+	Install Operation = iota // a package is installed for the first time
+	Upgrade                  // a package replaces an installed version
+	Erase                    // a package is removed
+)
+
+// Operation is a type of rpm transaction.
+type Operation int
+
+// Arg returns the first argument rpm passes to a scriptlet of the given type
+// during the given operation.
+//
+// The argument is the number of instances of the package that will be
+// installed once the operation completes. Install scriptlets (pretrans, pre,
+// post and posttrans) of a new package receive 1 when installed and 2 when
+// upgrading. Uninstall scriptlets (preun, postun, preuntrans and postuntrans)
+// of the old package receive 1 when upgrading and 0 when erased.
+func Arg(typ string, op Operation) int {
+	switch typ {
+	case rpm.ScriptPreUn, rpm.ScriptPostUn, rpm.ScriptPreUnTrans, rpm.ScriptPostUnTrans:
+		if op == Upgrade {
+			return 1
+		}
+		return 0
+	}
+	if op == Upgrade {
+		return 2
+	}
+	return 1
+}
+
+// A Result is the outcome of running a scriptlet.
+type Result struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// A Runner runs scriptlets with a controlled environment.
+type Runner struct {
+	// Root is the directory which represents the root file system of the
+	// target system.
+	Root string
+
+	// Chroot runs each scriptlet with Root as its root directory. The
+	// scriptlet interpreter must exist within Root. This typically requires
+	// the process to run as root and is not supported on all platforms.
+	Chroot bool
+
+	// Env lists additional environment variables for each scriptlet in the
+	// form "key=value".
+	Env []string
+}
+
+// Run runs the scriptlet of the given type in pkg, such as rpm.ScriptPost,
+// with arg as its first argument. Use Arg to compute the argument rpm would
+// pass for an operation.
+//
+// If pkg has no scriptlet of the given type, ErrNoScript is returned. A
+// scriptlet that exits with a non-zero status is not an error; the status is
+// reported in Result.ExitCode.
+func (c *Runner) Run(ctx context.Context, pkg *rpm.Package, typ string, arg int) (*Result, error) {
+	script := pkg.Script(typ)
+	if script == nil {
+		return nil, ErrNoScript
+	}
+	return c.RunScript(ctx, script, pkg.Prefixes(), arg)
+}
+
+// RunScript runs the given scriptlet. Prefixes are the installation prefixes
+// of a relocatable package, which are exported to the scriptlet as
+// RPM_INSTALL_PREFIX. Each argument is passed to the scriptlet after its body.
+func (c *Runner) RunScript(ctx context.Context, script *rpm.Script, prefixes []string, args ...int) (*Result, error) {
+	if script.IsLua() {
+		return nil, fmt.Errorf("%w: Lua scriptlets are not supported", ErrUnsupported)
+	}
+	if script.Flags&(rpm.ScriptFlagExpand|rpm.ScriptFlagQFormat) != 0 {
+		return nil, fmt.Errorf("%w: scriptlet requires expansion", ErrUnsupported)
+	}
+	if len(script.Interpreter) == 0 {
+		return nil, fmt.Errorf("%w: no interpreter", ErrUnsupported)
+	}
+	if c.Root == "" {
+		return nil, errors.New("scriptlet: no root directory")
+	}
+	root, err := filepath.Abs(c.Root)
+	if err != nil {
+		return nil, err
+	}
+
+	// write the scriptlet body to a temporary file, like rpm does
+	argv := append([]string{}, script.Interpreter...)
+	if script.Body != "" {
+		name, err := c.writeScript(root, script.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(name)
+		if c.Chroot {
+			rel, err := filepath.Rel(root, name)
+			if err != nil {
+				return nil, err
+			}
+			name = "/" + filepath.ToSlash(rel)
+		}
+		argv = append(argv, name)
+		for _, arg := range args {
+			argv = append(argv, strconv.Itoa(arg))
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = c.environ(root, prefixes)
+	cmd.Dir = root
+	if c.Chroot {
+		if err := setChroot(cmd, root); err != nil {
+			return nil, err
+		}
+		cmd.Dir = "/"
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	res := &Result{
+		Stdout: stdout.Bytes(),
+		Stderr: stderr.Bytes(),
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitCode = exitErr.ExitCode()
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// writeScript writes a scriptlet body to a temporary file. If the scriptlet
+// runs in a chroot, the file is created in Root/var/tmp.
+func (c *Runner) writeScript(root, body string) (string, error) {
+	dir := ""
+	if c.Chroot {
+		dir = filepath.Join(root, "var", "tmp")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+	}
+	f, err := os.CreateTemp(dir, "rpm-tmp.")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.WriteString(body); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// environ returns the environment of a scriptlet.
+func (c *Runner) environ(root string, prefixes []string) []string {
+	env := []string{"PATH=" + DefaultPath}
+	for i, prefix := range prefixes {
+		if !c.Chroot {
+			prefix = filepath.Join(root, filepath.FromSlash(path.Clean("/"+prefix)))
+		}
+		if i == 0 {
+			env = append(env, "RPM_INSTALL_PREFIX="+prefix)
+		}
+		env = append(env, fmt.Sprintf("RPM_INSTALL_PREFIX%d=%s", i, prefix))
+	}
+	return append(env, c.Env...)
+}
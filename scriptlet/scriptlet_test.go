@@ -0,0 +1,153 @@
+package scriptlet
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+func TestRun(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh is not available")
+	}
+	pkg, err := rpm.Open("../testdata/centos-release-7-2.1511.el7.centos.2.10.x86_64.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, v := range map[int][]string{
+		1023: {"echo \"pre $1\"\necho warning >&2"},
+		1024: {"mkdir -p \"$RPM_INSTALL_PREFIX/etc\"\necho \"$1 $FOO\" > \"$RPM_INSTALL_PREFIX0/etc/installed\""},
+		1025: {"exit 3"},
+		1098: {"/opt/foo"},
+		1151: {"print('pretrans')"},
+		1153: {"<lua>"},
+	} {
+		pkg.Header.Tags[id] = &rpm.Tag{ID: id, Type: rpm.TagTypeStringArray, Value: v}
+	}
+	root := t.TempDir()
+	runner := &Runner{Root: root, Env: []string{"FOO=bar"}}
+	ctx := context.Background()
+
+	res, err := runner.Run(ctx, pkg, rpm.ScriptPre, Arg(rpm.ScriptPre, Upgrade))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(res.Stdout); s != "pre 2\n" {
+		t.Errorf("Unexpected stdout: %q", s)
+	}
+	if s := string(res.Stderr); s != "warning\n" {
+		t.Errorf("Unexpected stderr: %q", s)
+	}
+
+	res, err = runner.Run(ctx, pkg, rpm.ScriptPost, Arg(rpm.ScriptPost, Install))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 0 {
+		t.Fatalf("Expected exit code 0, got: %d: %s", res.ExitCode, res.Stderr)
+	}
+	b, err := os.ReadFile(filepath.Join(root, "opt/foo/etc/installed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); s != "1 bar\n" {
+		t.Errorf("Unexpected scriptlet output file: %q", s)
+	}
+
+	res, err = runner.Run(ctx, pkg, rpm.ScriptPreUn, Arg(rpm.ScriptPreUn, Erase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got: %d", res.ExitCode)
+	}
+
+	if _, err := runner.Run(ctx, pkg, rpm.ScriptPreTrans, 1); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for Lua scriptlet, got: %v", err)
+	}
+	if _, err := runner.Run(ctx, pkg, rpm.ScriptPostUn, 0); err != ErrNoScript {
+		t.Errorf("Expected ErrNoScript, got: %v", err)
+	}
+}
+
+func TestRunNoScripts(t *testing.T) {
+	names, err := filepath.Glob("../testdata/*.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runner := &Runner{Root: t.TempDir()}
+	for _, name := range names {
+		pkg, err := rpm.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, typ := range []string{rpm.ScriptPre, rpm.ScriptPost, rpm.ScriptPreUn, rpm.ScriptPostUn} {
+			if _, err := runner.Run(context.Background(), pkg, typ, 1); err != ErrNoScript {
+				t.Errorf("Expected ErrNoScript for %s in %s, got: %v", typ, pkg, err)
+			}
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh is not available")
+	}
+	runner := &Runner{Root: t.TempDir()}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	script := &rpm.Script{
+		Type:        rpm.ScriptPost,
+		Interpreter: []string{"/bin/sh"},
+		Body:        "exec sleep 5",
+	}
+	if _, err := runner.RunScript(ctx, script, nil, 1); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+}
+
+func TestArg(t *testing.T) {
+	tests := []struct {
+		typ    string
+		op     Operation
+		expect int
+	}{
+		{rpm.ScriptPre, Install, 1},
+		{rpm.ScriptPost, Install, 1},
+		{rpm.ScriptPre, Upgrade, 2},
+		{rpm.ScriptPostTrans, Upgrade, 2},
+		{rpm.ScriptPreUn, Upgrade, 1},
+		{rpm.ScriptPostUn, Upgrade, 1},
+		{rpm.ScriptPreUn, Erase, 0},
+		{rpm.ScriptPostUn, Erase, 0},
+	}
+	for _, test := range tests {
+		if arg := Arg(test.typ, test.op); arg != test.expect {
+			t.Errorf("Expected %d for %s, got: %d", test.expect, test.typ, arg)
+		}
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	runner := &Runner{Root: "/tmp/root"}
+	env := strings.Join(runner.environ("/tmp/root", []string{"/usr", "/etc"}), " ")
+	expect := "PATH=" + DefaultPath +
+		" RPM_INSTALL_PREFIX=/tmp/root/usr" +
+		" RPM_INSTALL_PREFIX0=/tmp/root/usr" +
+		" RPM_INSTALL_PREFIX1=/tmp/root/etc"
+	if env != expect {
+		t.Errorf("Expected environment %q, got: %q", expect, env)
+	}
+	runner.Chroot = true
+	env = strings.Join(runner.environ("/tmp/root", []string{"/usr"}), " ")
+	expect = "PATH=" + DefaultPath + " RPM_INSTALL_PREFIX=/usr RPM_INSTALL_PREFIX0=/usr"
+	if env != expect {
+		t.Errorf("Expected environment %q, got: %q", expect, env)
+	}
+}
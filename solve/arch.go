@@ -0,0 +1,19 @@
+package solve
+
+import "github.com/cavaliergopher/rpm"
+
+// compatible returns true if a package built for arch may be installed on a
+// host of architecture host.
+func compatible(host, arch string) bool {
+	return archScore(host, arch) >= 0
+}
+
+// archScore ranks arch for installation on host. Lower scores are preferred
+// and -1 indicates that arch is incompatible. If no host architecture is
+// configured, every architecture is compatible.
+func archScore(host, arch string) int {
+	if host == "" {
+		return 0
+	}
+	return rpm.ArchScore(host, arch)
+}
@@ -0,0 +1,59 @@
+package solve
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// A Problem describes why a requirement could not be satisfied.
+type Problem struct {
+	// Package is the package with the requirement or nil if the requirement
+	// was requested by the caller.
+	Package *rpm.Package
+
+	// Requirement is the requirement that could not be satisfied.
+	Requirement string
+
+	// Candidate is a package that could have satisfied the requirement but
+	// was rejected, or nil if nothing provides the requirement.
+	Candidate *rpm.Package
+
+	// Reason explains why the requirement could not be satisfied.
+	Reason string
+}
+
+// String returns a human readable explanation of the problem.
+func (c *Problem) String() string {
+	if c.Candidate == nil {
+		if c.Package != nil {
+			return fmt.Sprintf("%s needed by %v", c.Reason, c.Package)
+		}
+		return c.Reason
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "cannot install %v", c.Candidate)
+	if c.Requirement != "" {
+		fmt.Fprintf(&sb, " for %v", c.Requirement)
+		if c.Package != nil {
+			fmt.Fprintf(&sb, " needed by %v", c.Package)
+		}
+	}
+	fmt.Fprintf(&sb, ": %s", c.Reason)
+	return sb.String()
+}
+
+// Error is returned by Solve when no solution exists.
+type Error struct {
+	// Problems lists each problem encountered while searching for a solution.
+	Problems []*Problem
+}
+
+func (c *Error) Error() string {
+	a := make([]string, len(c.Problems))
+	for i, p := range c.Problems {
+		a[i] = p.String()
+	}
+	return "solve: no solution: " + strings.Join(a, "; ")
+}
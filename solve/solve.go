@@ -0,0 +1,617 @@
+/*
+Package solve computes consistent sets of rpm packages to install.
+
+Given a universe of available packages, Solve selects the packages that must be
+installed to satisfy a list of requested names, along with all of their
+dependencies:
+
+	pkgs, err := solve.Solve(universe, []string{"bash", "coreutils"}, &solve.Options{
+		Arch: "x86_64",
+	})
+	if err != nil {
+		log.Fatal(err) // err is a *solve.Error that explains each problem
+	}
+	for _, pkg := range pkgs {
+		fmt.Println(pkg)
+	}
+
+The solver honors Requires, Conflicts and Obsoletes relationships, file
+dependencies, architecture compatibility and rich (boolean) dependencies.
+Requirements on rpmlib() features are assumed to be provided by the rpm
+installation on the target system. Weak dependencies (Recommends and
+Supplements) are optional and are only installed if they can be satisfied
+without invalidating the solution.
+
+Packages with invalid headers, as reported by rpm.Package.Validate, are never
+selected. At most one package of each name is selected. When a requirement can be
+satisfied by more than one package, packages named after the requirement are
+preferred, followed by the most recent version and the best architecture. If a
+choice later leads to a problem, the solver backtracks and tries the next
+candidate.
+*/
+package solve
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// maxSteps limits the number of requirements the solver evaluates before
+// giving up.
+const maxSteps = 1 << 20
+
+// Options configures the behavior of Solve.
+type Options struct {
+	// Arch is the architecture of the target system. Packages that are not
+	// compatible with Arch are ignored. If Arch is empty, packages of all
+	// architectures are considered.
+	Arch string
+
+	// WeakDeps enables installation of packages recommended by, or
+	// supplementing, the packages in the solution.
+	WeakDeps bool
+}
+
+// Solve computes a consistent set of packages from universe that satisfies
+// each of the requested names and all of their dependencies.
+//
+// Each requested name may be a package name, a capability provided by a
+// package, a file path or a dependency expression such as 'foo >= 1.2' or
+// '(foo or bar)'.
+//
+// If no solution exists, the returned error is an *Error describing the
+// problems that prevented a solution.
+func Solve(universe []*rpm.Package, names []string, opts *Options) ([]*rpm.Package, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	s := newSolver(universe, opts)
+	var queue *goalList
+	for i := len(names) - 1; i >= 0; i-- {
+		queue = queue.push(goal{req: parseRequirement(names[i])})
+	}
+	if !s.solve(queue) {
+		return nil, &Error{Problems: s.problems}
+	}
+	if opts.WeakDeps {
+		s.solveWeak()
+	}
+	pkgs := make([]*rpm.Package, len(s.trail))
+	for i, p := range s.trail {
+		pkgs[i] = p.Package
+	}
+	rpm.Sort(pkgs)
+	return pkgs, nil
+}
+
+// pkg caches the relationships of a package in the universe.
+type pkg struct {
+	*rpm.Package
+	name        string
+	arch        string
+	self        rpm.Dependency
+	provides    []rpm.Dependency
+	files       map[string]bool
+	requires    []*requirement
+	conflicts   []*requirement
+	obsoletes   []rpm.Dependency
+	recommends  []*requirement
+	supplements []*requirement
+	err         error // set if the header is invalid
+}
+
+func newPkg(p *rpm.Package) *pkg {
+	c := &pkg{
+		Package:     p,
+		err:         p.Validate(),
+		name:        p.Name(),
+		arch:        p.Architecture(),
+		provides:    p.Provides(),
+		files:       make(map[string]bool),
+		requires:    parseRequirements(p.Requires()),
+		conflicts:   parseRequirements(p.Conflicts()),
+		obsoletes:   p.Obsoletes(),
+		recommends:  parseRequirements(p.Recommends()),
+		supplements: parseRequirements(p.Supplements()),
+	}
+	c.self = &selfProvide{p}
+	for _, fi := range p.Files() {
+		c.files[fi.Name()] = true
+	}
+	return c
+}
+
+// satisfies returns true if c satisfies the simple dependency dep.
+func (c *pkg) satisfies(dep rpm.Dependency) bool {
+	if strings.HasPrefix(dep.Name(), "/") && c.files[dep.Name()] {
+		return true
+	}
+	if rpm.Satisfies(dep, c.self) {
+		return true
+	}
+	for _, p := range c.provides {
+		if rpm.Satisfies(dep, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// obsoletesPkg returns true if c obsoletes p. Obsoletes only apply to package
+// names and not to other capabilities provided by a package.
+func (c *pkg) obsoletesPkg(p *pkg) bool {
+	if c == p {
+		return false
+	}
+	for _, o := range c.obsoletes {
+		if o.Name() == p.name && rpm.Satisfies(o, p.self) {
+			return true
+		}
+	}
+	return false
+}
+
+// selfProvide is the implicit provide of a package's own name and version.
+type selfProvide struct {
+	*rpm.Package
+}
+
+func (c *selfProvide) Flags() int { return rpm.DepFlagEqual }
+
+// requirement is a parsed package relationship.
+type requirement struct {
+	*rpm.RichDependency
+	s string
+}
+
+func parseRequirement(s string) *requirement {
+	rd, err := rpm.ParseRichDependency(s)
+	if err != nil {
+		// unparseable requirements are treated as a name that nothing provides
+		rd = &rpm.RichDependency{Dependency: &simpleDep{name: s}}
+	}
+	return &requirement{RichDependency: rd, s: s}
+}
+
+func parseRequirements(deps []rpm.Dependency) []*requirement {
+	a := make([]*requirement, 0, len(deps))
+	for _, dep := range deps {
+		if rpm.IsRich(dep) {
+			a = append(a, parseRequirement(dep.Name()))
+			continue
+		}
+		a = append(a, &requirement{
+			RichDependency: &rpm.RichDependency{Dependency: dep},
+			s:              fmt.Sprintf("%v", dep),
+		})
+	}
+	return a
+}
+
+func (c *requirement) String() string { return c.s }
+
+// simpleDep is a dependency on any version of a name.
+type simpleDep struct {
+	name string
+}
+
+func (c *simpleDep) Name() string    { return c.name }
+func (c *simpleDep) Flags() int      { return rpm.DepFlagAny }
+func (c *simpleDep) Epoch() int      { return 0 }
+func (c *simpleDep) Version() string { return "" }
+func (c *simpleDep) Release() string { return "" }
+
+// isRPMLib returns true if dep is a requirement on a feature of rpm itself.
+func isRPMLib(dep rpm.Dependency) bool {
+	return dep.Flags()&rpm.DepFlagRpmlib != 0 || strings.HasPrefix(dep.Name(), "rpmlib(")
+}
+
+// goal is a requirement that must be satisfied by the solution.
+type goal struct {
+	req  *requirement
+	expr *rpm.RichDependency // the part of req being solved
+	from *pkg                // nil for requested names
+}
+
+func (g goal) rd() *rpm.RichDependency {
+	if g.expr != nil {
+		return g.expr
+	}
+	return g.req.RichDependency
+}
+
+// goalList is an immutable stack of goals which can be shared between
+// branches of the search.
+type goalList struct {
+	goal
+	next *goalList
+}
+
+func (c *goalList) push(g goal) *goalList {
+	return &goalList{goal: g, next: c}
+}
+
+// solver holds the state of a search for a solution.
+type solver struct {
+	opts      *Options
+	pkgs      []*pkg
+	providers map[string][]*pkg
+	selected  map[string]*pkg
+	trail     []*pkg
+	problems  []*Problem
+	seen      map[string]bool
+	steps     int
+}
+
+func newSolver(universe []*rpm.Package, opts *Options) *solver {
+	s := &solver{
+		opts:      opts,
+		providers: make(map[string][]*pkg),
+		selected:  make(map[string]*pkg),
+		seen:      make(map[string]bool),
+	}
+	for _, p := range universe {
+		if opts.Arch != "" && !compatible(opts.Arch, p.Architecture()) {
+			continue
+		}
+		c := newPkg(p)
+		s.pkgs = append(s.pkgs, c)
+		names := map[string]bool{c.name: true}
+		for _, dep := range c.provides {
+			names[dep.Name()] = true
+		}
+		for name := range c.files {
+			names[name] = true
+		}
+		for name := range names {
+			s.providers[name] = append(s.providers[name], c)
+		}
+	}
+	return s
+}
+
+// solve satisfies each goal in queue, backtracking if a choice leads to a
+// problem. Returns true if a solution was found, leaving the solution in
+// s.selected.
+func (s *solver) solve(queue *goalList) bool {
+	for ; queue != nil; queue = queue.next {
+		if s.steps++; s.steps > maxSteps {
+			s.addProblem(&Problem{Reason: "search limit exceeded"})
+			return false
+		}
+		g := queue.goal
+		rd := g.rd()
+		switch rd.Op {
+		case rpm.RichOpNone:
+			if isRPMLib(rd.Dependency) || s.eval(rd) {
+				continue
+			}
+			return s.try(g, s.candidates(rd, rd.Dependency), queue.next)
+
+		case rpm.RichOpAnd:
+			queue = queue.next.
+				push(goal{req: g.req, expr: rd.Right, from: g.from}).
+				push(goal{req: g.req, expr: rd.Left, from: g.from})
+			return s.solve(queue)
+
+		case rpm.RichOpOr:
+			if s.eval(rd) {
+				continue
+			}
+			mark := len(s.trail)
+			if s.solve(queue.next.push(goal{req: g.req, expr: rd.Left, from: g.from})) {
+				return true
+			}
+			s.undo(mark)
+			return s.solve(queue.next.push(goal{req: g.req, expr: rd.Right, from: g.from}))
+
+		case rpm.RichOpWith, rpm.RichOpWithout:
+			if s.eval(rd) {
+				continue
+			}
+			return s.try(g, s.candidates(rd, leftmost(rd)), queue.next)
+
+		case rpm.RichOpIf, rpm.RichOpUnless:
+			// conditionals are evaluated once all other goals are satisfied
+			continue
+		}
+	}
+	if g, ok := s.nextConditional(); ok {
+		return s.solve((*goalList)(nil).push(g))
+	}
+	return true
+}
+
+// try attempts to satisfy g with each candidate in turn.
+func (s *solver) try(g goal, candidates []*pkg, queue *goalList) bool {
+	if len(candidates) == 0 {
+		s.addProblem(&Problem{
+			Package:     pkgOrNil(g.from),
+			Requirement: g.req.String(),
+			Reason:      "nothing provides " + g.rd().String(),
+		})
+		return false
+	}
+	for _, c := range candidates {
+		mark := len(s.trail)
+		if s.add(c, g) {
+			q := queue
+			for i := len(c.requires) - 1; i >= 0; i-- {
+				q = q.push(goal{req: c.requires[i], from: c})
+			}
+			if s.solve(q) {
+				return true
+			}
+		}
+		s.undo(mark)
+	}
+	return false
+}
+
+// add selects package c to satisfy goal g if it does not conflict with any
+// package already selected.
+func (s *solver) add(c *pkg, g goal) bool {
+	reject := func(reason string) bool {
+		s.addProblem(&Problem{
+			Package:     pkgOrNil(g.from),
+			Requirement: g.req.String(),
+			Candidate:   c.Package,
+			Reason:      reason,
+		})
+		return false
+	}
+	if c.err != nil {
+		return reject(fmt.Sprintf("invalid header: %v", c.err))
+	}
+	if p, ok := s.selected[c.name]; ok {
+		return reject(fmt.Sprintf("%v is already selected", p))
+	}
+	for _, p := range s.trail {
+		if c.obsoletesPkg(p) {
+			return reject(fmt.Sprintf("it obsoletes %v", p))
+		}
+		if p.obsoletesPkg(c) {
+			return reject(fmt.Sprintf("it is obsoleted by %v", p))
+		}
+	}
+	s.selected[c.name] = c
+	s.trail = append(s.trail, c)
+	for _, p := range s.trail {
+		for _, conflict := range p.conflicts {
+			if p != c && !s.conflictInvolves(conflict.RichDependency, c) {
+				continue
+			}
+			if s.evalExcluding(conflict.RichDependency, p) {
+				if p == c {
+					return reject(fmt.Sprintf("it conflicts with %v", conflict))
+				}
+				return reject(fmt.Sprintf("%v conflicts with %v", p, conflict))
+			}
+		}
+	}
+	return true
+}
+
+// conflictInvolves returns true if package c could contribute to the conflict
+// rd of another package. This avoids re-evaluating conflicts that were already
+// checked before c was selected.
+func (s *solver) conflictInvolves(rd *rpm.RichDependency, c *pkg) bool {
+	if rd.Op != rpm.RichOpNone {
+		return true
+	}
+	return c.satisfies(rd.Dependency)
+}
+
+// undo deselects all packages selected after mark.
+func (s *solver) undo(mark int) {
+	for _, p := range s.trail[mark:] {
+		delete(s.selected, p.name)
+	}
+	s.trail = s.trail[:mark]
+}
+
+// candidates returns the packages that could satisfy rd, in order of
+// preference. Name is the simple dependency whose providers are considered.
+func (s *solver) candidates(rd *rpm.RichDependency, name rpm.Dependency) []*pkg {
+	a := make([]*pkg, 0)
+	for _, p := range s.providers[name.Name()] {
+		if s.matches(rd, p) {
+			a = append(a, p)
+		}
+	}
+	sort.SliceStable(a, func(i, j int) bool {
+		pi, pj := a[i], a[j]
+		if mi, mj := pi.name == name.Name(), pj.name == name.Name(); mi != mj {
+			return mi
+		}
+		if pi.name != pj.name {
+			return pi.name < pj.name
+		}
+		if rc := rpm.Compare(pi, pj); rc != 0 {
+			return rc > 0
+		}
+		return archScore(s.opts.Arch, pi.arch) < archScore(s.opts.Arch, pj.arch)
+	})
+	return a
+}
+
+// leftmost returns the first simple dependency in rd.
+func leftmost(rd *rpm.RichDependency) rpm.Dependency {
+	for rd.Op != rpm.RichOpNone {
+		rd = rd.Left
+	}
+	return rd.Dependency
+}
+
+// matches returns true if the single package p satisfies rd. This is used to
+// evaluate the operands of the 'with' and 'without' operators, which must be
+// satisfied by the same package.
+func (s *solver) matches(rd *rpm.RichDependency, p *pkg) bool {
+	switch rd.Op {
+	case rpm.RichOpNone:
+		return p.satisfies(rd.Dependency)
+	case rpm.RichOpAnd, rpm.RichOpWith:
+		return s.matches(rd.Left, p) && s.matches(rd.Right, p)
+	case rpm.RichOpOr:
+		return s.matches(rd.Left, p) || s.matches(rd.Right, p)
+	case rpm.RichOpWithout:
+		return s.matches(rd.Left, p) && !s.matches(rd.Right, p)
+	}
+	return s.matches(rd.Left, p)
+}
+
+// eval returns true if rd is satisfied by the selected packages.
+func (s *solver) eval(rd *rpm.RichDependency) bool {
+	return s.evalExcluding(rd, nil)
+}
+
+// evalExcluding returns true if rd is satisfied by the selected packages,
+// excluding package x.
+func (s *solver) evalExcluding(rd *rpm.RichDependency, x *pkg) bool {
+	switch rd.Op {
+	case rpm.RichOpNone:
+		if isRPMLib(rd.Dependency) {
+			return true
+		}
+		for _, p := range s.providers[rd.Dependency.Name()] {
+			if p != x && s.selected[p.name] == p && p.satisfies(rd.Dependency) {
+				return true
+			}
+		}
+		return false
+	case rpm.RichOpAnd:
+		return s.evalExcluding(rd.Left, x) && s.evalExcluding(rd.Right, x)
+	case rpm.RichOpOr:
+		return s.evalExcluding(rd.Left, x) || s.evalExcluding(rd.Right, x)
+	case rpm.RichOpWith, rpm.RichOpWithout:
+		for _, p := range s.trail {
+			if p != x && s.matches(rd, p) {
+				return true
+			}
+		}
+		return false
+	case rpm.RichOpIf:
+		if s.evalExcluding(rd.Right, x) {
+			return s.evalExcluding(rd.Left, x)
+		}
+		return rd.Else == nil || s.evalExcluding(rd.Else, x)
+	case rpm.RichOpUnless:
+		if s.evalExcluding(rd.Right, x) {
+			return rd.Else == nil || s.evalExcluding(rd.Else, x)
+		}
+		return s.evalExcluding(rd.Left, x)
+	}
+	return false
+}
+
+// nextConditional returns the first conditional requirement of the selected
+// packages that is not yet satisfied, as a goal for the branch that must be
+// satisfied.
+func (s *solver) nextConditional() (goal, bool) {
+	for _, p := range s.trail {
+		for _, req := range p.requires {
+			if rd := s.conditionalBranch(req.RichDependency); rd != nil {
+				return goal{req: req, expr: rd, from: p}, true
+			}
+		}
+	}
+	return goal{}, false
+}
+
+// conditionalBranch returns the unsatisfied branch of any 'if' or 'unless'
+// operator in rd that must be satisfied given the selected packages.
+func (s *solver) conditionalBranch(rd *rpm.RichDependency) *rpm.RichDependency {
+	switch rd.Op {
+	case rpm.RichOpAnd:
+		if b := s.conditionalBranch(rd.Left); b != nil {
+			return b
+		}
+		return s.conditionalBranch(rd.Right)
+	case rpm.RichOpOr:
+		if s.eval(rd) {
+			return nil
+		}
+		return s.conditionalBranch(rd.Left)
+	case rpm.RichOpIf, rpm.RichOpUnless:
+		branch := rd.Left
+		if s.eval(rd.Right) == (rd.Op == rpm.RichOpUnless) {
+			branch = rd.Else
+		}
+		if branch == nil {
+			return nil
+		}
+		if b := s.conditionalBranch(branch); b != nil {
+			return b
+		}
+		if !s.eval(branch) {
+			return branch
+		}
+	}
+	return nil
+}
+
+// solveWeak adds each weak dependency of the selected packages which can be
+// satisfied without invalidating the solution.
+func (s *solver) solveWeak() {
+	problems := s.problems
+	tried := make(map[string]bool)
+	for changed := true; changed; {
+		changed = false
+		for i := 0; i < len(s.trail); i++ {
+			p := s.trail[i]
+			for _, req := range p.recommends {
+				key := p.String() + "\x00" + req.String()
+				if tried[key] || s.eval(req.RichDependency) {
+					continue
+				}
+				tried[key] = true
+				changed = s.tryWeak(goal{req: req, from: p}) || changed
+			}
+		}
+		for _, p := range s.pkgs {
+			if _, ok := s.selected[p.name]; ok || tried[p.String()] {
+				continue
+			}
+			for _, req := range p.supplements {
+				if s.eval(req.RichDependency) {
+					tried[p.String()] = true
+					changed = s.tryWeak(goal{req: &requirement{
+						RichDependency: &rpm.RichDependency{Dependency: p.self},
+						s:              p.String(),
+					}}) || changed
+					break
+				}
+			}
+		}
+	}
+	s.problems = problems
+}
+
+func (s *solver) tryWeak(g goal) bool {
+	mark := len(s.trail)
+	if s.solve((*goalList)(nil).push(g)) {
+		return true
+	}
+	s.undo(mark)
+	return false
+}
+
+// addProblem records a problem encountered during the search.
+func (s *solver) addProblem(p *Problem) {
+	key := p.String()
+	if s.seen[key] {
+		return
+	}
+	s.seen[key] = true
+	s.problems = append(s.problems, p)
+}
+
+func pkgOrNil(p *pkg) *rpm.Package {
+	if p == nil {
+		return nil
+	}
+	return p.Package
+}
@@ -0,0 +1,298 @@
+package solve
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// testPkg describes a synthetic package for testing.
+type testPkg struct {
+	name       string
+	version    string
+	arch       string
+	requires   []string
+	provides   []string
+	conflicts  []string
+	obsoletes  []string
+	recommends []string
+	files      []string
+}
+
+// build creates an rpm package header from the test description.
+func (c testPkg) build() *rpm.Package {
+	epoch, ver, rel := parseEVR(c.version)
+	tags := make(map[int]*rpm.Tag)
+	setStrings := func(id int, a ...string) {
+		tags[id] = &rpm.Tag{ID: id, Type: rpm.TagTypeStringArray, Value: a}
+	}
+	setInts := func(id int, a ...int64) {
+		tags[id] = &rpm.Tag{ID: id, Type: rpm.TagTypeInt32, Value: a}
+	}
+	setStrings(1000, c.name)
+	setStrings(1001, ver)
+	setStrings(1002, rel)
+	if epoch > 0 {
+		setInts(1003, int64(epoch))
+	}
+	arch := c.arch
+	if arch == "" {
+		arch = "noarch"
+	}
+	setStrings(1022, arch)
+	setDeps := func(flagsID, namesID, versionsID int, deps []string) {
+		if len(deps) == 0 {
+			return
+		}
+		flags := make([]int64, len(deps))
+		names := make([]string, len(deps))
+		versions := make([]string, len(deps))
+		for i, s := range deps {
+			names[i] = s
+			if strings.HasPrefix(s, "(") {
+				continue
+			}
+			rd, err := rpm.ParseRichDependency(s)
+			if err != nil {
+				panic(err)
+			}
+			dep := rd.Dependency
+			flags[i] = int64(dep.Flags())
+			names[i] = dep.Name()
+			versions[i] = dep.Version()
+			if dep.Epoch() > 0 {
+				versions[i] = strings.SplitN(s, " ", 3)[2]
+			} else if dep.Release() != "" {
+				versions[i] += "-" + dep.Release()
+			}
+		}
+		setInts(flagsID, flags...)
+		setStrings(namesID, names...)
+		setStrings(versionsID, versions...)
+	}
+	setDeps(1048, 1049, 1050, c.requires)
+	setDeps(1112, 1047, 1113, c.provides)
+	setDeps(1053, 1054, 1055, c.conflicts)
+	setDeps(1114, 1090, 1115, c.obsoletes)
+	setDeps(5048, 5046, 5047, c.recommends)
+	if len(c.files) > 0 {
+		n := len(c.files)
+		ixs := make([]int64, n)
+		dirs := make([]string, n)
+		bases := make([]string, n)
+		for i, name := range c.files {
+			j := strings.LastIndexByte(name, '/') + 1
+			ixs[i] = int64(i)
+			dirs[i], bases[i] = name[:j], name[j:]
+		}
+		setInts(1116, ixs...)
+		setStrings(1117, bases...)
+		setStrings(1118, dirs...)
+		for _, id := range []int{1030, 1028, 1034, 1037} {
+			setInts(id, make([]int64, n)...)
+		}
+		for _, id := range []int{1039, 1040, 1035, 1036} {
+			setStrings(id, make([]string, n)...)
+		}
+	}
+	return &rpm.Package{Header: rpm.Header{Tags: tags}}
+}
+
+func parseEVR(s string) (epoch int, version, release string) {
+	rd, err := rpm.ParseRichDependency("x = " + s)
+	if err != nil {
+		panic(err)
+	}
+	return rd.Dependency.Epoch(), rd.Dependency.Version(), rd.Dependency.Release()
+}
+
+func buildUniverse(pkgs ...testPkg) []*rpm.Package {
+	a := make([]*rpm.Package, len(pkgs))
+	for i, p := range pkgs {
+		a[i] = p.build()
+	}
+	return a
+}
+
+func names(pkgs []*rpm.Package) string {
+	a := make([]string, len(pkgs))
+	for i, p := range pkgs {
+		a[i] = p.Name() + "-" + p.Version() + "-" + p.Release()
+	}
+	return strings.Join(a, " ")
+}
+
+func TestSolve(t *testing.T) {
+	universe := buildUniverse(
+		testPkg{name: "app", version: "1.0-1", requires: []string{"lib >= 1.0", "/bin/sh", "rpmlib(PayloadIsXz) <= 5.2-1"}},
+		testPkg{name: "lib", version: "1.0-1"},
+		testPkg{name: "lib", version: "1.1-1"},
+		testPkg{name: "lib", version: "2.0-1", requires: []string{"missing"}},
+		testPkg{name: "bash", version: "5.0-1", files: []string{"/bin/bash", "/bin/sh"}},
+		testPkg{name: "web", version: "1.0-1", requires: []string{"webserver"}},
+		testPkg{name: "apache", version: "2.4-1", provides: []string{"webserver"}, requires: []string{"libapr"}},
+		testPkg{name: "nginx", version: "1.20-1", provides: []string{"webserver"}},
+		testPkg{name: "old", version: "1.0-1"},
+		testPkg{name: "new", version: "1.0-1", obsoletes: []string{"old < 2.0"}},
+		testPkg{name: "enemy", version: "1.0-1", conflicts: []string{"lib >= 1.1"}},
+		testPkg{name: "cond", version: "1.0-1", requires: []string{"(cond-extra if bash)"}},
+		testPkg{name: "cond-extra", version: "1.0-1"},
+		testPkg{name: "ranged", version: "1.0-1", requires: []string{"(lib >= 1.0 with lib < 1.1)"}},
+		testPkg{name: "either", version: "1.0-1", requires: []string{"(missing or nginx)"}},
+		testPkg{name: "epoch", version: "1:0.1-1"},
+		testPkg{name: "needs-epoch", version: "1.0-1", requires: []string{"epoch >= 1.0"}},
+	)
+	tests := []struct {
+		names  []string
+		expect string
+	}{
+		{[]string{"app"}, "app-1.0-1 bash-5.0-1 lib-1.1-1"},
+		{[]string{"web"}, "nginx-1.20-1 web-1.0-1"},
+		{[]string{"webserver"}, "nginx-1.20-1"},
+		{[]string{"lib < 1.1"}, "lib-1.0-1"},
+		{[]string{"app", "enemy"}, "app-1.0-1 bash-5.0-1 enemy-1.0-1 lib-1.0-1"},
+		{[]string{"cond"}, "cond-1.0-1"},
+		{[]string{"cond", "bash"}, "bash-5.0-1 cond-1.0-1 cond-extra-1.0-1"},
+		{[]string{"ranged"}, "lib-1.0-1 ranged-1.0-1"},
+		{[]string{"either"}, "either-1.0-1 nginx-1.20-1"},
+		{[]string{"needs-epoch"}, "epoch-0.1-1 needs-epoch-1.0-1"},
+		{[]string{"/bin/sh"}, "bash-5.0-1"},
+		{[]string{"new"}, "new-1.0-1"},
+	}
+	for _, test := range tests {
+		pkgs, err := Solve(universe, test.names, nil)
+		if err != nil {
+			t.Errorf("Error solving %v: %v", test.names, err)
+			continue
+		}
+		if s := names(pkgs); s != test.expect {
+			t.Errorf("Expected %q for %v, got: %q", test.expect, test.names, s)
+		}
+	}
+
+	unsatisfiable := []struct {
+		names  []string
+		reason string
+	}{
+		{[]string{"nothing"}, "nothing provides nothing"},
+		{[]string{"lib >= 2.0"}, "nothing provides missing"},
+		{[]string{"new", "old"}, "it is obsoleted by new-1.0-1.noarch"},
+		{[]string{"lib >= 1.1", "enemy"}, "it conflicts with lib >= 1.1"},
+	}
+	for _, test := range unsatisfiable {
+		_, err := Solve(universe, test.names, nil)
+		var solveErr *Error
+		if !errors.As(err, &solveErr) {
+			t.Errorf("Expected *Error solving %v, got: %v", test.names, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("Expected %q in error solving %v, got: %v", test.reason, test.names, err)
+		}
+	}
+}
+
+func TestSolveTestdata(t *testing.T) {
+	files, err := filepath.Glob("../testdata/*.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	universe := make([]*rpm.Package, 0, len(files))
+	for _, name := range files {
+		p, err := rpm.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		universe = append(universe, p)
+	}
+	tests := []struct {
+		names  []string
+		arch   string
+		expect string
+	}{
+		{[]string{"epel-release"}, "x86_64", "centos-release-7-2.1511.el7.centos.2.10 epel-release-7-5"},
+		// centos-release 6 provides redhat-release without a version, which
+		// satisfies epel-release's requirement of redhat-release >= 7
+		{[]string{"epel-release"}, "i686", "centos-release-6-0.el6.centos.5 epel-release-7-5"},
+		{[]string{"epel-release", "centos-release < 7"}, "x86_64", "centos-release-6-0.el6.centos.5 epel-release-7-5"},
+		{[]string{"/etc/redhat-release"}, "x86_64", "centos-release-7-2.1511.el7.centos.2.10"},
+		{[]string{"config(centos-release) = 6-0.el6.centos.5"}, "x86_64", "centos-release-6-0.el6.centos.5"},
+	}
+	for _, test := range tests {
+		pkgs, err := Solve(universe, test.names, &Options{Arch: test.arch})
+		if err != nil {
+			t.Errorf("Error solving %v: %v", test.names, err)
+			continue
+		}
+		if s := names(pkgs); s != test.expect {
+			t.Errorf("Expected %q for %v, got: %q", test.expect, test.names, s)
+		}
+	}
+	if _, err := Solve(universe, []string{"centos-release > 7.2"}, nil); err == nil {
+		t.Errorf("Expected no solution for centos-release > 7.2")
+	}
+}
+
+func TestSolveInvalid(t *testing.T) {
+	epel, err := rpm.Open("../testdata/epel-release-7-5.noarch.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	epel.Header.Tags[1048] = &rpm.Tag{ID: 1048, Type: rpm.TagTypeInt32, Value: []int64{0}}
+	_, err = Solve([]*rpm.Package{epel}, []string{"epel-release"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "cannot install epel-release-7-5.noarch for epel-release: invalid header") {
+		t.Errorf("Expected invalid header error, got: %v", err)
+	}
+}
+
+func TestSolveArch(t *testing.T) {
+	universe := buildUniverse(
+		testPkg{name: "app", version: "1.0-1", arch: "x86_64", requires: []string{"lib"}},
+		testPkg{name: "app", version: "2.0-1", arch: "aarch64", requires: []string{"lib"}},
+		testPkg{name: "lib", version: "1.0-1", arch: "i686"},
+		testPkg{name: "lib", version: "1.0-1", arch: "x86_64"},
+	)
+	pkgs, err := Solve(universe, []string{"app"}, &Options{Arch: "x86_64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 2 {
+		t.Fatalf("Expected 2 packages, got: %v", pkgs)
+	}
+	for _, p := range pkgs {
+		if p.Architecture() != "x86_64" {
+			t.Errorf("Expected x86_64 package, got: %v", p)
+		}
+	}
+	if _, err := Solve(universe, []string{"app"}, &Options{Arch: "ppc64le"}); err == nil {
+		t.Errorf("Expected no solution for incompatible architecture")
+	}
+}
+
+func TestSolveWeakDeps(t *testing.T) {
+	universe := buildUniverse(
+		testPkg{name: "app", version: "1.0-1", recommends: []string{"docs", "broken"}},
+		testPkg{name: "docs", version: "1.0-1"},
+		testPkg{name: "broken", version: "1.0-1", requires: []string{"missing"}},
+	)
+	tests := []struct {
+		weak   bool
+		expect string
+	}{
+		{false, "app-1.0-1"},
+		{true, "app-1.0-1 docs-1.0-1"},
+	}
+	for _, test := range tests {
+		pkgs, err := Solve(universe, []string{"app"}, &Options{WeakDeps: test.weak})
+		if err != nil {
+			t.Errorf("Error solving with weak deps %v: %v", test.weak, err)
+			continue
+		}
+		if s := names(pkgs); s != test.expect {
+			t.Errorf("Expected %q with weak deps %v, got: %q", test.expect, test.weak, s)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package rpm
+
+// A SourceFile is a source or patch file of a source package, as declared by a
+// Source or Patch directive in the spec file.
+type SourceFile struct {
+	// Name is the file name of the source or patch, without any URL.
+	Name string
+
+	// Number is the number of the source or patch, such as 1 for Source1.
+	// For the sources of a Package, it is the index of the file among the
+	// sources or patches of the header, in the order they were declared, as
+	// used by the NOSOURCE and NOPATCH tags.
+	Number int
+
+	// Patch is true if the file is a patch rather than a source.
+	Patch bool
+
+	// NoSource is true if the file was excluded from the source package with
+	// a NoSource or NoPatch directive.
+	NoSource bool
+}
+
+// IsSource returns true if the package is a source package (src.rpm).
+func (c *Package) IsSource() bool {
+	return c.Lead.Type == 1 || c.Header.GetTag(1106) != nil
+}
+
+// Sources returns the sources followed by the patches of a source package, in
+// the order they were declared in the spec file. Files whose numbers are
+// listed in the NOSOURCE or NOPATCH tags are marked as NoSource. For binary
+// packages, nil is returned.
+func (c *Package) Sources() []SourceFile {
+	if !c.IsSource() {
+		return nil
+	}
+	a := sourceFiles(c.Source(), c.Header.GetTag(1051).Int64Slice(), false)
+	return append(a, sourceFiles(c.Patch(), c.Header.GetTag(1052).Int64Slice(), true)...)
+}
+
+// sourceFiles returns the source files listed in a SOURCE or PATCH tag. rpm
+// stores these in the reverse order of their declaration.
+func sourceFiles(names []string, nosource []int64, patch bool) []SourceFile {
+	excluded := make(map[int]bool, len(nosource))
+	for _, n := range nosource {
+		excluded[int(n)] = true
+	}
+	a := make([]SourceFile, len(names))
+	for i, name := range names {
+		n := len(names) - 1 - i
+		a[n] = SourceFile{
+			Name:     name,
+			Number:   n,
+			Patch:    patch,
+			NoSource: excluded[n],
+		}
+	}
+	return a
+}
+
+// BuildRequires returns the packages or capabilities required to build a
+// source package. Requirements on rpmlib() features, which describe the
+// source package itself, are excluded. For binary packages, nil is returned.
+func (c *Package) BuildRequires() []Dependency {
+	if !c.IsSource() {
+		return nil
+	}
+	return withoutRpmlib(c.Requires())
+}
+
+// BuildConflicts returns the packages or capabilities that may not be
+// installed when building a source package. For binary packages, nil is
+// returned.
+func (c *Package) BuildConflicts() []Dependency {
+	if !c.IsSource() {
+		return nil
+	}
+	return c.Conflicts()
+}
+
+func withoutRpmlib(deps []Dependency) []Dependency {
+	a := make([]Dependency, 0, len(deps))
+	for _, dep := range deps {
+		if dep.Flags()&DepFlagRpmlib == 0 {
+			a = append(a, dep)
+		}
+	}
+	return a
+}
@@ -0,0 +1,57 @@
+package rpm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsSource(t *testing.T) {
+	p, err := Open("./testdata/epel-release-7-5.noarch.rpm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.IsSource() {
+		t.Errorf("Expected %v not to be a source package", p)
+	}
+	if a := p.Sources(); a != nil {
+		t.Errorf("Expected no sources for binary package, got: %v", a)
+	}
+	if a := p.BuildRequires(); a != nil {
+		t.Errorf("Expected no build requirements for binary package, got: %v", a)
+	}
+	p.Lead.Type = 1
+	if !p.IsSource() {
+		t.Errorf("Expected lead type 1 to indicate a source package")
+	}
+}
+
+func TestSources(t *testing.T) {
+	// Source0 and Source1 with NoSource: 0, and Patch0 and Patch1 with
+	// NoPatch: 1
+	p := newTestPackage(map[int]interface{}{
+		1106: []int64{1},
+		1018: []string{"foo.service", "foo-1.0.tar.gz"},
+		1019: []string{"foo-fix-crash.patch", "foo-fix-build.patch"},
+		1051: []int64{0},
+		1052: []int64{1},
+		1048: []int64{int64(DepFlagGreaterOrEqual), int64(DepFlagRpmlib | DepFlagLesserOrEqual)},
+		1049: []string{"gcc", "rpmlib(CompressedFileNames)"},
+		1050: []string{"8", "3.0.4-1"},
+	})
+	if !p.IsSource() {
+		t.Fatalf("Expected source package")
+	}
+	expect := []SourceFile{
+		{Name: "foo-1.0.tar.gz", Number: 0, NoSource: true},
+		{Name: "foo.service", Number: 1},
+		{Name: "foo-fix-build.patch", Number: 0, Patch: true},
+		{Name: "foo-fix-crash.patch", Number: 1, Patch: true, NoSource: true},
+	}
+	if a := p.Sources(); !reflect.DeepEqual(a, expect) {
+		t.Errorf("Expected sources %v, got: %v", expect, a)
+	}
+	deps := depStrings(p.BuildRequires())
+	if !reflect.DeepEqual(deps, []string{"gcc >= 8"}) {
+		t.Errorf("Expected build requirement gcc >= 8, got: %v", deps)
+	}
+}
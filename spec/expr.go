@@ -0,0 +1,379 @@
+package spec
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// A value is the result of an expression in a %if condition or %[...]
+// expansion. Values are integers, strings or versions.
+type value struct {
+	kind byte // 'i', 's' or 'v'
+	n    int64
+	s    string
+}
+
+func (v value) String() string {
+	if v.kind == 'i' {
+		return strconv.FormatInt(v.n, 10)
+	}
+	return v.s
+}
+
+func (v value) truth() bool {
+	if v.kind == 'i' {
+		return v.n != 0
+	}
+	return v.s != ""
+}
+
+func intValue(n int64) value { return value{kind: 'i', n: n} }
+
+func boolValue(b bool) value {
+	if b {
+		return intValue(1)
+	}
+	return intValue(0)
+}
+
+// eval expands the macros in expr and evaluates it as an rpm expression.
+//
+// Expressions support integer and string literals, version literals such as
+// v"1.0-1", the operators ! - * / + < > <= >= == != && || and ?:, and
+// parentheses. Strings and versions may only be compared with values of the
+// same type, and strings may be concatenated with +.
+func (c *Macros) eval(expr string, depth int) (value, error) {
+	s, err := c.expand(expr, depth+1)
+	if err != nil {
+		return value{}, err
+	}
+	p := &exprParser{s: s}
+	v, err := p.parseTernary()
+	if err != nil {
+		return value{}, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return value{}, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return v, nil
+}
+
+// exprParser is a recursive descent parser and evaluator for expressions.
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("invalid expression %q: "+format, append([]interface{}{p.s}, a...)...)
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// accept consumes op if it is next in the input.
+func (p *exprParser) accept(op string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], op) {
+		p.pos += len(op)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseTernary() (value, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return value{}, err
+	}
+	if !p.accept("?") {
+		return cond, nil
+	}
+	a, err := p.parseTernary()
+	if err != nil {
+		return value{}, err
+	}
+	if !p.accept(":") {
+		return value{}, p.errorf("expected ':'")
+	}
+	b, err := p.parseTernary()
+	if err != nil {
+		return value{}, err
+	}
+	if cond.truth() {
+		return a, nil
+	}
+	return b, nil
+}
+
+func (p *exprParser) parseOr() (value, error) {
+	v, err := p.parseAnd()
+	if err != nil {
+		return value{}, err
+	}
+	for p.accept("||") {
+		w, err := p.parseAnd()
+		if err != nil {
+			return value{}, err
+		}
+		if err := sameKind(p, v, w); err != nil {
+			return value{}, err
+		}
+		if !v.truth() {
+			v = w
+		}
+	}
+	return v, nil
+}
+
+func (p *exprParser) parseAnd() (value, error) {
+	v, err := p.parseCompare()
+	if err != nil {
+		return value{}, err
+	}
+	for p.accept("&&") {
+		w, err := p.parseCompare()
+		if err != nil {
+			return value{}, err
+		}
+		if err := sameKind(p, v, w); err != nil {
+			return value{}, err
+		}
+		if v.truth() {
+			v = w
+		}
+	}
+	return v, nil
+}
+
+var compareOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *exprParser) parseCompare() (value, error) {
+	v, err := p.parseAdd()
+	if err != nil {
+		return value{}, err
+	}
+	for {
+		op := ""
+		for _, o := range compareOps {
+			if p.accept(o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return v, nil
+		}
+		w, err := p.parseAdd()
+		if err != nil {
+			return value{}, err
+		}
+		if err := sameKind(p, v, w); err != nil {
+			return value{}, err
+		}
+		var rc int
+		switch v.kind {
+		case 'i':
+			rc = compareInts(v.n, w.n)
+		case 's':
+			rc = strings.Compare(v.s, w.s)
+		case 'v':
+			rc = rpm.Compare(parseEVR(v.s), parseEVR(w.s))
+		}
+		switch op {
+		case "==":
+			v = boolValue(rc == 0)
+		case "!=":
+			v = boolValue(rc != 0)
+		case "<=":
+			v = boolValue(rc <= 0)
+		case ">=":
+			v = boolValue(rc >= 0)
+		case "<":
+			v = boolValue(rc < 0)
+		case ">":
+			v = boolValue(rc > 0)
+		}
+	}
+}
+
+func (p *exprParser) parseAdd() (value, error) {
+	v, err := p.parseMul()
+	if err != nil {
+		return value{}, err
+	}
+	for {
+		var op byte
+		if p.accept("+") {
+			op = '+'
+		} else if p.accept("-") {
+			op = '-'
+		} else {
+			return v, nil
+		}
+		w, err := p.parseMul()
+		if err != nil {
+			return value{}, err
+		}
+		if err := sameKind(p, v, w); err != nil {
+			return value{}, err
+		}
+		switch {
+		case v.kind == 's' && op == '+':
+			v.s += w.s
+		case v.kind != 'i':
+			return value{}, p.errorf("%c is not supported for strings", op)
+		case op == '+':
+			v.n += w.n
+		default:
+			v.n -= w.n
+		}
+	}
+}
+
+func (p *exprParser) parseMul() (value, error) {
+	v, err := p.parseUnary()
+	if err != nil {
+		return value{}, err
+	}
+	for {
+		var op byte
+		if p.accept("*") {
+			op = '*'
+		} else if p.accept("/") {
+			op = '/'
+		} else {
+			return v, nil
+		}
+		w, err := p.parseUnary()
+		if err != nil {
+			return value{}, err
+		}
+		if v.kind != 'i' || w.kind != 'i' {
+			return value{}, p.errorf("%c is only supported for integers", op)
+		}
+		if op == '*' {
+			v.n *= w.n
+		} else if w.n == 0 {
+			return value{}, p.errorf("division by zero")
+		} else {
+			v.n /= w.n
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (value, error) {
+	if p.accept("!") {
+		v, err := p.parseUnary()
+		if err != nil {
+			return value{}, err
+		}
+		return boolValue(!v.truth()), nil
+	}
+	if p.accept("-") {
+		v, err := p.parseUnary()
+		if err != nil {
+			return value{}, err
+		}
+		if v.kind != 'i' {
+			return value{}, p.errorf("- is only supported for integers")
+		}
+		return intValue(-v.n), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (value, error) {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return value{}, p.errorf("unexpected end of expression")
+	}
+	switch b := p.s[p.pos]; {
+	case b == '(':
+		p.pos++
+		v, err := p.parseTernary()
+		if err != nil {
+			return value{}, err
+		}
+		if !p.accept(")") {
+			return value{}, p.errorf("expected ')'")
+		}
+		return v, nil
+
+	case b == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return value{}, err
+		}
+		return value{kind: 's', s: s}, nil
+
+	case b == 'v' && strings.HasPrefix(p.s[p.pos:], `v"`):
+		p.pos++
+		s, err := p.parseString()
+		if err != nil {
+			return value{}, err
+		}
+		return value{kind: 'v', s: s}, nil
+
+	case b >= '0' && b <= '9':
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.ParseInt(p.s[start:p.pos], 10, 64)
+		if err != nil {
+			return value{}, p.errorf("%v", err)
+		}
+		return intValue(n), nil
+	}
+	return value{}, p.errorf("bare words are not supported: %q", p.s[p.pos:])
+}
+
+// parseString parses a double-quoted string literal.
+func (p *exprParser) parseString() (string, error) {
+	p.pos++ // opening quote
+	i := strings.IndexByte(p.s[p.pos:], '"')
+	if i < 0 {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.s[p.pos : p.pos+i]
+	p.pos += i + 1
+	return s, nil
+}
+
+func sameKind(p *exprParser, v, w value) error {
+	if v.kind != w.kind {
+		return p.errorf("types must match")
+	}
+	return nil
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// parseEVR parses a version in the form '[epoch:]version[-release]'.
+func parseEVR(s string) rpm.Version {
+	epoch := 0
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		epoch, _ = strconv.Atoi(s[:i])
+		s = s[i+1:]
+	}
+	version, release := s, ""
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		version, release = s[:i], s[i+1:]
+	}
+	return rpm.NewDependency(rpm.DepFlagEqual, "", epoch, version, release)
+}
@@ -0,0 +1,310 @@
+package spec
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxDepth is the maximum depth of recursive macro expansion.
+const maxDepth = 64
+
+// Macros is a table of macro definitions used to expand the content of a spec
+// file.
+//
+// Macros are referenced as %name or %{name}. Conditional references such as
+// %{?name}, %{!?name}, %{?name:text} and %{!?name:text} expand to the macro
+// body or to the given text, depending on whether the macro is defined.
+// Expressions are expanded with %[expr] and '%%' expands to '%'. References
+// to undefined macros are left unexpanded, as rpm does.
+//
+// The following built-in macros are supported: %{nil}, %{expand:...},
+// %{lower:...}, %{upper:...}, %{basename:...}, %{dirname:...},
+// %{suffix:...}, %{len:...}, %{shrink:...}, %{defined:name},
+// %{undefined:name}, %{with name} and %{without name}.
+//
+// Parametric macros, Lua macros and shell expansion with %(...) are not
+// supported and are left unexpanded.
+type Macros struct {
+	defs map[string]string
+}
+
+// NewMacros returns a macro table with the given definitions.
+func NewMacros(defs map[string]string) *Macros {
+	c := &Macros{defs: make(map[string]string, len(defs))}
+	for name, body := range defs {
+		c.Define(name, body)
+	}
+	return c
+}
+
+// Define defines the macro name with the given body, replacing any existing
+// definition. The body is expanded each time the macro is referenced.
+func (c *Macros) Define(name, body string) {
+	c.defs[name] = body
+}
+
+// Undefine removes the definition of the macro name.
+func (c *Macros) Undefine(name string) {
+	delete(c.defs, name)
+}
+
+// Lookup returns the unexpanded body of the macro name and whether it is
+// defined.
+func (c *Macros) Lookup(name string) (string, bool) {
+	body, ok := c.defs[name]
+	return body, ok
+}
+
+// Expand expands all macro references in s.
+func (c *Macros) Expand(s string) (string, error) {
+	v, err := c.expand(s, 0)
+	if err != nil {
+		return "", errorf("%v", err)
+	}
+	return v, nil
+}
+
+func (c *Macros) expand(s string, depth int) (string, error) {
+	if depth > maxDepth {
+		return "", fmt.Errorf("macro expansion too deep: %s", s)
+	}
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '%' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		switch s[i+1] {
+		case '%':
+			sb.WriteByte('%')
+			i += 2
+			continue
+
+		case '{', '[':
+			j := matchBracket(s, i+1)
+			if j < 0 {
+				return "", fmt.Errorf("unterminated macro: %s", s[i:])
+			}
+			inner := s[i+2 : j]
+			var v string
+			var err error
+			if s[i+1] == '{' {
+				v, err = c.expandBraces(s[i:j+1], inner, depth)
+			} else {
+				v, err = c.expandExpr(inner, depth)
+			}
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(v)
+			i = j + 1
+			continue
+
+		case '(':
+			// shell expansion is not supported
+			j := matchBracket(s, i+1)
+			if j < 0 {
+				return "", fmt.Errorf("unterminated macro: %s", s[i:])
+			}
+			sb.WriteString(s[i : j+1])
+			i = j + 1
+			continue
+		}
+
+		// %name, %?name or %!?name
+		j := i + 1
+		for j < len(s) && (s[j] == '!' || s[j] == '?') {
+			j++
+		}
+		k := j
+		for k < len(s) && isNameChar(s[k], k == j) {
+			k++
+		}
+		if k == j {
+			sb.WriteByte('%')
+			i++
+			continue
+		}
+		v, err := c.expandName(s[i:k], s[i+1:j], s[j:k], "", false, depth)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(v)
+		i = k
+	}
+	return sb.String(), nil
+}
+
+// expandBraces expands a macro reference in the form %{...}.
+func (c *Macros) expandBraces(ref, inner string, depth int) (string, error) {
+	i := 0
+	for i < len(inner) && (inner[i] == '!' || inner[i] == '?') {
+		i++
+	}
+	flags := inner[:i]
+	j := i
+	for j < len(inner) && isNameChar(inner[j], j == i) {
+		j++
+	}
+	name := inner[i:j]
+	rest := inner[j:]
+	if name == "" {
+		return ref, nil
+	}
+	hasArg := false
+	if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, " ") {
+		rest, hasArg = rest[1:], true
+	} else if rest != "" {
+		// not a macro reference
+		return ref, nil
+	}
+	return c.expandName(ref, flags, name, rest, hasArg, depth)
+}
+
+// expandName expands a reference to the named macro. Flags are any '?' and
+// '!' characters which precede the name. Arg is the text following a colon or
+// space in the reference, if any.
+func (c *Macros) expandName(ref, flags, name, arg string, hasArg bool, depth int) (string, error) {
+	if strings.Contains(flags, "?") {
+		_, defined := c.defs[name]
+		if strings.Contains(flags, "!") {
+			defined = !defined
+		}
+		if !defined {
+			return "", nil
+		}
+		if hasArg {
+			return c.expand(arg, depth+1)
+		}
+		if strings.Contains(flags, "!") {
+			return "", nil
+		}
+	} else if builtin, ok := builtins[name]; ok && (hasArg || name == "nil") {
+		arg, err := c.expand(arg, depth+1)
+		if err != nil {
+			return "", err
+		}
+		return builtin(c, strings.TrimSpace(arg), depth)
+	}
+	body, ok := c.defs[name]
+	if !ok {
+		return ref, nil
+	}
+	return c.expand(body, depth+1)
+}
+
+// expandExpr expands an expression in the form %[...].
+func (c *Macros) expandExpr(expr string, depth int) (string, error) {
+	v, err := c.eval(expr, depth)
+	if err != nil {
+		return "", err
+	}
+	return v.String(), nil
+}
+
+// builtins are the built-in macros that take an argument.
+var builtins map[string]func(c *Macros, arg string, depth int) (string, error)
+
+func init() {
+	builtins = map[string]func(c *Macros, arg string, depth int) (string, error){
+		"nil": func(c *Macros, arg string, depth int) (string, error) {
+			return "", nil
+		},
+		"expand": func(c *Macros, arg string, depth int) (string, error) {
+			return c.expand(arg, depth+1)
+		},
+		"lower": func(c *Macros, arg string, depth int) (string, error) {
+			return strings.ToLower(arg), nil
+		},
+		"upper": func(c *Macros, arg string, depth int) (string, error) {
+			return strings.ToUpper(arg), nil
+		},
+		"basename": func(c *Macros, arg string, depth int) (string, error) {
+			return path.Base(arg), nil
+		},
+		"dirname": func(c *Macros, arg string, depth int) (string, error) {
+			return path.Dir(arg), nil
+		},
+		"suffix": func(c *Macros, arg string, depth int) (string, error) {
+			return strings.TrimPrefix(path.Ext(arg), "."), nil
+		},
+		"len": func(c *Macros, arg string, depth int) (string, error) {
+			return strconv.Itoa(len(arg)), nil
+		},
+		"shrink": func(c *Macros, arg string, depth int) (string, error) {
+			return strings.Join(strings.Fields(arg), " "), nil
+		},
+		"defined": func(c *Macros, arg string, depth int) (string, error) {
+			return boolString(c.isDefined(arg)), nil
+		},
+		"undefined": func(c *Macros, arg string, depth int) (string, error) {
+			return boolString(!c.isDefined(arg)), nil
+		},
+		"with": func(c *Macros, arg string, depth int) (string, error) {
+			return boolString(c.isDefined("with_" + arg)), nil
+		},
+		"without": func(c *Macros, arg string, depth int) (string, error) {
+			return boolString(!c.isDefined("with_" + arg)), nil
+		},
+	}
+}
+
+func (c *Macros) isDefined(name string) bool {
+	_, ok := c.defs[name]
+	return ok
+}
+
+// bcond defines with_name according to a %bcond_with or %bcond_without
+// directive. If enable is true, the option is enabled unless _without_name is
+// defined. Otherwise, the option is enabled only if _with_name is defined.
+func (c *Macros) bcond(name string, enable bool) {
+	if enable && !c.isDefined("_without_"+name) || !enable && c.isDefined("_with_"+name) {
+		c.Define("with_"+name, "1")
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func isNameChar(b byte, first bool) bool {
+	return b == '_' || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') ||
+		(!first && b >= '0' && b <= '9')
+}
+
+// matchBracket returns the index of the bracket that closes the bracket at
+// s[i], or -1 if it is not closed.
+func matchBracket(s string, i int) int {
+	open := s[i]
+	var close byte
+	switch open {
+	case '{':
+		close = '}'
+	case '[':
+		close = ']'
+	case '(':
+		close = ')'
+	}
+	n := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case open:
+			n++
+		case close:
+			n--
+			if n == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
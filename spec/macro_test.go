@@ -0,0 +1,106 @@
+package spec
+
+import "testing"
+
+func TestExpand(t *testing.T) {
+	m := NewMacros(map[string]string{
+		"name":       "hello",
+		"version":    "2.10",
+		"nv":         "%{name}-%{version}",
+		"empty":      "",
+		"with_tests": "1",
+		"path":       "/usr/share/hello/data.tar.gz",
+		"loop":       "%{loop}",
+	})
+	tests := []struct {
+		in     string
+		expect string
+	}{
+		{"plain text", "plain text"},
+		{"%name", "hello"},
+		{"%{name}", "hello"},
+		{"%{nv}.tar.gz", "hello-2.10.tar.gz"},
+		{"%name-%version", "hello-2.10"},
+		{"100%%", "100%"},
+		{"100%", "100%"},
+		{"%{undefined_macro}", "%{undefined_macro}"},
+		{"%undefined_macro", "%undefined_macro"},
+		{"%{?name}", "hello"},
+		{"%{?undefined_macro}", ""},
+		{"%?name", "hello"},
+		{"%{!?name}", ""},
+		{"%{?name:yes}", "yes"},
+		{"%{?undefined_macro:yes}", ""},
+		{"%{!?name:yes}", ""},
+		{"%{!?undefined_macro:yes}", "yes"},
+		{"%{?empty:set}", "set"},
+		{"%{?name:%{version}}", "2.10"},
+		{"a%{nil}b", "ab"},
+		{"%{upper:%name}", "HELLO"},
+		{"%{lower:ABC}", "abc"},
+		{"%{basename:%path}", "data.tar.gz"},
+		{"%{dirname:%path}", "/usr/share/hello"},
+		{"%{suffix:%path}", "gz"},
+		{"%{len:%name}", "5"},
+		{"%{shrink:  a   b  }", "a b"},
+		{"%{defined name}", "1"},
+		{"%{undefined name}", "0"},
+		{"%{with tests}", "1"},
+		{"%{without tests}", "0"},
+		{"%{with docs}", "0"},
+		{"%{expand:%%{name}}", "hello"},
+		{"%[1 + 2 * 3]", "7"},
+		{"%[(1 + 2) * 3]", "9"},
+		{"%[%{len:%name} > 3 ? 1 : 0]", "1"},
+		{`%["%name" == "hello"]`, "1"},
+		{`%[v"1.0^git1" < v"1.0.1"]`, "1"},
+		{`%[v"1:1.0" > v"2.0"]`, "1"},
+		{"%[!0 && 2]", "2"},
+		{"%(echo hello)", "%(echo hello)"},
+	}
+	for _, test := range tests {
+		v, err := m.Expand(test.in)
+		if err != nil {
+			t.Errorf("Error expanding %q: %v", test.in, err)
+			continue
+		}
+		if v != test.expect {
+			t.Errorf("Expected %q to expand to %q, got: %q", test.in, test.expect, v)
+		}
+	}
+
+	errorTests := []string{
+		"%{loop}",
+		"%{name",
+		"%[1 +]",
+		"%[1 / 0]",
+		`%["a" == 1]`,
+		`%["a" - "b"]`,
+		"%[foo]",
+	}
+	for _, test := range errorTests {
+		if _, err := m.Expand(test); err == nil {
+			t.Errorf("Expected error expanding %q", test)
+		}
+	}
+}
+
+func TestBcond(t *testing.T) {
+	tests := []struct {
+		defs   map[string]string
+		enable bool
+		expect bool
+	}{
+		{nil, true, true},
+		{nil, false, false},
+		{map[string]string{"_without_foo": "1"}, true, false},
+		{map[string]string{"_with_foo": "1"}, false, true},
+	}
+	for _, test := range tests {
+		m := NewMacros(test.defs)
+		m.bcond("foo", test.enable)
+		if _, ok := m.Lookup("with_foo"); ok != test.expect {
+			t.Errorf("Expected with_foo defined to be %v for %v, got: %v", test.expect, test.defs, ok)
+		}
+	}
+}
@@ -0,0 +1,1000 @@
+/*
+Package spec parses rpm spec files.
+
+Spec files are parsed the way rpmbuild parses them before building: macros are
+expanded, conditional blocks are evaluated and each section is collected into
+a Spec. The dependencies of each package are returned in the same form as the
+dependencies read from the headers of a binary package, so that a spec file may
+be compared with the packages built from it:
+
+	s, err := spec.Parse(f, &spec.Options{
+		Arch:   "x86_64",
+		Macros: map[string]string{"dist": ".el8"},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, pkg := range s.Packages {
+		fmt.Println(pkg.Name, pkg.Requires)
+	}
+
+Dependencies that rpmbuild generates automatically while building, such as
+shared library requirements and rpmlib() features, are not known until the
+package is built and are not included.
+*/
+package spec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+// Options configures the parsing of a spec file.
+type Options struct {
+	// Macros defines macros before parsing, such as {"dist": ".el8"}.
+	Macros map[string]string
+
+	// Arch is the target architecture, which is used to evaluate %ifarch
+	// conditions and is the architecture of packages that are not noarch.
+	// If Arch is empty, %ifarch conditions are false.
+	Arch string
+
+	// OS is the target operating system used to evaluate %ifos conditions.
+	// The default is linux.
+	OS string
+}
+
+// A Spec is a parsed spec file.
+type Spec struct {
+	// Packages lists the packages built from the spec file. The main package
+	// is first, followed by each subpackage in the order of declaration.
+	Packages []*Package
+
+	// Sources lists the Source and Patch files of the spec file, in order of
+	// declaration.
+	Sources []rpm.SourceFile
+
+	// BuildRequires and BuildConflicts list the build dependencies of the
+	// source package.
+	BuildRequires  []rpm.Dependency
+	BuildConflicts []rpm.Dependency
+
+	// Sections holds the content of each build section, such as prep, build,
+	// install and check, keyed by name without the leading '%'.
+	Sections map[string]string
+
+	// Changelog lists the entries of the %changelog section, most recent
+	// first.
+	Changelog []rpm.ChangelogEntry
+
+	// Macros holds the macro definitions after parsing.
+	Macros *Macros
+}
+
+// A Package is a binary package declared in a spec file.
+type Package struct {
+	Name    string
+	Epoch   int
+	Version string
+	Release string
+
+	// Arch is the architecture of the package: either noarch or the target
+	// architecture given in Options.
+	Arch string
+
+	// Tags holds the value of each preamble tag of the package, keyed by the
+	// tag name in lower case. Dependency, Source and Patch tags are parsed
+	// into their own fields and are not included.
+	Tags map[string]string
+
+	// Description is the content of the %description section.
+	Description string
+
+	// Requires, Provides, Conflicts, Obsoletes, Recommends, Suggests,
+	// Supplements, Enhances and OrderWithRequires list the dependencies of the
+	// package, including the dependencies that rpmbuild adds to every package:
+	// the package provides its own name and version, and each scriptlet
+	// requires its interpreter.
+	Requires          []rpm.Dependency
+	Provides          []rpm.Dependency
+	Conflicts         []rpm.Dependency
+	Obsoletes         []rpm.Dependency
+	Recommends        []rpm.Dependency
+	Suggests          []rpm.Dependency
+	Supplements       []rpm.Dependency
+	Enhances          []rpm.Dependency
+	OrderWithRequires []rpm.Dependency
+
+	// Scripts lists the scriptlets of the package.
+	Scripts []*rpm.Script
+
+	// Files lists the lines of the %files sections of the package, excluding
+	// comments. FileLists lists the files given with %files -f.
+	Files     []string
+	FileLists []string
+}
+
+// Script returns the scriptlet of the given type, such as rpm.ScriptPost, or
+// nil if the package has no such scriptlet.
+func (c *Package) Script(typ string) *rpm.Script {
+	for _, script := range c.Scripts {
+		if script.Type == typ {
+			return script
+		}
+	}
+	return nil
+}
+
+// Package returns the package with the given name, or nil if the spec file
+// declares no such package.
+func (c *Spec) Package(name string) *Package {
+	for _, pkg := range c.Packages {
+		if pkg.Name == name {
+			return pkg
+		}
+	}
+	return nil
+}
+
+// isaNames maps architectures to the ISA name that rpmbuild adds to the
+// architecture-specific provide of each package, as in 'bash(x86-64)'.
+var isaNames = map[string]string{
+	"x86_64":  "x86-64",
+	"amd64":   "x86-64",
+	"i386":    "x86-32",
+	"i486":    "x86-32",
+	"i586":    "x86-32",
+	"i686":    "x86-32",
+	"athlon":  "x86-32",
+	"aarch64": "aarch-64",
+	"armv7hl": "arm-32",
+	"ppc":     "ppc-32",
+	"ppc64":   "ppc-64",
+	"ppc64le": "ppc-64",
+	"s390":    "s390-32",
+	"s390x":   "s390-64",
+	"riscv64": "riscv-64",
+}
+
+// scriptSections maps section names to scriptlet types.
+var scriptSections = map[string]string{
+	"pretrans":     rpm.ScriptPreTrans,
+	"pre":          rpm.ScriptPre,
+	"post":         rpm.ScriptPost,
+	"preun":        rpm.ScriptPreUn,
+	"postun":       rpm.ScriptPostUn,
+	"posttrans":    rpm.ScriptPostTrans,
+	"preuntrans":   rpm.ScriptPreUnTrans,
+	"postuntrans":  rpm.ScriptPostUnTrans,
+	"verifyscript": rpm.ScriptVerify,
+}
+
+// scriptDepFlags maps scriptlet types to the flags of the requirement on
+// their interpreter.
+var scriptDepFlags = map[string]int{
+	rpm.ScriptPreTrans:  rpm.DepFlagPreTrans,
+	rpm.ScriptPre:       rpm.DepFlagScriptPre,
+	rpm.ScriptPost:      rpm.DepFlagScriptPost,
+	rpm.ScriptPreUn:     rpm.DepFlagScriptPreUn,
+	rpm.ScriptPostUn:    rpm.DepFlagScriptPostUn,
+	rpm.ScriptPostTrans: rpm.DepFlagPostTrans,
+	rpm.ScriptVerify:    rpm.DepFlagScriptVerify,
+}
+
+// buildSections are sections whose content is collected in Spec.Sections.
+var buildSections = map[string]bool{
+	"prep":                   true,
+	"generate_buildrequires": true,
+	"conf":                   true,
+	"build":                  true,
+	"install":                true,
+	"check":                  true,
+	"clean":                  true,
+}
+
+// ignoredSections are sections whose content is not parsed.
+var ignoredSections = map[string]bool{
+	"sourcelist":             true,
+	"patchlist":              true,
+	"triggerprein":           true,
+	"triggerin":              true,
+	"triggerun":              true,
+	"triggerpostun":          true,
+	"filetriggerin":          true,
+	"filetriggerun":          true,
+	"filetriggerpostun":      true,
+	"transfiletriggerin":     true,
+	"transfiletriggerun":     true,
+	"transfiletriggerpostun": true,
+}
+
+// inheritedTags are copied from the main package to each subpackage.
+var inheritedTags = []string{"license", "url", "bugurl", "vendor", "packager", "distribution"}
+
+// Parse parses a spec file from r.
+func Parse(r io.Reader, opts *Options) (*Spec, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	p := &parser{
+		opts:   opts,
+		macros: NewMacros(opts.Macros),
+		spec:   &Spec{Sections: make(map[string]string)},
+	}
+	if opts.Arch != "" {
+		for _, name := range []string{"_arch", "_target_cpu"} {
+			if !p.macros.isDefined(name) {
+				p.macros.Define(name, opts.Arch)
+			}
+		}
+	}
+	p.spec.Macros = p.macros
+	p.pkg = &Package{Tags: make(map[string]string)}
+	p.spec.Packages = append(p.spec.Packages, p.pkg)
+	p.section = "preamble"
+	if err := p.parse(r); err != nil {
+		return nil, err
+	}
+	return p.spec, nil
+}
+
+// parser holds the state of a spec file being parsed.
+type parser struct {
+	opts   *Options
+	macros *Macros
+	spec   *Spec
+	line   int
+
+	// conds is the stack of open conditional blocks
+	conds []cond
+
+	// current section and its target package
+	section string
+	pkg     *Package
+	args    []string
+	lines   []string
+}
+
+// cond is the state of a conditional block.
+type cond struct {
+	parent bool // whether the enclosing block is active
+	taken  bool // whether any branch has been active
+	active bool // whether the current branch is active
+	isElse bool // whether %else has been seen
+}
+
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return errorf("line %d: %s", p.line, fmt.Sprintf(format, a...))
+}
+
+// active returns true if lines are not excluded by a conditional block.
+func (p *parser) active() bool {
+	return len(p.conds) == 0 || p.conds[len(p.conds)-1].active
+}
+
+func (p *parser) parse(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		p.line++
+		line := scanner.Text()
+
+		// macro definitions may continue over multiple lines
+		for strings.HasSuffix(line, "\\") && isDefine(line) && scanner.Scan() {
+			p.line++
+			line = line[:len(line)-1] + "\n" + scanner.Text()
+		}
+		if err := p.parseLine(line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(p.conds) > 0 {
+		return p.errorf("missing %%endif")
+	}
+	return p.endSection()
+}
+
+func isDefine(line string) bool {
+	w := firstWord(line)
+	return w == "%define" || w == "%global"
+}
+
+// firstWord returns the first whitespace separated word of line.
+func firstWord(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func (p *parser) parseLine(line string) error {
+	word := firstWord(line)
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), word))
+	if ok, err := p.parseConditional(word, rest); ok || err != nil {
+		return err
+	}
+	if !p.active() {
+		return nil
+	}
+
+	switch word {
+	case "%define", "%global":
+		return p.define(word == "%global", rest)
+	case "%undefine":
+		p.macros.Undefine(rest)
+		return nil
+	case "%bcond_with", "%bcond_without":
+		p.macros.bcond(rest, word == "%bcond_without")
+		return nil
+	case "%bcond":
+		fields := strings.Fields(rest)
+		if len(fields) != 2 {
+			return p.errorf("invalid %%bcond: %s", rest)
+		}
+		v, err := p.macros.eval(fields[1], 0)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		p.macros.bcond(fields[0], v.truth())
+		return nil
+	case "%include":
+		return p.errorf("%%include is not supported")
+	}
+
+	// section headers
+	if strings.HasPrefix(word, "%") {
+		name := word[1:]
+		if name == "package" || name == "description" || name == "files" ||
+			name == "changelog" || scriptSections[name] != "" ||
+			buildSections[name] || ignoredSections[name] {
+			expanded, err := p.macros.expand(rest, 0)
+			if err != nil {
+				return p.errorf("%v", err)
+			}
+			return p.startSection(name, strings.Fields(expanded))
+		}
+	}
+
+	if p.section == "preamble" || p.section == "package" {
+		return p.parsePreamble(line)
+	}
+	if ignoredSections[p.section] {
+		return nil
+	}
+	expanded, err := p.macros.expand(line, 0)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	p.lines = append(p.lines, expanded)
+	return nil
+}
+
+// parseConditional handles %if, %ifarch, %ifnarch, %ifos, %ifnos, %elif,
+// %elifarch, %elifos, %else and %endif. It returns true if word is a
+// conditional directive.
+func (p *parser) parseConditional(word, rest string) (bool, error) {
+	switch word {
+	case "%if", "%ifarch", "%ifnarch", "%ifos", "%ifnos":
+		c := cond{parent: p.active()}
+		if c.parent {
+			ok, err := p.evalCondition(word[1:], rest)
+			if err != nil {
+				return true, err
+			}
+			c.active, c.taken = ok, ok
+		}
+		p.conds = append(p.conds, c)
+		return true, nil
+
+	case "%elif", "%elifarch", "%elifos":
+		if len(p.conds) == 0 || p.conds[len(p.conds)-1].isElse {
+			return true, p.errorf("%s without %%if", word)
+		}
+		c := &p.conds[len(p.conds)-1]
+		c.active = false
+		if c.parent && !c.taken {
+			ok, err := p.evalCondition("if"+strings.TrimPrefix(word[1:], "elif"), rest)
+			if err != nil {
+				return true, err
+			}
+			c.active, c.taken = ok, ok
+		}
+		return true, nil
+
+	case "%else":
+		if len(p.conds) == 0 || p.conds[len(p.conds)-1].isElse {
+			return true, p.errorf("%%else without %%if")
+		}
+		c := &p.conds[len(p.conds)-1]
+		c.isElse = true
+		c.active = c.parent && !c.taken
+		c.taken = true
+		return true, nil
+
+	case "%endif":
+		if len(p.conds) == 0 {
+			return true, p.errorf("%%endif without %%if")
+		}
+		p.conds = p.conds[:len(p.conds)-1]
+		return true, nil
+	}
+	return false, nil
+}
+
+// evalCondition evaluates the condition of a %if, %ifarch, %ifnarch, %ifos or
+// %ifnos directive.
+func (p *parser) evalCondition(directive, expr string) (bool, error) {
+	if directive == "if" {
+		v, err := p.macros.eval(expr, 0)
+		if err != nil {
+			return false, p.errorf("%v", err)
+		}
+		return v.truth(), nil
+	}
+	expanded, err := p.macros.expand(expr, 0)
+	if err != nil {
+		return false, p.errorf("%v", err)
+	}
+	target := p.opts.Arch
+	if strings.HasSuffix(directive, "os") {
+		target = p.opts.OS
+		if target == "" {
+			target = "linux"
+		}
+	}
+	match := false
+	for _, s := range strings.FieldsFunc(expanded, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	}) {
+		if target != "" && strings.EqualFold(s, target) {
+			match = true
+		}
+	}
+	if strings.HasPrefix(directive, "ifn") {
+		return !match, nil
+	}
+	return match, nil
+}
+
+// define handles a %define or %global directive. The body of %global is
+// expanded when it is defined.
+func (p *parser) define(global bool, rest string) error {
+	i := strings.IndexAny(rest, " \t\n")
+	if i < 0 {
+		return p.errorf("macro %s has no body", rest)
+	}
+	name, body := rest[:i], strings.TrimSpace(rest[i:])
+	if j := strings.IndexByte(name, '('); j >= 0 {
+		// parametric macro options are not supported
+		name = name[:j]
+	}
+	if global {
+		expanded, err := p.macros.expand(body, 0)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		body = expanded
+	}
+	p.macros.Define(name, body)
+	return nil
+}
+
+// parsePreamble parses a line of the preamble of a package.
+func (p *parser) parsePreamble(line string) error {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return nil
+	}
+	expanded, err := p.macros.expand(trimmed, 0)
+	if err != nil {
+		return p.errorf("%v", err)
+	}
+	if strings.TrimSpace(expanded) == "" {
+		return nil
+	}
+	i := strings.IndexByte(expanded, ':')
+	if i < 0 {
+		return p.errorf("invalid preamble line: %s", line)
+	}
+	tag, value := strings.TrimSpace(expanded[:i]), strings.TrimSpace(expanded[i+1:])
+	qualifier := ""
+	if j := strings.IndexByte(tag, '('); j >= 0 && strings.HasSuffix(tag, ")") {
+		tag, qualifier = tag[:j], tag[j+1:len(tag)-1]
+	}
+	key := strings.ToLower(tag)
+	pkg := p.pkg
+
+	switch key {
+	case "name":
+		if pkg != p.spec.Packages[0] {
+			return p.errorf("Name is only valid in the main package")
+		}
+		pkg.Name = value
+		p.macros.Define("name", value)
+		return nil
+	case "version":
+		pkg.Version = value
+		if pkg == p.spec.Packages[0] {
+			p.macros.Define("version", value)
+		}
+		return nil
+	case "release":
+		pkg.Release = value
+		if pkg == p.spec.Packages[0] {
+			p.macros.Define("release", value)
+		}
+		return nil
+	case "epoch":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return p.errorf("invalid epoch: %s", value)
+		}
+		pkg.Epoch = n
+		if pkg == p.spec.Packages[0] {
+			p.macros.Define("epoch", value)
+		}
+		return nil
+	case "buildarch", "buildarchitectures":
+		if value == "noarch" {
+			pkg.Arch = "noarch"
+		}
+		pkg.Tags[key] = value
+		return nil
+	case "summary", "url":
+		// License is not defined as a macro as %license is a %files
+		// directive.
+		if pkg == p.spec.Packages[0] {
+			p.macros.Define(key, value)
+		}
+	}
+
+	flags, err := p.qualifierFlags(qualifier)
+	if err != nil {
+		return err
+	}
+	var deps *[]rpm.Dependency
+	switch key {
+	case "requires":
+		deps = &pkg.Requires
+	case "prereq":
+		deps = &pkg.Requires
+		flags |= rpm.DepFlagPrereq
+	case "provides":
+		deps = &pkg.Provides
+	case "conflicts":
+		deps = &pkg.Conflicts
+	case "obsoletes":
+		deps = &pkg.Obsoletes
+	case "recommends":
+		deps = &pkg.Recommends
+	case "suggests":
+		deps = &pkg.Suggests
+	case "supplements":
+		deps = &pkg.Supplements
+	case "enhances":
+		deps = &pkg.Enhances
+	case "orderwithrequires":
+		deps = &pkg.OrderWithRequires
+	case "buildrequires":
+		deps = &p.spec.BuildRequires
+	case "buildconflicts":
+		deps = &p.spec.BuildConflicts
+	}
+	if deps != nil {
+		a, err := parseDependencies(value, flags)
+		if err != nil {
+			return p.errorf("%v", err)
+		}
+		*deps = append(*deps, a...)
+		return nil
+	}
+
+	if strings.HasPrefix(key, "source") || strings.HasPrefix(key, "patch") {
+		if ok, err := p.addSource(key, value); ok || err != nil {
+			return err
+		}
+	}
+	if key == "nosource" || key == "nopatch" {
+		return p.noSource(key == "nopatch", value)
+	}
+	pkg.Tags[key] = value
+	return nil
+}
+
+// qualifierFlags returns the dependency flags of a qualifier such as
+// Requires(post).
+func (p *parser) qualifierFlags(qualifier string) (int, error) {
+	flags := 0
+	for _, q := range strings.Split(qualifier, ",") {
+		switch strings.TrimSpace(q) {
+		case "":
+		case "pre":
+			flags |= rpm.DepFlagScriptPre
+		case "post":
+			flags |= rpm.DepFlagScriptPost
+		case "preun":
+			flags |= rpm.DepFlagScriptPreUn
+		case "postun":
+			flags |= rpm.DepFlagScriptPostUn
+		case "pretrans":
+			flags |= rpm.DepFlagPreTrans
+		case "posttrans":
+			flags |= rpm.DepFlagPostTrans
+		case "verify":
+			flags |= rpm.DepFlagScriptVerify
+		case "interp":
+			flags |= rpm.DepFlagInterp
+		default:
+			return 0, p.errorf("unsupported qualifier: %s", q)
+		}
+	}
+	return flags, nil
+}
+
+// addSource handles a SourceN or PatchN tag. It returns false if key is not
+// such a tag.
+func (p *parser) addSource(key, value string) (bool, error) {
+	patch := strings.HasPrefix(key, "patch")
+	num := strings.TrimPrefix(strings.TrimPrefix(key, "source"), "patch")
+	n := -1
+	if num != "" {
+		var err error
+		if n, err = strconv.Atoi(num); err != nil {
+			return false, nil
+		}
+	} else {
+		// unnumbered sources follow the previous source
+		for _, src := range p.spec.Sources {
+			if src.Patch == patch && src.Number > n {
+				n = src.Number
+			}
+		}
+		n++
+	}
+	name := path.Base(value)
+	p.spec.Sources = append(p.spec.Sources, rpm.SourceFile{
+		Name:   name,
+		Number: n,
+		Patch:  patch,
+	})
+	macro := "SOURCE"
+	if patch {
+		macro = "PATCH"
+	}
+	p.macros.Define(macro+strconv.Itoa(n), "%{_sourcedir}/"+name)
+	return true, nil
+}
+
+// noSource handles a NoSource or NoPatch tag.
+func (p *parser) noSource(patch bool, value string) error {
+	for _, s := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	}) {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return p.errorf("invalid source number: %s", s)
+		}
+		for i := range p.spec.Sources {
+			if p.spec.Sources[i].Patch == patch && p.spec.Sources[i].Number == n {
+				p.spec.Sources[i].NoSource = true
+			}
+		}
+	}
+	return nil
+}
+
+// startSection ends the current section and begins a new one.
+func (p *parser) startSection(name string, args []string) error {
+	if err := p.endSection(); err != nil {
+		return err
+	}
+	p.section, p.args, p.lines = name, args, nil
+	p.pkg = p.spec.Packages[0]
+	if buildSections[name] || name == "changelog" || ignoredSections[name] {
+		return nil
+	}
+
+	// resolve the package of the section
+	pkgName, _, err := p.packageName(args)
+	if err != nil {
+		return err
+	}
+	if name == "package" {
+		if pkgName == p.pkg.Name {
+			return p.errorf("%%package requires a name")
+		}
+		if p.spec.Package(pkgName) != nil {
+			return p.errorf("package %s already exists", pkgName)
+		}
+		main := p.spec.Packages[0]
+		p.pkg = &Package{
+			Name:    pkgName,
+			Epoch:   main.Epoch,
+			Version: main.Version,
+			Release: main.Release,
+			Arch:    main.Arch,
+			Tags:    make(map[string]string),
+		}
+		for _, key := range inheritedTags {
+			if v, ok := main.Tags[key]; ok {
+				p.pkg.Tags[key] = v
+			}
+		}
+		p.spec.Packages = append(p.spec.Packages, p.pkg)
+		return nil
+	}
+	p.pkg = p.spec.Package(pkgName)
+	if p.pkg == nil {
+		return p.errorf("package %s does not exist", pkgName)
+	}
+	return nil
+}
+
+// packageName returns the name of the package to which section arguments
+// refer, and the remaining options.
+func (p *parser) packageName(args []string) (string, map[string]string, error) {
+	main := p.spec.Packages[0].Name
+	name := main
+	opts := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-n" || arg == "-p" || arg == "-f":
+			if i+1 == len(args) {
+				return "", nil, p.errorf("missing argument for %s", arg)
+			}
+			i++
+			if arg == "-n" {
+				name = args[i]
+			} else {
+				opts[arg] = args[i]
+			}
+		case strings.HasPrefix(arg, "-"):
+			opts[arg] = ""
+		default:
+			name = main + "-" + arg
+		}
+	}
+	return name, opts, nil
+}
+
+// endSection processes the content of the current section.
+func (p *parser) endSection() error {
+	lines := p.lines
+	p.lines = nil
+	switch name := p.section; {
+	case name == "preamble" || name == "package":
+		return p.finishPackage(p.pkg)
+
+	case buildSections[name]:
+		p.spec.Sections[name] += joinLines(lines)
+
+	case name == "description":
+		p.pkg.Description = strings.TrimRight(joinLines(lines), " \t\n")
+
+	case name == "files":
+		_, opts, err := p.packageName(p.args)
+		if err != nil {
+			return err
+		}
+		if f, ok := opts["-f"]; ok {
+			p.pkg.FileLists = append(p.pkg.FileLists, f)
+		}
+		for _, line := range lines {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				p.pkg.Files = append(p.pkg.Files, line)
+			}
+		}
+
+	case name == "changelog":
+		return p.parseChangelog(lines)
+
+	case scriptSections[name] != "":
+		return p.addScript(scriptSections[name], lines)
+	}
+	return nil
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// finishPackage adds the implicit provides of a package once its preamble is
+// parsed.
+func (p *parser) finishPackage(pkg *Package) error {
+	if pkg.Name == "" {
+		return p.errorf("missing Name")
+	}
+	if pkg.Arch == "" {
+		pkg.Arch = p.opts.Arch
+	}
+	provide := func(name string) {
+		pkg.Provides = append(pkg.Provides, rpm.NewDependency(
+			rpm.DepFlagEqual,
+			name,
+			pkg.Epoch,
+			pkg.Version,
+			pkg.Release,
+		))
+	}
+	provide(pkg.Name)
+	if isa, ok := isaNames[pkg.Arch]; ok {
+		provide(pkg.Name + "(" + isa + ")")
+	}
+	return nil
+}
+
+// addScript adds a scriptlet to the current package.
+func (p *parser) addScript(typ string, lines []string) error {
+	_, opts, err := p.packageName(p.args)
+	if err != nil {
+		return err
+	}
+	if p.pkg.Script(typ) != nil {
+		return p.errorf("%%%s already defined for %s", p.section, p.pkg.Name)
+	}
+	script := &rpm.Script{
+		Type:        typ,
+		Interpreter: []string{rpm.DefaultInterpreter},
+		Body:        strings.TrimRight(joinLines(lines), " \t\n"),
+	}
+	if prog, ok := opts["-p"]; ok {
+		script.Interpreter = []string{prog}
+	}
+	if _, ok := opts["-e"]; ok {
+		script.Flags |= rpm.ScriptFlagExpand
+	}
+	if _, ok := opts["-q"]; ok {
+		script.Flags |= rpm.ScriptFlagQFormat
+	}
+	p.pkg.Scripts = append(p.pkg.Scripts, script)
+
+	// rpmbuild adds a requirement on the interpreter of each scriptlet
+	if !script.IsLua() {
+		p.pkg.Requires = append(p.pkg.Requires, rpm.NewDependency(
+			rpm.DepFlagInterp|scriptDepFlags[typ],
+			script.Interpreter[0],
+			0, "", "",
+		))
+	}
+	return nil
+}
+
+// changelogDateFormats are the accepted date formats of changelog entries.
+var changelogDateFormats = []string{
+	"Mon Jan 2 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+}
+
+// parseChangelog parses the lines of the %changelog section.
+func (p *parser) parseChangelog(lines []string) error {
+	var name string
+	var t time.Time
+	var text []string
+	flush := func() {
+		if name != "" {
+			p.spec.Changelog = append(p.spec.Changelog, rpm.NewChangelogEntry(
+				t,
+				name,
+				strings.TrimRight(strings.Join(text, "\n"), " \t\n"),
+			))
+		}
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "*") {
+			if name != "" && (len(text) > 0 || strings.TrimSpace(line) != "") {
+				text = append(text, line)
+			}
+			continue
+		}
+		flush()
+		fields := strings.Fields(strings.TrimPrefix(line, "*"))
+		var err error
+		for _, n := range []int{4, 6} {
+			if len(fields) < n {
+				continue
+			}
+			for _, layout := range changelogDateFormats {
+				var parsed time.Time
+				if parsed, err = time.Parse(layout, strings.Join(fields[:n], " ")); err == nil {
+					t = time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 12, 0, 0, 0, time.UTC)
+					name = strings.Join(fields[n:], " ")
+					break
+				}
+			}
+			if err == nil {
+				break
+			}
+		}
+		if err != nil || len(fields) < 4 {
+			return p.errorf("invalid changelog entry: %s", line)
+		}
+		text = nil
+	}
+	flush()
+	return nil
+}
+
+// parseDependencies parses a list of dependencies separated by commas or
+// whitespace, as in 'foo >= 1.0, bar (baz or qux)'.
+func parseDependencies(s string, flags int) ([]rpm.Dependency, error) {
+	var a []rpm.Dependency
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c == ' ' || c == '\t' || c == ',' {
+			i++
+			continue
+		}
+		if c == '(' {
+			j := matchBracket(s, i)
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated rich dependency: %s", s[i:])
+			}
+			if _, err := rpm.ParseRichDependency(s[i : j+1]); err != nil {
+				return nil, err
+			}
+			a = append(a, rpm.NewDependency(flags, s[i:j+1], 0, "", ""))
+			i = j + 1
+			continue
+		}
+
+		// name [op version]
+		fields := strings.FieldsFunc(s[i:], func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		n := 1
+		if len(fields) >= 3 && isOperator(fields[1]) {
+			n = 3
+		} else if len(fields) == 2 && isOperator(fields[1]) {
+			return nil, fmt.Errorf("missing version: %s", s[i:])
+		}
+		rd, err := rpm.ParseRichDependency(strings.Join(fields[:n], " "))
+		if err != nil {
+			return nil, err
+		}
+		dep := rd.Dependency
+		a = append(a, rpm.NewDependency(
+			dep.Flags()|flags,
+			dep.Name(),
+			dep.Epoch(),
+			dep.Version(),
+			dep.Release(),
+		))
+
+		// advance past the consumed fields
+		for k := 0; k < n; k++ {
+			for i < len(s) && (s[i] == ' ' || s[i] == '\t' || s[i] == ',') {
+				i++
+			}
+			i += len(fields[k])
+		}
+	}
+	return a, nil
+}
+
+func isOperator(s string) bool {
+	switch s {
+	case "<", "<=", "=<", ">", ">=", "=>", "=", "==":
+		return true
+	}
+	return false
+}
+
+func errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("spec: "+format, a...)
+}
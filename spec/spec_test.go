@@ -0,0 +1,237 @@
+package spec
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/rpm"
+)
+
+func depStrings(deps []rpm.Dependency) []string {
+	a := make([]string, len(deps))
+	for i, dep := range deps {
+		a[i] = (&rpm.RichDependency{Dependency: dep}).String()
+	}
+	return a
+}
+
+func parseTestSpec(t *testing.T, name string, opts *Options) *Spec {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := Parse(f, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	s := parseTestSpec(t, "./testdata/hello.spec", &Options{
+		Arch: "x86_64",
+		Macros: map[string]string{
+			"dist": ".el8",
+			"rhel": "8",
+			"_isa": "(x86-64)",
+		},
+	})
+
+	names := make([]string, len(s.Packages))
+	for i, pkg := range s.Packages {
+		names[i] = pkg.Name
+	}
+	if expect := []string{"hello", "hello-libs", "hello-doc"}; !reflect.DeepEqual(names, expect) {
+		t.Fatalf("Expected packages %v, got: %v", expect, names)
+	}
+
+	main := s.Packages[0]
+	if main.Epoch != 1 || main.Version != "2.10" || main.Release != "3.el8" || main.Arch != "x86_64" {
+		t.Errorf("Unexpected EVRA: %d:%s-%s.%s", main.Epoch, main.Version, main.Release, main.Arch)
+	}
+	if v := main.Tags["url"]; v != "https://example.com/hello" {
+		t.Errorf("Expected URL https://example.com/hello, got: %s", v)
+	}
+	if v := main.Description; v != "The GNU Hello program produces a familiar, friendly greeting.\nVersion 2.10." {
+		t.Errorf("Unexpected description: %q", v)
+	}
+
+	tests := []struct {
+		name   string
+		deps   []rpm.Dependency
+		expect []string
+	}{
+		{"hello requires", main.Requires, []string{
+			"hello-libs(x86-64) = 1:2.10-3.el8",
+			"systemd",
+			"hello-fast",
+			"other",
+			"/bin/sh",
+			"/bin/sh",
+		}},
+		{"hello provides", main.Provides, []string{
+			"greeting = 2.10",
+			"hello = 1:2.10-3.el8",
+			"hello(x86-64) = 1:2.10-3.el8",
+		}},
+		{"hello obsoletes", main.Obsoletes, []string{"hello-old < 2.0"}},
+		{"hello recommends", main.Recommends, []string{"(hello-doc if texinfo)"}},
+		{"hello-libs requires", s.Packages[1].Requires, []string{"/sbin/ldconfig", "/sbin/ldconfig"}},
+		{"hello-libs provides", s.Packages[1].Provides, []string{
+			"hello-libs = 1:2.10-3.el8",
+			"hello-libs(x86-64) = 1:2.10-3.el8",
+		}},
+		{"hello-doc provides", s.Packages[2].Provides, []string{"hello-doc = 1:2.10-3.el8"}},
+		{"build requires", s.BuildRequires, []string{
+			"gcc",
+			"make >= 4.0",
+			"(systemd-rpm-macros if systemd)",
+			"dejagnu",
+		}},
+	}
+	for _, test := range tests {
+		if a := depStrings(test.deps); !reflect.DeepEqual(a, test.expect) {
+			t.Errorf("Expected %s %q, got: %q", test.name, test.expect, a)
+		}
+	}
+	flags := []int{
+		0,
+		rpm.DepFlagScriptPost,
+		0,
+		0,
+		rpm.DepFlagInterp | rpm.DepFlagScriptPost,
+		rpm.DepFlagInterp | rpm.DepFlagScriptPreUn,
+	}
+	for i, dep := range main.Requires {
+		if dep.Flags()&^rpm.DepFlagEqual != flags[i] {
+			t.Errorf("Expected flags %#x for %v, got: %#x", flags[i], dep.Name(), dep.Flags())
+		}
+	}
+
+	expectSources := []rpm.SourceFile{
+		{Name: "hello-2.10.tar.gz", Number: 0},
+		{Name: "hello.service", Number: 1},
+		{Name: "hello-fix-build.patch", Number: 0, Patch: true},
+		{Name: "hello-fix-crash.patch", Number: 1, Patch: true, NoSource: true},
+	}
+	if !reflect.DeepEqual(s.Sources, expectSources) {
+		t.Errorf("Expected sources %v, got: %v", expectSources, s.Sources)
+	}
+
+	if v := s.Sections["build"]; v != "%configure\n%make_build\n\n" {
+		t.Errorf("Unexpected %%build: %q", v)
+	}
+	if v := s.Sections["check"]; v != "make check\n\n" {
+		t.Errorf("Unexpected %%check: %q", v)
+	}
+
+	if script := main.Script(rpm.ScriptPreUn); script == nil || !strings.Contains(script.Body, `echo "removing hello"`) {
+		t.Errorf("Unexpected %%preun: %v", script)
+	}
+	if script := main.Script(rpm.ScriptPreTrans); script == nil || !script.IsLua() {
+		t.Errorf("Expected Lua %%pretrans, got: %v", script)
+	}
+	if script := s.Packages[1].Script(rpm.ScriptPost); script == nil ||
+		script.Body != "" || !reflect.DeepEqual(script.Interpreter, []string{"/sbin/ldconfig"}) {
+		t.Errorf("Unexpected %%post for hello-libs: %v", script)
+	}
+
+	if expect := []string{"%license COPYING", "%{_bindir}/hello", "%doc README"}; !reflect.DeepEqual(main.Files, expect) {
+		t.Errorf("Expected files %q, got: %q", expect, main.Files)
+	}
+	if expect := []string{"%{_libdir}/libhello.so.2"}; !reflect.DeepEqual(s.Packages[1].Files, expect) {
+		t.Errorf("Expected files %q, got: %q", expect, s.Packages[1].Files)
+	}
+	if expect := []string{"docs.list"}; !reflect.DeepEqual(s.Packages[2].FileLists, expect) {
+		t.Errorf("Expected file lists %q, got: %q", expect, s.Packages[2].FileLists)
+	}
+
+	expectChangelog := []rpm.ChangelogEntry{
+		{
+			Time:   time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+			Author: "Jane Doe <jane@example.com>",
+			EVR:    "1:2.10-3",
+			Text:   "- Fix crash on startup (#123)\n- Rebuild for %dist",
+		},
+		{
+			Time:   time.Date(2022, 1, 3, 12, 0, 0, 0, time.UTC),
+			Author: "John Doe <john@example.com>",
+			EVR:    "2.10-1",
+			Text:   "- Update to 2.10",
+		},
+	}
+	if !reflect.DeepEqual(s.Changelog, expectChangelog) {
+		t.Errorf("Expected changelog %v, got: %v", expectChangelog, s.Changelog)
+	}
+}
+
+func TestParseConditionals(t *testing.T) {
+	s := parseTestSpec(t, "./testdata/hello.spec", &Options{
+		Arch: "ppc64le",
+		Macros: map[string]string{
+			"fedora":     "36",
+			"_with_docs": "1",
+		},
+	})
+	main := s.Packages[0]
+	expect := []string{"hello-libs = 1:2.10-3", "systemd", "hello-slow", "modern", "/bin/sh", "/bin/sh"}
+	if a := depStrings(main.Requires); !reflect.DeepEqual(a, expect) {
+		t.Errorf("Expected requires %q, got: %q", expect, a)
+	}
+	expect = []string{"gcc", "make >= 4.0", "(systemd-rpm-macros if systemd)", "dejagnu", "texinfo"}
+	if a := depStrings(s.BuildRequires); !reflect.DeepEqual(a, expect) {
+		t.Errorf("Expected build requires %q, got: %q", expect, a)
+	}
+	if a := depStrings(main.Provides); a[len(a)-1] != "hello(ppc-64) = 1:2.10-3" {
+		t.Errorf("Expected ISA provide for ppc64le, got: %q", a)
+	}
+}
+
+func TestParseSourceNumbers(t *testing.T) {
+	s, err := Parse(strings.NewReader(`Name: foo
+Version: 1.0
+Release: 1
+Source0: https://example.com/foo-1.0.tar.gz
+Source99: foo.service
+Source: foo.conf
+Patch1: foo-fix-build.patch
+NoSource: 99
+`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []rpm.SourceFile{
+		{Name: "foo-1.0.tar.gz", Number: 0},
+		{Name: "foo.service", Number: 99, NoSource: true},
+		{Name: "foo.conf", Number: 100},
+		{Name: "foo-fix-build.patch", Number: 1, Patch: true},
+	}
+	if !reflect.DeepEqual(s.Sources, expect) {
+		t.Errorf("Expected sources %v, got: %v", expect, s.Sources)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"Name: foo\n%if 1\n",
+		"Name: foo\n%endif\n",
+		"Name: foo\n%else\n",
+		"Name: foo\n%if bar\n%endif\n",
+		"Name: foo\nnot a tag\n",
+		"Version: 1.0\n",
+		"Name: foo\nRequires: bar >=\n",
+		"Name: foo\nRequires(bogus): bar\n",
+		"Name: foo\n%description bar\n",
+		"Name: foo\n%package bar\n%package bar\n",
+		"Name: foo\n%changelog\n* not a date\n",
+	}
+	for _, test := range tests {
+		if _, err := Parse(strings.NewReader(test), nil); err == nil {
+			t.Errorf("Expected error parsing %q", test)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+# A spec file exercising the features of the parser.
+%global forgeurl https://example.com/hello
+%define so_version 2
+%bcond_without tests
+%bcond_with docs
+
+Name:           hello
+Version:        2.10
+Release:        3%{?dist}
+Epoch:          1
+Summary:        Prints a familiar, friendly greeting
+License:        GPLv3+
+URL:            %{forgeurl}
+Source0:        %{url}/releases/%{name}-%{version}.tar.gz
+Source1:        hello.service
+Patch0:         hello-fix-build.patch
+Patch1:         hello-fix-crash.patch
+NoPatch:        1
+
+BuildRequires:  gcc, make >= 4.0
+BuildRequires:  (systemd-rpm-macros if systemd)
+%if %{with tests}
+BuildRequires:  dejagnu
+%endif
+%if %{with docs}
+BuildRequires:  texinfo
+%endif
+Requires:       %{name}-libs%{?_isa} = %{epoch}:%{version}-%{release}
+Requires(post): systemd
+Provides:       greeting = %{version}
+Obsoletes:      hello-old < 2.0
+Recommends:     (hello-doc if texinfo)
+
+%ifarch x86_64 aarch64
+Requires:       hello-fast
+%else
+Requires:       hello-slow
+%endif
+
+%if 0%{?rhel} && 0%{?rhel} < 8
+Requires:       legacy
+%elif 0%{?fedora} >= 35
+Requires:       modern
+%else
+Requires:       other
+%endif
+
+%description
+The GNU Hello program produces a familiar, friendly greeting.
+Version %{version}.
+
+%package libs
+Summary:        Libraries for %{name}
+
+%description libs
+Libraries for %{name} (so version %{so_version}).
+
+%package -n hello-doc
+Summary:        Documentation for %{name}
+BuildArch:      noarch
+
+%description -n hello-doc
+Documentation.
+
+%prep
+%autosetup -p1
+
+%build
+%configure
+%make_build
+
+%install
+%make_install
+
+%check
+%if %{with tests}
+make check
+%endif
+
+%post
+%systemd_post hello.service
+
+%preun
+if [ $1 -eq 0 ]; then
+    echo "removing %{name}"
+fi
+
+%post libs -p /sbin/ldconfig
+
+%postun libs -p /sbin/ldconfig
+
+%pretrans -p <lua>
+print("hello")
+
+%files
+%license COPYING
+%{_bindir}/hello
+# a comment
+%doc README
+
+%files libs
+%{_libdir}/libhello.so.%{so_version}
+
+%files -n hello-doc -f docs.list
+
+%changelog
+* Tue Mar 01 2022 Jane Doe <jane@example.com> - 1:2.10-3
+- Fix crash on startup (#123)
+- Rebuild for %%dist
+
+* Mon Jan 03 2022 John Doe <john@example.com> 2.10-1
+- Update to 2.10
@@ -0,0 +1,131 @@
+package rpm
+
+// A Trigger is a scriptlet in a package that runs when other packages, or
+// files owned by other packages, are installed or removed.
+type Trigger struct {
+	// Type is the event which runs the trigger. One of "prein", "in", "un" or
+	// "postun".
+	Type string
+
+	// Conditions are the packages which activate the trigger. For file
+	// triggers, the name of each condition is a path prefix that activates
+	// the trigger when matching files are installed or removed.
+	Conditions []Dependency
+
+	// Script is the body of the trigger scriptlet.
+	Script string
+
+	// Interpreter is the program that runs the scriptlet, such as /bin/sh.
+	Interpreter string
+
+	// ScriptFlags is a bitmask of ScriptFlag constants.
+	ScriptFlags int
+
+	// Priority orders the execution of file triggers. Triggers with a higher
+	// priority run first. Priority is zero for package triggers.
+	Priority int
+}
+
+// triggerTags identifies the header tags that describe a set of triggers.
+type triggerTags struct {
+	scripts     int
+	progs       int
+	scriptFlags int
+	names       int
+	index       int
+	versions    int
+	flags       int
+	priorities  int
+}
+
+var (
+	packageTriggerTags = triggerTags{1065, 1092, 5027, 1066, 1069, 1067, 1068, 0}
+	fileTriggerTags    = triggerTags{5066, 5067, 5068, 5069, 5070, 5071, 5072, 5084}
+	transTriggerTags   = triggerTags{5076, 5077, 5078, 5079, 5080, 5081, 5082, 5085}
+)
+
+// triggers returns the triggers described by the given header tags.
+func (c *Package) triggers(tags triggerTags) ([]Trigger, error) {
+	conds, err := c.dependencies(tags.flags, tags.names, tags.versions)
+	if err != nil {
+		return nil, err
+	}
+	index := c.Header.GetTag(tags.index).Int64Slice()
+	if len(index) != len(conds) {
+		return nil, errorf(
+			"tag %d has %d trigger indexes for %d names",
+			tags.index,
+			len(index),
+			len(conds),
+		)
+	}
+	scripts := c.Header.GetTag(tags.scripts).StringSlice()
+	progs := c.Header.GetTag(tags.progs).StringSlice()
+	flags := c.Header.GetTag(tags.scriptFlags).Int64Slice()
+	priorities := c.Header.GetTag(tags.priorities).Int64Slice()
+	triggers := make([]Trigger, len(scripts))
+	for i, script := range scripts {
+		triggers[i].Script = script
+		if i < len(progs) {
+			triggers[i].Interpreter = progs[i]
+		}
+		if i < len(flags) {
+			triggers[i].ScriptFlags = int(flags[i])
+		}
+		if i < len(priorities) {
+			triggers[i].Priority = int(priorities[i])
+		}
+	}
+	for i, dep := range conds {
+		ix := int(index[i])
+		if ix < 0 || ix >= len(triggers) {
+			return nil, errorf("trigger index %d is out of range for tag %d", ix, tags.index)
+		}
+		triggers[ix].Conditions = append(triggers[ix].Conditions, dep)
+		if triggers[ix].Type == "" {
+			triggers[ix].Type = triggerType(dep.Flags())
+		}
+	}
+	return triggers, nil
+}
+
+// triggerType returns the event type of a trigger with the given condition
+// flags.
+func triggerType(flags int) string {
+	switch {
+	case flags&DepFlagTriggerPreIn != 0:
+		return "prein"
+	case flags&DepFlagTriggerIn != 0:
+		return "in"
+	case flags&DepFlagTriggerUn != 0:
+		return "un"
+	case flags&DepFlagTriggerPostUn != 0:
+		return "postun"
+	}
+	return ""
+}
+
+// Triggers returns the scriptlets that run when other packages are installed
+// or removed.
+//
+// Triggers, FileTriggers and TransFileTriggers return nil if the trigger tags
+// in the package header are inconsistent. Use Validate to check for such
+// packages.
+func (c *Package) Triggers() []Trigger {
+	triggers, _ := c.triggers(packageTriggerTags)
+	return triggers
+}
+
+// FileTriggers returns the scriptlets that run once for each package that
+// installs or removes files matching the trigger conditions.
+func (c *Package) FileTriggers() []Trigger {
+	triggers, _ := c.triggers(fileTriggerTags)
+	return triggers
+}
+
+// TransFileTriggers returns the scriptlets that run once per transaction when
+// files matching the trigger conditions are installed or removed.
+func (c *Package) TransFileTriggers() []Trigger {
+	triggers, _ := c.triggers(transTriggerTags)
+	return triggers
+}
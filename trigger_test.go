@@ -0,0 +1,122 @@
+package rpm
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTriggers(t *testing.T) {
+	p := newTestPackage(map[int]interface{}{
+		1065: []string{"echo installed", "print('removed')"},
+		1066: []string{"foo", "bar", "baz"},
+		1067: []string{"1.0", "", ""},
+		1068: []int64{
+			DepFlagTriggerIn | DepFlagGreaterOrEqual,
+			DepFlagTriggerIn,
+			DepFlagTriggerUn,
+		},
+		1069: []int64{0, 0, 1},
+		1092: []string{"/bin/sh", "<lua>"},
+		5027: []int64{0, ScriptFlagExpand},
+	})
+	triggers := p.Triggers()
+	if len(triggers) != 2 {
+		t.Fatalf("Expected 2 triggers, got: %d", len(triggers))
+	}
+	tests := []struct {
+		typ         string
+		conditions  string
+		script      string
+		interpreter string
+		flags       int
+	}{
+		{"in", "foo >= 1.0, bar", "echo installed", "/bin/sh", 0},
+		{"un", "baz", "print('removed')", "<lua>", ScriptFlagExpand},
+	}
+	for i, test := range tests {
+		trigger := triggers[i]
+		if trigger.Type != test.typ {
+			t.Errorf("Expected type %q for trigger %d, got: %q", test.typ, i, trigger.Type)
+		}
+		if s := strings.Join(depStrings(trigger.Conditions), ", "); s != test.conditions {
+			t.Errorf("Expected conditions %q for trigger %d, got: %q", test.conditions, i, s)
+		}
+		if trigger.Script != test.script {
+			t.Errorf("Expected script %q for trigger %d, got: %q", test.script, i, trigger.Script)
+		}
+		if trigger.Interpreter != test.interpreter {
+			t.Errorf("Expected interpreter %q for trigger %d, got: %q", test.interpreter, i, trigger.Interpreter)
+		}
+		if trigger.ScriptFlags != test.flags {
+			t.Errorf("Expected flags %d for trigger %d, got: %d", test.flags, i, trigger.ScriptFlags)
+		}
+	}
+}
+
+func TestFileTriggers(t *testing.T) {
+	p := newTestPackage(map[int]interface{}{
+		5066: []string{"ldconfig"},
+		5067: []string{"/bin/sh"},
+		5068: []int64{0},
+		5069: []string{"/usr/lib64/", "/usr/lib/"},
+		5070: []int64{0, 0},
+		5071: []string{"", ""},
+		5072: []int64{DepFlagTriggerIn, DepFlagTriggerIn},
+		5084: []int64{1000},
+		5076: []string{"systemctl daemon-reload"},
+		5077: []string{"/bin/sh"},
+		5078: []int64{0},
+		5079: []string{"/usr/lib/systemd/system/"},
+		5080: []int64{0},
+		5081: []string{""},
+		5082: []int64{DepFlagTriggerPostUn},
+		5085: []int64{100},
+	})
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	triggers := p.FileTriggers()
+	if len(triggers) != 1 {
+		t.Fatalf("Expected 1 file trigger, got: %d", len(triggers))
+	}
+	if s := strings.Join(depStrings(triggers[0].Conditions), ", "); s != "/usr/lib64/, /usr/lib/" {
+		t.Errorf("Unexpected file trigger conditions: %q", s)
+	}
+	if triggers[0].Priority != 1000 {
+		t.Errorf("Expected file trigger priority 1000, got: %d", triggers[0].Priority)
+	}
+	triggers = p.TransFileTriggers()
+	if len(triggers) != 1 {
+		t.Fatalf("Expected 1 transaction file trigger, got: %d", len(triggers))
+	}
+	if triggers[0].Type != "postun" {
+		t.Errorf("Expected transaction file trigger type postun, got: %q", triggers[0].Type)
+	}
+	if triggers[0].Priority != 100 {
+		t.Errorf("Expected transaction file trigger priority 100, got: %d", triggers[0].Priority)
+	}
+
+	// index out of range
+	p.Header.Tags[5070].Value = []int64{0, 1}
+	if err := p.Validate(); err == nil {
+		t.Errorf("Expected error for out of range trigger index")
+	}
+	if triggers := p.FileTriggers(); triggers != nil {
+		t.Errorf("Expected no file triggers, got: %v", triggers)
+	}
+}
+
+func TestOrderWithRequires(t *testing.T) {
+	p := newTestPackage(map[int]interface{}{
+		5035: []string{"systemd", "selinux-policy"},
+		5036: []string{"", "3.14"},
+		5037: []int64{0, DepFlagGreaterOrEqual},
+	})
+	deps := depStrings(p.OrderWithRequires())
+	if s := strings.Join(deps, ", "); s != "systemd, selinux-policy >= 3.14" {
+		t.Errorf("Unexpected OrderWithRequires: %q", s)
+	}
+	if len(p.Requires()) != 0 {
+		t.Errorf("Expected OrderWithRequires not to be included in Requires")
+	}
+}
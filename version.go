@@ -1,15 +1,6 @@
 package rpm
 
-import (
-	"math"
-	"regexp"
-	"strings"
-	"unicode"
-)
-
-// alphanumPattern is a regular expression to match all sequences of numeric
-// characters or alphanumeric characters.
-var alphanumPattern = regexp.MustCompile("([a-zA-Z]+)|([0-9]+)|(~)")
+import "strings"
 
 // Version is an interface which holds version information for a package in EVR
 // form.
@@ -57,84 +48,141 @@ func Compare(a, b Version) int {
 	return CompareVersions(a.Release(), b.Release())
 }
 
-// CompareVersion compares version strings. It does not consider package epochs
-// or release numbers like Compare.
+// CompareVersions compares version strings. It does not consider package
+// epochs or release numbers like Compare.
+//
+// Versions are compared in the same way as rpmvercmp. Each version is split
+// into alphabetic and numeric segments which are compared in order; numeric
+// segments are newer than alphabetic segments. A tilde (~) sorts before
+// everything else, so 1.0~rc1 is older than 1.0. A caret (^) sorts after the
+// end of a version but before any other segment, so 1.0^git1 is newer than 1.0
+// but older than 1.0.1. All other characters, including non-ASCII characters,
+// only separate segments.
 //
 // If a is more recent than b, 1 is returned. If a is less recent than b, -1 is
 // returned. If a and b are equal, 0 is returned.
 func CompareVersions(a, b string) int {
 	// For the original C implementation, see:
-	// https://github.com/rpm-software-management/rpm/blob/master/lib/rpmvercmp.c#L16
+	// https://github.com/rpm-software-management/rpm/blob/master/rpmio/rpmvercmp.c
 	if a == b {
 		return 0
 	}
 
-	// get alpha/numeric segements
-	segsa := alphanumPattern.FindAllString(a, -1)
-	segsb := alphanumPattern.FindAllString(b, -1)
-	segs := int(math.Min(float64(len(segsa)), float64(len(segsb))))
-
-	// compare each segment
-	for i := 0; i < segs; i++ {
-		a := segsa[i]
-		b := segsb[i]
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		// skip separators
+		for i < len(a) && !isAlnum(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isAlnum(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
 
-		// compare tildes
-		if []rune(a)[0] == '~' || []rune(b)[0] == '~' {
-			if []rune(a)[0] != '~' {
+		// tilde sorts before everything else
+		if at(a, i) == '~' || at(b, j) == '~' {
+			if at(a, i) != '~' {
 				return 1
 			}
-			if []rune(b)[0] != '~' {
+			if at(b, j) != '~' {
 				return -1
 			}
+			i++
+			j++
+			continue
 		}
 
-		if unicode.IsNumber([]rune(a)[0]) {
-			// numbers are always greater than alphas
-			if !unicode.IsNumber([]rune(b)[0]) {
-				// a is numeric, b is alpha
+		// caret sorts before everything except the end of the version
+		if at(a, i) == '^' || at(b, j) == '^' {
+			if i == len(a) {
+				return -1
+			}
+			if j == len(b) {
 				return 1
 			}
-
-			// trim leading zeros
-			a = strings.TrimLeft(a, "0")
-			b = strings.TrimLeft(b, "0")
-
-			// longest string wins without further comparison
-			if len(a) > len(b) {
+			if a[i] != '^' {
 				return 1
-			} else if len(b) > len(a) {
+			}
+			if b[j] != '^' {
 				return -1
 			}
+			i++
+			j++
+			continue
+		}
+
+		if i == len(a) || j == len(b) {
+			break
+		}
+
+		// grab the next completely numeric or completely alphabetic segment
+		isNum := isDigit(a[i])
+		match := isAlpha
+		if isNum {
+			match = isDigit
+		}
+		si, sj := i, j
+		for i < len(a) && match(a[i]) {
+			i++
+		}
+		for j < len(b) && match(b[j]) {
+			j++
+		}
+		segA, segB := a[si:i], b[sj:j]
 
-		} else if unicode.IsNumber([]rune(b)[0]) {
-			// a is alpha, b is numeric
+		// numeric segments are always newer than alphabetic segments
+		if segB == "" {
+			if isNum {
+				return 1
+			}
 			return -1
 		}
 
-		// string compare
-		if a < b {
+		if isNum {
+			// trim leading zeros; the longest number wins
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if len(segA) > len(segB) {
+				return 1
+			} else if len(segB) > len(segA) {
+				return -1
+			}
+		}
+		if segA < segB {
 			return -1
-		} else if a > b {
+		} else if segA > segB {
 			return 1
 		}
 	}
 
-	// segments were all the same but separators must have been different
-	if len(segsa) == len(segsb) {
+	// whichever version has segments remaining is newer
+	if i >= len(a) && j >= len(b) {
 		return 0
 	}
-
-	// If there is a tilde in a segment past the min number of segments, find it.
-	if len(segsa) > segs && []rune(segsa[segs])[0] == '~' {
+	if i >= len(a) {
 		return -1
-	} else if len(segsb) > segs && []rune(segsb[segs])[0] == '~' {
-		return 1
 	}
+	return 1
+}
 
-	// whoever has the most segments wins
-	if len(segsa) > len(segsb) {
-		return 1
+// at returns the byte at index i of s, or zero if i is out of range.
+func at(s string, i int) byte {
+	if i < len(s) {
+		return s[i]
 	}
-	return -1
+	return 0
+}
+
+// isDigit returns true if c is an ASCII digit. Like rpm, only ASCII characters
+// are considered part of a version segment.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isAlpha returns true if c is an ASCII letter.
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || isAlpha(c)
 }